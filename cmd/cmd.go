@@ -11,16 +11,20 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/opentracing/opentracing-go"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/pingcap/tidb/util/logutil"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 
+	berrors "github.com/Orion7r/pr/pkg/errors"
 	"github.com/Orion7r/pr/pkg/gluetidb"
 	"github.com/Orion7r/pr/pkg/redact"
 	"github.com/Orion7r/pr/pkg/summary"
 	"github.com/Orion7r/pr/pkg/task"
+	"github.com/Orion7r/pr/pkg/trace"
 	"github.com/Orion7r/pr/pkg/utils"
 )
 
@@ -30,6 +34,12 @@ var (
 	hasLogFile      uint64
 	tidbGlue        = gluetidb.New()
 	envLogToTermKey = "BR_LOG_TO_TERM"
+	// stopMetricsPusher pushes the metrics for the last time.
+	stopMetricsPusher = func() {}
+	// closeProgressFile closes the file of the JSON progress events.
+	closeProgressFile = func() {}
+	// stopTracing finishes the root span and exports the spans.
+	stopTracing = func() {}
 )
 
 const (
@@ -41,6 +51,20 @@ const (
 	FlagLogFormat = "log-format"
 	// FlagStatusAddr is the name of status-addr flag.
 	FlagStatusAddr = "status-addr"
+	// FlagMetricsPushGateway is the name of metrics-pushgateway flag.
+	FlagMetricsPushGateway = "metrics-pushgateway"
+	// FlagMetricsPushInterval is the name of metrics-push-interval flag.
+	FlagMetricsPushInterval = "metrics-push-interval"
+	// FlagSummaryFile is the name of summary-file flag.
+	FlagSummaryFile = "summary-file"
+	// FlagProgressFormat is the name of progress-format flag.
+	FlagProgressFormat = "progress-format"
+	// FlagProgressFile is the name of progress-file flag.
+	FlagProgressFile = "progress-file"
+	// FlagTraceFile is the name of trace-file flag.
+	FlagTraceFile = "trace-file"
+	// FlagTraceOTLPEndpoint is the name of trace-otlp-endpoint flag.
+	FlagTraceOTLPEndpoint = "trace-otlp-endpoint"
 	// FlagSlowLogFile is the name of slow-log-file flag.
 	FlagSlowLogFile = "slow-log-file"
 	// FlagRedactLog is whether to redact sensitive information in log, already deprecated by FlagRedactInfoLog
@@ -50,6 +74,9 @@ const (
 
 	flagVersion      = "version"
 	flagVersionShort = "V"
+
+	progressFormatBar  = "bar"
+	progressFormatJSON = "json"
 )
 
 func timestampLogFileName() string {
@@ -74,6 +101,22 @@ func AddFlags(cmd *cobra.Command) {
 		"Set whether to redact sensitive info in log")
 	cmd.PersistentFlags().String(FlagStatusAddr, "",
 		"Set the HTTP listening address for the status report service. Set to empty string to disable")
+	cmd.PersistentFlags().String(FlagMetricsPushGateway, "",
+		"Set the address of the Prometheus push gateway to push the metrics to. Set to empty string to disable")
+	cmd.PersistentFlags().Duration(FlagMetricsPushInterval, 15*time.Second,
+		"Set the interval to push the metrics to the Prometheus push gateway")
+	cmd.PersistentFlags().String(FlagSummaryFile, "",
+		"Set the file path to write the task summary to in JSON. Set to empty string to disable")
+	cmd.PersistentFlags().String(FlagProgressFormat, progressFormatBar,
+		"Set the progress format, 'bar' prints progress bars, "+
+			"'json' writes newline-delimited JSON progress events to --"+FlagProgressFile)
+	cmd.PersistentFlags().String(FlagProgressFile, "",
+		"Set the file path to write the JSON progress events to. If not set, write to stderr")
+	cmd.PersistentFlags().String(FlagTraceFile, "",
+		"Set the file path to write the tracing spans to in newline-delimited JSON. Set to empty string to disable")
+	cmd.PersistentFlags().String(FlagTraceOTLPEndpoint, "",
+		"Set the OTLP/HTTP endpoint to export the tracing spans to, e.g. 'http://127.0.0.1:4318/v1/traces'. "+
+			"Set to empty string to disable")
 	task.DefineCommonFlags(cmd.PersistentFlags())
 
 	cmd.PersistentFlags().StringP(FlagSlowLogFile, "", "",
@@ -161,10 +204,126 @@ func Init(cmd *cobra.Command) (err error) {
 		} else {
 			utils.StartDynamicPProfListener()
 		}
+
+		// Initialize the metrics pusher.
+		pushGateway, e := cmd.Flags().GetString(FlagMetricsPushGateway)
+		if e != nil {
+			err = e
+			return
+		}
+		pushInterval, e := cmd.Flags().GetDuration(FlagMetricsPushInterval)
+		if e != nil {
+			err = e
+			return
+		}
+		if pushGateway != "" {
+			if pushInterval <= 0 {
+				err = errors.Annotatef(berrors.ErrInvalidArgument, "--%s must be positive", FlagMetricsPushInterval)
+				return
+			}
+			stopMetricsPusher = utils.StartMetricsPusher(pushGateway, "br", pushInterval)
+		}
+
+		// Initialize the machine-readable outputs.
+		summaryFile, e := cmd.Flags().GetString(FlagSummaryFile)
+		if e != nil {
+			err = e
+			return
+		}
+		summary.SetSummaryFile(summaryFile)
+		if err = initProgressFormat(cmd); err != nil {
+			return
+		}
+		err = initTracing(cmd)
 	})
 	return errors.Trace(err)
 }
 
+// Shutdown flushes the states of BR cli before exiting, e.g. pushes the
+// metrics for the last time.
+func Shutdown() {
+	stopTracing()
+	stopMetricsPusher()
+	closeProgressFile()
+}
+
+func initTracing(cmd *cobra.Command) error {
+	traceFile, err := cmd.Flags().GetString(FlagTraceFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	otlpEndpoint, err := cmd.Flags().GetString(FlagTraceOTLPEndpoint)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var recorders []trace.Recorder
+	if traceFile != "" {
+		r, err := trace.NewFileRecorder(traceFile)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		recorders = append(recorders, r)
+	}
+	if otlpEndpoint != "" {
+		recorders = append(recorders, trace.NewOTLPRecorder(otlpEndpoint, "br"))
+	}
+	if len(recorders) == 0 {
+		return nil
+	}
+
+	// the spans of the task are the children of the root span in the default
+	// context.
+	recorder := trace.NewMultiRecorder(recorders...)
+	root := trace.NewTracer(recorder).StartSpan(cmd.CommandPath())
+	defaultContext = opentracing.ContextWithSpan(defaultContext, root)
+	stopTracing = func() {
+		root.Finish()
+		if err := recorder.Close(); err != nil {
+			log.Warn("failed to export the tracing spans", zap.Error(err))
+		}
+	}
+	return nil
+}
+
+func initProgressFormat(cmd *cobra.Command) error {
+	format, err := cmd.Flags().GetString(FlagProgressFormat)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	progressFile, err := cmd.Flags().GetString(FlagProgressFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	switch format {
+	case progressFormatBar:
+		if progressFile != "" {
+			return errors.Annotatef(berrors.ErrInvalidArgument,
+				"--%s requires --%s=%s", FlagProgressFile, FlagProgressFormat, progressFormatJSON)
+		}
+	case progressFormatJSON:
+		if progressFile == "" {
+			// stdout carries the JSON output of commands like dry run and list.
+			utils.SetProgressJSONWriter(os.Stderr)
+			return nil
+		}
+		f, err := os.OpenFile(progressFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return errors.Annotatef(err, "failed to open the progress file %s", progressFile)
+		}
+		utils.SetProgressJSONWriter(f)
+		closeProgressFile = func() {
+			utils.SetProgressJSONWriter(nil)
+			if err := f.Close(); err != nil {
+				log.Warn("failed to close the progress file", zap.String("path", progressFile), zap.Error(err))
+			}
+		}
+	default:
+		return errors.Annotatef(berrors.ErrInvalidArgument, "--%s must be %s or %s, but got %s",
+			FlagProgressFormat, progressFormatBar, progressFormatJSON, format)
+	}
+	return nil
+}
+
 // HasLogFile returns whether we set a log file.
 func HasLogFile() bool {
 	return atomic.LoadUint64(&hasLogFile) != uint64(0)
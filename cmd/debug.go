@@ -25,6 +25,7 @@ import (
 	"github.com/Orion7r/pr/pkg/logutil"
 	"github.com/Orion7r/pr/pkg/restore"
 	"github.com/Orion7r/pr/pkg/rtree"
+	"github.com/Orion7r/pr/pkg/storage"
 	"github.com/Orion7r/pr/pkg/task"
 	"github.com/Orion7r/pr/pkg/utils"
 )
@@ -51,6 +52,7 @@ func NewDebugCommand() *cobra.Command {
 	meta.AddCommand(decodeBackupMetaCommand())
 	meta.AddCommand(encodeBackupMetaCommand())
 	meta.AddCommand(setPDConfigCommand())
+	meta.AddCommand(newCleanupOnlineRestoreCommand())
 	meta.Hidden = true
 
 	return meta
@@ -70,10 +72,12 @@ func newCheckSumCommand() *cobra.Command {
 				return errors.Trace(err)
 			}
 
-			_, s, backupMeta, err := task.ReadBackupMeta(ctx, utils.MetaFile, &cfg)
+			s, backupMeta, err := task.ReadExternalBackupMeta(ctx, utils.MetaFile, &cfg)
 			if err != nil {
 				return errors.Trace(err)
 			}
+			// SST files are written by TiKV, they are never encrypted.
+			s = storage.WithoutEncryption(s)
 
 			dbs, err := utils.LoadBackupTables(backupMeta)
 			if err != nil {
@@ -159,7 +163,7 @@ func newBackupMetaCommand() *cobra.Command {
 			if err = cfg.ParseFromFlags(cmd.Flags()); err != nil {
 				return errors.Trace(err)
 			}
-			_, _, backupMeta, err := task.ReadBackupMeta(ctx, utils.MetaFile, &cfg)
+			_, backupMeta, err := task.ReadExternalBackupMeta(ctx, utils.MetaFile, &cfg)
 			if err != nil {
 				log.Error("read backupmeta failed", zap.Error(err))
 				return errors.Trace(err)
@@ -251,7 +255,7 @@ func decodeBackupMetaCommand() *cobra.Command {
 			if err := cfg.ParseFromFlags(cmd.Flags()); err != nil {
 				return errors.Trace(err)
 			}
-			_, s, backupMeta, err := task.ReadBackupMeta(ctx, utils.MetaFile, &cfg)
+			s, backupMeta, err := task.ReadExternalBackupMeta(ctx, utils.MetaFile, &cfg)
 			if err != nil {
 				return errors.Trace(err)
 			}
@@ -312,7 +316,7 @@ func encodeBackupMetaCommand() *cobra.Command {
 			if err := cfg.ParseFromFlags(cmd.Flags()); err != nil {
 				return errors.Trace(err)
 			}
-			_, s, err := task.GetStorage(ctx, &cfg)
+			s, err := task.GetExternalStorage(ctx, &cfg)
 			if err != nil {
 				return errors.Trace(err)
 			}
@@ -376,3 +380,25 @@ func setPDConfigCommand() *cobra.Command {
 	}
 	return pdConfigCmd
 }
+
+func newCleanupOnlineRestoreCommand() *cobra.Command {
+	cleanupCmd := &cobra.Command{
+		Use:   "cleanup-online-restore",
+		Short: "remove the store labels and placement rules left by an online restore",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var cfg task.CleanupOnlineRestoreConfig
+			if err := cfg.ParseFromFlags(cmd.Flags()); err != nil {
+				return errors.Trace(err)
+			}
+			if err := task.RunCleanupOnlineRestore(GetDefaultContext(), tidbGlue, &cfg); err != nil {
+				log.Error("failed to clean up online restore", zap.Error(err))
+				return errors.Trace(err)
+			}
+			log.Info("clean up online restore succeed")
+			return nil
+		},
+	}
+	task.DefineCleanupOnlineRestoreFlags(cleanupCmd.Flags())
+	return cleanupCmd
+}
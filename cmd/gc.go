@@ -0,0 +1,45 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package cmd
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/Orion7r/pr/pkg/task"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// NewGCCommand return a gc subcommand.
+func NewGCCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:     "gc",
+		Short:   "delete the backups out of the retention policy under the storage",
+		Aliases: []string{"prune"},
+		Args:    cobra.NoArgs,
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			if err := Init(c); err != nil {
+				return errors.Trace(err)
+			}
+			utils.LogBRInfo()
+			task.LogArguments(c)
+			return nil
+		},
+		RunE: func(command *cobra.Command, _ []string) error {
+			var cfg task.GCConfig
+			if err := cfg.ParseFromFlags(command.Flags()); err != nil {
+				command.SilenceUsage = false
+				return errors.Trace(err)
+			}
+			if err := task.RunGC(GetDefaultContext(), "GC", &cfg, command.OutOrStdout()); err != nil {
+				log.Error("failed to gc backups", zap.Error(err))
+				return errors.Trace(err)
+			}
+			return nil
+		},
+	}
+	task.DefineGCFlags(command.Flags())
+	return command
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package cmd
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/Orion7r/pr/pkg/task"
+)
+
+func runCatalogCommand(
+	command *cobra.Command,
+	run func(cfg *task.CatalogConfig, command *cobra.Command) error,
+) error {
+	if err := Init(command); err != nil {
+		return errors.Trace(err)
+	}
+	task.LogArguments(command)
+	var cfg task.CatalogConfig
+	if err := cfg.ParseFromFlags(command.Flags()); err != nil {
+		command.SilenceUsage = false
+		return errors.Trace(err)
+	}
+	return errors.Trace(run(&cfg, command))
+}
+
+// NewListCommand return a list subcommand.
+func NewListCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "list",
+		Short: "list the backups under the storage",
+		Args:  cobra.NoArgs,
+		RunE: func(command *cobra.Command, _ []string) error {
+			return runCatalogCommand(command, func(cfg *task.CatalogConfig, command *cobra.Command) error {
+				return task.RunList(GetDefaultContext(), cfg, command.OutOrStdout())
+			})
+		},
+	}
+	task.DefineCatalogFlags(command.Flags())
+	return command
+}
+
+// NewShowCommand return a show subcommand.
+func NewShowCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "show",
+		Short: "show the databases and tables of the backup at the storage",
+		Args:  cobra.NoArgs,
+		RunE: func(command *cobra.Command, _ []string) error {
+			return runCatalogCommand(command, func(cfg *task.CatalogConfig, command *cobra.Command) error {
+				return task.RunShow(GetDefaultContext(), cfg, command.OutOrStdout())
+			})
+		},
+	}
+	task.DefineCatalogFlags(command.Flags())
+	return command
+}
@@ -41,6 +41,21 @@ func runLogRestoreCommand(command *cobra.Command) error {
 	return nil
 }
 
+func runPointRestoreCommand(command *cobra.Command, cmdName string) error {
+	cfg := task.PointRestoreConfig{
+		RestoreConfig: task.RestoreConfig{Config: task.Config{LogProgress: HasLogFile()}},
+	}
+	if err := cfg.ParseFromFlags(command.Flags()); err != nil {
+		command.SilenceUsage = false
+		return errors.Trace(err)
+	}
+	if err := task.RunPointRestore(GetDefaultContext(), tidbGlue, cmdName, &cfg); err != nil {
+		log.Error("failed to restore", zap.Error(err))
+		return errors.Trace(err)
+	}
+	return nil
+}
+
 func runRestoreRawCommand(command *cobra.Command, cmdName string) error {
 	cfg := task.RestoreRawConfig{
 		RawKvConfig: task.RawKvConfig{Config: task.Config{LogProgress: HasLogFile()}},
@@ -79,6 +94,7 @@ func NewRestoreCommand() *cobra.Command {
 		newDBRestoreCommand(),
 		newTableRestoreCommand(),
 		newLogRestoreCommand(),
+		newPointRestoreCommand(),
 		newRawRestoreCommand(),
 	)
 	task.DefineRestoreFlags(command.PersistentFlags())
@@ -139,6 +155,20 @@ func newLogRestoreCommand() *cobra.Command {
 	return command
 }
 
+func newPointRestoreCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "point",
+		Short: "(experimental) restore to a point in time from a snapshot backup and a cdc log backup",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return runPointRestoreCommand(cmd, "Point restore")
+		},
+	}
+	task.DefineFilterFlags(command)
+	task.DefinePointRestoreFlags(command)
+	return command
+}
+
 func newRawRestoreCommand() *cobra.Command {
 	command := &cobra.Command{
 		Use:   "raw",
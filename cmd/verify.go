@@ -0,0 +1,45 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package cmd
+
+import (
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/Orion7r/pr/pkg/task"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// NewVerifyCommand return a verify subcommand.
+func NewVerifyCommand() *cobra.Command {
+	command := &cobra.Command{
+		Use:   "verify",
+		Short: "verify the integrity of the backup data without the cluster",
+		Long: "verify the integrity of the backup data without the cluster, " +
+			"it prints the report in JSON, and fails if there is any problem",
+		Args: cobra.NoArgs,
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			if err := Init(c); err != nil {
+				return errors.Trace(err)
+			}
+			utils.LogBRInfo()
+			task.LogArguments(c)
+			return nil
+		},
+		RunE: func(command *cobra.Command, _ []string) error {
+			var cfg task.Config
+			if err := cfg.ParseFromFlags(command.Flags()); err != nil {
+				command.SilenceUsage = false
+				return errors.Trace(err)
+			}
+			if err := task.RunVerify(GetDefaultContext(), &cfg, command.OutOrStdout()); err != nil {
+				log.Error("failed to verify backup", zap.Error(err))
+				return errors.Trace(err)
+			}
+			return nil
+		},
+	}
+	return command
+}
@@ -50,12 +50,18 @@ func main() {
 		cmd.NewDebugCommand(),
 		cmd.NewBackupCommand(),
 		cmd.NewRestoreCommand(),
+		cmd.NewGCCommand(),
+		cmd.NewListCommand(),
+		cmd.NewShowCommand(),
+		cmd.NewVerifyCommand(),
 	)
 	// Ouputs cmd.Print to stdout.
 	rootCmd.SetOut(os.Stdout)
 
 	rootCmd.SetArgs(os.Args[1:])
-	if err := rootCmd.Execute(); err != nil {
+	err := rootCmd.Execute()
+	cmd.Shutdown()
+	if err != nil {
 		log.Error("br failed", zap.Error(err))
 		os.Exit(1)
 	}
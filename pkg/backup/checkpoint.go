@@ -0,0 +1,158 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/rtree"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// checkpointFlushInterval is the interval of persisting the checkpoint during backup.
+const checkpointFlushInterval = 30 * time.Second
+
+// CheckpointRange is a backed up range recorded in the checkpoint.
+type CheckpointRange struct {
+	StartKey []byte          `json:"start-key"`
+	EndKey   []byte          `json:"end-key"`
+	Files    []*kvproto.File `json:"files"`
+}
+
+// Checkpoint is the progress of a backup, it is persisted next to the backupmeta
+// so that a failed backup can be resumed without backing up the completed ranges again.
+type Checkpoint struct {
+	ClusterID    uint64 `json:"cluster-id"`
+	BackupTS     uint64 `json:"backup-ts"`
+	LastBackupTS uint64 `json:"last-backup-ts"`
+	// RangesHash is the hash of the ranges to backup, which are decided by the
+	// filter, so the checkpoint is not used by a backup with another filter.
+	RangesHash string             `json:"ranges-hash"`
+	Ranges     []*CheckpointRange `json:"ranges"`
+	// Layout is the layout of the files, the checkpoints without it are
+	// created by the flat layout.
+	Layout string `json:"layout,omitempty"`
+}
+
+// NewCheckpoint creates an empty checkpoint for the backup.
+func NewCheckpoint(clusterID, backupTS, lastBackupTS uint64, ranges []rtree.Range) *Checkpoint {
+	return &Checkpoint{
+		ClusterID:    clusterID,
+		BackupTS:     backupTS,
+		LastBackupTS: lastBackupTS,
+		RangesHash:   hashRanges(ranges),
+	}
+}
+
+func hashRanges(ranges []rtree.Range) string {
+	hash := sha256.New()
+	var length [8]byte
+	for _, r := range ranges {
+		for _, key := range [][]byte{r.StartKey, r.EndKey} {
+			binary.BigEndian.PutUint64(length[:], uint64(len(key)))
+			_, _ = hash.Write(length[:])
+			_, _ = hash.Write(key)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Check checks whether the backup described by cp can be resumed from the
+// progress recorded in the checkpoint previous.
+func (cp *Checkpoint) Check(previous *Checkpoint) error {
+	switch {
+	case cp.ClusterID != previous.ClusterID:
+		return errors.Annotatef(berrors.ErrBackupCheckpointMismatch,
+			"the checkpoint is created by cluster %d, but the current cluster is %d",
+			previous.ClusterID, cp.ClusterID)
+	case cp.BackupTS != previous.BackupTS:
+		return errors.Annotatef(berrors.ErrBackupCheckpointMismatch,
+			"the backup ts of the checkpoint is %d, but the current backup ts is %d",
+			previous.BackupTS, cp.BackupTS)
+	case cp.LastBackupTS != previous.LastBackupTS:
+		return errors.Annotatef(berrors.ErrBackupCheckpointMismatch,
+			"the last backup ts of the checkpoint is %d, but the current last backup ts is %d",
+			previous.LastBackupTS, cp.LastBackupTS)
+	case cp.RangesHash != previous.RangesHash:
+		return errors.Annotate(berrors.ErrBackupCheckpointMismatch,
+			"the ranges to backup are different from the checkpoint, please check the filter")
+	case cp.layout() != previous.layout():
+		return errors.Annotatef(berrors.ErrBackupCheckpointMismatch,
+			"the layout of the checkpoint is %s, but the current layout is %s",
+			previous.layout(), cp.layout())
+	}
+	return nil
+}
+
+func (cp *Checkpoint) layout() string {
+	if cp.Layout == "" {
+		return LayoutFlat
+	}
+	return cp.Layout
+}
+
+// completedRanges returns the completed ranges as a range tree.
+func (cp *Checkpoint) completedRanges() rtree.RangeTree {
+	tree := rtree.NewRangeTree()
+	for _, r := range cp.Ranges {
+		tree.Put(r.StartKey, r.EndKey, r.Files)
+	}
+	return tree
+}
+
+// LoadCheckpoint loads the checkpoint of the previous backup from the storage,
+// it returns nil if there is no checkpoint.
+func (bc *Client) LoadCheckpoint(ctx context.Context) (*Checkpoint, error) {
+	exist, err := bc.storage.FileExists(ctx, utils.CheckpointFile)
+	if err != nil {
+		return nil, errors.Annotatef(err, "error occurred when checking %s file", utils.CheckpointFile)
+	}
+	if !exist {
+		return nil, nil
+	}
+	data, err := bc.storage.Read(ctx, utils.CheckpointFile)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to read %s file", utils.CheckpointFile)
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, errors.Annotatef(err, "failed to parse %s file", utils.CheckpointFile)
+	}
+	log.Info("load backup checkpoint",
+		zap.Uint64("clusterID", cp.ClusterID),
+		zap.Uint64("backupTS", cp.BackupTS),
+		zap.Int("completedRanges", len(cp.Ranges)))
+	return cp, nil
+}
+
+// SetCheckpoint sets the checkpoint of the backup. BackupRanges skips the
+// ranges completed in the checkpoint, and persists the progress to it.
+func (bc *Client) SetCheckpoint(cp *Checkpoint) {
+	bc.checkpoint = cp
+}
+
+// saveCheckpoint persists the checkpoint to the storage.
+func (bc *Client) saveCheckpoint(ctx context.Context) error {
+	data, err := json.Marshal(bc.checkpoint)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("save backup checkpoint", zap.Int("completedRanges", len(bc.checkpoint.Ranges)))
+	return bc.storage.Write(ctx, utils.CheckpointFile, data)
+}
+
+// RemoveCheckpoint removes the checkpoint after the backup is finished.
+func (bc *Client) RemoveCheckpoint(ctx context.Context) error {
+	return bc.storage.DeleteFile(ctx, utils.CheckpointFile)
+}
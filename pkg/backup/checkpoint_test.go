@@ -0,0 +1,107 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup_test
+
+import (
+	"encoding/json"
+
+	. "github.com/pingcap/check"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+
+	"github.com/Orion7r/pr/pkg/backup"
+	"github.com/Orion7r/pr/pkg/rtree"
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+func (r *testBackup) TestCheckpointCheck(c *C) {
+	ranges := []rtree.Range{
+		{StartKey: []byte("a"), EndKey: []byte("c")},
+		{StartKey: []byte("d"), EndKey: []byte("f")},
+	}
+	cp := backup.NewCheckpoint(1, 100, 10, ranges)
+	c.Assert(cp.Check(backup.NewCheckpoint(1, 100, 10, ranges)), IsNil)
+	c.Assert(cp.Check(backup.NewCheckpoint(2, 100, 10, ranges)), ErrorMatches,
+		".*the checkpoint is created by cluster 2, but the current cluster is 1.*")
+	c.Assert(cp.Check(backup.NewCheckpoint(1, 99, 10, ranges)), ErrorMatches,
+		".*the backup ts of the checkpoint is 99, but the current backup ts is 100.*")
+	c.Assert(cp.Check(backup.NewCheckpoint(1, 100, 0, ranges)), ErrorMatches,
+		".*the last backup ts of the checkpoint is 0.*")
+	c.Assert(cp.Check(backup.NewCheckpoint(1, 100, 10, ranges[:1])), ErrorMatches,
+		".*please check the filter.*")
+	// the boundaries of the keys are also part of the hash.
+	c.Assert(cp.Check(backup.NewCheckpoint(1, 100, 10, []rtree.Range{
+		{StartKey: []byte("a"), EndKey: []byte("cd")},
+		{StartKey: []byte(""), EndKey: []byte("f")},
+	})), ErrorMatches, ".*please check the filter.*")
+
+	// the checkpoints without the layout are created by the flat layout.
+	flat := backup.NewCheckpoint(1, 100, 10, ranges)
+	flat.Layout = backup.LayoutFlat
+	c.Assert(flat.Check(cp), IsNil)
+	table := backup.NewCheckpoint(1, 100, 10, ranges)
+	table.Layout = backup.LayoutTable
+	c.Assert(table.Check(cp), ErrorMatches,
+		".*the layout of the checkpoint is flat, but the current layout is table.*")
+}
+
+func (r *testBackup) TestResumeFromCheckpoint(c *C) {
+	dir := c.MkDir()
+	backend, err := storage.ParseBackend("local://"+dir, nil)
+	c.Assert(err, IsNil)
+	// the test enables resume, so it doesn't change the client of the suite.
+	client := r.newBackupClient(c)
+	err = client.SetStorage(r.ctx, backend, &storage.ExternalStorageOptions{})
+	c.Assert(err, IsNil)
+
+	cp, err := client.LoadCheckpoint(r.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(cp, IsNil)
+
+	ranges := []rtree.Range{
+		{StartKey: []byte("a"), EndKey: []byte("c")},
+		{StartKey: []byte("d"), EndKey: []byte("f")},
+	}
+	previous := backup.NewCheckpoint(client.GetClusterID(), 100, 0, ranges)
+	previous.Ranges = []*backup.CheckpointRange{
+		{StartKey: []byte("a"), EndKey: []byte("c"), Files: []*kvproto.File{{Name: "1.sst"}}},
+		{StartKey: []byte("d"), EndKey: []byte("e"), Files: []*kvproto.File{{Name: "2.sst"}}},
+		{StartKey: []byte("e"), EndKey: []byte("f"), Files: []*kvproto.File{{Name: "3.sst"}}},
+	}
+	data, err := json.Marshal(previous)
+	c.Assert(err, IsNil)
+	local, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	err = local.Write(r.ctx, utils.CheckpointFile, data)
+	c.Assert(err, IsNil)
+
+	// the backup lock left by the failed backup is an error unless resuming.
+	err = client.SetLockFile(r.ctx)
+	c.Assert(err, IsNil)
+	err = client.SetStorage(r.ctx, backend, &storage.ExternalStorageOptions{})
+	c.Assert(err, ErrorMatches, ".*backup lock exists.*")
+	client.EnableResume()
+	err = client.SetStorage(r.ctx, backend, &storage.ExternalStorageOptions{})
+	c.Assert(err, IsNil)
+
+	cp, err = client.LoadCheckpoint(r.ctx)
+	c.Assert(err, IsNil)
+	c.Assert(cp.Check(backup.NewCheckpoint(client.GetClusterID(), 100, 0, ranges)), IsNil)
+	c.Assert(cp.Ranges, HasLen, 3)
+
+	// all ranges are completed, nothing is sent to TiKV.
+	client.SetCheckpoint(cp)
+	files, err := client.BackupRanges(r.ctx, ranges, kvproto.BackupRequest{}, 1, nil)
+	c.Assert(err, IsNil)
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	c.Assert(names, DeepEquals, []string{"1.sst", "2.sst", "3.sst"})
+
+	err = client.RemoveCheckpoint(r.ctx)
+	c.Assert(err, IsNil)
+	exist, err := local.FileExists(r.ctx, utils.CheckpointFile)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+}
@@ -7,7 +7,9 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"io"
+	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
@@ -42,6 +44,7 @@ import (
 	"github.com/Orion7r/pr/pkg/rtree"
 	"github.com/Orion7r/pr/pkg/storage"
 	"github.com/Orion7r/pr/pkg/summary"
+	"github.com/Orion7r/pr/pkg/trace"
 	"github.com/Orion7r/pr/pkg/utils"
 )
 
@@ -77,6 +80,20 @@ type Client struct {
 	backend *kvproto.StorageBackend
 
 	gcTTL int64
+
+	// resume marks the backup is resumed from the checkpoint of a failed backup.
+	resume     bool
+	checkpoint *Checkpoint
+
+	// rangesPool and rateLimit control the running BackupRanges, they can be
+	// changed while the backup is running. rateLimit is accessed atomically.
+	rangesPool *utils.WorkerPool
+	rateLimit  uint64
+
+	// tables and physicalTables are the tables in the table layout, they are
+	// nil in the flat layout.
+	tables         []*BackupTable
+	physicalTables map[int64]*BackupTable
 }
 
 // NewBackupClient returns a new backup client.
@@ -129,6 +146,18 @@ func (bc *Client) GetTS(ctx context.Context, duration time.Duration, ts uint64)
 	return backupTS, nil
 }
 
+// GetClusterID returns the cluster ID of the cluster to backup.
+func (bc *Client) GetClusterID() uint64 {
+	return bc.clusterID
+}
+
+// EnableResume allows the backup to be resumed from the checkpoint, the
+// backup lock left by the failed backup is not regarded as an error.
+// It must be called before SetStorage.
+func (bc *Client) EnableResume() {
+	bc.resume = true
+}
+
 // SetLockFile set write lock file.
 func (bc *Client) SetLockFile(ctx context.Context) error {
 	return bc.storage.Write(ctx, utils.LockFile,
@@ -150,9 +179,9 @@ func (bc *Client) GetGCTTL() int64 {
 }
 
 // SetStorage set ExternalStorage for client.
-func (bc *Client) SetStorage(ctx context.Context, backend *kvproto.StorageBackend, sendCreds bool) error {
+func (bc *Client) SetStorage(ctx context.Context, backend *kvproto.StorageBackend, opts *storage.ExternalStorageOptions) error {
 	var err error
-	bc.storage, err = storage.Create(ctx, backend, sendCreds)
+	bc.storage, err = storage.New(ctx, backend, opts)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -168,7 +197,7 @@ func (bc *Client) SetStorage(ctx context.Context, backend *kvproto.StorageBacken
 	if err != nil {
 		return errors.Annotatef(err, "error occurred when checking %s file", utils.LockFile)
 	}
-	if exist {
+	if exist && !bc.resume {
 		return errors.Annotate(berrors.ErrInvalidArgument, "backup lock exists, may be some backup files in the path already")
 	}
 	bc.backend = backend
@@ -182,6 +211,8 @@ func BuildBackupMeta(
 	rawRanges []*kvproto.RawRange,
 	ddlJobs []*model.Job,
 ) (backupMeta kvproto.BackupMeta, err error) {
+	backupMeta.ClusterId = req.ClusterId
+	backupMeta.BrVersion = utils.BRReleaseVersion
 	backupMeta.StartVersion = req.StartVersion
 	backupMeta.EndVersion = req.EndVersion
 	backupMeta.IsRawKv = req.IsRawKv
@@ -250,15 +281,12 @@ func BuildBackupRangeAndSchema(
 	storage kv.Storage,
 	tableFilter filter.Filter,
 	backupTS uint64,
-	ignoreStats bool,
 ) ([]rtree.Range, *Schemas, error) {
 	info, err := dom.GetSnapshotInfoSchema(backupTS)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
 
-	h := dom.StatsHandle()
-
 	ranges := make([]rtree.Range, 0)
 	backupSchemas := newBackupSchemas()
 	for _, dbInfo := range info.AllSchemas() {
@@ -337,23 +365,14 @@ func BuildBackupRangeAndSchema(
 				return nil, nil, errors.Trace(err)
 			}
 
-			var stats []byte
-			if !ignoreStats {
-				jsonTable, err := h.DumpStatsToJSON(dbInfo.Name.String(), tableInfo, nil)
-				if err != nil {
-					logger.Error("dump table stats failed", logutil.ShortError(err))
-				} else {
-					stats, err = json.Marshal(jsonTable)
-					if err != nil {
-						logger.Error("dump table stats failed (cannot serialize)", logutil.ShortError(err))
-					}
-				}
-			}
-
+			// the statistics are dumped into separate files by BackupStats.
 			schema := kvproto.Schema{
 				Db:    dbData,
 				Table: tableData,
-				Stats: stats,
+			}
+			// the TiFlash replicas are set on restore after the data is restored.
+			if tableInfo.TiFlashReplica != nil {
+				schema.TiflashReplicas = uint32(tableInfo.TiFlashReplica.Count)
 			}
 			backupSchemas.pushPending(schema, dbInfo.Name.L, tableInfo.Name.L)
 
@@ -361,6 +380,7 @@ func BuildBackupRangeAndSchema(
 			if err != nil {
 				return nil, nil, errors.Trace(err)
 			}
+			backupSchemas.pushTable(newBackupTable(dbInfo, tableInfo))
 			for _, r := range tableRanges {
 				ranges = append(ranges, rtree.Range{
 					StartKey: r.StartKey,
@@ -422,7 +442,47 @@ func GetBackupDDLJobs(dom *domain.Domain, lastBackupTS, backupTS uint64) ([]*mod
 	return completedJobs, nil
 }
 
-// BackupRanges make a backup of the given key ranges.
+// SetConcurrency sets the number of the ranges backed up concurrently. If the
+// backup is running, the running ranges are not interrupted.
+func (bc *Client) SetConcurrency(concurrency uint) {
+	if bc.rangesPool != nil {
+		bc.rangesPool.SetLimit(concurrency)
+		return
+	}
+	bc.rangesPool = utils.NewWorkerPool(concurrency, "Ranges")
+}
+
+// Concurrency returns the number of the ranges backed up concurrently.
+func (bc *Client) Concurrency() uint {
+	return bc.rangesPool.Limit()
+}
+
+// SetRateLimit sets the rate limit of the backup requests. If the backup is
+// running, it takes effect from the next range.
+func (bc *Client) SetRateLimit(rateLimit uint64) {
+	atomic.StoreUint64(&bc.rateLimit, rateLimit)
+}
+
+// RateLimit returns the rate limit of the backup requests.
+func (bc *Client) RateLimit() uint64 {
+	return atomic.LoadUint64(&bc.rateLimit)
+}
+
+// Pause stops backing up new ranges, the ranges being backed up are not
+// interrupted.
+func (bc *Client) Pause() {
+	bc.rangesPool.Pause()
+}
+
+// Resume resumes backing up ranges.
+func (bc *Client) Resume() {
+	bc.rangesPool.Resume()
+}
+
+// BackupRanges make a backup of the given key ranges. The concurrency and the
+// rate limit of the request are ignored if SetConcurrency is called before,
+// and they can be changed by SetConcurrency and SetRateLimit while it is
+// running.
 func (bc *Client) BackupRanges(
 	ctx context.Context,
 	ranges []rtree.Range,
@@ -431,39 +491,118 @@ func (bc *Client) BackupRanges(
 	updateCh glue.Progress,
 ) ([]*kvproto.File, error) {
 	errCh := make(chan error)
+	if bc.rangesPool == nil {
+		bc.SetConcurrency(concurrency)
+		bc.SetRateLimit(req.RateLimit)
+	}
 
 	// we collect all files in a single goroutine to avoid thread safety issues.
-	filesCh := make(chan []*kvproto.File, concurrency)
+	filesCh := make(chan rtree.Range, concurrency)
 	allFiles := make([]*kvproto.File, 0, len(ranges))
 	allFilesCollected := make(chan struct{}, 1)
+
+	if bc.checkpoint != nil && len(bc.checkpoint.Ranges) > 0 {
+		// Skip the ranges completed by the previous backup.
+		completed := bc.checkpoint.completedRanges()
+		incomplete := make([]rtree.Range, 0, len(ranges))
+		for _, r := range ranges {
+			incomplete = append(incomplete, completed.GetIncompleteRange(r.StartKey, r.EndKey)...)
+		}
+		for _, r := range bc.checkpoint.Ranges {
+			allFiles = append(allFiles, r.Files...)
+		}
+		log.Info("resume backup from checkpoint",
+			zap.Int("completedRanges", len(bc.checkpoint.Ranges)),
+			zap.Int("incompleteRanges", len(incomplete)))
+		ranges = incomplete
+	}
+
 	go func() {
 		init := time.Now()
 		// nolint:ineffassign
 		lastBackupStart, currentBackupStart := init, init
-		for files := range filesCh {
-			lastBackupStart, currentBackupStart = currentBackupStart, time.Now()
-			allFiles = append(allFiles, files...)
-			summary.CollectSuccessUnit("backup ranges", 1, currentBackupStart.Sub(lastBackupStart))
+		var flushCh <-chan time.Time
+		if bc.checkpoint != nil {
+			ticker := time.NewTicker(checkpointFlushInterval)
+			defer ticker.Stop()
+			flushCh = ticker.C
+		}
+		dirty := false
+	collectLoop:
+		for {
+			select {
+			case r, ok := <-filesCh:
+				if !ok {
+					break collectLoop
+				}
+				lastBackupStart, currentBackupStart = currentBackupStart, time.Now()
+				allFiles = append(allFiles, r.Files...)
+				summary.CollectSuccessUnit("backup ranges", 1, currentBackupStart.Sub(lastBackupStart))
+				if bc.checkpoint != nil {
+					bc.checkpoint.Ranges = append(bc.checkpoint.Ranges, &CheckpointRange{
+						StartKey: r.StartKey,
+						EndKey:   r.EndKey,
+						Files:    r.Files,
+					})
+					dirty = true
+				}
+			case <-flushCh:
+				if !dirty {
+					continue
+				}
+				if err := bc.saveCheckpoint(ctx); err != nil {
+					log.Warn("failed to save backup checkpoint", zap.Error(err))
+					continue
+				}
+				dirty = false
+			}
 		}
 		log.Info("Backup Ranges", zap.Duration("take", currentBackupStart.Sub(init)))
+		if dirty {
+			// Persist the final progress even if the backup is failed or canceled,
+			// so that it can be resumed later.
+			if err := bc.saveCheckpoint(context.Background()); err != nil {
+				log.Warn("failed to save backup checkpoint", zap.Error(err))
+			}
+		}
 		allFilesCollected <- struct{}{}
 	}()
 
 	go func() {
 		defer close(filesCh)
-		workerPool := utils.NewWorkerPool(concurrency, "Ranges")
 		eg, ectx := errgroup.WithContext(ctx)
+		var applyErr error
 		for _, r := range ranges {
 			sk, ek := r.StartKey, r.EndKey
-			workerPool.ApplyOnErrorGroup(eg, func() error {
-				files, err := bc.BackupRange(ectx, sk, ek, req, updateCh)
+			applyErr = bc.rangesPool.ApplyOnErrorGroupContext(ectx, eg, func() error {
+				rangeReq := req
+				rangeReq.RateLimit = bc.RateLimit()
+				table := bc.tableOfRange(sk)
+				if table != nil {
+					rangeReq.StorageBackend = tableBackend(bc.backend, table.Dir())
+				}
+				files, err := bc.BackupRange(ectx, sk, ek, rangeReq, updateCh)
 				if err == nil {
-					filesCh <- files
+					// the names are relative to the root of the storage.
+					if table != nil {
+						for _, f := range files {
+							f.Name = path.Join(table.Dir(), f.Name)
+						}
+					}
+					filesCh <- rtree.Range{StartKey: sk, EndKey: ek, Files: files}
 				}
 				return errors.Trace(err)
 			})
+			if applyErr != nil {
+				break
+			}
 		}
-		if err := eg.Wait(); err != nil {
+		// the error of the ranges is preferred to the canceled context.
+		err := eg.Wait()
+		if err == nil {
+			err = applyErr
+		}
+		if err != nil {
 			errCh <- err
 			return
 		}
@@ -472,6 +611,8 @@ func (bc *Client) BackupRanges(
 
 	for err := range errCh {
 		if err != nil {
+			// Wait for the completed ranges being saved to the checkpoint.
+			<-allFilesCollected
 			return nil, errors.Trace(err)
 		}
 	}
@@ -485,15 +626,19 @@ func (bc *Client) BackupRanges(
 }
 
 // BackupRange make a backup of the given key range.
-// Returns an array of files backed up.
+// Returns an array of files backed up. The files are written to the storage
+// backend of the request, or the storage of the client if it is not set.
 func (bc *Client) BackupRange(
 	ctx context.Context,
 	startKey, endKey []byte,
 	req kvproto.BackupRequest,
 	updateCh glue.Progress,
 ) (files []*kvproto.File, err error) {
+	span, ctx := trace.StartSpan(ctx, "Client.BackupRange")
+	trace.SetRangeTags(span, startKey, endKey)
 	start := time.Now()
 	defer func() {
+		trace.FinishSpan(span, err)
 		elapsed := time.Since(start)
 		log.Info("backup range finished", zap.Duration("take", elapsed))
 		key := "range start:" + hex.EncodeToString(startKey) + " end:" + hex.EncodeToString(endKey)
@@ -516,7 +661,9 @@ func (bc *Client) BackupRange(
 	req.ClusterId = bc.clusterID
 	req.StartKey = startKey
 	req.EndKey = endKey
-	req.StorageBackend = bc.backend
+	if req.StorageBackend == nil {
+		req.StorageBackend = bc.backend
+	}
 
 	push := newPushDown(bc.mgr, len(allStores))
 
@@ -531,7 +678,7 @@ func (bc *Client) BackupRange(
 	// TODO: test fine grained backup.
 	err = bc.fineGrainedBackup(
 		ctx, startKey, endKey, req.StartVersion, req.EndVersion, req.CompressionType, req.CompressionLevel,
-		req.RateLimit, req.Concurrency, results, updateCh)
+		req.RateLimit, req.Concurrency, req.StorageBackend, results, updateCh)
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
@@ -594,9 +741,13 @@ func (bc *Client) fineGrainedBackup(
 	compressLevel int32,
 	rateLimit uint64,
 	concurrency uint32,
+	backend *kvproto.StorageBackend,
 	rangeTree rtree.RangeTree,
 	updateCh glue.Progress,
-) error {
+) (err error) {
+	span, ctx := trace.StartSpan(ctx, "Client.fineGrainedBackup")
+	trace.SetRangeTags(span, startKey, endKey)
+	defer func() { trace.FinishSpan(span, err) }()
 	bo := tikv.NewBackoffer(ctx, backupFineGrainedMaxBackoff)
 	for {
 		// Step1, check whether there is any incomplete range
@@ -604,7 +755,10 @@ func (bc *Client) fineGrainedBackup(
 		if len(incomplete) == 0 {
 			return nil
 		}
+		span.LogKV("incomplete", len(incomplete))
 		log.Info("start fine grained backup", zap.Int("incomplete", len(incomplete)))
+		roundStart := time.Now()
+		backupFineGrainedRangeCounter.Add(float64(len(incomplete)))
 		// Step2, retry backup on incomplete range
 		respCh := make(chan *kvproto.BackupResponse, 4)
 		errCh := make(chan error, 4)
@@ -623,7 +777,7 @@ func (bc *Client) fineGrainedBackup(
 				for rg := range retry {
 					backoffMs, err :=
 						bc.handleFineGrained(ctx, boFork, rg, lastBackupTS, backupTS,
-							compressType, compressLevel, rateLimit, concurrency, respCh)
+							compressType, compressLevel, rateLimit, concurrency, backend, respCh)
 					if err != nil {
 						errCh <- err
 						return
@@ -675,6 +829,8 @@ func (bc *Client) fineGrainedBackup(
 			}
 		}
 
+		backupFineGrainedHistogram.Observe(time.Since(roundStart).Seconds())
+
 		// Step3. Backoff if needed, then repeat.
 		max.mu.Lock()
 		ms := max.ms
@@ -762,6 +918,7 @@ func (bc *Client) handleFineGrained(
 	compressionLevel int32,
 	rateLimit uint64,
 	concurrency uint32,
+	backend *kvproto.StorageBackend,
 	respCh chan<- *kvproto.BackupResponse,
 ) (int, error) {
 	leader, pderr := bc.findRegionLeader(ctx, rg.StartKey)
@@ -777,7 +934,7 @@ func (bc *Client) handleFineGrained(
 		EndKey:           rg.EndKey,
 		StartVersion:     lastBackupTS,
 		EndVersion:       backupTS,
-		StorageBackend:   bc.backend,
+		StorageBackend:   backend,
 		RateLimit:        rateLimit,
 		Concurrency:      concurrency,
 		CompressionType:  compressType,
@@ -42,12 +42,18 @@ func TestT(t *testing.T) {
 func (r *testBackup) SetUpSuite(c *C) {
 	r.mockPDClient = mocktikv.NewPDClient(mocktikv.NewCluster())
 	r.ctx, r.cancel = context.WithCancel(context.Background())
+	r.backupClient = r.newBackupClient(c)
+}
+
+// newBackupClient creates a backup client on the mock PD client, the tests
+// changing the state of the client should use their own client.
+func (r *testBackup) newBackupClient(c *C) *backup.Client {
 	mockMgr := &conn.Mgr{PdController: &pdutil.PdController{}}
 	mockMgr.SetPDClient(r.mockPDClient)
 	mockMgr.SetHTTP([]string{"test"}, nil)
-	var err error
-	r.backupClient, err = backup.NewBackupClient(r.ctx, mockMgr)
+	client, err := backup.NewBackupClient(r.ctx, mockMgr)
 	c.Assert(err, IsNil)
+	return client
 }
 
 func (r *testBackup) TestGetTS(c *C) {
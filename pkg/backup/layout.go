@@ -0,0 +1,206 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/tablecodec"
+	"go.uber.org/zap"
+
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+const (
+	// LayoutFlat writes all files of the backup into the root of the storage.
+	LayoutFlat = "flat"
+	// LayoutTable writes the files of each table under the <db>/<table>/
+	// directory, with a manifest of the files in the directory.
+	LayoutTable = "table"
+)
+
+// BackupTable is a table to backup, it decides the directory of the files of
+// the table in the table layout.
+type BackupTable struct {
+	DB      string
+	DBID    int64
+	Table   string
+	TableID int64
+	// PhysicalIDs are the IDs in the keys of the table, i.e. the IDs of the
+	// partitions if the table is partitioned.
+	PhysicalIDs []int64
+}
+
+func newBackupTable(dbInfo *model.DBInfo, tableInfo *model.TableInfo) *BackupTable {
+	t := &BackupTable{
+		DB:      dbInfo.Name.O,
+		DBID:    dbInfo.ID,
+		Table:   tableInfo.Name.O,
+		TableID: tableInfo.ID,
+	}
+	// the same as the keys in BuildTableRanges.
+	if pi := tableInfo.GetPartitionInfo(); pi != nil {
+		for _, def := range pi.Definitions {
+			t.PhysicalIDs = append(t.PhysicalIDs, def.ID)
+		}
+	} else {
+		t.PhysicalIDs = []int64{tableInfo.ID}
+	}
+	return t
+}
+
+// Dir returns the directory of the files of the table relative to the root of
+// the storage, the names are escaped so they are valid paths.
+func (t *BackupTable) Dir() string {
+	return TableDir(t.DB, t.Table)
+}
+
+// TableDir returns the directory of the files of the table in the table
+// layout relative to the root of the storage.
+func TableDir(db, table string) string {
+	return path.Join(escapePathName(db), escapePathName(table))
+}
+
+// escapePathName escapes the name to a single path element.
+func escapePathName(name string) string {
+	escaped := url.PathEscape(name)
+	// "." and ".." are not escaped, but they are not a normal path element.
+	if strings.Trim(escaped, ".") == "" {
+		return strings.ReplaceAll(escaped, ".", "%2E")
+	}
+	return escaped
+}
+
+// TableManifest is the manifest of the files of a table in the table layout,
+// it maps the files to the table without decoding the keys.
+type TableManifest struct {
+	DB      string `json:"db"`
+	DBID    int64  `json:"db-id"`
+	Table   string `json:"table"`
+	TableID int64  `json:"table-id"`
+	// Files are the files of the table, the names are relative to the root
+	// of the storage like the names in the backupmeta.
+	Files []*TableFile `json:"files"`
+}
+
+// TableFile is a file in the table manifest.
+type TableFile struct {
+	Name       string `json:"name"`
+	DB         string `json:"db"`
+	DBID       int64  `json:"db-id"`
+	Table      string `json:"table"`
+	TableID    int64  `json:"table-id"`
+	Cf         string `json:"cf"`
+	StartKey   string `json:"start-key"`
+	EndKey     string `json:"end-key"`
+	Sha256     string `json:"sha256"`
+	Crc64Xor   uint64 `json:"crc64xor"`
+	TotalKvs   uint64 `json:"total-kvs"`
+	TotalBytes uint64 `json:"total-bytes"`
+	Size       uint64 `json:"size"`
+}
+
+// SetTableLayout makes the files of each table written under the directory
+// of the table, or makes the files written in the flat layout if tables is
+// nil. It must be called after SetStorage and before BackupRanges.
+func (bc *Client) SetTableLayout(tables []*BackupTable) {
+	bc.tables = tables
+	bc.physicalTables = nil
+	if tables == nil {
+		return
+	}
+	bc.physicalTables = make(map[int64]*BackupTable)
+	for _, t := range tables {
+		for _, id := range t.PhysicalIDs {
+			bc.physicalTables[id] = t
+		}
+	}
+}
+
+// tableOfRange returns the table of the range in the table layout, or nil in
+// the flat layout. The ranges to backup never cross tables.
+func (bc *Client) tableOfRange(startKey []byte) *BackupTable {
+	if bc.physicalTables == nil {
+		return nil
+	}
+	return bc.physicalTables[tablecodec.DecodeTableID(startKey)]
+}
+
+// tableBackend returns the storage backend of the directory under the
+// backend.
+func tableBackend(backend *kvproto.StorageBackend, dir string) *kvproto.StorageBackend {
+	b := proto.Clone(backend).(*kvproto.StorageBackend)
+	switch v := b.Backend.(type) {
+	case *kvproto.StorageBackend_Local:
+		v.Local.Path = path.Join(v.Local.Path, dir)
+	case *kvproto.StorageBackend_S3:
+		v.S3.Prefix = path.Join(v.S3.Prefix, dir)
+	case *kvproto.StorageBackend_Gcs:
+		v.Gcs.Prefix = path.Join(v.Gcs.Prefix, dir)
+	}
+	return b
+}
+
+// SaveTableManifests saves the manifest of the files of each table in the
+// table layout, the tables without files have empty manifests.
+func (bc *Client) SaveTableManifests(ctx context.Context, files []*kvproto.File) error {
+	if bc.tables == nil {
+		return nil
+	}
+	manifests := make(map[string]*TableManifest, len(bc.tables))
+	for _, t := range bc.tables {
+		manifests[t.Dir()] = &TableManifest{
+			DB:      t.DB,
+			DBID:    t.DBID,
+			Table:   t.Table,
+			TableID: t.TableID,
+			Files:   make([]*TableFile, 0),
+		}
+	}
+	for _, f := range files {
+		m, ok := manifests[path.Dir(f.Name)]
+		if !ok {
+			// the file is written in the flat layout.
+			continue
+		}
+		m.Files = append(m.Files, &TableFile{
+			Name:       f.Name,
+			DB:         m.DB,
+			DBID:       m.DBID,
+			Table:      m.Table,
+			TableID:    m.TableID,
+			Cf:         f.Cf,
+			StartKey:   hex.EncodeToString(f.StartKey),
+			EndKey:     hex.EncodeToString(f.EndKey),
+			Sha256:     hex.EncodeToString(f.Sha256),
+			Crc64Xor:   f.Crc64Xor,
+			TotalKvs:   f.TotalKvs,
+			TotalBytes: f.TotalBytes,
+			Size:       f.Size_,
+		})
+	}
+	for dir, m := range manifests {
+		sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+		data, err := json.Marshal(m)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		name := path.Join(dir, utils.TableManifestFile)
+		if err = bc.storage.Write(ctx, name, data); err != nil {
+			return errors.Annotatef(err, "failed to save the table manifest %s", name)
+		}
+	}
+	log.Info("save table manifests", zap.Int("tables", len(manifests)))
+	return nil
+}
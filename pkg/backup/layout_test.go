@@ -0,0 +1,80 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+
+	"github.com/Orion7r/pr/pkg/backup"
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+func (r *testBackup) TestBackupTableDir(c *C) {
+	t := &backup.BackupTable{DB: "test", Table: "t"}
+	c.Assert(t.Dir(), Equals, "test/t")
+	t = &backup.BackupTable{DB: "a/b", Table: "c d"}
+	c.Assert(t.Dir(), Equals, "a%2Fb/c%20d")
+	t = &backup.BackupTable{DB: "..", Table: "."}
+	c.Assert(t.Dir(), Equals, "%2E%2E/%2E")
+	t = &backup.BackupTable{DB: "a..b", Table: ".t"}
+	c.Assert(t.Dir(), Equals, "a..b/.t")
+	c.Assert(backup.TableDir("test", "t"), Equals, "test/t")
+}
+
+func (r *testBackup) TestSaveTableManifests(c *C) {
+	dir := c.MkDir()
+	backend, err := storage.ParseBackend("local://"+dir, nil)
+	c.Assert(err, IsNil)
+	err = r.backupClient.SetStorage(r.ctx, backend, &storage.ExternalStorageOptions{})
+	c.Assert(err, IsNil)
+
+	// nothing is saved in the flat layout.
+	c.Assert(r.backupClient.SaveTableManifests(r.ctx, nil), IsNil)
+	_, err = ioutil.ReadFile(filepath.Join(dir, "test", "t1", utils.TableManifestFile))
+	c.Assert(err, NotNil)
+
+	r.backupClient.SetTableLayout([]*backup.BackupTable{
+		{DB: "test", DBID: 1, Table: "t1", TableID: 2, PhysicalIDs: []int64{2}},
+		{DB: "test", DBID: 1, Table: "t2", TableID: 3, PhysicalIDs: []int64{4, 5}},
+	})
+	defer r.backupClient.SetTableLayout(nil)
+	files := []*kvproto.File{
+		{Name: "test/t1/2_write.sst", Cf: "write", StartKey: []byte{0x74}, TotalKvs: 2},
+		{Name: "test/t1/1_default.sst", Cf: "default", StartKey: []byte{0x74}, TotalKvs: 1},
+		{Name: "1_write.sst", Cf: "write"},
+	}
+	c.Assert(r.backupClient.SaveTableManifests(r.ctx, files), IsNil)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "test", "t1", utils.TableManifestFile))
+	c.Assert(err, IsNil)
+	m := &backup.TableManifest{}
+	c.Assert(json.Unmarshal(data, m), IsNil)
+	c.Assert(m.DB, Equals, "test")
+	c.Assert(m.DBID, Equals, int64(1))
+	c.Assert(m.Table, Equals, "t1")
+	c.Assert(m.TableID, Equals, int64(2))
+	c.Assert(m.Files, HasLen, 2)
+	c.Assert(m.Files[0].Name, Equals, "test/t1/1_default.sst")
+	c.Assert(m.Files[0].Cf, Equals, "default")
+	c.Assert(m.Files[0].StartKey, Equals, "74")
+	c.Assert(m.Files[0].TotalKvs, Equals, uint64(1))
+	c.Assert(m.Files[1].Name, Equals, "test/t1/2_write.sst")
+	for _, f := range m.Files {
+		c.Assert(f.DB, Equals, "test")
+		c.Assert(f.TableID, Equals, int64(2))
+	}
+
+	// the tables without files have empty manifests.
+	data, err = ioutil.ReadFile(filepath.Join(dir, "test", "t2", utils.TableManifestFile))
+	c.Assert(err, IsNil)
+	m = &backup.TableManifest{}
+	c.Assert(json.Unmarshal(data, m), IsNil)
+	c.Assert(m.Table, Equals, "t2")
+	c.Assert(m.Files, HasLen, 0)
+}
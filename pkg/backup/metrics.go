@@ -23,9 +23,37 @@ var (
 			Help:      "Backup region latency distributions.",
 			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 16),
 		})
+
+	backupStoreResponseCounters = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "br",
+			Subsystem: "backup",
+			Name:      "store_response_total",
+			Help:      "The backup responses from each store.",
+		}, []string{"store", "type"})
+
+	backupFineGrainedRangeCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "br",
+			Subsystem: "backup",
+			Name:      "fine_grained_ranges_total",
+			Help:      "The incomplete ranges retried by fine grained backup.",
+		})
+
+	backupFineGrainedHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "br",
+			Subsystem: "backup",
+			Name:      "fine_grained_round_seconds",
+			Help:      "Fine grained backup round latency distributions.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 16),
+		})
 )
 
 func init() { // nolint:gochecknoinits
 	prometheus.MustRegister(backupRegionCounters)
 	prometheus.MustRegister(backupRegionHistogram)
+	prometheus.MustRegister(backupStoreResponseCounters)
+	prometheus.MustRegister(backupFineGrainedRangeCounter)
+	prometheus.MustRegister(backupFineGrainedHistogram)
 }
@@ -0,0 +1,90 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"github.com/tikv/pd/server/schedule/placement"
+	"go.uber.org/zap"
+
+	"github.com/Orion7r/pr/pkg/pdutil"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// BackupPlacementRules records the custom placement rules of the backed up
+// tables and partitions in the placement rules file, so they can be applied
+// to the restored tables. Nothing is written if there is no such rule.
+func (bc *Client) BackupPlacementRules(
+	ctx context.Context,
+	pdAddrs []string,
+	tlsConf *tls.Config,
+	schemas []*kvproto.Schema,
+) error {
+	var (
+		rules []placement.Rule
+		err   error
+	)
+	for _, addr := range pdAddrs {
+		rules, err = pdutil.GetPlacementRules(ctx, addr, tlsConf)
+		if err == nil {
+			break
+		}
+		log.Warn("failed to get placement rules", zap.String("pd", addr), zap.Error(err))
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	tableRules, err := buildTablePlacementRules(rules, schemas)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(tableRules) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(tableRules)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("backup placement rules", zap.Int("tables", len(tableRules)))
+	return bc.storage.Write(ctx, utils.PlacementRulesFile, data)
+}
+
+func buildTablePlacementRules(
+	rules []placement.Rule,
+	schemas []*kvproto.Schema,
+) (pdutil.TablePlacementRules, error) {
+	tableRules := make(pdutil.TablePlacementRules)
+	if len(rules) == 0 {
+		return tableRules, nil
+	}
+	for _, schema := range schemas {
+		// the empty databases are recorded without table.
+		if len(schema.Table) == 0 {
+			continue
+		}
+		tableInfo := &model.TableInfo{}
+		if err := json.Unmarshal(schema.Table, tableInfo); err != nil {
+			return nil, errors.Trace(err)
+		}
+		ids := []int64{tableInfo.ID}
+		if tableInfo.Partition != nil {
+			for _, def := range tableInfo.Partition.Definitions {
+				ids = append(ids, def.ID)
+			}
+		}
+		for _, id := range ids {
+			if found := pdutil.SearchTablePlacementRules(id, rules); len(found) > 0 {
+				tableRules[id] = found
+			}
+		}
+	}
+	return tableRules, nil
+}
@@ -4,6 +4,7 @@ package backup
 
 import (
 	"context"
+	"strconv"
 	"sync"
 
 	"github.com/pingcap/errors"
@@ -15,6 +16,7 @@ import (
 	berrors "github.com/Orion7r/pr/pkg/errors"
 	"github.com/Orion7r/pr/pkg/glue"
 	"github.com/Orion7r/pr/pkg/rtree"
+	"github.com/Orion7r/pr/pkg/trace"
 )
 
 // pushDown wraps a backup task.
@@ -39,7 +41,11 @@ func (push *pushDown) pushBackup(
 	req backup.BackupRequest,
 	stores []*metapb.Store,
 	updateCh glue.Progress,
-) (rtree.RangeTree, error) {
+) (_ rtree.RangeTree, err error) {
+	span, ctx := trace.StartSpan(ctx, "pushDown.pushBackup")
+	span.SetTag("stores", len(stores))
+	trace.SetRangeTags(span, req.StartKey, req.EndKey)
+	defer func() { trace.FinishSpan(span, err) }()
 	// Push down backup tasks to all tikv instances.
 	res := rtree.NewRangeTree()
 	wg := new(sync.WaitGroup)
@@ -54,12 +60,18 @@ func (push *pushDown) pushBackup(
 			log.Error("fail to connect store", zap.Uint64("StoreID", storeID))
 			return res, errors.Trace(err)
 		}
+		store := strconv.FormatUint(storeID, 10)
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			err := SendBackup(
 				ctx, storeID, client, req,
 				func(resp *backup.BackupResponse) error {
+					if resp.GetError() == nil {
+						backupStoreResponseCounters.WithLabelValues(store, "success").Inc()
+					} else {
+						backupStoreResponseCounters.WithLabelValues(store, "error").Inc()
+					}
 					// Forward all responses (including error).
 					push.respCh <- resp
 					return nil
@@ -20,6 +20,7 @@ import (
 	"github.com/Orion7r/pr/pkg/checksum"
 	"github.com/Orion7r/pr/pkg/glue"
 	"github.com/Orion7r/pr/pkg/summary"
+	"github.com/Orion7r/pr/pkg/trace"
 	"github.com/Orion7r/pr/pkg/utils"
 )
 
@@ -35,6 +36,8 @@ type Schemas struct {
 	schemas        map[string]backup.Schema
 	backupSchemaCh chan backup.Schema
 	errCh          chan error
+	// tables are the tables to backup in the order of the ranges.
+	tables []*BackupTable
 }
 
 func newBackupSchemas() *Schemas {
@@ -54,6 +57,16 @@ func (pending *Schemas) pushPending(
 	pending.schemas[name] = schema
 }
 
+func (pending *Schemas) pushTable(table *BackupTable) {
+	pending.tables = append(pending.tables, table)
+}
+
+// Tables returns the tables to backup, they decide the directories of the
+// files in the table layout.
+func (pending *Schemas) Tables() []*BackupTable {
+	return pending.tables
+}
+
 // Start backups schemas.
 func (pending *Schemas) Start(
 	ctx context.Context,
@@ -64,6 +77,8 @@ func (pending *Schemas) Start(
 	updateCh glue.Progress,
 ) {
 	workerPool := utils.NewWorkerPool(concurrency, "Schemas")
+	span, ctx := trace.StartSpan(ctx, "Schemas.Start")
+	span.SetTag("tables", len(pending.schemas))
 	errg, ectx := errgroup.WithContext(ctx)
 	go func() {
 		startAll := time.Now()
@@ -71,15 +86,18 @@ func (pending *Schemas) Start(
 			log.Info("table checksum start", zap.String("table", n))
 			name := n
 			schema := s
-			workerPool.ApplyOnErrorGroup(errg, func() error {
+			workerPool.ApplyOnErrorGroup(errg, func() (err error) {
 				start := time.Now()
+				tableSpan, cctx := trace.StartSpan(ectx, "calculateChecksum")
+				tableSpan.SetTag("table", name)
+				defer func() { trace.FinishSpan(tableSpan, err) }()
 				table := model.TableInfo{}
-				err := json.Unmarshal(schema.Table, &table)
+				err = json.Unmarshal(schema.Table, &table)
 				if err != nil {
 					return errors.Trace(err)
 				}
 				checksumResp, err := calculateChecksum(
-					ectx, &table, store.GetClient(), backupTS, copConcurrency)
+					cctx, &table, store.GetClient(), backupTS, copConcurrency)
 				if err != nil {
 					return errors.Trace(err)
 				}
@@ -98,7 +116,9 @@ func (pending *Schemas) Start(
 				return nil
 			})
 		}
-		if err := errg.Wait(); err != nil {
+		err := errg.Wait()
+		trace.FinishSpan(span, err)
+		if err != nil {
 			pending.errCh <- err
 		}
 		close(pending.backupSchemaCh)
@@ -3,18 +3,26 @@
 package backup_test
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/json"
 	"math"
 	"sync/atomic"
 
 	. "github.com/pingcap/check"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
 	filter "github.com/pingcap/tidb-tools/pkg/table-filter"
 	"github.com/pingcap/tidb/sessionctx/variable"
+	"github.com/pingcap/tidb/statistics/handle"
 	"github.com/pingcap/tidb/util/testkit"
 	"github.com/pingcap/tidb/util/testleak"
 
 	"github.com/Orion7r/pr/pkg/backup"
+	"github.com/Orion7r/pr/pkg/conn"
 	"github.com/Orion7r/pr/pkg/mock"
+	"github.com/Orion7r/pr/pkg/pdutil"
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/utils"
 )
 
 var _ = Suite(&testBackupSchemaSuite{})
@@ -53,6 +61,27 @@ func (sp *simpleProgress) get() int64 {
 	return atomic.LoadInt64(&sp.counter)
 }
 
+// backupStats backups the stats of the schemas into a local storage.
+func (s *testBackupSchemaSuite) backupStats(c *C, schemas []*kvproto.Schema) storage.ExternalStorage {
+	ctx := context.Background()
+	mgr := &conn.Mgr{PdController: &pdutil.PdController{}}
+	mgr.SetPDClient(s.mock.PDClient)
+	client, err := backup.NewBackupClient(ctx, mgr)
+	c.Assert(err, IsNil)
+	dir := c.MkDir()
+	backend, err := storage.ParseBackend("local://"+dir, nil)
+	c.Assert(err, IsNil)
+	c.Assert(client.SetStorage(ctx, backend, &storage.ExternalStorageOptions{}), IsNil)
+
+	updateCh := new(simpleProgress)
+	err = client.BackupStats(ctx, s.mock.Domain.StatsHandle(), schemas, 1, updateCh)
+	c.Assert(err, IsNil)
+	c.Assert(updateCh.get(), Equals, int64(len(schemas)))
+	local, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	return local
+}
+
 func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	tk := testkit.NewTestKit(c, s.mock.Storage)
 
@@ -60,7 +89,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	testFilter, err := filter.Parse([]string{"test.t1"})
 	c.Assert(err, IsNil)
 	_, backupSchemas, err := backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas, IsNil)
 
@@ -68,7 +97,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	fooFilter, err := filter.Parse([]string{"foo.t1"})
 	c.Assert(err, IsNil)
 	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, fooFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, fooFilter, math.MaxUint64)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas, IsNil)
 
@@ -76,7 +105,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	noFilter, err := filter.Parse([]string{"*.*"})
 	c.Assert(err, IsNil)
 	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, noFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, noFilter, math.MaxUint64)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas, IsNil)
 
@@ -86,7 +115,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	tk.MustExec("insert into t1 values (10);")
 
 	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, testFilter, math.MaxUint64)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas.Len(), Equals, 1)
 	updateCh := new(simpleProgress)
@@ -106,7 +135,7 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchema(c *C) {
 	tk.MustExec("insert into t2 values (11);")
 
 	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(
-		s.mock.Domain, s.mock.Storage, noFilter, math.MaxUint64, false)
+		s.mock.Domain, s.mock.Storage, noFilter, math.MaxUint64)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas.Len(), Equals, 2)
 	updateCh.reset()
@@ -143,16 +172,17 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchemaWithBrokenStats(c *
 	f, err := filter.Parse([]string{"test.t3"})
 	c.Assert(err, IsNil)
 
-	_, backupSchemas, err := backup.BuildBackupRangeAndSchema(s.mock.Domain, s.mock.Storage, f, math.MaxUint64, false)
+	_, backupSchemas, err := backup.BuildBackupRangeAndSchema(s.mock.Domain, s.mock.Storage, f, math.MaxUint64)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas.Len(), Equals, 1)
 
 	updateCh := new(simpleProgress)
 	backupSchemas.Start(context.Background(), s.mock.Storage, math.MaxUint64, 1, variable.DefChecksumTableConcurrency, updateCh)
 	schemas, err := backupSchemas.FinishTableChecksum()
+	c.Assert(err, IsNil)
+	s.backupStats(c, schemas)
 
 	// the stats should be empty, but other than that everything should be backed up.
-	c.Assert(err, IsNil)
 	c.Assert(schemas[0].Stats, HasLen, 0)
 	c.Assert(schemas[0].Crc64Xor, Not(Equals), 0)
 	c.Assert(schemas[0].TotalKvs, Not(Equals), 0)
@@ -163,17 +193,32 @@ func (s *testBackupSchemaSuite) TestBuildBackupRangeAndSchemaWithBrokenStats(c *
 	// recover the statistics.
 	tk.MustExec("analyze table t3;")
 
-	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(s.mock.Domain, s.mock.Storage, f, math.MaxUint64, false)
+	_, backupSchemas, err = backup.BuildBackupRangeAndSchema(s.mock.Domain, s.mock.Storage, f, math.MaxUint64)
 	c.Assert(err, IsNil)
 	c.Assert(backupSchemas.Len(), Equals, 1)
 
 	updateCh.reset()
 	backupSchemas.Start(context.Background(), s.mock.Storage, math.MaxUint64, 1, variable.DefChecksumTableConcurrency, updateCh)
 	schemas2, err := backupSchemas.FinishTableChecksum()
+	c.Assert(err, IsNil)
+	local := s.backupStats(c, schemas2)
 
 	// the stats should now be filled, and other than that the result should be equivalent to the first backup.
+	stats, statsFile, err := utils.ParseStats(schemas2[0].Stats)
 	c.Assert(err, IsNil)
-	c.Assert(schemas2[0].Stats, Not(HasLen), 0)
+	c.Assert(stats, IsNil)
+	c.Assert(statsFile, Matches, `stats_[0-9]+\.json\.gz`)
+	reader, err := local.Open(context.Background(), statsFile)
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	gzipReader, err := gzip.NewReader(reader)
+	c.Assert(err, IsNil)
+	jsonTable := &handle.JSONTable{}
+	c.Assert(json.NewDecoder(gzipReader).Decode(jsonTable), IsNil)
+	c.Assert(jsonTable.DatabaseName, Equals, "test")
+	c.Assert(jsonTable.TableName, Equals, "t3")
+	c.Assert(jsonTable.Columns, HasLen, 1)
+
 	c.Assert(schemas2[0].Crc64Xor, Equals, schemas[0].Crc64Xor)
 	c.Assert(schemas2[0].TotalKvs, Equals, schemas[0].TotalKvs)
 	c.Assert(schemas2[0].TotalBytes, Equals, schemas[0].TotalBytes)
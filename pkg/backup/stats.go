@@ -0,0 +1,312 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/statistics/handle"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Orion7r/pr/pkg/glue"
+	"github.com/Orion7r/pr/pkg/logutil"
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/summary"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+const (
+	// DefaultStatsConcurrency is the default number of the tables whose
+	// statistics are dumped concurrently. The statistics of a table, or of a
+	// partition of the partitioned table, are fully loaded in memory while
+	// dumping, so keep it small.
+	DefaultStatsConcurrency = 4
+
+	// statsChunkSize is the size of the parts uploaded to the storage, it
+	// should be larger than the minimal part size of S3.
+	statsChunkSize = 8 * 1024 * 1024
+)
+
+// StatsFileName returns the name of the statistics file of the table.
+func StatsFileName(tableID int64) string {
+	return fmt.Sprintf("stats_%d.json.gz", tableID)
+}
+
+// BackupStats dumps the statistics of the tables into separate gzipped JSON
+// files, and records the file names in the schemas. The statistics are
+// streamed to the storage, the partitions of the partitioned tables are dumped
+// one by one. The statistics of a table or a partition are still built in
+// memory by the handle, so the memory usage is bounded by the concurrency and
+// the statistics of the largest table or partition, rather than the number of
+// tables. The tables whose statistics fail to dump are skipped, they are
+// analyzed on restore if required.
+func (bc *Client) BackupStats(
+	ctx context.Context,
+	h *handle.Handle,
+	schemas []*kvproto.Schema,
+	concurrency uint,
+	updateCh glue.Progress,
+) error {
+	start := time.Now()
+	pool := utils.NewWorkerPool(concurrency, "Stats")
+	eg, ectx := errgroup.WithContext(ctx)
+	for _, s := range schemas {
+		schema := s
+		pool.ApplyOnErrorGroup(eg, func() error {
+			defer updateCh.Inc()
+			return errors.Trace(bc.backupTableStats(ectx, h, schema))
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return errors.Trace(err)
+	}
+	summary.CollectDuration("backup stats", time.Since(start))
+	return nil
+}
+
+func (bc *Client) backupTableStats(ctx context.Context, h *handle.Handle, schema *kvproto.Schema) error {
+	// the empty databases are recorded without table.
+	if len(schema.Table) == 0 {
+		return nil
+	}
+	dbInfo := &model.DBInfo{}
+	if err := json.Unmarshal(schema.Db, dbInfo); err != nil {
+		return errors.Trace(err)
+	}
+	tableInfo := &model.TableInfo{}
+	if err := json.Unmarshal(schema.Table, tableInfo); err != nil {
+		return errors.Trace(err)
+	}
+	logger := log.With(
+		zap.String("db", dbInfo.Name.O),
+		zap.String("table", tableInfo.Name.O),
+	)
+
+	var (
+		jsonTable  *handle.JSONTable
+		partitions *statsPartitions
+		err        error
+	)
+	if pi := tableInfo.GetPartitionInfo(); pi != nil {
+		// the same as DumpStatsToJSON, except that the partitions are dumped
+		// while encoding.
+		jsonTable = &handle.JSONTable{DatabaseName: dbInfo.Name.String(), TableName: tableInfo.Name.L}
+		partitions = newStatsPartitions(h, dbInfo.Name.String(), tableInfo, pi)
+	} else {
+		jsonTable, err = h.DumpStatsToJSON(dbInfo.Name.String(), tableInfo, nil)
+		if err != nil {
+			logger.Error("dump table stats failed", logutil.ShortError(err))
+			return nil
+		}
+	}
+	name := StatsFileName(tableInfo.ID)
+	uploader, err := bc.storage.CreateUploader(ctx, name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	writer := storage.NewUploaderWriter(uploader, statsChunkSize, storage.Gzip)
+	if err = encodeStatsJSON(&ctxWriter{ctx: ctx, w: writer}, jsonTable, partitions); err != nil {
+		logger.Error("dump table stats failed", logutil.ShortError(err))
+		// complete the upload and remove the partial file.
+		if err = writer.Close(ctx); err != nil {
+			return errors.Annotatef(err, "failed to write %s", name)
+		}
+		return errors.Trace(bc.storage.DeleteFile(ctx, name))
+	}
+	if err = writer.Close(ctx); err != nil {
+		return errors.Annotatef(err, "failed to write %s", name)
+	}
+	schema.Stats, err = json.Marshal(&utils.StatsFile{Name: name})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	logger.Info("table stats backed up", zap.String("file", name))
+	return nil
+}
+
+// ctxWriter adapts storage.Writer to io.Writer.
+type ctxWriter struct {
+	ctx context.Context
+	w   storage.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	return w.w.Write(w.ctx, p)
+}
+
+// statsPartitions dumps the statistics of the partitions one by one, so only
+// the statistics of one partition are in memory.
+type statsPartitions struct {
+	// names are the sorted names of the partitions.
+	names []string
+	dump  func(name string) (*handle.JSONTable, error)
+}
+
+func newStatsPartitions(h *handle.Handle, dbName string, tableInfo *model.TableInfo, pi *model.PartitionInfo) *statsPartitions {
+	ids := make(map[string]int64, len(pi.Definitions))
+	names := make([]string, 0, len(pi.Definitions))
+	for _, def := range pi.Definitions {
+		ids[def.Name.L] = def.ID
+		names = append(names, def.Name.L)
+	}
+	sort.Strings(names)
+	return &statsPartitions{
+		names: names,
+		dump: func(name string) (*handle.JSONTable, error) {
+			// a partition is dumped as a table with the ID of the partition.
+			partInfo := *tableInfo
+			partInfo.ID = ids[name]
+			partInfo.Partition = nil
+			table, err := h.DumpStatsToJSON(dbName, &partInfo, nil)
+			return table, errors.Trace(err)
+		},
+	}
+}
+
+// encodeStatsJSON encodes the statistics like json.Marshal, except that the
+// entries of the maps (the columns, the indices and the partitions) are
+// encoded and written one by one, so only the encoded statistics of one
+// column or index are buffered. If partitions is not nil, the partitions of
+// the table are dumped by it while encoding, the partitions without
+// statistics are skipped like DumpStatsToJSON.
+func encodeStatsJSON(w io.Writer, table *handle.JSONTable, partitions *statsPartitions) error {
+	if table == nil {
+		_, err := io.WriteString(w, "null")
+		return errors.Trace(err)
+	}
+	tableType := reflect.TypeOf(table)
+	v := reflect.ValueOf(table).Elem()
+	if _, err := io.WriteString(w, "{"); err != nil {
+		return errors.Trace(err)
+	}
+	written := 0
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		if err := writeJSONKey(w, name, written > 0); err != nil {
+			return errors.Trace(err)
+		}
+		written++
+		if field.Name == "Partitions" && partitions != nil {
+			if err := encodeStatsPartitions(w, partitions); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+		value := v.Field(i)
+		if value.Kind() != reflect.Map || value.IsNil() {
+			if err := writeJSONValue(w, value.Interface()); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+
+		keys := make([]string, 0, value.Len())
+		for _, key := range value.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		if _, err := io.WriteString(w, "{"); err != nil {
+			return errors.Trace(err)
+		}
+		for j, key := range keys {
+			if err := writeJSONKey(w, key, j > 0); err != nil {
+				return errors.Trace(err)
+			}
+			item := value.MapIndex(reflect.ValueOf(key).Convert(value.Type().Key()))
+			var err error
+			if item.Type() == tableType {
+				// the statistics of the partitions.
+				err = encodeStatsJSON(w, item.Interface().(*handle.JSONTable), nil)
+			} else {
+				err = writeJSONValue(w, item.Interface())
+			}
+			if err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if _, err := io.WriteString(w, "}"); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	_, err := io.WriteString(w, "}")
+	return errors.Trace(err)
+}
+
+func encodeStatsPartitions(w io.Writer, partitions *statsPartitions) error {
+	if _, err := io.WriteString(w, "{"); err != nil {
+		return errors.Trace(err)
+	}
+	written := 0
+	for _, name := range partitions.names {
+		table, err := partitions.dump(name)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if table == nil {
+			continue
+		}
+		if err = writeJSONKey(w, name, written > 0); err != nil {
+			return errors.Trace(err)
+		}
+		written++
+		if err = encodeStatsJSON(w, table, nil); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	_, err := io.WriteString(w, "}")
+	return errors.Trace(err)
+}
+
+// jsonFieldName returns the name of the struct field in JSON, and whether the
+// field is encoded.
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		return field.Name, true
+	}
+	return name, true
+}
+
+func writeJSONKey(w io.Writer, key string, comma bool) error {
+	if comma {
+		if _, err := io.WriteString(w, ","); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := writeJSONValue(w, key); err != nil {
+		return errors.Trace(err)
+	}
+	_, err := io.WriteString(w, ":")
+	return errors.Trace(err)
+}
+
+func writeJSONValue(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	_, err = w.Write(data)
+	return errors.Trace(err)
+}
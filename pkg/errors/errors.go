@@ -20,19 +20,27 @@ var (
 	ErrBackupInvalidRange        = errors.Normalize("backup range invalid", errors.RFCCodeText("BR:Backup:ErrBackupInvalidRange"))
 	ErrBackupNoLeader            = errors.Normalize("backup no leader", errors.RFCCodeText("BR:Backup:ErrBackupNoLeader"))
 	ErrBackupGCSafepointExceeded = errors.Normalize("backup GC safepoint exceeded", errors.RFCCodeText("BR:Backup:ErrBackupGCSafepointExceeded"))
+	ErrBackupCheckpointMismatch  = errors.Normalize("backup checkpoint mismatch", errors.RFCCodeText("BR:Backup:ErrBackupCheckpointMismatch"))
+	ErrBackupVerifyFailed        = errors.Normalize("backup verify failed", errors.RFCCodeText("BR:Backup:ErrBackupVerifyFailed"))
 
-	ErrRestoreModeMismatch     = errors.Normalize("restore mode mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreModeMismatch"))
-	ErrRestoreRangeMismatch    = errors.Normalize("restore range mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreRangeMismatch"))
-	ErrRestoreChecksumMismatch = errors.Normalize("restore checksum mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreChecksumMismatch"))
-	ErrRestoreTableIDMismatch  = errors.Normalize("restore table ID mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreTableIDMismatch"))
-	ErrRestoreRejectStore      = errors.Normalize("failed to restore remove rejected store", errors.RFCCodeText("BR:Restore:ErrRestoreRejectStore"))
-	ErrRestoreNoPeer           = errors.Normalize("region does not have peer", errors.RFCCodeText("BR:Restore:ErrRestoreNoPeer"))
-	ErrRestoreSplitFailed      = errors.Normalize("fail to split region", errors.RFCCodeText("BR:Restore:ErrRestoreSplitFailed"))
-	ErrRestoreInvalidRewrite   = errors.Normalize("invalid rewrite rule", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidRewrite"))
-	ErrRestoreInvalidBackup    = errors.Normalize("invalid backup", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidBackup"))
-	ErrRestoreInvalidRange     = errors.Normalize("invalid restore range", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidRange"))
-	ErrRestoreWriteAndIngest   = errors.Normalize("failed to write and ingest", errors.RFCCodeText("BR:Restore:ErrRestoreWriteAndIngest"))
-	ErrRestoreSchemaNotExists  = errors.Normalize("schema not exists", errors.RFCCodeText("BR:Restore:ErrRestoreSchemaNotExists"))
+	ErrRestoreModeMismatch       = errors.Normalize("restore mode mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreModeMismatch"))
+	ErrRestoreRangeMismatch      = errors.Normalize("restore range mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreRangeMismatch"))
+	ErrRestoreChecksumMismatch   = errors.Normalize("restore checksum mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreChecksumMismatch"))
+	ErrRestoreTableIDMismatch    = errors.Normalize("restore table ID mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreTableIDMismatch"))
+	ErrRestoreRejectStore        = errors.Normalize("failed to restore remove rejected store", errors.RFCCodeText("BR:Restore:ErrRestoreRejectStore"))
+	ErrRestoreNoPeer             = errors.Normalize("region does not have peer", errors.RFCCodeText("BR:Restore:ErrRestoreNoPeer"))
+	ErrRestoreSplitFailed        = errors.Normalize("fail to split region", errors.RFCCodeText("BR:Restore:ErrRestoreSplitFailed"))
+	ErrRestoreInvalidRewrite     = errors.Normalize("invalid rewrite rule", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidRewrite"))
+	ErrRestoreInvalidBackup      = errors.Normalize("invalid backup", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidBackup"))
+	ErrRestoreInvalidRange       = errors.Normalize("invalid restore range", errors.RFCCodeText("BR:Restore:ErrRestoreInvalidRange"))
+	ErrRestoreWriteAndIngest     = errors.Normalize("failed to write and ingest", errors.RFCCodeText("BR:Restore:ErrRestoreWriteAndIngest"))
+	ErrRestoreSchemaNotExists    = errors.Normalize("schema not exists", errors.RFCCodeText("BR:Restore:ErrRestoreSchemaNotExists"))
+	ErrRestoreCheckpointMismatch = errors.Normalize("restore checkpoint mismatch", errors.RFCCodeText("BR:Restore:ErrRestoreCheckpointMismatch"))
+	ErrRestoreTableExists        = errors.Normalize("table already exists", errors.RFCCodeText("BR:Restore:ErrRestoreTableExists"))
+	ErrRestoreSchemaIncompatible = errors.Normalize("incompatible schema", errors.RFCCodeText("BR:Restore:ErrRestoreSchemaIncompatible"))
+	ErrRestoreOnlineInProgress   = errors.Normalize("online restore in progress", errors.RFCCodeText("BR:Restore:ErrRestoreOnlineInProgress"))
+	ErrRestoreBackupChainBroken  = errors.Normalize("backup chain broken", errors.RFCCodeText("BR:Restore:ErrRestoreBackupChainBroken"))
+	ErrRestoreTiFlashTimeout     = errors.Normalize("TiFlash replica not available in time", errors.RFCCodeText("BR:Restore:ErrRestoreTiFlashTimeout"))
 
 	// TODO maybe it belongs to PiTR.
 	ErrRestoreRTsConstrain = errors.Normalize("resolved ts constrain violation", errors.RFCCodeText("BR:Restore:ErrRestoreResolvedTsConstrain"))
@@ -41,6 +49,7 @@ var (
 
 	ErrStorageUnknown       = errors.Normalize("unknown external storage error", errors.RFCCodeText("BR:ExternalStorage:ErrStorageUnknown"))
 	ErrStorageInvalidConfig = errors.Normalize("invalid external storage config", errors.RFCCodeText("BR:ExternalStorage:ErrStorageInvalidConfig"))
+	ErrStorageEncryption    = errors.Normalize("external storage encryption error", errors.RFCCodeText("BR:ExternalStorage:ErrStorageEncryption"))
 
 	// Errors reported from TiKV.
 	ErrKVUnknown           = errors.Normalize("unknown tikv error", errors.RFCCodeText("BR:KV:ErrKVUnknown"))
@@ -16,8 +16,10 @@ import (
 	"github.com/coreos/go-semver/semver"
 	. "github.com/pingcap/check"
 	"github.com/pingcap/kvproto/pkg/metapb"
+	"github.com/pingcap/tidb/tablecodec"
 	"github.com/pingcap/tidb/util/codec"
 	"github.com/tikv/pd/server/core"
+	"github.com/tikv/pd/server/schedule/placement"
 	"github.com/tikv/pd/server/statistics"
 )
 
@@ -167,3 +169,41 @@ func (s *testPDControllerSuite) TestPDVersion(c *C) {
 	c.Assert(r.Minor, Equals, expectV.Minor)
 	c.Assert(r.PreRelease, Equals, expectV.PreRelease)
 }
+
+func (s *testPDControllerSuite) TestTablePlacementRules(c *C) {
+	keyHex := func(key []byte) string {
+		return hex.EncodeToString(codec.EncodeBytes([]byte{}, key))
+	}
+	tableRule := placement.Rule{
+		GroupID:     "pd",
+		ID:          "t45",
+		Role:        placement.Voter,
+		Count:       3,
+		StartKeyHex: keyHex(tablecodec.EncodeTablePrefix(45)),
+		EndKeyHex:   keyHex(tablecodec.EncodeTablePrefix(46)),
+	}
+	recordRule := tableRule
+	recordRule.ID = "t45-r"
+	recordRule.StartKeyHex = keyHex(tablecodec.GenTableRecordPrefix(45))
+	tiflashRule := tableRule
+	tiflashRule.GroupID = "tiflash"
+	otherRule := tableRule
+	otherRule.ID = "t46"
+	otherRule.StartKeyHex = keyHex(tablecodec.EncodeTablePrefix(46))
+	otherRule.EndKeyHex = keyHex(tablecodec.EncodeTablePrefix(47))
+	defaultRule := placement.Rule{GroupID: "pd", ID: "default", Role: placement.Voter, Count: 3}
+
+	rules := SearchTablePlacementRules(45, []placement.Rule{defaultRule, tableRule, tiflashRule, recordRule, otherRule})
+	c.Assert(rules, DeepEquals, []placement.Rule{tableRule, recordRule})
+
+	rule, err := RewriteTablePlacementRule(recordRule, 45, 100)
+	c.Assert(err, IsNil)
+	c.Assert(rule.ID, Equals, "restored-t100-t45-r")
+	c.Assert(rule.StartKeyHex, Equals, keyHex(tablecodec.GenTableRecordPrefix(100)))
+	c.Assert(rule.EndKeyHex, Equals, keyHex(tablecodec.EncodeTablePrefix(101)))
+	rule, err = RewriteTablePlacementRule(tableRule, 45, 45)
+	c.Assert(err, IsNil)
+	c.Assert(rule, DeepEquals, tableRule)
+	_, err = RewriteTablePlacementRule(otherRule, 45, 100)
+	c.Assert(err, NotNil)
+}
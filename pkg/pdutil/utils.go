@@ -31,6 +31,9 @@ var Nop UndoFunc = func(context.Context) error { return nil }
 const (
 	resetTSURL       = "/pd/api/v1/admin/reset-ts"
 	placementRuleURL = "/pd/api/v1/config/rules"
+
+	// tiflashRuleGroup is the group of the placement rules of TiFlash replicas.
+	tiflashRuleGroup = "tiflash"
 )
 
 // ResetTS resets the timestamp of PD to a bigger value.
@@ -124,3 +127,74 @@ func SearchPlacementRule(tableID int64, placementRules []placement.Rule, role pl
 	}
 	return nil
 }
+
+// TablePlacementRules are the custom placement rules of the tables, keyed by
+// the IDs of the tables and the partitions. It is recorded at backup time.
+type TablePlacementRules map[int64][]placement.Rule
+
+// SearchTablePlacementRules returns the custom placement rules in the key
+// range of the table. The rules of TiFlash are not included, since they are
+// managed by TiDB with the TiFlash replica of the table.
+func SearchTablePlacementRules(tableID int64, placementRules []placement.Rule) []placement.Rule {
+	prefix := tablecodec.EncodeTablePrefix(tableID)
+	nextPrefix := tablecodec.EncodeTablePrefix(tableID + 1)
+	var rules []placement.Rule
+	for _, rule := range placementRules {
+		if rule.GroupID == tiflashRuleGroup {
+			continue
+		}
+		start, err := decodeRuleKey(rule.StartKeyHex)
+		if err != nil || !bytes.HasPrefix(start, prefix) {
+			continue
+		}
+		end, err := decodeRuleKey(rule.EndKeyHex)
+		if err != nil || !(bytes.HasPrefix(end, prefix) || bytes.Equal(end, nextPrefix)) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// RewriteTablePlacementRule returns the placement rule of the table oldID for
+// the table newID. The key range is rewritten with the new table ID, and the
+// rule ID is prefixed with the new table ID to avoid overwriting the old rule.
+func RewriteTablePlacementRule(rule placement.Rule, oldID, newID int64) (placement.Rule, error) {
+	rewrite := func(keyHex string) (string, error) {
+		key, err := decodeRuleKey(keyHex)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		oldPrefix := tablecodec.EncodeTablePrefix(oldID)
+		switch {
+		case bytes.HasPrefix(key, oldPrefix):
+			key = append(tablecodec.EncodeTablePrefix(newID), key[len(oldPrefix):]...)
+		case bytes.Equal(key, tablecodec.EncodeTablePrefix(oldID+1)):
+			key = tablecodec.EncodeTablePrefix(newID + 1)
+		default:
+			return "", errors.Annotatef(berrors.ErrInvalidArgument,
+				"key %s of placement rule %s/%s is not in table %d", keyHex, rule.GroupID, rule.ID, oldID)
+		}
+		return hex.EncodeToString(codec.EncodeBytes(key)), nil
+	}
+	var err error
+	if rule.StartKeyHex, err = rewrite(rule.StartKeyHex); err != nil {
+		return rule, errors.Trace(err)
+	}
+	if rule.EndKeyHex, err = rewrite(rule.EndKeyHex); err != nil {
+		return rule, errors.Trace(err)
+	}
+	if oldID != newID {
+		rule.ID = fmt.Sprintf("restored-t%d-%s", newID, rule.ID)
+	}
+	return rule, nil
+}
+
+func decodeRuleKey(keyHex string) ([]byte, error) {
+	key, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	_, decoded, err := codec.DecodeBytes(key)
+	return decoded, errors.Trace(err)
+}
@@ -53,7 +53,7 @@ type Batcher struct {
 
 	sender             BatchSender
 	manager            ContextManager
-	batchSizeThreshold int
+	batchSizeThreshold int32
 	size               int32
 }
 
@@ -174,7 +174,7 @@ func (b *Batcher) sendWorker(ctx context.Context, send <-chan SendType) {
 	for sendType := range send {
 		switch sendType {
 		case SendUntilLessThanBatch:
-			sendUntil(b.batchSizeThreshold)
+			sendUntil(b.Threshold())
 		case SendAll:
 			sendUntil(0)
 		case SendAllThenClose:
@@ -261,6 +261,7 @@ func newDrainResult() DrainResult {
 // as you can see, all restored ranges would be removed.
 func (b *Batcher) drainRanges() DrainResult {
 	result := newDrainResult()
+	threshold := b.Threshold()
 
 	b.cachedTablesMu.Lock()
 	defer b.cachedTablesMu.Unlock()
@@ -275,8 +276,8 @@ func (b *Batcher) drainRanges() DrainResult {
 		// the batch is full, we should stop here!
 		// we use strictly greater than because when we send a batch at equal, the offset should plus one.
 		// (because the last table is sent, we should put it in emptyTables), and this will introduce extra complex.
-		if thisTableLen+collected > b.batchSizeThreshold {
-			drainSize := b.batchSizeThreshold - collected
+		if thisTableLen+collected > threshold {
+			drainSize := threshold - collected
 			thisTableRanges := thisTable.Range
 
 			var drained []rtree.Range
@@ -289,14 +290,14 @@ func (b *Batcher) drainRanges() DrainResult {
 			)
 			result.Ranges = append(result.Ranges, drained...)
 			b.cachedTables = b.cachedTables[offset:]
-			atomic.AddInt32(&b.size, -int32(len(drained)))
+			restoreBatcherGauge.Set(float64(atomic.AddInt32(&b.size, -int32(len(drained)))))
 			return result
 		}
 
 		result.BlankTablesAfterSend = append(result.BlankTablesAfterSend, thisTable.CreatedTable)
 		// let's 'drain' the ranges of current table. This op must not make the batch full.
 		result.Ranges = append(result.Ranges, thisTable.Range...)
-		atomic.AddInt32(&b.size, -int32(len(thisTable.Range)))
+		restoreBatcherGauge.Set(float64(atomic.AddInt32(&b.size, -int32(len(thisTable.Range)))))
 		// clear the table length.
 		b.cachedTables[offset].Range = []rtree.Range{}
 		log.Debug("draining table to batch",
@@ -327,7 +328,7 @@ func (b *Batcher) Send(ctx context.Context) {
 }
 
 func (b *Batcher) sendIfFull() {
-	if b.Len() >= b.batchSizeThreshold {
+	if b.Len() >= b.Threshold() {
 		log.Debug("sending batch because batcher is full", zap.Int("size", b.Len()))
 		b.asyncSend(SendUntilLessThanBatch)
 	}
@@ -346,7 +347,7 @@ func (b *Batcher) Add(tbs TableWithRange) {
 	)
 	b.cachedTables = append(b.cachedTables, tbs)
 	b.rewriteRules.Append(*tbs.RewriteRule)
-	atomic.AddInt32(&b.size, int32(len(tbs.Range)))
+	restoreBatcherGauge.Set(float64(atomic.AddInt32(&b.size, int32(len(tbs.Range)))))
 	b.cachedTablesMu.Unlock()
 
 	b.sendIfFull()
@@ -362,8 +363,13 @@ func (b *Batcher) Close() {
 }
 
 // SetThreshold sets the threshold that how big the batch size reaching need to send batch.
-// note this function isn't goroutine safe yet,
-// just set threshold before anything starts(e.g. EnableAutoCommit), please.
+// It can be changed while the batcher is running, the new threshold takes
+// effect from the next batch.
 func (b *Batcher) SetThreshold(newThreshold int) {
-	b.batchSizeThreshold = newThreshold
+	atomic.StoreInt32(&b.batchSizeThreshold, int32(newThreshold))
+}
+
+// Threshold returns the threshold of the batch size.
+func (b *Batcher) Threshold() int {
+	return int(atomic.LoadInt32(&b.batchSizeThreshold))
 }
@@ -0,0 +1,302 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/rtree"
+	"github.com/Orion7r/pr/pkg/storage"
+)
+
+// checkpointFlushInterval is the interval of persisting the checkpoint during restore.
+const checkpointFlushInterval = 30 * time.Second
+
+// CheckpointRange is a restored range recorded in the checkpoint, the keys are
+// the keys before rewriting.
+type CheckpointRange struct {
+	StartKey []byte `json:"start-key"`
+	EndKey   []byte `json:"end-key"`
+}
+
+// Checkpoint is the progress of a restore.
+type Checkpoint struct {
+	ClusterID uint64 `json:"cluster-id"`
+	BackupTS  uint64 `json:"backup-ts"`
+	// ResetTS marks the timestamp of PD has been reset to the backup ts.
+	ResetTS bool `json:"reset-ts"`
+	// Tables maps the old table IDs to the IDs of the created tables.
+	Tables map[int64]int64 `json:"tables"`
+	// Ranges are the ranges downloaded and ingested.
+	Ranges []CheckpointRange `json:"ranges"`
+	// Checksums are the old IDs of the tables passed the checksum.
+	Checksums []int64 `json:"checksums"`
+	// Finished marks the backup has been restored, it is only kept when the
+	// backup is restored in a chain of incremental backups.
+	Finished bool `json:"finished"`
+}
+
+// LoadCheckpoint loads the checkpoint from the storage, it returns nil if there is no checkpoint.
+func LoadCheckpoint(ctx context.Context, s storage.ExternalStorage, name string) (*Checkpoint, error) {
+	exist, err := s.FileExists(ctx, name)
+	if err != nil {
+		return nil, errors.Annotatef(err, "error occurred when checking %s file", name)
+	}
+	if !exist {
+		return nil, nil
+	}
+	data, err := s.Read(ctx, name)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to read %s file", name)
+	}
+	cp := &Checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil, errors.Annotatef(err, "failed to parse %s file", name)
+	}
+	return cp, nil
+}
+
+// Checkpointer records the restore progress and persists it to the storage periodically.
+// All the methods are goroutine-safe, and a nil Checkpointer records nothing.
+type Checkpointer struct {
+	storage storage.ExternalStorage
+	name    string
+	// flushMu serializes the writes of the checkpoint, so an older checkpoint
+	// never overwrites a newer one.
+	flushMu sync.Mutex
+
+	mu         sync.Mutex
+	checkpoint *Checkpoint
+	ranges     map[string]struct{}
+	checksums  map[int64]struct{}
+	dirty      bool
+}
+
+// NewCheckpointer creates a Checkpointer which persists the checkpoint to the
+// file name of the storage. The previous checkpoint is resumed if not nil.
+func NewCheckpointer(
+	s storage.ExternalStorage,
+	name string,
+	clusterID, backupTS uint64,
+	previous *Checkpoint,
+) (*Checkpointer, error) {
+	cp := &Checkpoint{ClusterID: clusterID, BackupTS: backupTS}
+	if previous != nil {
+		if previous.ClusterID != clusterID {
+			return nil, errors.Annotatef(berrors.ErrRestoreCheckpointMismatch,
+				"the checkpoint is created by restoring to cluster %d, but the current cluster is %d",
+				previous.ClusterID, clusterID)
+		}
+		if previous.BackupTS != backupTS {
+			return nil, errors.Annotatef(berrors.ErrRestoreCheckpointMismatch,
+				"the checkpoint is created by restoring the backup at %d, but the current backup is at %d",
+				previous.BackupTS, backupTS)
+		}
+		cp = previous
+		log.Info("resume restore from checkpoint",
+			zap.Int("createdTables", len(cp.Tables)),
+			zap.Int("restoredRanges", len(cp.Ranges)),
+			zap.Int("checksumTables", len(cp.Checksums)))
+	}
+	if cp.Tables == nil {
+		cp.Tables = make(map[int64]int64)
+	}
+	c := &Checkpointer{
+		storage:    s,
+		name:       name,
+		checkpoint: cp,
+		ranges:     make(map[string]struct{}, len(cp.Ranges)),
+		checksums:  make(map[int64]struct{}, len(cp.Checksums)),
+	}
+	for _, r := range cp.Ranges {
+		c.ranges[checkpointRangeKey(r.StartKey, r.EndKey)] = struct{}{}
+	}
+	for _, id := range cp.Checksums {
+		c.checksums[id] = struct{}{}
+	}
+	return c, nil
+}
+
+func checkpointRangeKey(startKey, endKey []byte) string {
+	key := make([]byte, 4, 4+len(startKey)+len(endKey))
+	binary.BigEndian.PutUint32(key, uint32(len(startKey)))
+	key = append(key, startKey...)
+	return string(append(key, endKey...))
+}
+
+// IsTSReset checks whether the timestamp of PD has been reset.
+func (c *Checkpointer) IsTSReset() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checkpoint.ResetTS
+}
+
+// MarkTSReset records the timestamp of PD has been reset.
+func (c *Checkpointer) MarkTSReset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkpoint.ResetTS = true
+	c.dirty = true
+}
+
+// IsFinished checks whether the backup has been restored.
+func (c *Checkpointer) IsFinished() bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checkpoint.Finished
+}
+
+// MarkFinished records the backup has been restored, and persists the
+// checkpoint at once.
+func (c *Checkpointer) MarkFinished(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	c.checkpoint.Finished = true
+	c.dirty = true
+	c.mu.Unlock()
+	return errors.Annotate(c.Flush(ctx), "failed to save the finished backup to the restore checkpoint")
+}
+
+// createdTable returns the ID of the table created from the old table.
+func (c *Checkpointer) createdTable(oldID int64) (int64, bool) {
+	if c == nil {
+		return 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	newID, ok := c.checkpoint.Tables[oldID]
+	return newID, ok
+}
+
+// tableCreated records the table created from the old table, and persists the
+// checkpoint at once. Otherwise the table created before a crash would be
+// treated as an existing table on resume.
+func (c *Checkpointer) tableCreated(ctx context.Context, oldID, newID int64) error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	if id, ok := c.checkpoint.Tables[oldID]; !ok || id != newID {
+		c.checkpoint.Tables[oldID] = newID
+		c.dirty = true
+	}
+	c.mu.Unlock()
+	return errors.Annotate(c.Flush(ctx), "failed to save the created table to the restore checkpoint")
+}
+
+// isRangeRestored checks whether the range has been restored.
+func (c *Checkpointer) isRangeRestored(r rtree.Range) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.ranges[checkpointRangeKey(r.StartKey, r.EndKey)]
+	return ok
+}
+
+func (c *Checkpointer) rangesRestored(ranges []rtree.Range) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range ranges {
+		key := checkpointRangeKey(r.StartKey, r.EndKey)
+		if _, ok := c.ranges[key]; ok {
+			continue
+		}
+		c.ranges[key] = struct{}{}
+		c.checkpoint.Ranges = append(c.checkpoint.Ranges, CheckpointRange{StartKey: r.StartKey, EndKey: r.EndKey})
+		c.dirty = true
+	}
+}
+
+func (c *Checkpointer) isChecksumPassed(oldID int64) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.checksums[oldID]
+	return ok
+}
+
+func (c *Checkpointer) checksumPassed(oldID int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checksums[oldID]; ok {
+		return
+	}
+	c.checksums[oldID] = struct{}{}
+	c.checkpoint.Checksums = append(c.checkpoint.Checksums, oldID)
+	c.dirty = true
+}
+
+// Flush persists the checkpoint if there is any new progress.
+func (c *Checkpointer) Flush(ctx context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(c.checkpoint)
+	c.dirty = false
+	c.mu.Unlock()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = c.storage.Write(ctx, c.name, data); err != nil {
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// Run persists the checkpoint periodically until the context is done.
+func (c *Checkpointer) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkpointFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Flush(ctx); err != nil {
+				log.Warn("failed to save restore checkpoint", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Remove removes the checkpoint after the restore is finished.
+func (c *Checkpointer) Remove(ctx context.Context) error {
+	return c.storage.DeleteFile(ctx, c.name)
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore_test
+
+import (
+	"context"
+
+	. "github.com/pingcap/check"
+
+	"github.com/Orion7r/pr/pkg/restore"
+	"github.com/Orion7r/pr/pkg/storage"
+)
+
+var _ = Suite(&testCheckpointSuite{})
+
+type testCheckpointSuite struct{}
+
+func (s *testCheckpointSuite) TestCheckpointer(c *C) {
+	ctx := context.Background()
+	local, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+
+	var nilCheckpointer *restore.Checkpointer
+	c.Assert(nilCheckpointer.IsTSReset(), IsFalse)
+	nilCheckpointer.MarkTSReset()
+
+	cp, err := restore.LoadCheckpoint(ctx, local, "restore.checkpoint")
+	c.Assert(err, IsNil)
+	c.Assert(cp, IsNil)
+
+	checkpointer, err := restore.NewCheckpointer(local, "restore.checkpoint", 1, 100, nil)
+	c.Assert(err, IsNil)
+	c.Assert(checkpointer.IsTSReset(), IsFalse)
+	// nothing is persisted without progress.
+	c.Assert(checkpointer.Flush(ctx), IsNil)
+	exist, err := local.FileExists(ctx, "restore.checkpoint")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+
+	checkpointer.MarkTSReset()
+	c.Assert(checkpointer.Flush(ctx), IsNil)
+	cp, err = restore.LoadCheckpoint(ctx, local, "restore.checkpoint")
+	c.Assert(err, IsNil)
+	c.Assert(cp.ClusterID, Equals, uint64(1))
+	c.Assert(cp.BackupTS, Equals, uint64(100))
+	c.Assert(cp.ResetTS, IsTrue)
+
+	_, err = restore.NewCheckpointer(local, "restore.checkpoint", 2, 100, cp)
+	c.Assert(err, ErrorMatches, ".*restoring to cluster 1, but the current cluster is 2.*")
+	_, err = restore.NewCheckpointer(local, "restore.checkpoint", 1, 99, cp)
+	c.Assert(err, ErrorMatches, ".*restoring the backup at 100, but the current backup is at 99.*")
+	resumed, err := restore.NewCheckpointer(local, "restore.checkpoint", 1, 100, cp)
+	c.Assert(err, IsNil)
+	c.Assert(resumed.IsTSReset(), IsTrue)
+
+	c.Assert(resumed.Remove(ctx), IsNil)
+	exist, err = local.FileExists(ctx, "restore.checkpoint")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+}
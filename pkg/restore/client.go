@@ -8,9 +8,10 @@ import (
 	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pingcap/errors"
@@ -42,6 +43,7 @@ import (
 	"github.com/Orion7r/pr/pkg/pdutil"
 	"github.com/Orion7r/pr/pkg/storage"
 	"github.com/Orion7r/pr/pkg/summary"
+	"github.com/Orion7r/pr/pkg/trace"
 	"github.com/Orion7r/pr/pkg/utils"
 )
 
@@ -70,18 +72,36 @@ type Client struct {
 	// Before you do it, you can firstly read discussions at
 	// https://github.com/Orion7r/pr/pull/377#discussion_r446594501,
 	// this probably isn't as easy as it seems like (however, not hard, too :D)
-	db              *DB
-	rateLimit       uint64
-	isOnline        bool
-	noSchema        bool
-	hasSpeedLimited bool
+	db *DB
+	// rateLimit and checksumConcurrency are accessed atomically, since they
+	// can be changed while the restore is running.
+	rateLimit           uint64
+	checksumConcurrency uint64
+	isOnline            bool
+	noSchema            bool
+	hasSpeedLimited     bool
+	speedLimitMu        sync.Mutex
 
 	restoreStores []uint64
+	// onlineStores is the number of the stores labelled by BR for online
+	// restore, and onlineRecorder records the labels and the placement rules.
+	onlineStores      int
+	onlineRecorder    *OnlineRecorder
+	placementProgress func(total int64) glue.Progress
+
+	// checkpointer records the progress of the restore, it is nil unless
+	// the checkpoint is enabled.
+	checkpointer *Checkpointer
 
 	storage            storage.ExternalStorage
 	backend            *backup.StorageBackend
 	switchModeInterval time.Duration
 	switchCh           chan struct{}
+	// switchMu protects the switching of TiKV mode. importMode is true if the
+	// cluster is kept in import mode, and holdNormalMode suspends it.
+	switchMu       sync.Mutex
+	importMode     bool
+	holdNormalMode bool
 
 	// statHandler and dom are used for analyze table after restore.
 	// it will backup stats with #dump.DumpStatsToJSON
@@ -127,13 +147,43 @@ func NewRestoreClient(
 
 // SetRateLimit to set rateLimit.
 func (rc *Client) SetRateLimit(rateLimit uint64) {
-	rc.rateLimit = rateLimit
+	atomic.StoreUint64(&rc.rateLimit, rateLimit)
+}
+
+// RateLimit returns the download rate limit of the TiKV stores.
+func (rc *Client) RateLimit() uint64 {
+	return atomic.LoadUint64(&rc.rateLimit)
+}
+
+// UpdateRateLimit changes the rate limit while the restore is running. The
+// new limit is pushed to all TiKV stores if the files are being restored.
+func (rc *Client) UpdateRateLimit(ctx context.Context, rateLimit uint64) error {
+	old := atomic.SwapUint64(&rc.rateLimit, rateLimit)
+	log.Info("update restore rate limit", zap.Uint64("from", old), zap.Uint64("to", rateLimit))
+	rc.speedLimitMu.Lock()
+	defer rc.speedLimitMu.Unlock()
+	if !rc.hasSpeedLimited {
+		// the limit is set when the files start to restore.
+		return nil
+	}
+	return errors.Trace(rc.pushSpeedLimit(ctx, rateLimit))
+}
+
+// SetChecksumConcurrency sets the concurrency of the checksum of every table,
+// it takes effect from the next table if the checksum is running.
+func (rc *Client) SetChecksumConcurrency(c uint) {
+	atomic.StoreUint64(&rc.checksumConcurrency, uint64(c))
+}
+
+// ChecksumConcurrency returns the concurrency of the checksum of every table.
+func (rc *Client) ChecksumConcurrency() uint {
+	return uint(atomic.LoadUint64(&rc.checksumConcurrency))
 }
 
 // SetStorage set ExternalStorage for client.
-func (rc *Client) SetStorage(ctx context.Context, backend *backup.StorageBackend, sendCreds bool) error {
+func (rc *Client) SetStorage(ctx context.Context, backend *backup.StorageBackend, opts *storage.ExternalStorageOptions) error {
 	var err error
-	rc.storage, err = storage.Create(ctx, backend, sendCreds)
+	rc.storage, err = storage.New(ctx, backend, opts)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -141,6 +191,14 @@ func (rc *Client) SetStorage(ctx context.Context, backend *backup.StorageBackend
 	return nil
 }
 
+// SetExternalStorage set ExternalStorage for client directly.
+//
+// It is used by the tasks which only read files on BR side, the storage
+// backend is not sent to TiKV.
+func (rc *Client) SetExternalStorage(s storage.ExternalStorage) {
+	rc.storage = s
+}
+
 // GetPDClient returns a pd client.
 func (rc *Client) GetPDClient() pd.Client {
 	return rc.pdClient
@@ -186,7 +244,7 @@ func (rc *Client) InitBackupMeta(backupMeta *backup.BackupMeta, backend *backup.
 
 	metaClient := NewSplitClient(rc.pdClient, rc.tlsConf)
 	importCli := NewImportClient(metaClient, rc.tlsConf, rc.keepaliveConf)
-	rc.fileImporter = NewFileImporter(metaClient, importCli, backend, rc.backupMeta.IsRawKv, rc.rateLimit)
+	rc.fileImporter = NewFileImporter(metaClient, importCli, backend, rc.backupMeta.IsRawKv)
 
 	return nil
 }
@@ -249,16 +307,43 @@ func (rc *Client) GetFilesInRawRange(startKey []byte, endKey []byte, cf string)
 	return nil, errors.Annotate(berrors.ErrRestoreRangeMismatch, "no backup data in the range")
 }
 
-// SetConcurrency sets the concurrency of dbs tables files.
+// SetConcurrency sets the concurrency of dbs tables files. It can be changed
+// while the files are being restored.
 func (rc *Client) SetConcurrency(c uint) {
+	if rc.workerPool != nil {
+		rc.workerPool.SetLimit(c)
+		return
+	}
 	rc.workerPool = utils.NewWorkerPool(c, "file")
 }
 
+// Concurrency returns the concurrency of dbs tables files.
+func (rc *Client) Concurrency() uint {
+	return rc.workerPool.Limit()
+}
+
+// Pause stops restoring new files, the files being restored are not
+// interrupted.
+func (rc *Client) Pause() {
+	rc.workerPool.Pause()
+}
+
+// Resume resumes restoring files.
+func (rc *Client) Resume() {
+	rc.workerPool.Resume()
+}
+
 // EnableOnline sets the mode of restore to online.
 func (rc *Client) EnableOnline() {
 	rc.isOnline = true
 }
 
+// SetCheckpointer sets the checkpointer which records the progress of the
+// restore. The tables, ranges and checksums recorded in it are skipped.
+func (rc *Client) SetCheckpointer(c *Checkpointer) {
+	rc.checkpointer = c
+}
+
 // GetTLSConfig returns the tls config.
 func (rc *Client) GetTLSConfig() *tls.Config {
 	return rc.tlsConf
@@ -387,13 +472,16 @@ func (rc *Client) createTable(
 	table *utils.Table,
 	newTS uint64,
 ) (CreatedTable, error) {
+	createdID, created := rc.checkpointer.createdTable(table.Info.ID)
 	if rc.IsSkipCreateSQL() {
 		log.Info("skip create table and alter autoIncID", zap.Stringer("table", table.Info.Name))
+	} else if created {
+		log.Info("skip create table created before checkpoint", zap.Stringer("table", table.Info.Name))
 	} else {
 		// don't use rc.ctx here...
 		// remove the ctx field of Client would be a great work,
 		// we just take a small step here :<
-		err := db.CreateTable(ctx, table)
+		err := db.CreateTable(ctx, withoutTiFlashReplica(table))
 		if err != nil {
 			return CreatedTable{}, errors.Trace(err)
 		}
@@ -402,6 +490,14 @@ func (rc *Client) createTable(
 	if err != nil {
 		return CreatedTable{}, errors.Trace(err)
 	}
+	if created && newTableInfo.ID != createdID {
+		return CreatedTable{}, errors.Annotatef(berrors.ErrRestoreTableIDMismatch,
+			"table %s.%s is recreated after the checkpoint, the ID in checkpoint is %d, but the current ID is %d",
+			table.DB.Name, table.Info.Name, createdID, newTableInfo.ID)
+	}
+	if err = rc.checkpointer.tableCreated(ctx, table.Info.ID, newTableInfo.ID); err != nil {
+		return CreatedTable{}, errors.Trace(err)
+	}
 	rules := GetRewriteRules(newTableInfo, table.Info, newTS)
 	et := CreatedTable{
 		RewriteRule: rules,
@@ -424,13 +520,19 @@ func (rc *Client) GoCreateTables(
 ) <-chan CreatedTable {
 	// Could we have a smaller size of tables?
 	log.Info("start create tables")
+	span, ctx := trace.StartSpan(ctx, "Client.GoCreateTables")
+	span.SetTag("tables", len(tables))
 	outCh := make(chan CreatedTable, len(tables))
-	createOneTable := func(c context.Context, db *DB, t *utils.Table) error {
+	createOneTable := func(c context.Context, db *DB, t *utils.Table) (err error) {
 		select {
 		case <-c.Done():
 			return c.Err()
 		default:
 		}
+		tableSpan, c := trace.StartSpan(c, "Client.createTable")
+		tableSpan.SetTag("db", t.DB.Name.O)
+		tableSpan.SetTag("table", t.Info.Name.O)
+		defer func() { trace.FinishSpan(tableSpan, err) }()
 		rt, err := rc.createTable(c, db, dom, t, newTS)
 		if err != nil {
 			log.Error("create table failed",
@@ -450,6 +552,7 @@ func (rc *Client) GoCreateTables(
 		defer close(outCh)
 		defer log.Debug("all tables are created")
 		var err error
+		defer func() { trace.FinishSpan(span, err) }()
 		if len(dbPool) > 0 {
 			err = rc.createTablesWithDBPool(ctx, createOneTable, tables, dbPool)
 		} else {
@@ -509,22 +612,33 @@ func (rc *Client) ExecDDLs(ctx context.Context, ddlJobs []*model.Job) error {
 }
 
 func (rc *Client) setSpeedLimit(ctx context.Context) error {
-	if !rc.hasSpeedLimited && rc.rateLimit != 0 {
-		stores, err := conn.GetAllTiKVStores(ctx, rc.pdClient, conn.SkipTiFlash)
-		if err != nil {
+	rc.speedLimitMu.Lock()
+	defer rc.speedLimitMu.Unlock()
+	if rateLimit := rc.RateLimit(); !rc.hasSpeedLimited && rateLimit != 0 {
+		if err := rc.pushSpeedLimit(ctx, rateLimit); err != nil {
 			return errors.Trace(err)
 		}
-		for _, store := range stores {
-			err = rc.fileImporter.setDownloadSpeedLimit(ctx, store.GetId())
-			if err != nil {
-				return errors.Trace(err)
-			}
-		}
 		rc.hasSpeedLimited = true
 	}
 	return nil
 }
 
+// pushSpeedLimit sets the download speed limit of all TiKV stores, zero means
+// unlimited.
+func (rc *Client) pushSpeedLimit(ctx context.Context, rateLimit uint64) error {
+	stores, err := conn.GetAllTiKVStores(ctx, rc.pdClient, conn.SkipTiFlash)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, store := range stores {
+		err = rc.fileImporter.setDownloadSpeedLimit(ctx, store.GetId(), rateLimit)
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
 // RestoreFiles tries to restore the files.
 func (rc *Client) RestoreFiles(
 	ctx context.Context,
@@ -549,9 +663,10 @@ func (rc *Client) RestoreFiles(
 		return errors.Trace(err)
 	}
 
+	var applyErr error
 	for _, file := range files {
 		fileReplica := file
-		rc.workerPool.ApplyOnErrorGroup(eg,
+		applyErr = rc.workerPool.ApplyOnErrorGroupContext(ectx, eg,
 			func() error {
 				fileStart := time.Now()
 				defer func() {
@@ -561,8 +676,14 @@ func (rc *Client) RestoreFiles(
 				}()
 				return rc.fileImporter.Import(ectx, fileReplica, rewriteRules)
 			})
+		if applyErr != nil {
+			break
+		}
 	}
-	if err := eg.Wait(); err != nil {
+	if err := eg.Wait(); err != nil || applyErr != nil {
+		if err == nil {
+			err = applyErr
+		}
 		summary.CollectFailureUnit("file", err)
 		log.Error(
 			"restore files failed",
@@ -594,15 +715,22 @@ func (rc *Client) RestoreRaw(
 		return errors.Trace(err)
 	}
 
+	var applyErr error
 	for _, file := range files {
 		fileReplica := file
-		rc.workerPool.ApplyOnErrorGroup(eg,
+		applyErr = rc.workerPool.ApplyOnErrorGroupContext(ectx, eg,
 			func() error {
 				defer updateCh.Inc()
 				return rc.fileImporter.Import(ectx, fileReplica, EmptyRewriteRule())
 			})
+		if applyErr != nil {
+			break
+		}
 	}
-	if err := eg.Wait(); err != nil {
+	if err := eg.Wait(); err != nil || applyErr != nil {
+		if err == nil {
+			err = applyErr
+		}
 		log.Error(
 			"restore raw range failed",
 			logutil.Key("startKey", startKey),
@@ -621,6 +749,9 @@ func (rc *Client) RestoreRaw(
 
 // SwitchToImportMode switch tikv cluster to import mode.
 func (rc *Client) SwitchToImportMode(ctx context.Context) {
+	rc.switchMu.Lock()
+	rc.importMode = true
+	rc.switchMu.Unlock()
 	// tikv automatically switch to normal mode in every 10 minutes
 	// so we need ping tikv in less than 10 minute
 	go func() {
@@ -629,10 +760,7 @@ func (rc *Client) SwitchToImportMode(ctx context.Context) {
 
 		// [important!] switch tikv mode into import at the beginning
 		log.Info("switch to import mode at beginning")
-		err := rc.switchTiKVMode(ctx, import_sstpb.SwitchMode_Import)
-		if err != nil {
-			log.Warn("switch to import mode failed", zap.Error(err))
-		}
+		rc.keepImportMode(ctx)
 
 		for {
 			select {
@@ -640,10 +768,7 @@ func (rc *Client) SwitchToImportMode(ctx context.Context) {
 				return
 			case <-tick.C:
 				log.Info("switch to import mode")
-				err := rc.switchTiKVMode(ctx, import_sstpb.SwitchMode_Import)
-				if err != nil {
-					log.Warn("switch to import mode failed", zap.Error(err))
-				}
+				rc.keepImportMode(ctx)
 			case <-rc.switchCh:
 				log.Info("stop automatic switch to import mode")
 				return
@@ -652,8 +777,43 @@ func (rc *Client) SwitchToImportMode(ctx context.Context) {
 	}()
 }
 
+func (rc *Client) keepImportMode(ctx context.Context) {
+	rc.switchMu.Lock()
+	defer rc.switchMu.Unlock()
+	if !rc.importMode || rc.holdNormalMode {
+		return
+	}
+	if err := rc.switchTiKVMode(ctx, import_sstpb.SwitchMode_Import); err != nil {
+		log.Warn("switch to import mode failed", zap.Error(err))
+	}
+}
+
+// HoldNormalMode switches the tikv cluster to normal mode and stops keeping it
+// in import mode if hold is true, and switches it back to import mode if hold
+// is false. It does nothing unless SwitchToImportMode is called.
+func (rc *Client) HoldNormalMode(ctx context.Context, hold bool) error {
+	rc.switchMu.Lock()
+	defer rc.switchMu.Unlock()
+	if rc.holdNormalMode == hold {
+		return nil
+	}
+	rc.holdNormalMode = hold
+	if !rc.importMode {
+		return nil
+	}
+	if hold {
+		log.Info("hold normal mode")
+		return errors.Trace(rc.switchTiKVMode(ctx, import_sstpb.SwitchMode_Normal))
+	}
+	log.Info("switch back to import mode")
+	return errors.Trace(rc.switchTiKVMode(ctx, import_sstpb.SwitchMode_Import))
+}
+
 // SwitchToNormalMode switch tikv cluster to normal mode.
 func (rc *Client) SwitchToNormalMode(ctx context.Context) error {
+	rc.switchMu.Lock()
+	defer rc.switchMu.Unlock()
+	rc.importMode = false
 	close(rc.switchCh)
 	return rc.switchTiKVMode(ctx, import_sstpb.SwitchMode_Normal)
 }
@@ -700,17 +860,16 @@ func (rc *Client) switchTiKVMode(ctx context.Context, mode import_sstpb.SwitchMo
 }
 
 // GoValidateChecksum forks a goroutine to validate checksum after restore.
-// it returns a channel fires a struct{} when all things get done.
+// it returns a channel of the tables whose checksum are validated.
 func (rc *Client) GoValidateChecksum(
 	ctx context.Context,
 	tableStream <-chan CreatedTable,
 	kvClient kv.Client,
 	errCh chan<- error,
 	updateCh glue.Progress,
-	concurrency uint,
-) <-chan struct{} {
+) <-chan CreatedTable {
 	log.Info("Start to validate checksum")
-	outCh := make(chan struct{}, 1)
+	outCh := make(chan CreatedTable, defaultChannelSize)
 	workers := utils.NewWorkerPool(defaultChecksumConcurrency, "RestoreChecksum")
 	go func() {
 		start := time.Now()
@@ -723,7 +882,6 @@ func (rc *Client) GoValidateChecksum(
 			elapsed := time.Since(start)
 			summary.CollectDuration("restore checksum", elapsed)
 			summary.CollectSuccessUnit("table checksum", 1, elapsed)
-			outCh <- struct{}{}
 			close(outCh)
 		}()
 		for {
@@ -736,11 +894,22 @@ func (rc *Client) GoValidateChecksum(
 					return
 				}
 				workers.ApplyOnErrorGroup(wg, func() error {
-					err := rc.execChecksum(ectx, tbl, kvClient, concurrency)
-					if err != nil {
-						return errors.Trace(err)
+					if rc.checkpointer.isChecksumPassed(tbl.OldTable.Info.ID) {
+						log.Info("skip checksum passed before checkpoint",
+							zap.Stringer("table", tbl.OldTable.Info.Name))
+					} else {
+						err := rc.execChecksum(ectx, tbl, kvClient, rc.ChecksumConcurrency())
+						if err != nil {
+							return errors.Trace(err)
+						}
+						rc.checkpointer.checksumPassed(tbl.OldTable.Info.ID)
 					}
 					updateCh.Inc()
+					select {
+					case <-ectx.Done():
+						return ectx.Err()
+					case outCh <- tbl:
+					}
 					return nil
 				})
 			}
@@ -749,17 +918,25 @@ func (rc *Client) GoValidateChecksum(
 	return outCh
 }
 
-func (rc *Client) execChecksum(ctx context.Context, tbl CreatedTable, kvClient kv.Client, concurrency uint) error {
+func (rc *Client) execChecksum(ctx context.Context, tbl CreatedTable, kvClient kv.Client, concurrency uint) (err error) {
 	logger := log.With(
 		zap.String("db", tbl.OldTable.DB.Name.O),
 		zap.String("table", tbl.OldTable.Info.Name.O),
 	)
+	span, ctx := trace.StartSpan(ctx, "Client.execChecksum")
+	span.SetTag("db", tbl.OldTable.DB.Name.O)
+	span.SetTag("table", tbl.OldTable.Info.Name.O)
+	defer func() { trace.FinishSpan(span, err) }()
 
 	if tbl.OldTable.NoChecksum() {
 		logger.Warn("table has no checksum, skipping checksum")
 		return nil
 	}
 
+	start := time.Now()
+	defer func() {
+		restoreChecksumHistogram.Observe(time.Since(start).Seconds())
+	}()
 	startTS, err := rc.GetTS(ctx)
 	if err != nil {
 		return errors.Trace(err)
@@ -792,55 +969,105 @@ func (rc *Client) execChecksum(ctx context.Context, tbl CreatedTable, kvClient k
 		)
 		return errors.Annotate(berrors.ErrRestoreChecksumMismatch, "failed to validate checksum")
 	}
-	if table.Stats != nil {
-		logger.Info("start loads analyze after validate checksum",
-			zap.Int64("old id", tbl.OldTable.Info.ID),
-			zap.Int64("new id", tbl.Table.ID),
-		)
-		if err := rc.statsHandler.LoadStatsFromJSON(rc.dom.InfoSchema(), table.Stats); err != nil {
-			logger.Error("analyze table failed", zap.Any("table", table.Stats), zap.Error(err))
-		}
-	}
 	return nil
 }
 
 const (
 	restoreLabelKey   = "exclusive"
 	restoreLabelValue = "restore"
+
+	placementScheduleCheckInterval = 10 * time.Second
 )
 
-// LoadRestoreStores loads the stores used to restore data.
+// SetOnlineStores sets the number of the stores which BR labels for online
+// restore. If it is zero, the stores labelled manually are used.
+func (rc *Client) SetOnlineStores(n int) {
+	rc.onlineStores = n
+}
+
+// SetOnlineRecorder sets the recorder of the store labels and the placement
+// rules set by online restore.
+func (rc *Client) SetOnlineRecorder(r *OnlineRecorder) {
+	rc.onlineRecorder = r
+}
+
+// SetPlacementProgress sets the function to start the progress of waiting
+// the placement schedule. The total of the progress is the number of the
+// regions to move to the restore stores.
+func (rc *Client) SetPlacementProgress(start func(total int64) glue.Progress) {
+	rc.placementProgress = start
+}
+
+// LoadRestoreStores loads the stores used to restore data. If the number of
+// the online stores is set, BR chooses the stores and labels them, otherwise
+// the stores labelled manually are used.
 func (rc *Client) LoadRestoreStores(ctx context.Context) error {
 	if !rc.isOnline {
 		return nil
 	}
 
-	stores, err := rc.pdClient.GetAllStores(ctx)
+	stores, err := conn.GetAllTiKVStores(ctx, rc.pdClient, conn.SkipTiFlash)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	var unlabelled []uint64
 	for _, s := range stores {
 		if s.GetState() != metapb.StoreState_Up {
 			continue
 		}
+		labelled := false
 		for _, l := range s.GetLabels() {
 			if l.GetKey() == restoreLabelKey && l.GetValue() == restoreLabelValue {
-				rc.restoreStores = append(rc.restoreStores, s.GetId())
+				labelled = true
 				break
 			}
 		}
+		if labelled {
+			rc.restoreStores = append(rc.restoreStores, s.GetId())
+		} else {
+			unlabelled = append(unlabelled, s.GetId())
+		}
+	}
+
+	if rc.onlineStores > len(rc.restoreStores) {
+		need := rc.onlineStores - len(rc.restoreStores)
+		if need > len(unlabelled) {
+			return errors.Annotatef(berrors.ErrInvalidArgument,
+				"cannot choose %d stores for online restore, there are only %d up TiKV stores",
+				rc.onlineStores, len(rc.restoreStores)+len(unlabelled))
+		}
+		sort.Slice(unlabelled, func(i, j int) bool { return unlabelled[i] < unlabelled[j] })
+		chosen := unlabelled[:need]
+		// record the stores first, so they can be cleaned up if BR exits
+		// before the labels are reset.
+		if err = rc.onlineRecorder.AddStores(ctx, chosen); err != nil {
+			return errors.Trace(err)
+		}
+		if err = rc.toolClient.SetStoresLabel(ctx, chosen, restoreLabelKey, restoreLabelValue); err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("label restore stores", zap.Uint64s("store-ids", chosen))
+		rc.restoreStores = append(rc.restoreStores, chosen...)
 	}
 	log.Info("load restore stores", zap.Uint64s("store-ids", rc.restoreStores))
 	return nil
 }
 
-// ResetRestoreLabels removes the exclusive labels of the restore stores.
+// ResetRestoreLabels removes the exclusive labels of the restore stores
+// labelled by BR. The stores labelled manually are kept.
 func (rc *Client) ResetRestoreLabels(ctx context.Context) error {
 	if !rc.isOnline {
 		return nil
 	}
-	log.Info("start reseting store labels")
-	return rc.toolClient.SetStoresLabel(ctx, rc.restoreStores, restoreLabelKey, "")
+	stores := rc.onlineRecorder.Stores()
+	if len(stores) == 0 {
+		return nil
+	}
+	log.Info("start reseting store labels", zap.Uint64s("store-ids", stores))
+	if err := rc.toolClient.SetStoresLabel(ctx, stores, restoreLabelKey, ""); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(rc.onlineRecorder.RemoveStores(ctx, stores))
 }
 
 // SetupPlacementRules sets rules for the tables' regions.
@@ -853,6 +1080,15 @@ func (rc *Client) SetupPlacementRules(ctx context.Context, tables []*model.Table
 	if err != nil {
 		return errors.Trace(err)
 	}
+	ruleIDs := make([]string, 0, len(tables))
+	for _, t := range tables {
+		ruleIDs = append(ruleIDs, rc.getRuleID(t.ID))
+	}
+	// record the rules first, so they can be cleaned up if BR exits before
+	// they are removed.
+	if err = rc.onlineRecorder.AddRules(ctx, ruleIDs); err != nil {
+		return errors.Trace(err)
+	}
 	rule.Index = 100
 	rule.Override = true
 	rule.LabelConstraints = append(rule.LabelConstraints, placement.LabelConstraint{
@@ -879,58 +1115,73 @@ func (rc *Client) WaitPlacementSchedule(ctx context.Context, tables []*model.Tab
 		return nil
 	}
 	log.Info("start waiting placement schedule")
-	ticker := time.NewTicker(time.Second * 10)
+	ticker := time.NewTicker(placementScheduleCheckInterval)
 	defer ticker.Stop()
+	var (
+		progress glue.Progress
+		reported int
+	)
+	defer func() {
+		if progress != nil {
+			progress.Close()
+		}
+	}()
 	for {
+		placed, total, err := rc.checkRegions(ctx, tables)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if progress == nil && rc.placementProgress != nil {
+			progress = rc.placementProgress(int64(total))
+		}
+		// the progress doesn't go back, even if some regions are moved out.
+		for ; progress != nil && reported < placed && reported < total; reported++ {
+			progress.Inc()
+		}
+		if placed == total {
+			log.Info("finish waiting placement schedule")
+			return nil
+		}
+		log.Info("placement schedule progress", zap.Int("placed regions", placed), zap.Int("total regions", total))
 		select {
 		case <-ticker.C:
-			ok, progress, err := rc.checkRegions(ctx, tables)
-			if err != nil {
-				return errors.Trace(err)
-			}
-			if ok {
-				log.Info("finish waiting placement schedule")
-				return nil
-			}
-			log.Info("placement schedule progress: " + progress)
 		case <-ctx.Done():
 			return ctx.Err()
 		}
 	}
 }
 
-func (rc *Client) checkRegions(ctx context.Context, tables []*model.TableInfo) (bool, string, error) {
-	for i, t := range tables {
+// checkRegions returns the number of the regions of the tables whose peers
+// are all in the restore stores, and the number of all regions of the tables.
+func (rc *Client) checkRegions(ctx context.Context, tables []*model.TableInfo) (placed, total int, err error) {
+	for _, t := range tables {
 		start := codec.EncodeBytes([]byte{}, tablecodec.EncodeTablePrefix(t.ID))
 		end := codec.EncodeBytes([]byte{}, tablecodec.EncodeTablePrefix(t.ID+1))
-		ok, regionProgress, err := rc.checkRange(ctx, start, end)
+		regions, err := rc.toolClient.ScanRegions(ctx, start, end, -1)
 		if err != nil {
-			return false, "", errors.Trace(err)
+			return 0, 0, errors.Trace(err)
 		}
-		if !ok {
-			return false, fmt.Sprintf("table %v/%v, %s", i, len(tables), regionProgress), nil
+		total += len(regions)
+		for _, r := range regions {
+			if rc.inRestoreStores(r) {
+				placed++
+			}
 		}
 	}
-	return true, "", nil
+	return placed, total, nil
 }
 
-func (rc *Client) checkRange(ctx context.Context, start, end []byte) (bool, string, error) {
-	regions, err := rc.toolClient.ScanRegions(ctx, start, end, -1)
-	if err != nil {
-		return false, "", errors.Trace(err)
-	}
-	for i, r := range regions {
-	NEXT_PEER:
-		for _, p := range r.Region.GetPeers() {
-			for _, storeID := range rc.restoreStores {
-				if p.GetStoreId() == storeID {
-					continue NEXT_PEER
-				}
+func (rc *Client) inRestoreStores(region *RegionInfo) bool {
+NEXT_PEER:
+	for _, p := range region.Region.GetPeers() {
+		for _, storeID := range rc.restoreStores {
+			if p.GetStoreId() == storeID {
+				continue NEXT_PEER
 			}
-			return false, fmt.Sprintf("region %v/%v", i, len(regions)), nil
 		}
+		return false
 	}
-	return true, "", nil
+	return true
 }
 
 // ResetPlacementRules removes placement rules for tables.
@@ -939,13 +1190,22 @@ func (rc *Client) ResetPlacementRules(ctx context.Context, tables []*model.Table
 		return nil
 	}
 	log.Info("start reseting placement rules")
-	var failedTables []int64
+	var (
+		failedTables []int64
+		deleted      []string
+	)
 	for _, t := range tables {
-		err := rc.toolClient.DeletePlacementRule(ctx, "pd", rc.getRuleID(t.ID))
+		ruleID := rc.getRuleID(t.ID)
+		err := rc.toolClient.DeletePlacementRule(ctx, "pd", ruleID)
 		if err != nil {
 			log.Info("failed to delete placement rule for table", zap.Int64("table-id", t.ID))
 			failedTables = append(failedTables, t.ID)
+			continue
 		}
+		deleted = append(deleted, ruleID)
+	}
+	if err := rc.onlineRecorder.RemoveRules(ctx, deleted); err != nil {
+		log.Warn("failed to update the online restore record", zap.Error(err))
 	}
 	if len(failedTables) > 0 {
 		return errors.Annotatef(berrors.ErrPDInvalidResponse, "failed to delete placement rules for tables %v", failedTables)
@@ -3,6 +3,7 @@
 package restore_test
 
 import (
+	"context"
 	"math"
 	"strconv"
 	"time"
@@ -12,6 +13,7 @@ import (
 	"github.com/DigitalChinaOpenSource/DCParser/mysql"
 	"github.com/DigitalChinaOpenSource/DCParser/types"
 	"github.com/pingcap/tidb/tablecodec"
+	"github.com/pingcap/tidb/util/testkit"
 	"github.com/pingcap/tidb/util/testleak"
 	"google.golang.org/grpc/keepalive"
 
@@ -110,3 +112,170 @@ func (s *testRestoreClientSuite) TestIsOnline(c *C) {
 	client.EnableOnline()
 	c.Assert(client.IsOnline(), IsTrue)
 }
+
+func (s *testRestoreClientSuite) TestPlanRestore(c *C) {
+	c.Assert(s.mock.Start(), IsNil)
+	defer s.mock.Stop()
+	client, err := restore.NewRestoreClient(gluetidb.New(), s.mock.PDClient, s.mock.Storage, nil, defaultKeepaliveCfg)
+	c.Assert(err, IsNil)
+	client.SetRateLimit(10)
+
+	info, err := s.mock.Domain.GetSnapshotInfoSchema(math.MaxUint64)
+	c.Assert(err, IsNil)
+	dbSchema, isExist := info.SchemaByName(model.NewCIStr("test"))
+	c.Assert(isExist, IsTrue)
+	intField := types.NewFieldType(mysql.TypeLong)
+	intField.Charset = "binary"
+	newTable := func(id int64, name string) *model.TableInfo {
+		return &model.TableInfo{
+			ID:   id,
+			Name: model.NewCIStr(name),
+			Columns: []*model.ColumnInfo{{
+				ID:        1,
+				Name:      model.NewCIStr("id"),
+				FieldType: *intField,
+				State:     model.StatePublic,
+			}},
+			Charset: "utf8mb4",
+			Collate: "utf8mb4_bin",
+		}
+	}
+	existing := &utils.Table{DB: dbSchema, Info: newTable(1, "plan_exists"), TotalKvs: 10, TotalBytes: 100}
+	_, _, err = client.CreateTables(s.mock.Domain, []*utils.Table{existing}, 0)
+	c.Assert(err, IsNil)
+
+	newDB := &model.DBInfo{ID: 100, Name: model.NewCIStr("plan_db")}
+	tables := []*utils.Table{
+		existing,
+		{DB: newDB, Info: newTable(2, "plan_new"), TotalKvs: 5, TotalBytes: 50},
+	}
+	dbs := []*utils.Database{
+		{Info: dbSchema, Tables: tables[:1]},
+		{Info: newDB, Tables: tables[1:]},
+	}
+	ddlJobs := []*model.Job{{
+		Type:       model.ActionAddColumn,
+		SchemaName: "test",
+		Query:      "alter table plan_exists add column b int",
+		BinlogInfo: &model.HistoryInfo{SchemaVersion: 7},
+	}}
+	plan, err := client.PlanRestore(context.Background(), s.mock.Domain, dbs, tables, ddlJobs, nil)
+	c.Assert(err, IsNil)
+	c.Assert(plan.NewDatabases, DeepEquals, []string{"plan_db"})
+	c.Assert(plan.ExistingDatabases, DeepEquals, []string{"test"})
+	c.Assert(plan.NewTables, DeepEquals, []string{"`plan_db`.`plan_new`"})
+	c.Assert(plan.ExistingTables, DeepEquals, []string{"`test`.`plan_exists`"})
+	c.Assert(plan.DDLJobs, DeepEquals, []restore.PlanDDLJob{{
+		Schema:        "test",
+		Type:          model.ActionAddColumn.String(),
+		Query:         "alter table plan_exists add column b int",
+		SchemaVersion: 7,
+	}})
+	c.Assert(plan.TotalKvs, Equals, uint64(15))
+	c.Assert(plan.TotalBytes, Equals, uint64(150))
+	c.Assert(plan.SplitKeys, Equals, 0)
+	c.Assert(plan.Stores, Equals, 1)
+	c.Assert(plan.ETA, Equals, "15s")
+}
+
+func (s *testRestoreClientSuite) TestResolveExistingTables(c *C) {
+	c.Assert(s.mock.Start(), IsNil)
+	defer s.mock.Stop()
+	client, err := restore.NewRestoreClient(gluetidb.New(), s.mock.PDClient, s.mock.Storage, nil, defaultKeepaliveCfg)
+	c.Assert(err, IsNil)
+	ctx := context.Background()
+
+	tk := testkit.NewTestKit(c, s.mock.Storage)
+	tk.MustExec("use test")
+	tk.MustExec("create table on_existing (id int primary key, v varchar(10), key idx_v (v))")
+	getTable := func() (*model.TableInfo, error) {
+		t, err := s.mock.Domain.InfoSchema().TableByName(model.NewCIStr("test"), model.NewCIStr("on_existing"))
+		if err != nil {
+			return nil, err
+		}
+		return t.Meta(), nil
+	}
+	info, err := getTable()
+	c.Assert(err, IsNil)
+	dbSchema, isExist := s.mock.Domain.InfoSchema().SchemaByName(model.NewCIStr("test"))
+	c.Assert(isExist, IsTrue)
+	tables := []*utils.Table{{DB: dbSchema, Info: info.Clone()}}
+
+	_, err = client.ResolveExistingTables(ctx, s.mock.Domain, tables, restore.OnExistingError)
+	c.Assert(err, ErrorMatches, ".*table already exists.*")
+	resolved, err := client.ResolveExistingTables(ctx, s.mock.Domain, tables, restore.OnExistingSkip)
+	c.Assert(err, IsNil)
+	c.Assert(resolved, HasLen, 0)
+	resolved, err = client.ResolveExistingTables(ctx, s.mock.Domain, tables, restore.OnExistingAppend)
+	c.Assert(err, IsNil)
+	c.Assert(resolved, DeepEquals, tables)
+
+	tk.MustExec("insert into on_existing values (1, 'a')")
+	_, err = client.ResolveExistingTables(ctx, s.mock.Domain, tables, restore.OnExistingAppend)
+	c.Assert(err, ErrorMatches, ".*is not empty.*")
+
+	// no table is truncated if the policy fails on any table.
+	tk.MustExec("create table on_existing_other (id int primary key)")
+	other := info.Clone()
+	other.Name = model.NewCIStr("on_existing_other")
+	_, err = client.ResolveExistingTables(ctx, s.mock.Domain,
+		append(tables, &utils.Table{DB: dbSchema, Info: other}), restore.OnExistingTruncate)
+	c.Assert(err, ErrorMatches, ".*columns in the backup.*")
+	tk.MustQuery("select count(*) from on_existing").Check(testkit.Rows("1"))
+
+	resolved, err = client.ResolveExistingTables(ctx, s.mock.Domain, tables, restore.OnExistingTruncate)
+	c.Assert(err, IsNil)
+	c.Assert(resolved, DeepEquals, tables)
+	tk.MustQuery("select count(*) from on_existing").Check(testkit.Rows("0"))
+	truncated, err := getTable()
+	c.Assert(err, IsNil)
+	c.Assert(truncated.ID, Not(Equals), info.ID)
+
+	resolved, err = client.ResolveExistingTables(ctx, s.mock.Domain, tables, restore.OnExistingReplace)
+	c.Assert(err, IsNil)
+	c.Assert(resolved, DeepEquals, tables)
+	_, err = getTable()
+	c.Assert(err, NotNil)
+}
+
+func (s *testRestoreClientSuite) TestCheckTableCompatible(c *C) {
+	intField := types.NewFieldType(mysql.TypeLong)
+	newTable := func() *model.TableInfo {
+		return &model.TableInfo{
+			ID:   1,
+			Name: model.NewCIStr("t"),
+			Columns: []*model.ColumnInfo{
+				{ID: 1, Name: model.NewCIStr("a"), FieldType: *intField, State: model.StatePublic},
+				{ID: 2, Name: model.NewCIStr("b"), FieldType: *intField, State: model.StatePublic},
+			},
+			Indices: []*model.IndexInfo{{
+				ID:      1,
+				Name:    model.NewCIStr("idx_b"),
+				Columns: []*model.IndexColumn{{Name: model.NewCIStr("b"), Offset: 1, Length: types.UnspecifiedLength}},
+			}},
+		}
+	}
+	existing := newTable()
+	existing.ID = 10
+	existing.Indices[0].ID = 3
+	c.Assert(restore.CheckTableCompatible(newTable(), existing), IsNil)
+
+	for _, modify := range []func(*model.TableInfo){
+		func(t *model.TableInfo) { t.Columns = t.Columns[:1] },
+		func(t *model.TableInfo) { t.Columns[1].ID = 3 },
+		func(t *model.TableInfo) { t.Columns[1].Name = model.NewCIStr("c") },
+		func(t *model.TableInfo) { t.Columns[1].Tp = mysql.TypeLonglong },
+		func(t *model.TableInfo) { t.Columns[1].Flag |= mysql.UnsignedFlag },
+		func(t *model.TableInfo) { t.PKIsHandle = true },
+		func(t *model.TableInfo) { t.Indices[0].Unique = true },
+		func(t *model.TableInfo) { t.Indices[0].Columns[0].Name = model.NewCIStr("a") },
+		func(t *model.TableInfo) { t.Indices = nil },
+		func(t *model.TableInfo) {
+			t.Partition = &model.PartitionInfo{Definitions: []model.PartitionDefinition{{ID: 2, Name: model.NewCIStr("p0")}}}
+		},
+	} {
+		backupInfo := newTable()
+		modify(backupInfo)
+		c.Assert(restore.CheckTableCompatible(backupInfo, existing), ErrorMatches, ".*incompatible schema.*")
+	}
+}
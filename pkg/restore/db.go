@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"strings"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
@@ -201,6 +202,70 @@ func (db *DB) CreateTable(ctx context.Context, table *utils.Table) error {
 	return errors.Trace(err)
 }
 
+// AnalyzeTable executes an ANALYZE TABLE SQL.
+func (db *DB) AnalyzeTable(ctx context.Context, dbName, tableName model.CIStr) error {
+	analyzeSQL := fmt.Sprintf("analyze table %s.%s;",
+		utils.EncloseName(dbName.O), utils.EncloseName(tableName.O))
+	err := db.se.Execute(ctx, analyzeSQL)
+	if err != nil {
+		log.Error("analyze table failed",
+			zap.String("query", analyzeSQL),
+			zap.Error(err))
+	}
+	return errors.Trace(err)
+}
+
+// SetTiFlashReplica executes an ALTER TABLE SET TIFLASH REPLICA SQL.
+func (db *DB) SetTiFlashReplica(
+	ctx context.Context,
+	dbName, tableName model.CIStr,
+	count uint64,
+	labels []string,
+) error {
+	replicaSQL := fmt.Sprintf("alter table %s.%s set tiflash replica %d",
+		utils.EncloseName(dbName.O), utils.EncloseName(tableName.O), count)
+	if len(labels) > 0 {
+		quoted := make([]string, 0, len(labels))
+		for _, label := range labels {
+			quoted = append(quoted, "'"+strings.ReplaceAll(label, "'", "''")+"'")
+		}
+		replicaSQL += " location labels " + strings.Join(quoted, ", ")
+	}
+	err := db.se.Execute(ctx, replicaSQL)
+	if err != nil {
+		log.Error("set tiflash replica failed",
+			zap.String("query", replicaSQL),
+			zap.Error(err))
+	}
+	return errors.Trace(err)
+}
+
+// TruncateTable executes a TRUNCATE TABLE SQL.
+func (db *DB) TruncateTable(ctx context.Context, dbName, tableName model.CIStr) error {
+	truncateSQL := fmt.Sprintf("truncate table %s.%s;",
+		utils.EncloseName(dbName.O), utils.EncloseName(tableName.O))
+	err := db.se.Execute(ctx, truncateSQL)
+	if err != nil {
+		log.Error("truncate table failed",
+			zap.String("query", truncateSQL),
+			zap.Error(err))
+	}
+	return errors.Trace(err)
+}
+
+// DropTable executes a DROP TABLE SQL.
+func (db *DB) DropTable(ctx context.Context, dbName, tableName model.CIStr) error {
+	dropSQL := fmt.Sprintf("drop table %s.%s;",
+		utils.EncloseName(dbName.O), utils.EncloseName(tableName.O))
+	err := db.se.Execute(ctx, dropSQL)
+	if err != nil {
+		log.Error("drop table failed",
+			zap.String("query", dropSQL),
+			zap.Error(err))
+	}
+	return errors.Trace(err)
+}
+
 // Close closes the connection.
 func (db *DB) Close() {
 	db.se.Close()
@@ -0,0 +1,245 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"context"
+
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	"github.com/DigitalChinaOpenSource/DCParser/mysql"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/domain"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/tablecodec"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// OnExisting is the policy to restore a table which already exists.
+type OnExisting string
+
+const (
+	// OnExistingError fails the restore.
+	OnExistingError OnExisting = "error"
+	// OnExistingSkip doesn't restore the table.
+	OnExistingSkip OnExisting = "skip"
+	// OnExistingTruncate truncates the table and restores into it.
+	OnExistingTruncate OnExisting = "truncate"
+	// OnExistingReplace drops the table and creates it from the backup.
+	OnExistingReplace OnExisting = "replace"
+	// OnExistingAppend restores into the table. The table must be empty
+	// unless the backup is incremental.
+	OnExistingAppend OnExisting = "append"
+)
+
+// ParseOnExisting parses the policy to restore the existing tables.
+func ParseOnExisting(s string) (OnExisting, error) {
+	switch policy := OnExisting(s); policy {
+	case OnExistingError, OnExistingSkip, OnExistingTruncate, OnExistingReplace, OnExistingAppend:
+		return policy, nil
+	default:
+		return "", errors.Annotatef(berrors.ErrInvalidArgument,
+			"invalid policy %q for the existing tables, it should be one of error, skip, truncate, replace and append", s)
+	}
+}
+
+// ResolveExistingTables applies the policy to the tables which already exist
+// in the cluster, and returns the tables to restore. The tables created by
+// this restore before the checkpoint are not treated as existing.
+// The schemas of the tables to truncate or append are checked against the
+// backup, the tables to replace are dropped and created later like the new
+// tables, and the tables to skip are removed from the result.
+// All tables are checked before any of them is truncated or dropped, so the
+// cluster is not changed if the policy fails on any table. It must be called
+// before executing the DDLs and creating the databases.
+func (rc *Client) ResolveExistingTables(
+	ctx context.Context,
+	dom *domain.Domain,
+	tables []*utils.Table,
+	policy OnExisting,
+) ([]*utils.Table, error) {
+	is := dom.InfoSchema()
+	result := make([]*utils.Table, 0, len(tables))
+	var toTruncate, toDrop []*utils.Table
+	for _, table := range tables {
+		existing, err := is.TableByName(table.DB.Name, table.Info.Name)
+		if err != nil {
+			// the table doesn't exist.
+			result = append(result, table)
+			continue
+		}
+		info := existing.Meta()
+		if createdID, created := rc.checkpointer.createdTable(table.Info.ID); created && createdID == info.ID {
+			result = append(result, table)
+			continue
+		}
+
+		log.Info("table already exists",
+			zap.Stringer("db", table.DB.Name),
+			zap.Stringer("table", table.Info.Name),
+			zap.String("policy", string(policy)))
+		switch policy {
+		case OnExistingSkip:
+			continue
+		case OnExistingTruncate:
+			if err = CheckTableCompatible(table.Info, info); err != nil {
+				return nil, errors.Trace(err)
+			}
+			toTruncate = append(toTruncate, table)
+		case OnExistingReplace:
+			if rc.IsSkipCreateSQL() {
+				return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+					"cannot replace table %s.%s without creating tables", table.DB.Name, table.Info.Name)
+			}
+			toDrop = append(toDrop, table)
+		case OnExistingAppend:
+			if err = CheckTableCompatible(table.Info, info); err != nil {
+				return nil, errors.Trace(err)
+			}
+			// the incremental backup is restored into the tables restored
+			// from the previous backups.
+			if !rc.IsIncremental() {
+				empty, err := isTableEmpty(dom.Store(), info)
+				if err != nil {
+					return nil, errors.Trace(err)
+				}
+				if !empty {
+					return nil, errors.Annotatef(berrors.ErrRestoreTableExists,
+						"table %s.%s is not empty", table.DB.Name, table.Info.Name)
+				}
+			}
+		default:
+			return nil, errors.Annotatef(berrors.ErrRestoreTableExists,
+				"table %s.%s", table.DB.Name, table.Info.Name)
+		}
+		result = append(result, table)
+	}
+
+	for _, table := range toTruncate {
+		if err := rc.db.TruncateTable(ctx, table.DB.Name, table.Info.Name); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	for _, table := range toDrop {
+		if err := rc.db.DropTable(ctx, table.DB.Name, table.Info.Name); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return result, nil
+}
+
+// CheckTableCompatible checks whether the data of the table in the backup can
+// be restored into the existing table. The columns must have the same IDs,
+// names and types, the indexes must have the same names and columns, and the
+// existing table must have all partitions of the backup.
+func CheckTableCompatible(backupInfo, existing *model.TableInfo) error {
+	incompatible := func(format string, args ...interface{}) error {
+		return errors.Annotatef(berrors.ErrRestoreSchemaIncompatible,
+			"table %s: "+format, append([]interface{}{existing.Name}, args...)...)
+	}
+
+	if len(backupInfo.Columns) != len(existing.Columns) {
+		return incompatible("%d columns in the backup, but %d columns exist",
+			len(backupInfo.Columns), len(existing.Columns))
+	}
+	for i, col := range backupInfo.Columns {
+		exCol := existing.Columns[i]
+		if col.Name.L != exCol.Name.L || col.ID != exCol.ID {
+			return incompatible("column %s (ID %d) in the backup, but column %s (ID %d) exists",
+				col.Name, col.ID, exCol.Name, exCol.ID)
+		}
+		if col.Tp != exCol.Tp || col.Flen != exCol.Flen || col.Decimal != exCol.Decimal ||
+			mysql.HasUnsignedFlag(col.Flag) != mysql.HasUnsignedFlag(exCol.Flag) {
+			return incompatible("column %s is %s in the backup, but %s exists",
+				col.Name, col.FieldType.String(), exCol.FieldType.String())
+		}
+	}
+	if backupInfo.PKIsHandle != existing.PKIsHandle {
+		return incompatible("the primary key is the handle in only one of the backup and the existing table")
+	}
+
+	exIndices := make(map[string]*model.IndexInfo, len(existing.Indices))
+	for _, idx := range existing.Indices {
+		exIndices[idx.Name.L] = idx
+	}
+	for _, idx := range backupInfo.Indices {
+		exIdx, ok := exIndices[idx.Name.L]
+		if !ok {
+			return incompatible("index %s doesn't exist", idx.Name)
+		}
+		if idx.Unique != exIdx.Unique || idx.Primary != exIdx.Primary || !sameIndexColumns(idx, exIdx) {
+			return incompatible("index %s is different from the backup", idx.Name)
+		}
+	}
+	if len(existing.Indices) != len(backupInfo.Indices) {
+		return incompatible("%d indexes in the backup, but %d indexes exist",
+			len(backupInfo.Indices), len(existing.Indices))
+	}
+
+	if backupInfo.Partition == nil {
+		if existing.Partition != nil {
+			return incompatible("the table is partitioned, but it isn't in the backup")
+		}
+		return nil
+	}
+	if existing.Partition == nil {
+		return incompatible("the table isn't partitioned, but it is in the backup")
+	}
+	exPartitions := make(map[string]struct{}, len(existing.Partition.Definitions))
+	for _, def := range existing.Partition.Definitions {
+		exPartitions[def.Name.L] = struct{}{}
+	}
+	for _, def := range backupInfo.Partition.Definitions {
+		if _, ok := exPartitions[def.Name.L]; !ok {
+			return incompatible("partition %s doesn't exist", def.Name)
+		}
+	}
+	return nil
+}
+
+func sameIndexColumns(a, b *model.IndexInfo) bool {
+	if len(a.Columns) != len(b.Columns) {
+		return false
+	}
+	for i := range a.Columns {
+		if a.Columns[i].Name.L != b.Columns[i].Name.L || a.Columns[i].Length != b.Columns[i].Length {
+			return false
+		}
+	}
+	return true
+}
+
+// isTableEmpty checks whether there is any key of the table and its partitions
+// by scanning at most one key of every physical table.
+func isTableEmpty(store kv.Storage, info *model.TableInfo) (bool, error) {
+	txn, err := store.Begin()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer func() {
+		_ = txn.Rollback()
+	}()
+
+	ids := []int64{info.ID}
+	if info.Partition != nil {
+		for _, def := range info.Partition.Definitions {
+			ids = append(ids, def.ID)
+		}
+	}
+	for _, id := range ids {
+		prefix := tablecodec.EncodeTablePrefix(id)
+		iter, err := txn.Iter(prefix, prefix.PrefixNext())
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		valid := iter.Valid()
+		iter.Close()
+		if valid {
+			return false, nil
+		}
+	}
+	return true, nil
+}
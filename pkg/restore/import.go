@@ -26,6 +26,7 @@ import (
 	berrors "github.com/Orion7r/pr/pkg/errors"
 	"github.com/Orion7r/pr/pkg/logutil"
 	"github.com/Orion7r/pr/pkg/summary"
+	"github.com/Orion7r/pr/pkg/trace"
 	"github.com/Orion7r/pr/pkg/utils"
 )
 
@@ -160,7 +161,6 @@ type FileImporter struct {
 	metaClient   SplitClient
 	importClient ImporterClient
 	backend      *backup.StorageBackend
-	rateLimit    uint64
 
 	isRawKvMode bool
 	rawStartKey []byte
@@ -173,14 +173,12 @@ func NewFileImporter(
 	importClient ImporterClient,
 	backend *backup.StorageBackend,
 	isRawKvMode bool,
-	rateLimit uint64,
 ) FileImporter {
 	return FileImporter{
 		metaClient:   metaClient,
 		backend:      backend,
 		importClient: importClient,
 		isRawKvMode:  isRawKvMode,
-		rateLimit:    rateLimit,
 	}
 }
 
@@ -219,7 +217,11 @@ func (importer *FileImporter) Import(
 		logutil.Key("startKey", startKey),
 		logutil.Key("endKey", endKey))
 
+	importAttempts := 0
 	err = utils.WithRetry(ctx, func() error {
+		if importAttempts++; importAttempts > 1 {
+			restoreImportRetryCounters.WithLabelValues("import").Inc()
+		}
 		tctx, cancel := context.WithTimeout(ctx, importScanRegionTime)
 		defer cancel()
 		// Scan regions covered by the file range
@@ -236,13 +238,19 @@ func (importer *FileImporter) Import(
 			info := regionInfo
 			// Try to download file.
 			var downloadMeta *import_sstpb.SSTMeta
+			downloadAttempts := 0
 			errDownload := utils.WithRetry(ctx, func() error {
+				if downloadAttempts++; downloadAttempts > 1 {
+					restoreImportRetryCounters.WithLabelValues("download").Inc()
+				}
+				start := time.Now()
 				var e error
 				if importer.isRawKvMode {
 					downloadMeta, e = importer.downloadRawKVSST(ctx, info, file)
 				} else {
 					downloadMeta, e = importer.downloadSST(ctx, info, file, rewriteRules)
 				}
+				restoreImportHistogram.WithLabelValues("download").Observe(time.Since(start).Seconds())
 				return e
 			}, newDownloadSSTBackoffer())
 			if errDownload != nil {
@@ -268,6 +276,7 @@ func (importer *FileImporter) Import(
 				return errors.Trace(errDownload)
 			}
 
+			ingestStart := time.Now()
 			ingestResp, errIngest := importer.ingestSST(ctx, downloadMeta, info)
 		ingestRetry:
 			for errIngest == nil {
@@ -299,6 +308,7 @@ func (importer *FileImporter) Import(
 							continue
 						}
 					}
+					restoreImportRetryCounters.WithLabelValues("ingest").Inc()
 					log.Debug("ingest sst returns not leader error, retry it",
 						logutil.Region(info.Region),
 						zap.Stringer("newLeader", newInfo.Leader))
@@ -324,6 +334,7 @@ func (importer *FileImporter) Import(
 				}
 			}
 
+			restoreImportHistogram.WithLabelValues("ingest").Observe(time.Since(ingestStart).Seconds())
 			if errIngest != nil {
 				log.Error("ingest file failed",
 					logutil.File(file),
@@ -335,14 +346,17 @@ func (importer *FileImporter) Import(
 		}
 		summary.CollectSuccessUnit(summary.TotalKV, 1, file.TotalKvs)
 		summary.CollectSuccessUnit(summary.TotalBytes, 1, file.TotalBytes)
+		restoreIngestCounters.WithLabelValues("files").Inc()
+		restoreIngestCounters.WithLabelValues("kvs").Add(float64(file.TotalKvs))
+		restoreIngestCounters.WithLabelValues("bytes").Add(float64(file.TotalBytes))
 		return nil
 	}, newImportSSTBackoffer())
 	return errors.Trace(err)
 }
 
-func (importer *FileImporter) setDownloadSpeedLimit(ctx context.Context, storeID uint64) error {
+func (importer *FileImporter) setDownloadSpeedLimit(ctx context.Context, storeID, rateLimit uint64) error {
 	req := &import_sstpb.SetDownloadSpeedLimitRequest{
-		SpeedLimit: importer.rateLimit,
+		SpeedLimit: rateLimit,
 	}
 	_, err := importer.importClient.SetDownloadSpeedLimit(ctx, storeID, req)
 	return errors.Trace(err)
@@ -353,7 +367,11 @@ func (importer *FileImporter) downloadSST(
 	regionInfo *RegionInfo,
 	file *backup.File,
 	rewriteRules *RewriteRules,
-) (*import_sstpb.SSTMeta, error) {
+) (_ *import_sstpb.SSTMeta, err error) {
+	span, ctx := trace.StartSpan(ctx, "FileImporter.downloadSST")
+	span.SetTag("file", file.GetName())
+	span.SetTag("region", regionInfo.Region.GetId())
+	defer func() { trace.FinishSpan(span, err) }()
 	uid := uuid.New()
 	id := uid[:]
 	// Assume one region reflects to one rewrite rule
@@ -455,7 +473,11 @@ func (importer *FileImporter) ingestSST(
 	ctx context.Context,
 	sstMeta *import_sstpb.SSTMeta,
 	regionInfo *RegionInfo,
-) (*import_sstpb.IngestResponse, error) {
+) (_ *import_sstpb.IngestResponse, err error) {
+	span, ctx := trace.StartSpan(ctx, "FileImporter.ingestSST")
+	span.SetTag("region", regionInfo.Region.GetId())
+	trace.SetRangeTags(span, sstMeta.GetRange().GetStart(), sstMeta.GetRange().GetEnd())
+	defer func() { trace.FinishSpan(span, err) }()
 	leader := regionInfo.Leader
 	if leader == nil {
 		leader = regionInfo.Region.GetPeers()[0]
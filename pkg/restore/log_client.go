@@ -65,6 +65,102 @@ type LogMeta struct {
 	GlobalResolvedTS uint64           `json:"global_resolved_ts"`
 }
 
+// ReadLogMeta reads the log.meta of the cdc log backup in the storage.
+func ReadLogMeta(ctx context.Context, s storage.ExternalStorage) (*LogMeta, error) {
+	data, err := s.Read(ctx, metaFile)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	meta := new(LogMeta)
+	if err = json.Unmarshal(data, meta); err != nil {
+		return nil, errors.Annotatef(err, "failed to parse %s", metaFile)
+	}
+	log.Info("get meta from storage", zap.Binary("data", data))
+	return meta, nil
+}
+
+// ReadLogStartTS reads the TS of the first event in the cdc log backup, it
+// is the earliest commit ts of the DDL files and the first row change file
+// of the tables in the meta. It returns 0 if the log backup has no events.
+func ReadLogStartTS(ctx context.Context, s storage.ExternalStorage, meta *LogMeta) (uint64, error) {
+	startTS := uint64(0)
+	update := func(ts uint64) {
+		if startTS == 0 || ts < startTS {
+			startTS = ts
+		}
+	}
+
+	err := s.WalkDir(ctx, &storage.WalkOption{SubDir: ddlEventsDir, ListCount: -1},
+		func(path string, size int64) error {
+			names := strings.Split(filepath.Base(path), ".")
+			if len(names) != 2 || names[0] != ddlFilePrefix {
+				return nil
+			}
+			ts, err := strconv.ParseUint(names[1], 10, 64)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			// the file name is maxUint64 - the first DDL event's commit ts.
+			update(maxUint64 - ts)
+			return nil
+		})
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	for tableID := range meta.Names {
+		// the file name is the last event's ts, so the first event is in the
+		// file with the smallest ts, or in the streaming file if it is the
+		// only one.
+		first, firstTS := "", uint64(0)
+		opt := &storage.WalkOption{SubDir: fmt.Sprintf("%s%d", tableLogPrefix, tableID), ListCount: -1}
+		err := s.WalkDir(ctx, opt, func(path string, size int64) error {
+			fileName := filepath.Base(path)
+			if fileName == logPrefix {
+				if first == "" {
+					first = path
+				}
+				return nil
+			}
+			names := strings.Split(fileName, ".")
+			if len(names) != 2 || names[0] != logPrefix {
+				return nil
+			}
+			ts, err := strconv.ParseUint(names[1], 10, 64)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if firstTS == 0 || ts < firstTS {
+				first, firstTS = path, ts
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if first == "" {
+			continue
+		}
+		data, err := s.Read(ctx, first)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		decoder, err := cdclog.NewJSONEventBatchDecoder(data)
+		if err != nil {
+			return 0, errors.Annotatef(err, "failed to decode %s", first)
+		}
+		if decoder == nil || !decoder.HasNext() {
+			continue
+		}
+		item, err := decoder.NextEvent(cdclog.RowChanged)
+		if err != nil {
+			return 0, errors.Annotatef(err, "failed to decode %s", first)
+		}
+		update(item.TS)
+	}
+	return startTS, nil
+}
+
 // LogClient sends requests to restore files.
 type LogClient struct {
 	// lock DDL execution
@@ -926,15 +1022,11 @@ func (l *LogClient) RestoreLogData(ctx context.Context, dom *domain.Domain) erro
 	// 3. Encode and ingest data to tikv
 
 	// parse meta file
-	data, err := l.restoreClient.storage.Read(ctx, metaFile)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	err = json.Unmarshal(data, l.meta)
+	meta, err := ReadLogMeta(ctx, l.restoreClient.storage)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	log.Info("get meta from storage", zap.Binary("data", data))
+	l.meta = meta
 
 	if l.startTS > l.meta.GlobalResolvedTS {
 		return errors.Annotatef(berrors.ErrRestoreRTsConstrain,
@@ -0,0 +1,69 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	restoreIngestCounters = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "br",
+			Subsystem: "restore",
+			Name:      "ingested_total",
+			Help:      "The files, bytes and kvs ingested.",
+		}, []string{"type"})
+
+	restoreSplitHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "br",
+			Subsystem: "restore",
+			Name:      "split_seconds",
+			Help:      "Split and scatter latency distributions of a batch of ranges.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 16),
+		}, []string{"type"})
+
+	restoreImportHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "br",
+			Subsystem: "restore",
+			Name:      "import_seconds",
+			Help:      "Download and ingest latency distributions of a file in a region.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 16),
+		}, []string{"type"})
+
+	restoreImportRetryCounters = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "br",
+			Subsystem: "restore",
+			Name:      "import_retry_total",
+			Help:      "The retries of importing files.",
+		}, []string{"type"})
+
+	restoreBatcherGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "br",
+			Subsystem: "restore",
+			Name:      "batcher_ranges",
+			Help:      "The ranges waiting in the batcher.",
+		})
+
+	restoreChecksumHistogram = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "br",
+			Subsystem: "restore",
+			Name:      "checksum_seconds",
+			Help:      "Checksum latency distributions of a table.",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 16),
+		})
+)
+
+func init() { // nolint:gochecknoinits
+	prometheus.MustRegister(restoreIngestCounters)
+	prometheus.MustRegister(restoreSplitHistogram)
+	prometheus.MustRegister(restoreImportHistogram)
+	prometheus.MustRegister(restoreImportRetryCounters)
+	prometheus.MustRegister(restoreBatcherGauge)
+	prometheus.MustRegister(restoreChecksumHistogram)
+}
@@ -0,0 +1,315 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/storage"
+)
+
+// OnlineRecord records the store labels and the placement rules set by an
+// online restore, so they can be removed if the restore exits unexpectedly.
+type OnlineRecord struct {
+	ClusterID uint64 `json:"cluster-id"`
+	// Stores are the stores labelled by BR, the stores labelled manually are
+	// not recorded.
+	Stores []uint64 `json:"stores"`
+	// Rules are the IDs of the placement rules in the "pd" group.
+	Rules []string `json:"rules"`
+	// LeaseExpireAt is renewed while the restore is running. The record is
+	// considered abandoned after the lease expires.
+	LeaseExpireAt time.Time `json:"lease-expire-at"`
+}
+
+// Expired checks whether the lease of the record expires.
+func (r *OnlineRecord) Expired(now time.Time) bool {
+	return now.After(r.LeaseExpireAt)
+}
+
+// IsEmpty checks whether there is nothing left to clean up.
+func (r *OnlineRecord) IsEmpty() bool {
+	return len(r.Stores) == 0 && len(r.Rules) == 0
+}
+
+// OnlineRecordName returns the file name of the online restore record of
+// the cluster.
+func OnlineRecordName(clusterID uint64) string {
+	return fmt.Sprintf("online-restore-%d.json", clusterID)
+}
+
+// LoadOnlineRecord loads the online restore record from the storage, it
+// returns nil if the record doesn't exist.
+func LoadOnlineRecord(ctx context.Context, s storage.ExternalStorage, name string) (*OnlineRecord, error) {
+	exists, err := s.FileExists(ctx, name)
+	if err != nil || !exists {
+		return nil, errors.Trace(err)
+	}
+	data, err := s.Read(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	record := &OnlineRecord{}
+	if err = json.Unmarshal(data, record); err != nil {
+		return nil, errors.Annotatef(err, "failed to parse the online restore record %s", name)
+	}
+	return record, nil
+}
+
+// CleanupOnlineRestore removes the store labels and the placement rules left
+// by an online restore, and removes the record after that. It fails if the
+// lease of the record doesn't expire, which means the restore may be still
+// running, unless force is set.
+func CleanupOnlineRestore(
+	ctx context.Context,
+	s storage.ExternalStorage,
+	name string,
+	client SplitClient,
+	force bool,
+) error {
+	record, err := LoadOnlineRecord(ctx, s, name)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if record == nil {
+		log.Info("no online restore record found", zap.String("name", name))
+		return nil
+	}
+	if !record.Expired(time.Now()) && !force {
+		return errors.Annotatef(berrors.ErrRestoreOnlineInProgress,
+			"the lease of the online restore record %s expires at %s", name, record.LeaseExpireAt)
+	}
+	if err = cleanupOnlineRecord(ctx, client, record); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.DeleteFile(ctx, name))
+}
+
+func cleanupOnlineRecord(ctx context.Context, client SplitClient, record *OnlineRecord) error {
+	log.Info("clean up online restore",
+		zap.Uint64s("stores", record.Stores),
+		zap.Strings("rules", record.Rules),
+		zap.Time("lease-expire-at", record.LeaseExpireAt))
+	var errs error
+	for _, ruleID := range record.Rules {
+		if err := client.DeletePlacementRule(ctx, "pd", ruleID); err != nil {
+			errs = multierr.Append(errs, errors.Annotatef(err, "failed to delete placement rule %s", ruleID))
+		}
+	}
+	if len(record.Stores) > 0 {
+		if err := client.SetStoresLabel(ctx, record.Stores, restoreLabelKey, ""); err != nil {
+			errs = multierr.Append(errs, errors.Annotatef(err, "failed to reset labels of stores %v", record.Stores))
+		}
+	}
+	return errs
+}
+
+// OnlineRecorder persists the online restore record of the running restore
+// and keeps its lease. The methods do nothing on a nil recorder.
+type OnlineRecorder struct {
+	storage storage.ExternalStorage
+	name    string
+	ttl     time.Duration
+
+	mu     sync.Mutex
+	record OnlineRecord
+	// finished is set by Finish, the record isn't written after that.
+	finished bool
+}
+
+// NewOnlineRecorder creates the online restore record of the cluster. The
+// record left by an abandoned restore is cleaned up first, and it fails if
+// the lease of the left record doesn't expire.
+func NewOnlineRecorder(
+	ctx context.Context,
+	s storage.ExternalStorage,
+	clusterID uint64,
+	ttl time.Duration,
+	client SplitClient,
+) (*OnlineRecorder, error) {
+	name := OnlineRecordName(clusterID)
+	if err := CleanupOnlineRestore(ctx, s, name, client, false); err != nil {
+		return nil, errors.Trace(err)
+	}
+	r := &OnlineRecorder{
+		storage: s,
+		name:    name,
+		ttl:     ttl,
+		record:  OnlineRecord{ClusterID: clusterID},
+	}
+	if err := r.save(ctx); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return r, nil
+}
+
+// save renews the lease and writes the record, the caller must hold the lock
+// or own the recorder exclusively.
+func (r *OnlineRecorder) save(ctx context.Context) error {
+	r.record.LeaseExpireAt = time.Now().Add(r.ttl)
+	data, err := json.Marshal(&r.record)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(r.storage.Write(ctx, r.name, data))
+}
+
+func (r *OnlineRecorder) update(ctx context.Context, f func(record *OnlineRecord)) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return nil
+	}
+	f(&r.record)
+	return r.save(ctx)
+}
+
+// AddStores records the stores before they are labelled.
+func (r *OnlineRecorder) AddStores(ctx context.Context, stores []uint64) error {
+	return r.update(ctx, func(record *OnlineRecord) {
+		record.Stores = mergeStores(record.Stores, stores)
+	})
+}
+
+// RemoveStores removes the stores whose labels are reset from the record.
+func (r *OnlineRecorder) RemoveStores(ctx context.Context, stores []uint64) error {
+	return r.update(ctx, func(record *OnlineRecord) {
+		record.Stores = removeStores(record.Stores, stores)
+	})
+}
+
+// Stores returns the stores labelled by BR.
+func (r *OnlineRecorder) Stores() []uint64 {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]uint64(nil), r.record.Stores...)
+}
+
+// AddRules records the placement rules before they are set.
+func (r *OnlineRecorder) AddRules(ctx context.Context, rules []string) error {
+	return r.update(ctx, func(record *OnlineRecord) {
+		record.Rules = mergeRules(record.Rules, rules)
+	})
+}
+
+// RemoveRules removes the deleted placement rules from the record.
+func (r *OnlineRecorder) RemoveRules(ctx context.Context, rules []string) error {
+	return r.update(ctx, func(record *OnlineRecord) {
+		record.Rules = removeRules(record.Rules, rules)
+	})
+}
+
+// Run renews the lease periodically until the context is done.
+func (r *OnlineRecorder) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.update(ctx, func(*OnlineRecord) {}); err != nil {
+				log.Warn("failed to renew the lease of the online restore record", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Finish removes the record if everything recorded is cleaned up. Otherwise
+// the record is kept for `br debug cleanup-online-restore`.
+func (r *OnlineRecorder) Finish(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finished = true
+	if !r.record.IsEmpty() {
+		log.Warn("online restore leaves store labels or placement rules, "+
+			"run `br debug cleanup-online-restore` to remove them",
+			zap.Uint64s("stores", r.record.Stores),
+			zap.Strings("rules", r.record.Rules))
+		return nil
+	}
+	return errors.Trace(r.storage.DeleteFile(ctx, r.name))
+}
+
+func mergeStores(stores, added []uint64) []uint64 {
+	merged := append([]uint64(nil), stores...)
+	for _, id := range added {
+		if !containsStore(merged, id) {
+			merged = append(merged, id)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i] < merged[j] })
+	return merged
+}
+
+func removeStores(stores, removed []uint64) []uint64 {
+	kept := make([]uint64, 0, len(stores))
+	for _, id := range stores {
+		if !containsStore(removed, id) {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+func containsStore(stores []uint64, id uint64) bool {
+	for _, s := range stores {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeRules(rules, added []string) []string {
+	set := make(map[string]struct{}, len(rules)+len(added))
+	for _, id := range rules {
+		set[id] = struct{}{}
+	}
+	for _, id := range added {
+		set[id] = struct{}{}
+	}
+	merged := make([]string, 0, len(set))
+	for id := range set {
+		merged = append(merged, id)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+func removeRules(rules, removed []string) []string {
+	set := make(map[string]struct{}, len(removed))
+	for _, id := range removed {
+		set[id] = struct{}{}
+	}
+	kept := make([]string, 0, len(rules))
+	for _, id := range rules {
+		if _, ok := set[id]; !ok {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,120 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/pingcap/check"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/restore"
+	"github.com/Orion7r/pr/pkg/storage"
+)
+
+var _ = Suite(&testOnlineSuite{})
+
+type testOnlineSuite struct{}
+
+// onlineClient records the placement rules deleted and the stores whose
+// labels are reset.
+type onlineClient struct {
+	testClient
+	deletedRules []string
+	resetStores  []uint64
+}
+
+func (c *onlineClient) DeletePlacementRule(ctx context.Context, groupID, ruleID string) error {
+	c.deletedRules = append(c.deletedRules, ruleID)
+	return nil
+}
+
+func (c *onlineClient) SetStoresLabel(ctx context.Context, stores []uint64, labelKey, labelValue string) error {
+	if labelValue == "" {
+		c.resetStores = append(c.resetStores, stores...)
+	}
+	return nil
+}
+
+func (s *testOnlineSuite) TestOnlineRecorder(c *C) {
+	ctx := context.Background()
+	local, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	client := &onlineClient{}
+	name := restore.OnlineRecordName(1)
+
+	var nilRecorder *restore.OnlineRecorder
+	c.Assert(nilRecorder.AddStores(ctx, []uint64{1}), IsNil)
+	c.Assert(nilRecorder.Stores(), IsNil)
+	c.Assert(nilRecorder.Finish(ctx), IsNil)
+
+	recorder, err := restore.NewOnlineRecorder(ctx, local, 1, time.Hour, client)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.AddStores(ctx, []uint64{3, 1}), IsNil)
+	c.Assert(recorder.AddStores(ctx, []uint64{1, 2}), IsNil)
+	c.Assert(recorder.AddRules(ctx, []string{"restore-t2", "restore-t1"}), IsNil)
+	c.Assert(recorder.Stores(), DeepEquals, []uint64{1, 2, 3})
+
+	record, err := restore.LoadOnlineRecord(ctx, local, name)
+	c.Assert(err, IsNil)
+	c.Assert(record.ClusterID, Equals, uint64(1))
+	c.Assert(record.Stores, DeepEquals, []uint64{1, 2, 3})
+	c.Assert(record.Rules, DeepEquals, []string{"restore-t1", "restore-t2"})
+	c.Assert(record.Expired(time.Now()), IsFalse)
+
+	// the lease is held by the running restore.
+	_, err = restore.NewOnlineRecorder(ctx, local, 1, time.Hour, client)
+	c.Assert(berrors.ErrRestoreOnlineInProgress.Equal(err), IsTrue)
+	err = restore.CleanupOnlineRestore(ctx, local, name, client, false)
+	c.Assert(berrors.ErrRestoreOnlineInProgress.Equal(err), IsTrue)
+	c.Assert(client.deletedRules, HasLen, 0)
+
+	// the record is kept if something is left.
+	c.Assert(recorder.RemoveRules(ctx, []string{"restore-t1"}), IsNil)
+	c.Assert(recorder.RemoveStores(ctx, []uint64{2}), IsNil)
+	c.Assert(recorder.Finish(ctx), IsNil)
+	// nothing is written after finish.
+	c.Assert(recorder.RemoveStores(ctx, []uint64{1}), IsNil)
+	record, err = restore.LoadOnlineRecord(ctx, local, name)
+	c.Assert(err, IsNil)
+	c.Assert(record.Stores, DeepEquals, []uint64{1, 3})
+	c.Assert(record.Rules, DeepEquals, []string{"restore-t2"})
+
+	c.Assert(restore.CleanupOnlineRestore(ctx, local, name, client, true), IsNil)
+	c.Assert(client.deletedRules, DeepEquals, []string{"restore-t2"})
+	c.Assert(client.resetStores, DeepEquals, []uint64{1, 3})
+	record, err = restore.LoadOnlineRecord(ctx, local, name)
+	c.Assert(err, IsNil)
+	c.Assert(record, IsNil)
+
+	// the record is removed if everything is cleaned up.
+	recorder, err = restore.NewOnlineRecorder(ctx, local, 1, time.Hour, client)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.AddStores(ctx, []uint64{4}), IsNil)
+	c.Assert(recorder.RemoveStores(ctx, []uint64{4}), IsNil)
+	c.Assert(recorder.Finish(ctx), IsNil)
+	exists, err := local.FileExists(ctx, name)
+	c.Assert(err, IsNil)
+	c.Assert(exists, IsFalse)
+}
+
+func (s *testOnlineSuite) TestCleanupExpiredOnlineRestore(c *C) {
+	ctx := context.Background()
+	local, err := storage.NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+	client := &onlineClient{}
+
+	recorder, err := restore.NewOnlineRecorder(ctx, local, 2, time.Millisecond, client)
+	c.Assert(err, IsNil)
+	c.Assert(recorder.AddStores(ctx, []uint64{5}), IsNil)
+	c.Assert(recorder.AddRules(ctx, []string{"restore-t3"}), IsNil)
+	time.Sleep(10 * time.Millisecond)
+
+	// the expired record is cleaned up by the next restore.
+	recorder, err = restore.NewOnlineRecorder(ctx, local, 2, time.Hour, client)
+	c.Assert(err, IsNil)
+	c.Assert(client.deletedRules, DeepEquals, []string{"restore-t3"})
+	c.Assert(client.resetStores, DeepEquals, []uint64{5})
+	c.Assert(recorder.Stores(), HasLen, 0)
+}
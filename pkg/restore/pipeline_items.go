@@ -4,8 +4,10 @@ package restore
 
 import (
 	"context"
+	"strings"
 	"sync"
 
+	"github.com/opentracing/opentracing-go"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"github.com/DigitalChinaOpenSource/DCParser/model"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/Orion7r/pr/pkg/glue"
 	"github.com/Orion7r/pr/pkg/rtree"
+	"github.com/Orion7r/pr/pkg/trace"
 	"github.com/Orion7r/pr/pkg/utils"
 )
 
@@ -231,7 +234,15 @@ func (b *tikvSender) splitWorker(ctx context.Context, ranges <-chan DrainResult,
 			if !ok {
 				return
 			}
-			if err := SplitRanges(ctx, b.client, result.Ranges, result.RewriteRules, b.updateCh); err != nil {
+			result.Ranges = b.skipRestoredRanges(result.Ranges)
+			if len(result.Ranges) == 0 {
+				next <- result
+				continue
+			}
+			span, sctx := startBatchSpan(ctx, "tikvSender.splitWorker", result)
+			err := SplitRanges(sctx, b.client, result.Ranges, result.RewriteRules, b.updateCh)
+			trace.FinishSpan(span, err)
+			if err != nil {
 				log.Error("failed on split range", rtree.ZapRanges(result.Ranges), zap.Error(err))
 				b.sink.EmitError(err)
 				return
@@ -241,6 +252,27 @@ func (b *tikvSender) splitWorker(ctx context.Context, ranges <-chan DrainResult,
 	}
 }
 
+// skipRestoredRanges filters out the ranges restored before the checkpoint,
+// and counts them into the progress as they were split and restored.
+func (b *tikvSender) skipRestoredRanges(ranges []rtree.Range) []rtree.Range {
+	unrestored := make([]rtree.Range, 0, len(ranges))
+	for _, r := range ranges {
+		if !b.client.checkpointer.isRangeRestored(r) {
+			unrestored = append(unrestored, r)
+			continue
+		}
+		// one for splitting the range and the others for the files.
+		for i := 0; i <= len(r.Files); i++ {
+			b.updateCh.Inc()
+		}
+	}
+	if len(unrestored) < len(ranges) {
+		log.Info("skip ranges restored before checkpoint",
+			zap.Int("ranges", len(ranges)-len(unrestored)))
+	}
+	return unrestored
+}
+
 func (b *tikvSender) restoreWorker(ctx context.Context, ranges <-chan DrainResult) {
 	defer func() {
 		log.Debug("restore worker closed")
@@ -256,10 +288,15 @@ func (b *tikvSender) restoreWorker(ctx context.Context, ranges <-chan DrainResul
 				return
 			}
 			files := result.Files()
-			if err := b.client.RestoreFiles(ctx, files, result.RewriteRules, b.updateCh); err != nil {
+			span, rctx := startBatchSpan(ctx, "tikvSender.restoreWorker", result)
+			span.SetTag("files", len(files))
+			err := b.client.RestoreFiles(rctx, files, result.RewriteRules, b.updateCh)
+			trace.FinishSpan(span, err)
+			if err != nil {
 				b.sink.EmitError(err)
 				return
 			}
+			b.client.checkpointer.rangesRestored(result.Ranges)
 
 			log.Info("restore batch done", rtree.ZapRanges(result.Ranges))
 			b.sink.EmitTables(result.BlankTablesAfterSend...)
@@ -267,6 +304,22 @@ func (b *tikvSender) restoreWorker(ctx context.Context, ranges <-chan DrainResul
 	}
 }
 
+// startBatchSpan starts the span of processing the batch, with the tables and
+// the key range of the batch.
+func startBatchSpan(ctx context.Context, operation string, result DrainResult) (opentracing.Span, context.Context) {
+	span, ctx := trace.StartSpan(ctx, operation)
+	tables := make([]string, 0, len(result.TablesToSend))
+	for _, t := range result.TablesToSend {
+		tables = append(tables, t.OldTable.DB.Name.O+"."+t.OldTable.Info.Name.O)
+	}
+	span.SetTag("tables", strings.Join(tables, ","))
+	span.SetTag("ranges", len(result.Ranges))
+	if len(result.Ranges) > 0 {
+		trace.SetRangeTags(span, result.Ranges[0].StartKey, result.Ranges[len(result.Ranges)-1].EndKey)
+	}
+	return span, ctx
+}
+
 func (b *tikvSender) Close() {
 	close(b.inCh)
 	b.wg.Wait()
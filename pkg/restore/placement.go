@@ -0,0 +1,282 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/Orion7r/pr/pkg/conn"
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/glue"
+	"github.com/Orion7r/pr/pkg/pdutil"
+	"github.com/Orion7r/pr/pkg/summary"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// tiflashCheckInterval is the interval to check whether the TiFlash replicas
+// are available.
+const tiflashCheckInterval = 5 * time.Second
+
+// TiFlashReplicaCount returns the TiFlash replica count to set on the restored
+// table. The count recorded in the backup is overridden by override if it
+// isn't negative, and the tables without TiFlash replicas are not changed.
+func TiFlashReplicaCount(table *utils.Table, override int) uint64 {
+	count := uint64(table.TiFlashReplicas)
+	// the old backups only record the count in the table info.
+	if count == 0 && table.Info.TiFlashReplica != nil {
+		count = table.Info.TiFlashReplica.Count
+	}
+	if count > 0 && override >= 0 {
+		count = uint64(override)
+	}
+	return count
+}
+
+// HasTiFlashStores checks whether there is any TiFlash store in the cluster.
+func (rc *Client) HasTiFlashStores(ctx context.Context) (bool, error) {
+	stores, err := conn.GetAllTiKVStores(ctx, rc.pdClient, conn.TiFlashOnly)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return len(stores) > 0, nil
+}
+
+// withoutTiFlashReplica returns the table to create without the TiFlash
+// replica, which is set after the data is restored.
+func withoutTiFlashReplica(table *utils.Table) *utils.Table {
+	if table.Info.TiFlashReplica == nil {
+		return table
+	}
+	info := *table.Info
+	info.TiFlashReplica = nil
+	newTable := *table
+	newTable.Info = &info
+	return &newTable
+}
+
+// GoRestorePlacement forks a goroutine to restore the TiFlash replicas and
+// the custom placement rules recorded at backup time to the restored tables.
+// The TiFlash replica count is overridden by tiflashReplicas if it isn't
+// negative, and the placement rules are skipped unless placementRules is set.
+// It returns a channel of the tables whose placement is restored.
+func (rc *Client) GoRestorePlacement(
+	ctx context.Context,
+	tableStream <-chan CreatedTable,
+	errCh chan<- error,
+	tiflashReplicas int,
+	placementRules bool,
+) <-chan CreatedTable {
+	log.Info("Start to restore placement")
+	outCh := make(chan CreatedTable, defaultChannelSize)
+	go func() {
+		defer func() {
+			log.Info("all placement restored")
+			close(outCh)
+		}()
+		var rules pdutil.TablePlacementRules
+		if placementRules {
+			var err error
+			if rules, err = rc.readPlacementRules(ctx); err != nil {
+				errCh <- errors.Annotatef(err, "failed to read %s", utils.PlacementRulesFile)
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			case tbl, ok := <-tableStream:
+				if !ok {
+					return
+				}
+				if err := rc.restoreTablePlacement(ctx, tbl, tiflashReplicas, rules); err != nil {
+					errCh <- err
+					return
+				}
+				select {
+				case <-ctx.Done():
+					errCh <- ctx.Err()
+					return
+				case outCh <- tbl:
+				}
+			}
+		}
+	}()
+	return outCh
+}
+
+func (rc *Client) restoreTablePlacement(
+	ctx context.Context,
+	tbl CreatedTable,
+	tiflashReplicas int,
+	rules pdutil.TablePlacementRules,
+) error {
+	table := tbl.OldTable
+	logger := log.With(
+		zap.String("db", table.DB.Name.O),
+		zap.String("table", tbl.Table.Name.O),
+	)
+
+	for oldID, newID := range tablePhysicalIDs(table.Info, tbl.Table) {
+		for _, rule := range rules[oldID] {
+			newRule, err := pdutil.RewriteTablePlacementRule(rule, oldID, newID)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if err = rc.toolClient.SetPlacementRule(ctx, newRule); err != nil {
+				return errors.Annotatef(err, "failed to set placement rule %s/%s", newRule.GroupID, newRule.ID)
+			}
+			logger.Info("placement rule restored",
+				zap.String("group", newRule.GroupID), zap.String("rule", newRule.ID))
+		}
+	}
+
+	count := TiFlashReplicaCount(table, tiflashReplicas)
+	if count == 0 {
+		return nil
+	}
+	var labels []string
+	if table.Info.TiFlashReplica != nil {
+		labels = table.Info.TiFlashReplica.LocationLabels
+	}
+	if err := rc.db.SetTiFlashReplica(ctx, table.DB.Name, tbl.Table.Name, count, labels); err != nil {
+		return errors.Annotatef(err, "failed to set TiFlash replica of %s.%s", table.DB.Name, tbl.Table.Name)
+	}
+	logger.Info("TiFlash replica restored", zap.Uint64("count", count))
+	return nil
+}
+
+// tablePhysicalIDs maps the IDs of the table and the partitions in the backup
+// to the restored table, the partitions are matched by name.
+func tablePhysicalIDs(oldTable, newTable *model.TableInfo) map[int64]int64 {
+	ids := map[int64]int64{oldTable.ID: newTable.ID}
+	if oldTable.Partition == nil || newTable.Partition == nil {
+		return ids
+	}
+	for _, oldDef := range oldTable.Partition.Definitions {
+		for _, newDef := range newTable.Partition.Definitions {
+			if oldDef.Name.L == newDef.Name.L {
+				ids[oldDef.ID] = newDef.ID
+			}
+		}
+	}
+	return ids
+}
+
+// readPlacementRules reads the placement rules recorded at backup time, it
+// returns nil if there is no such rule.
+func (rc *Client) readPlacementRules(ctx context.Context) (pdutil.TablePlacementRules, error) {
+	exists, err := rc.storage.FileExists(ctx, utils.PlacementRulesFile)
+	if err != nil || !exists {
+		return nil, errors.Trace(err)
+	}
+	data, err := rc.storage.Read(ctx, utils.PlacementRulesFile)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	rules := make(pdutil.TablePlacementRules)
+	if err = json.Unmarshal(data, &rules); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return rules, nil
+}
+
+// GoWaitTiFlashReplicas forks a goroutine to wait until the TiFlash replicas
+// of the restored tables are available. The progress is increased once the
+// replica of a table is available. The replica of each table is waited for at
+// most timeout, or forever if timeout is 0. It returns a channel of the tables
+// which are ready.
+func (rc *Client) GoWaitTiFlashReplicas(
+	ctx context.Context,
+	tableStream <-chan CreatedTable,
+	errCh chan<- error,
+	updateCh glue.Progress,
+	timeout time.Duration,
+) <-chan CreatedTable {
+	log.Info("Start to wait TiFlash replicas")
+	outCh := make(chan CreatedTable, defaultChannelSize)
+	go func() {
+		start := time.Now()
+		defer func() {
+			log.Info("all TiFlash replicas are available")
+			summary.CollectDuration("wait tiflash replicas", time.Since(start))
+			close(outCh)
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			case tbl, ok := <-tableStream:
+				if !ok {
+					return
+				}
+				waited, err := rc.waitTiFlashReplica(ctx, tbl, timeout)
+				if err != nil {
+					errCh <- err
+					return
+				}
+				if waited {
+					updateCh.Inc()
+				}
+				select {
+				case <-ctx.Done():
+					errCh <- ctx.Err()
+					return
+				case outCh <- tbl:
+				}
+			}
+		}
+	}()
+	return outCh
+}
+
+// waitTiFlashReplica waits until the TiFlash replica of the table is
+// available. It returns false if the table has no TiFlash replica.
+func (rc *Client) waitTiFlashReplica(ctx context.Context, tbl CreatedTable, timeout time.Duration) (bool, error) {
+	start := time.Now()
+	ticker := time.NewTicker(tiflashCheckInterval)
+	defer ticker.Stop()
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	for {
+		table, ok := rc.dom.InfoSchema().TableByID(tbl.Table.ID)
+		if !ok {
+			return false, errors.Annotatef(berrors.ErrRestoreSchemaNotExists,
+				"table %s.%s (ID %d)", tbl.OldTable.DB.Name, tbl.Table.Name, tbl.Table.ID)
+		}
+		replica := table.Meta().TiFlashReplica
+		if replica == nil || replica.Count == 0 {
+			return false, nil
+		}
+		if replica.Available {
+			log.Info("TiFlash replica is available",
+				zap.String("db", tbl.OldTable.DB.Name.O),
+				zap.String("table", tbl.Table.Name.O),
+				zap.Duration("take", time.Since(start)))
+			return true, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-timeoutCh:
+			return false, errors.Annotatef(berrors.ErrRestoreTiFlashTimeout,
+				"the TiFlash replica of table %s.%s is not available after %s, "+
+					"the data is restored, please check the TiFlash stores",
+				tbl.OldTable.DB.Name, tbl.Table.Name, timeout)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/kvproto/pkg/import_sstpb"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/domain"
+	"github.com/pingcap/tidb/util/codec"
+	"go.uber.org/zap"
+
+	"github.com/Orion7r/pr/pkg/conn"
+	"github.com/Orion7r/pr/pkg/rtree"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// Plan is what a restore would do. It is made by PlanRestore without changing
+// the cluster.
+type Plan struct {
+	NewDatabases      []string     `json:"new-databases"`
+	ExistingDatabases []string     `json:"existing-databases"`
+	NewTables         []string     `json:"new-tables"`
+	ExistingTables    []string     `json:"existing-tables"`
+	DDLJobs           []PlanDDLJob `json:"ddl-jobs"`
+
+	Files      int    `json:"files"`
+	Ranges     int    `json:"ranges"`
+	TotalKvs   uint64 `json:"total-kvs"`
+	TotalBytes uint64 `json:"total-bytes"`
+	// SplitKeys is the number of the keys to split the regions, and
+	// SplitRegions is the number of the regions to split, against the current
+	// region layout. The new tables are assumed to be created after the
+	// existing tables.
+	SplitKeys    int `json:"split-keys"`
+	SplitRegions int `json:"split-regions"`
+
+	// RateLimit is the download rate limit of every TiKV store, and ETA is the
+	// time to download the data if every store downloads the same amount at
+	// the rate limit. It is empty if the rate is unlimited.
+	RateLimit uint64 `json:"rate-limit"`
+	Stores    int    `json:"stores"`
+	ETA       string `json:"eta,omitempty"`
+}
+
+// PlanDDLJob is an incremental DDL job which would be replayed.
+type PlanDDLJob struct {
+	Schema        string `json:"schema"`
+	Type          string `json:"type"`
+	Query         string `json:"query"`
+	SchemaVersion int64  `json:"schema-version"`
+}
+
+// PlanRestore makes the plan to restore the tables and replay the DDL jobs.
+// It only reads the schemas and the regions of the cluster.
+func (rc *Client) PlanRestore(
+	ctx context.Context,
+	dom *domain.Domain,
+	dbs []*utils.Database,
+	tables []*utils.Table,
+	ddlJobs []*model.Job,
+	files []*backup.File,
+) (*Plan, error) {
+	plan := &Plan{
+		NewDatabases:      []string{},
+		ExistingDatabases: []string{},
+		NewTables:         []string{},
+		ExistingTables:    []string{},
+		DDLJobs:           make([]PlanDDLJob, 0, len(ddlJobs)),
+		Files:             len(files),
+		Ranges:            EstimateRangeSize(files),
+		RateLimit:         rc.RateLimit(),
+	}
+	is := dom.InfoSchema()
+	for _, db := range dbs {
+		if _, ok := is.SchemaByName(db.Info.Name); ok {
+			plan.ExistingDatabases = append(plan.ExistingDatabases, db.Info.Name.O)
+		} else {
+			plan.NewDatabases = append(plan.NewDatabases, db.Info.Name.O)
+		}
+	}
+
+	// the existing tables are restored into their current key spaces.
+	existing := make(map[int64]*model.TableInfo)
+	for _, table := range tables {
+		name := utils.EncloseName(table.DB.Name.O) + "." + utils.EncloseName(table.Info.Name.O)
+		if t, err := is.TableByName(table.DB.Name, table.Info.Name); err == nil {
+			plan.ExistingTables = append(plan.ExistingTables, name)
+			existing[table.Info.ID] = t.Meta()
+		} else {
+			plan.NewTables = append(plan.NewTables, name)
+		}
+		plan.TotalKvs += table.TotalKvs
+		plan.TotalBytes += table.TotalBytes
+	}
+	sort.Strings(plan.NewDatabases)
+	sort.Strings(plan.ExistingDatabases)
+	sort.Strings(plan.NewTables)
+	sort.Strings(plan.ExistingTables)
+
+	for _, job := range ddlJobs {
+		plan.DDLJobs = append(plan.DDLJobs, PlanDDLJob{
+			Schema:        job.SchemaName,
+			Type:          job.Type.String(),
+			Query:         job.Query,
+			SchemaVersion: job.BinlogInfo.SchemaVersion,
+		})
+	}
+
+	var err error
+	plan.SplitKeys, plan.SplitRegions, err = rc.planSplit(ctx, dom, tables, existing)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	stores, err := conn.GetAllTiKVStores(ctx, rc.pdClient, conn.SkipTiFlash)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	plan.Stores = len(stores)
+	if plan.RateLimit > 0 && plan.Stores > 0 {
+		seconds := float64(plan.TotalBytes) / float64(plan.RateLimit) / float64(plan.Stores)
+		plan.ETA = time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+	}
+	return plan, nil
+}
+
+// planSplit returns the number of the split keys and the regions to split.
+// The new tables are given the IDs after all existing tables, like they are
+// created by the restore.
+func (rc *Client) planSplit(
+	ctx context.Context,
+	dom *domain.Domain,
+	tables []*utils.Table,
+	existing map[int64]*model.TableInfo,
+) (keys int, regions int, err error) {
+	nextID := maxTableID(dom) + 1
+	rules := EmptyRewriteRule()
+	ranges := make([]rtree.Range, 0)
+	for _, table := range tables {
+		newInfo, ok := existing[table.Info.ID]
+		if !ok {
+			newInfo, nextID = simulateNewTable(table.Info, nextID)
+		}
+		tableRules := GetRewriteRules(newInfo, table.Info, 0)
+		tableRanges, errRange := ValidateFileRanges(table.Files, tableRules)
+		if errRange != nil {
+			return 0, 0, errors.Trace(errRange)
+		}
+		rules.Append(*tableRules)
+		ranges = append(ranges, tableRanges...)
+	}
+	if len(ranges) == 0 {
+		return 0, 0, nil
+	}
+
+	sortedRanges, err := SortRanges(ranges, rules)
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	minKey := codec.EncodeBytes([]byte{}, sortedRanges[0].StartKey)
+	maxKey := codec.EncodeBytes([]byte{}, sortedRanges[len(sortedRanges)-1].EndKey)
+	for _, prefixRules := range [][]*import_sstpb.RewriteRule{rules.Table, rules.Data} {
+		for _, rule := range prefixRules {
+			if bytes.Compare(minKey, rule.GetNewKeyPrefix()) > 0 {
+				minKey = rule.GetNewKeyPrefix()
+			}
+			if bytes.Compare(maxKey, rule.GetNewKeyPrefix()) < 0 {
+				maxKey = rule.GetNewKeyPrefix()
+			}
+		}
+	}
+	regionInfos, err := PaginateScanRegion(ctx, rc.toolClient, minKey, maxKey, scanRegionPaginationLimit)
+	if err != nil {
+		return 0, 0, errors.Trace(err)
+	}
+	splitKeys := GetSplitKeys(rules, sortedRanges, regionInfos)
+	for _, regionKeys := range splitKeys {
+		keys += len(regionKeys)
+	}
+	log.Info("plan split regions",
+		zap.Int("ranges", len(sortedRanges)),
+		zap.Int("scanned regions", len(regionInfos)),
+		zap.Int("split keys", keys),
+		zap.Int("split regions", len(splitKeys)))
+	return keys, len(splitKeys), nil
+}
+
+// maxTableID returns the max ID of the tables and the partitions.
+func maxTableID(dom *domain.Domain) int64 {
+	is := dom.InfoSchema()
+	var maxID int64
+	for _, db := range is.AllSchemas() {
+		for _, t := range is.SchemaTables(db.Name) {
+			info := t.Meta()
+			if info.ID > maxID {
+				maxID = info.ID
+			}
+			if info.Partition != nil {
+				for _, def := range info.Partition.Definitions {
+					if def.ID > maxID {
+						maxID = def.ID
+					}
+				}
+			}
+		}
+	}
+	return maxID
+}
+
+// simulateNewTable returns a copy of the table with the IDs starting from
+// nextID, and the next unused ID.
+func simulateNewTable(info *model.TableInfo, nextID int64) (*model.TableInfo, int64) {
+	newInfo := *info
+	newInfo.ID = nextID
+	nextID++
+	if info.Partition != nil {
+		partition := *info.Partition
+		partition.Definitions = append([]model.PartitionDefinition(nil), info.Partition.Definitions...)
+		for i := range partition.Definitions {
+			partition.Definitions[i].ID = nextID
+			nextID++
+		}
+		newInfo.Partition = &partition
+	}
+	return &newInfo, nextID
+}
@@ -0,0 +1,268 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/DigitalChinaOpenSource/DCParser"
+	"github.com/DigitalChinaOpenSource/DCParser/ast"
+	"github.com/DigitalChinaOpenSource/DCParser/format"
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	_ "github.com/pingcap/tidb/types/parser_driver" // for parsing the queries of ddl jobs
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// renameWildcard matches any table in a rename rule.
+const renameWildcard = "*"
+
+// RenameRule renames a table, or all tables of a database if FromTable is "*".
+// ToTable is "*" if the table name is kept.
+type RenameRule struct {
+	FromDB    string
+	FromTable string
+	ToDB      string
+	ToTable   string
+}
+
+// ParseRenameRule parses a rename rule in the form of `db.table:newdb.newtable`,
+// e.g. `prod.*:prod_restore.*` renames the database prod to prod_restore.
+func ParseRenameRule(rule string) (RenameRule, error) {
+	parts := strings.Split(rule, ":")
+	if len(parts) != 2 {
+		return RenameRule{}, errors.Annotatef(berrors.ErrInvalidArgument,
+			"rename rule '%s' should be in the form of 'db.table:newdb.newtable'", rule)
+	}
+	fromDB, fromTable, err := parseRenameName(rule, parts[0])
+	if err != nil {
+		return RenameRule{}, errors.Trace(err)
+	}
+	toDB, toTable, err := parseRenameName(rule, parts[1])
+	if err != nil {
+		return RenameRule{}, errors.Trace(err)
+	}
+	if toDB == renameWildcard {
+		return RenameRule{}, errors.Annotatef(berrors.ErrInvalidArgument,
+			"the target database of rename rule '%s' should not be '*'", rule)
+	}
+	if fromTable == renameWildcard && toTable != renameWildcard {
+		return RenameRule{}, errors.Annotatef(berrors.ErrInvalidArgument,
+			"rename rule '%s' renames all tables of a database to one table", rule)
+	}
+	return RenameRule{FromDB: fromDB, FromTable: fromTable, ToDB: toDB, ToTable: toTable}, nil
+}
+
+func parseRenameName(rule, name string) (string, string, error) {
+	i := strings.Index(name, ".")
+	if i <= 0 || i == len(name)-1 {
+		return "", "", errors.Annotatef(berrors.ErrInvalidArgument,
+			"'%s' in rename rule '%s' should be in the form of 'db.table'", name, rule)
+	}
+	return name[:i], name[i+1:], nil
+}
+
+func (r RenameRule) String() string {
+	return fmt.Sprintf("%s.%s:%s.%s", r.FromDB, r.FromTable, r.ToDB, r.ToTable)
+}
+
+// TableRenamer renames the databases and tables before they are created, and
+// renames them in the ddl jobs replayed by the incremental restore. The rules
+// are matched case-insensitively in order, the first matched rule is used.
+type TableRenamer struct {
+	rules []RenameRule
+}
+
+// NewTableRenamer creates a TableRenamer, it returns nil if there is no rule.
+func NewTableRenamer(rules []RenameRule) *TableRenamer {
+	if len(rules) == 0 {
+		return nil
+	}
+	return &TableRenamer{rules: rules}
+}
+
+// Rename returns the new names of the table.
+func (r *TableRenamer) Rename(db, table string) (string, string) {
+	if r == nil {
+		return db, table
+	}
+	for _, rule := range r.rules {
+		if !strings.EqualFold(rule.FromDB, db) {
+			continue
+		}
+		if rule.FromTable != renameWildcard && !strings.EqualFold(rule.FromTable, table) {
+			continue
+		}
+		if rule.ToTable == renameWildcard {
+			return rule.ToDB, table
+		}
+		return rule.ToDB, rule.ToTable
+	}
+	return db, table
+}
+
+// RenameDB returns the new name of the database, only the rules renaming all
+// tables of a database rename the database itself.
+func (r *TableRenamer) RenameDB(db string) string {
+	if r == nil {
+		return db
+	}
+	for _, rule := range r.rules {
+		if rule.FromTable == renameWildcard && strings.EqualFold(rule.FromDB, db) {
+			return rule.ToDB
+		}
+	}
+	return db
+}
+
+// RenameTables renames the tables, and groups them by the new databases. The
+// IDs of the tables are kept, so the rewrite rules and the checksum of the
+// tables are built with the original IDs.
+func (r *TableRenamer) RenameTables(
+	tables []*utils.Table,
+) (renamedTables []*utils.Table, renamedDBs []*utils.Database, err error) {
+	type namePair struct {
+		db    string
+		table string
+	}
+	dbs := make(map[string]*utils.Database)
+	renamedFrom := make(map[namePair]*utils.Table)
+	for _, table := range tables {
+		newDB, newTable := r.Rename(table.DB.Name.O, table.Info.Name.O)
+		name := namePair{strings.ToLower(newDB), strings.ToLower(newTable)}
+		if origin, ok := renamedFrom[name]; ok {
+			return nil, nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"both %s.%s and %s.%s are renamed to %s.%s",
+				utils.EncloseName(origin.DB.Name.O), utils.EncloseName(origin.Info.Name.O),
+				utils.EncloseName(table.DB.Name.O), utils.EncloseName(table.Info.Name.O),
+				utils.EncloseName(newDB), utils.EncloseName(newTable))
+		}
+		renamedFrom[name] = table
+
+		db, ok := dbs[name.db]
+		if !ok {
+			dbInfo := table.DB.Clone()
+			dbInfo.Name = model.NewCIStr(newDB)
+			dbInfo.Tables = nil
+			db = &utils.Database{Info: dbInfo}
+			dbs[name.db] = db
+			renamedDBs = append(renamedDBs, db)
+		}
+		renamed := *table
+		renamed.DB = db.Info
+		if newTable != table.Info.Name.O {
+			renamed.Info = table.Info.Clone()
+			renamed.Info.Name = model.NewCIStr(newTable)
+		}
+		if newDB != table.DB.Name.O || newTable != table.Info.Name.O {
+			log.Info("rename table",
+				zap.Stringer("db", table.DB.Name), zap.Stringer("table", table.Info.Name),
+				zap.String("new db", newDB), zap.String("new table", newTable))
+		}
+		db.Tables = append(db.Tables, &renamed)
+		renamedTables = append(renamedTables, &renamed)
+	}
+	return renamedTables, renamedDBs, nil
+}
+
+// RenameDDLJobs renames the schema, the table and the tables in the query of
+// the ddl jobs. The original jobs are not modified.
+func (r *TableRenamer) RenameDDLJobs(ddlJobs []*model.Job) ([]*model.Job, error) {
+	if r == nil {
+		return ddlJobs, nil
+	}
+	p := parser.New()
+	renamedJobs := make([]*model.Job, 0, len(ddlJobs))
+	for _, job := range ddlJobs {
+		renamed := *job
+		binlogInfo := *job.BinlogInfo
+		renamed.BinlogInfo = &binlogInfo
+
+		if dbInfo := binlogInfo.DBInfo; dbInfo != nil {
+			binlogInfo.DBInfo = dbInfo.Clone()
+			binlogInfo.DBInfo.Name = model.NewCIStr(r.RenameDB(dbInfo.Name.O))
+		}
+		if tableInfo := binlogInfo.TableInfo; tableInfo != nil {
+			newDB, newTable := r.Rename(job.SchemaName, tableInfo.Name.O)
+			binlogInfo.TableInfo = tableInfo.Clone()
+			binlogInfo.TableInfo.Name = model.NewCIStr(newTable)
+			renamed.SchemaName = newDB
+		} else {
+			renamed.SchemaName = r.RenameDB(job.SchemaName)
+		}
+
+		query, err := r.renameQuery(p, job.Query, job.SchemaName, renamed.SchemaName)
+		if err != nil {
+			return nil, errors.Annotatef(err, "failed to rename the query of ddl job %d", job.ID)
+		}
+		renamed.Query = query
+		log.Debug("rename ddl job",
+			zap.String("db", job.SchemaName), zap.String("query", job.Query),
+			zap.String("new db", renamed.SchemaName), zap.String("new query", renamed.Query))
+		renamedJobs = append(renamedJobs, &renamed)
+	}
+	return renamedJobs, nil
+}
+
+// renameQuery renames the databases and tables in the query. The tables without
+// a database are resolved in the current database of the job, and they are
+// qualified with the new database unless it is the new current database.
+func (r *TableRenamer) renameQuery(p *parser.Parser, query, currentDB, newCurrentDB string) (string, error) {
+	stmts, _, err := p.Parse(query, "", "")
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	visitor := &renameVisitor{renamer: r, currentDB: currentDB, newCurrentDB: newCurrentDB}
+	var sb strings.Builder
+	for i, stmt := range stmts {
+		stmt.Accept(visitor)
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		if err = stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+			return "", errors.Trace(err)
+		}
+	}
+	return sb.String(), nil
+}
+
+type renameVisitor struct {
+	renamer      *TableRenamer
+	currentDB    string
+	newCurrentDB string
+}
+
+// Enter implements ast.Visitor.
+func (v *renameVisitor) Enter(n ast.Node) (ast.Node, bool) {
+	switch node := n.(type) {
+	case *ast.TableName:
+		db := node.Schema.O
+		if db == "" {
+			db = v.currentDB
+		}
+		newDB, newTable := v.renamer.Rename(db, node.Name.O)
+		if node.Schema.O != "" || !strings.EqualFold(newDB, v.newCurrentDB) {
+			node.Schema = model.NewCIStr(newDB)
+		}
+		node.Name = model.NewCIStr(newTable)
+	case *ast.CreateDatabaseStmt:
+		node.Name = v.renamer.RenameDB(node.Name)
+	case *ast.DropDatabaseStmt:
+		node.Name = v.renamer.RenameDB(node.Name)
+	case *ast.AlterDatabaseStmt:
+		if node.Name != "" {
+			node.Name = v.renamer.RenameDB(node.Name)
+		}
+	}
+	return n, false
+}
+
+// Leave implements ast.Visitor.
+func (v *renameVisitor) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
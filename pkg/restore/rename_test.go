@@ -0,0 +1,133 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore_test
+
+import (
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	. "github.com/pingcap/check"
+
+	"github.com/Orion7r/pr/pkg/restore"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+var _ = Suite(&testRenameSuite{})
+
+type testRenameSuite struct{}
+
+func mustNewTableRenamer(c *C, rules ...string) *restore.TableRenamer {
+	renameRules := make([]restore.RenameRule, 0, len(rules))
+	for _, r := range rules {
+		rule, err := restore.ParseRenameRule(r)
+		c.Assert(err, IsNil)
+		renameRules = append(renameRules, rule)
+	}
+	return restore.NewTableRenamer(renameRules)
+}
+
+func (s *testRenameSuite) TestParseRenameRule(c *C) {
+	rule, err := restore.ParseRenameRule("prod.*:prod_restore.*")
+	c.Assert(err, IsNil)
+	c.Assert(rule, DeepEquals, restore.RenameRule{FromDB: "prod", FromTable: "*", ToDB: "prod_restore", ToTable: "*"})
+
+	for _, invalid := range []string{"prod", "prod.*", "prod:prod_restore", "prod.*:*.*", "prod.*:bak.orders", ".t:db.t"} {
+		_, err = restore.ParseRenameRule(invalid)
+		c.Assert(err, ErrorMatches, ".*invalid argument.*", Commentf("rule %s", invalid))
+	}
+	c.Assert(restore.NewTableRenamer(nil), IsNil)
+}
+
+func (s *testRenameSuite) TestRenameTables(c *C) {
+	renamer := mustNewTableRenamer(c, "prod.orders:bak.orders_1", "prod.*:prod_restore.*")
+	db, table := renamer.Rename("PROD", "orders")
+	c.Assert(db, Equals, "bak")
+	c.Assert(table, Equals, "orders_1")
+	db, table = renamer.Rename("prod", "users")
+	c.Assert(db, Equals, "prod_restore")
+	c.Assert(table, Equals, "users")
+	db, table = renamer.Rename("test", "users")
+	c.Assert(db, Equals, "test")
+	c.Assert(table, Equals, "users")
+	c.Assert(renamer.RenameDB("prod"), Equals, "prod_restore")
+	c.Assert(renamer.RenameDB("bak"), Equals, "bak")
+
+	prod := &model.DBInfo{ID: 1, Name: model.NewCIStr("prod")}
+	tables := []*utils.Table{
+		{DB: prod, Info: &model.TableInfo{ID: 11, Name: model.NewCIStr("orders")}, TotalKvs: 1},
+		{DB: prod, Info: &model.TableInfo{ID: 12, Name: model.NewCIStr("users")}, TotalKvs: 2},
+	}
+	renamedTables, renamedDBs, err := renamer.RenameTables(tables)
+	c.Assert(err, IsNil)
+	c.Assert(renamedDBs, HasLen, 2)
+	c.Assert(renamedDBs[0].Info.Name.O, Equals, "bak")
+	c.Assert(renamedDBs[0].Tables, HasLen, 1)
+	c.Assert(renamedDBs[1].Info.Name.O, Equals, "prod_restore")
+	c.Assert(renamedTables, HasLen, 2)
+	c.Assert(renamedTables[0].DB.Name.O, Equals, "bak")
+	c.Assert(renamedTables[0].Info.Name.O, Equals, "orders_1")
+	c.Assert(renamedTables[0].Info.ID, Equals, int64(11))
+	c.Assert(renamedTables[0].TotalKvs, Equals, uint64(1))
+	c.Assert(renamedTables[1].DB.Name.O, Equals, "prod_restore")
+	c.Assert(renamedTables[1].Info.Name.O, Equals, "users")
+	// the original tables are not modified.
+	c.Assert(tables[0].DB.Name.O, Equals, "prod")
+	c.Assert(tables[0].Info.Name.O, Equals, "orders")
+
+	renamer = mustNewTableRenamer(c, "prod.orders:prod.users")
+	_, _, err = renamer.RenameTables(tables)
+	c.Assert(err, ErrorMatches, ".*both `prod`.`orders` and `prod`.`users` are renamed to `prod`.`users`.*")
+}
+
+func (s *testRenameSuite) TestRenameDDLJobs(c *C) {
+	renamer := mustNewTableRenamer(c, "prod.orders:bak.orders_1", "prod.*:prod_restore.*")
+	jobs := []*model.Job{
+		{
+			ID:         1,
+			Type:       model.ActionCreateSchema,
+			SchemaName: "prod",
+			Query:      "create database prod",
+			BinlogInfo: &model.HistoryInfo{DBInfo: &model.DBInfo{Name: model.NewCIStr("prod")}},
+		},
+		{
+			ID:         2,
+			Type:       model.ActionAddColumn,
+			SchemaName: "prod",
+			Query:      "alter table orders add column b int",
+			BinlogInfo: &model.HistoryInfo{TableInfo: &model.TableInfo{Name: model.NewCIStr("orders")}},
+		},
+		{
+			ID:         3,
+			Type:       model.ActionCreateTable,
+			SchemaName: "prod",
+			Query:      "create table users2 like users",
+			BinlogInfo: &model.HistoryInfo{TableInfo: &model.TableInfo{Name: model.NewCIStr("users2")}},
+		},
+		{
+			ID:         4,
+			Type:       model.ActionTruncateTable,
+			SchemaName: "prod",
+			Query:      "truncate table prod.orders",
+			BinlogInfo: &model.HistoryInfo{TableInfo: &model.TableInfo{Name: model.NewCIStr("orders")}},
+		},
+	}
+	renamed, err := renamer.RenameDDLJobs(jobs)
+	c.Assert(err, IsNil)
+	c.Assert(renamed, HasLen, 4)
+
+	c.Assert(renamed[0].BinlogInfo.DBInfo.Name.O, Equals, "prod_restore")
+	c.Assert(renamed[0].Query, Equals, "CREATE DATABASE `prod_restore`")
+
+	c.Assert(renamed[1].SchemaName, Equals, "bak")
+	c.Assert(renamed[1].BinlogInfo.TableInfo.Name.O, Equals, "orders_1")
+	c.Assert(renamed[1].Query, Equals, "ALTER TABLE `orders_1` ADD COLUMN `b` INT")
+
+	c.Assert(renamed[2].SchemaName, Equals, "prod_restore")
+	c.Assert(renamed[2].Query, Equals, "CREATE TABLE `users2` LIKE `users`")
+
+	c.Assert(renamed[3].SchemaName, Equals, "bak")
+	c.Assert(renamed[3].Query, Equals, "TRUNCATE TABLE `bak`.`orders_1`")
+
+	// the original jobs are not modified.
+	c.Assert(jobs[1].SchemaName, Equals, "prod")
+	c.Assert(jobs[1].BinlogInfo.TableInfo.Name.O, Equals, "orders")
+	c.Assert(jobs[1].Query, Equals, "alter table orders add column b int")
+}
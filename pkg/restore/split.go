@@ -157,6 +157,7 @@ SplitRegions:
 	if errSplit != nil {
 		return errors.Trace(errSplit)
 	}
+	restoreSplitHistogram.WithLabelValues("split").Observe(time.Since(startTime).Seconds())
 	log.Info("start to wait for scattering regions",
 		zap.Int("regions", len(scatterRegions)), zap.Duration("take", time.Since(startTime)))
 	startTime = time.Now()
@@ -168,6 +169,7 @@ SplitRegions:
 		}
 		scatterCount++
 	}
+	restoreSplitHistogram.WithLabelValues("scatter").Observe(time.Since(startTime).Seconds())
 	if scatterCount == len(scatterRegions) {
 		log.Info("waiting for scattering regions done",
 			zap.Int("regions", len(scatterRegions)), zap.Duration("take", time.Since(startTime)))
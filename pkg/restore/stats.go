@@ -0,0 +1,124 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package restore
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/statistics/handle"
+	"go.uber.org/zap"
+
+	"github.com/Orion7r/pr/pkg/glue"
+	"github.com/Orion7r/pr/pkg/summary"
+)
+
+// GoLoadStats forks a goroutine to load the statistics of the restored tables.
+// The tables are loaded one by one, so only the statistics of one table are
+// kept in memory. The tables without statistics are analyzed if analyze is
+// set. It returns a channel of the tables whose statistics are loaded.
+func (rc *Client) GoLoadStats(
+	ctx context.Context,
+	tableStream <-chan CreatedTable,
+	errCh chan<- error,
+	updateCh glue.Progress,
+	analyze bool,
+) <-chan CreatedTable {
+	log.Info("Start to load statistics")
+	outCh := make(chan CreatedTable, defaultChannelSize)
+	go func() {
+		start := time.Now()
+		defer func() {
+			log.Info("all statistics loaded")
+			summary.CollectDuration("restore stats", time.Since(start))
+			close(outCh)
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			case tbl, ok := <-tableStream:
+				if !ok {
+					return
+				}
+				if err := rc.loadTableStats(ctx, tbl, analyze); err != nil {
+					errCh <- err
+					return
+				}
+				updateCh.Inc()
+				select {
+				case <-ctx.Done():
+					errCh <- ctx.Err()
+					return
+				case outCh <- tbl:
+				}
+			}
+		}
+	}()
+	return outCh
+}
+
+// loadTableStats loads the statistics of the table. The failure of loading or
+// analyzing is not an error since the data is restored, the table can be
+// analyzed later.
+func (rc *Client) loadTableStats(ctx context.Context, tbl CreatedTable, analyze bool) error {
+	table := tbl.OldTable
+	logger := log.With(
+		zap.String("db", table.DB.Name.O),
+		zap.String("table", tbl.Table.Name.O),
+	)
+	if !table.HasStats() {
+		if !analyze {
+			return nil
+		}
+		logger.Info("analyze table without statistics")
+		if err := rc.db.AnalyzeTable(ctx, table.DB.Name, tbl.Table.Name); err != nil {
+			logger.Warn("analyze table failed", zap.Error(err))
+		}
+		return nil
+	}
+
+	stats := table.Stats
+	if stats == nil {
+		var err error
+		stats, err = rc.readStatsFile(ctx, table.StatsFile)
+		if err != nil {
+			return errors.Annotatef(err, "failed to read %s", table.StatsFile)
+		}
+	}
+	// the database and the table may be renamed on restore.
+	renamed := *stats
+	renamed.DatabaseName = table.DB.Name.O
+	renamed.TableName = tbl.Table.Name.O
+	start := time.Now()
+	if err := rc.statsHandler.LoadStatsFromJSON(rc.dom.InfoSchema(), &renamed); err != nil {
+		logger.Warn("load table stats failed", zap.Error(err))
+		return nil
+	}
+	logger.Info("table stats loaded", zap.Duration("take", time.Since(start)))
+	return nil
+}
+
+// readStatsFile reads the gzipped JSON statistics file in a streaming way.
+func (rc *Client) readStatsFile(ctx context.Context, name string) (*handle.JSONTable, error) {
+	reader, err := rc.storage.Open(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer reader.Close()
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer gzipReader.Close()
+	stats := &handle.JSONTable{}
+	if err = json.NewDecoder(gzipReader).Decode(stats); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return stats, nil
+}
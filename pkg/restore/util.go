@@ -27,6 +27,7 @@ import (
 	"github.com/Orion7r/pr/pkg/logutil"
 	"github.com/Orion7r/pr/pkg/rtree"
 	"github.com/Orion7r/pr/pkg/summary"
+	"github.com/Orion7r/pr/pkg/trace"
 	"github.com/Orion7r/pr/pkg/utils"
 )
 
@@ -227,9 +228,11 @@ func GoValidateFileRanges(
 ) <-chan TableWithRange {
 	// Could we have a smaller outCh size?
 	outCh := make(chan TableWithRange, len(fileOfTable))
+	span, ctx := trace.StartSpan(ctx, "GoValidateFileRanges")
 	go func() {
 		defer close(outCh)
 		defer log.Info("all range generated")
+		defer span.Finish()
 		for {
 			select {
 			case <-ctx.Done():
@@ -250,7 +253,12 @@ func GoValidateFileRanges(
 						files = append(files, fileOfTable[partition.ID]...)
 					}
 				}
+				tableSpan, _ := trace.StartSpan(ctx, "ValidateFileRanges")
+				tableSpan.SetTag("db", t.OldTable.DB.Name.O)
+				tableSpan.SetTag("table", t.OldTable.Info.Name.O)
+				tableSpan.SetTag("files", len(files))
 				ranges, err := ValidateFileRanges(files, t.RewriteRule)
+				trace.FinishSpan(tableSpan, err)
 				if err != nil {
 					errCh <- err
 					return
@@ -0,0 +1,671 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/spf13/pflag"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+)
+
+const (
+	azblobEndpointOption    = "azblob.endpoint"
+	azblobAccessTierOption  = "azblob.access-tier"
+	azblobAccountNameOption = "azblob.account-name"
+	azblobAccountKeyOption  = "azblob.account-key"
+	azblobSASTokenOption    = "azblob.sas-token"
+
+	azblobAccountNameEnv = "AZURE_STORAGE_ACCOUNT"
+	azblobAccountKeyEnv  = "AZURE_STORAGE_KEY"
+	azblobSASTokenEnv    = "AZURE_STORAGE_SAS_TOKEN"
+
+	// azblobAPIVersion is the version of the Blob service REST API we speak.
+	azblobAPIVersion = "2019-12-12"
+
+	azblobCopyPollInterval = 500 * time.Millisecond
+)
+
+// AzureBackendOptions contains options for Azure Blob Storage.
+type AzureBackendOptions struct {
+	Endpoint    string `json:"endpoint" toml:"endpoint"`
+	AccessTier  string `json:"access-tier" toml:"access-tier"`
+	AccountName string `json:"account-name" toml:"account-name"`
+	AccountKey  string `json:"account-key" toml:"account-key"`
+	SASToken    string `json:"sas-token" toml:"sas-token"`
+}
+
+// AzureBlobStorageConfig is the resolved configuration of an Azure Blob
+// Storage backend.
+type AzureBlobStorageConfig struct {
+	Endpoint    string
+	Container   string
+	Prefix      string
+	AccessTier  string
+	AccountName string
+	AccountKey  string
+	SASToken    string
+}
+
+func (options *AzureBackendOptions) apply(config *AzureBlobStorageConfig) error {
+	config.Endpoint = options.Endpoint
+	config.AccessTier = options.AccessTier
+	config.AccountName = options.AccountName
+	config.AccountKey = options.AccountKey
+	config.SASToken = strings.TrimPrefix(options.SASToken, "?")
+
+	// fallback to the environment variables used by the azure cli.
+	if config.AccountName == "" {
+		config.AccountName = os.Getenv(azblobAccountNameEnv)
+	}
+	if config.AccountKey == "" && config.SASToken == "" {
+		config.AccountKey = os.Getenv(azblobAccountKeyEnv)
+		config.SASToken = strings.TrimPrefix(os.Getenv(azblobSASTokenEnv), "?")
+	}
+
+	if config.AccountName == "" && config.Endpoint == "" {
+		return errors.Annotate(berrors.ErrStorageInvalidConfig,
+			"account name not found, please set --azblob.account-name or the endpoint")
+	}
+	if config.AccountKey != "" && config.AccountName == "" {
+		return errors.Annotate(berrors.ErrStorageInvalidConfig, "account name is required by the account key")
+	}
+	if config.AccountKey != "" {
+		if _, err := base64.StdEncoding.DecodeString(config.AccountKey); err != nil {
+			return errors.Annotate(berrors.ErrStorageInvalidConfig, "account key is not a valid base64 string")
+		}
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", config.AccountName)
+	} else {
+		u, err := url.Parse(config.Endpoint)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if u.Scheme == "" {
+			return errors.Annotate(berrors.ErrStorageInvalidConfig, "scheme not found in endpoint")
+		}
+		if u.Host == "" {
+			return errors.Annotate(berrors.ErrStorageInvalidConfig, "host not found in endpoint")
+		}
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return nil
+}
+
+func defineAzureFlags(flags *pflag.FlagSet) {
+	// TODO: remove experimental tag if it's stable
+	flags.String(azblobEndpointOption, "",
+		"(experimental) Set the Azure Blob Storage endpoint URL, e.g. http://127.0.0.1:10000/devstoreaccount1")
+	flags.String(azblobAccessTierOption, "", "(experimental) Specify the access tier for objects, e.g. Hot, Cool, Archive")
+	flags.String(azblobAccountNameOption, "", "(experimental) Set the Azure storage account name")
+	flags.String(azblobAccountKeyOption, "", "(experimental) Set the Azure storage account shared key")
+	flags.String(azblobSASTokenOption, "", "(experimental) Set the Azure shared access signature token")
+}
+
+func (options *AzureBackendOptions) parseFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	options.Endpoint, err = flags.GetString(azblobEndpointOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	options.AccessTier, err = flags.GetString(azblobAccessTierOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	options.AccountName, err = flags.GetString(azblobAccountNameOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	options.AccountKey, err = flags.GetString(azblobAccountKeyOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	options.SASToken, err = flags.GetString(azblobSASTokenOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// AzureBlobStorage is a storage backend on Azure Blob Storage.
+//
+// It talks to the Blob service REST API directly, so it also works with
+// Azurite and other compatible implementations.
+type AzureBlobStorage struct {
+	config *AzureBlobStorageConfig
+	client *http.Client
+	key    []byte
+}
+
+func newAzureBlobStorage(
+	ctx context.Context,
+	config *AzureBlobStorageConfig,
+	opts *ExternalStorageOptions,
+) (*AzureBlobStorage, error) {
+	s := &AzureBlobStorage{
+		config: config,
+		client: http.DefaultClient,
+	}
+	if opts.HTTPClient != nil {
+		s.client = opts.HTTPClient
+	}
+	if config.AccountKey != "" {
+		key, err := base64.StdEncoding.DecodeString(config.AccountKey)
+		if err != nil {
+			return nil, errors.Annotate(berrors.ErrStorageInvalidConfig, "account key is not a valid base64 string")
+		}
+		s.key = key
+	}
+	if !opts.SkipCheckPath {
+		// check container exists
+		query := url.Values{"restype": []string{"container"}}
+		resp, err := s.do(ctx, http.MethodHead, "", query, nil, nil)
+		if err != nil {
+			return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig,
+				"Container %s is not accessible: %v", config.Container, err)
+		}
+		resp.Body.Close()
+	}
+	return s, nil
+}
+
+func (s *AzureBlobStorage) objectName(name string) string {
+	return path.Join(s.config.Prefix, name)
+}
+
+// requestURL returns the URL to the blob, or to the container if blob is empty.
+func (s *AzureBlobStorage) requestURL(blob string, query url.Values) (*url.URL, error) {
+	u, err := url.Parse(s.config.Endpoint)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.config.Container
+	if blob != "" {
+		u.Path += "/" + blob
+	}
+	q := url.Values{}
+	if s.key == nil && s.config.SASToken != "" {
+		q, err = url.ParseQuery(s.config.SASToken)
+		if err != nil {
+			return nil, errors.Annotate(berrors.ErrStorageInvalidConfig, "invalid SAS token")
+		}
+	}
+	for k, v := range query {
+		q[k] = v
+	}
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// do sends a request to the Blob service. A response with non-2xx status is
+// converted into an error.
+func (s *AzureBlobStorage) do(
+	ctx context.Context,
+	method, blob string,
+	query url.Values,
+	header http.Header,
+	body []byte,
+) (*http.Response, error) {
+	u, err := s.requestURL(blob, query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("x-ms-version", azblobAPIVersion)
+	s.authorize(req)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, &azblobError{
+			method:     method,
+			blob:       blob,
+			statusCode: resp.StatusCode,
+			code:       resp.Header.Get("x-ms-error-code"),
+		}
+	}
+	return resp, nil
+}
+
+// authorize sets the Shared Key authorization header of the request if the
+// account key is set, it must be called after all headers are set.
+func (s *AzureBlobStorage) authorize(req *http.Request) {
+	if s.key != nil {
+		req.Header.Set("Authorization", "SharedKey "+s.config.AccountName+":"+s.sign(req))
+	}
+}
+
+// sign computes the signature of the request for the Shared Key authorization.
+// See https://docs.microsoft.com/en-us/rest/api/storageservices/authorize-with-shared-key.
+func (s *AzureBlobStorage) sign(req *http.Request) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	stringToSign := strings.Join([]string{
+		req.Method,
+		req.Header.Get("Content-Encoding"),
+		req.Header.Get("Content-Language"),
+		contentLength,
+		req.Header.Get("Content-MD5"),
+		req.Header.Get("Content-Type"),
+		"", // Date, we always use x-ms-date instead.
+		req.Header.Get("If-Modified-Since"),
+		req.Header.Get("If-Match"),
+		req.Header.Get("If-None-Match"),
+		req.Header.Get("If-Unmodified-Since"),
+		req.Header.Get("Range"),
+		canonicalizedAzureHeaders(req.Header) + canonicalizedAzureResource(s.config.AccountName, req.URL),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = mac.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func canonicalizedAzureHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-ms-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.TrimSpace(header.Get(name)))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func canonicalizedAzureResource(account string, u *url.URL) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	b.WriteString(account)
+	b.WriteString(u.EscapedPath())
+
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		b.WriteByte('\n')
+		b.WriteString(strings.ToLower(name))
+		b.WriteByte(':')
+		b.WriteString(strings.Join(values, ","))
+	}
+	return b.String()
+}
+
+// azblobError is the error returned by the Blob service.
+type azblobError struct {
+	method     string
+	blob       string
+	statusCode int
+	code       string
+}
+
+func (e *azblobError) Error() string {
+	return fmt.Sprintf("azure blob request %s '%s' failed, status: %d, code: %s",
+		e.method, e.blob, e.statusCode, e.code)
+}
+
+func isAzureBlobNotFound(err error) bool {
+	e, ok := errors.Cause(err).(*azblobError) // nolint:errorlint
+	return ok && e.statusCode == http.StatusNotFound
+}
+
+// Write file to storage.
+func (s *AzureBlobStorage) Write(ctx context.Context, name string, data []byte) error {
+	header := http.Header{}
+	header.Set("x-ms-blob-type", "BlockBlob")
+	if s.config.AccessTier != "" {
+		header.Set("x-ms-access-tier", s.config.AccessTier)
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.objectName(name), nil, header, data)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return resp.Body.Close()
+}
+
+// Read storage file.
+func (s *AzureBlobStorage) Read(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.objectName(name), nil, nil, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, errors.Trace(err)
+}
+
+// FileExists return true if file exists.
+func (s *AzureBlobStorage) FileExists(ctx context.Context, name string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.objectName(name), nil, nil, nil)
+	if err != nil {
+		if isAzureBlobNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Trace(err)
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+// Open a Reader by file path.
+func (s *AzureBlobStorage) Open(ctx context.Context, path string) (ReadSeekCloser, error) {
+	resp, err := s.do(ctx, http.MethodHead, s.objectName(path), nil, nil, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	resp.Body.Close()
+	return &azblobObjectReader{
+		storage:   s,
+		name:      path,
+		totalSize: resp.ContentLength,
+		ctx:       ctx,
+	}, nil
+}
+
+type azblobListResult struct {
+	Blobs []struct {
+		Name       string `xml:"Name"`
+		Properties struct {
+			ContentLength int64 `xml:"Content-Length"`
+		} `xml:"Properties"`
+	} `xml:"Blobs>Blob"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// WalkDir traverse all the files in a dir.
+//
+// fn is the function called for each regular file visited by WalkDir.
+// The first argument is the file path that can be used in `Open`
+// function; the second argument is the size in byte of the file determined
+// by path.
+func (s *AzureBlobStorage) WalkDir(ctx context.Context, opt *WalkOption, fn func(string, int64) error) error {
+	if opt == nil {
+		opt = &WalkOption{}
+	}
+	prefix := path.Join(s.config.Prefix, opt.SubDir)
+	if len(prefix) > 0 && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	maxResults := int64(1000)
+	if opt.ListCount > 0 {
+		maxResults = opt.ListCount
+	}
+
+	query := url.Values{}
+	query.Set("restype", "container")
+	query.Set("comp", "list")
+	query.Set("prefix", prefix)
+	query.Set("maxresults", strconv.FormatInt(maxResults, 10))
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		var res azblobListResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, blob := range res.Blobs {
+			// when walk on specify directory, the result include storage.Prefix,
+			// which can not be reuse in other API(Open/Read) directly.
+			// so we use TrimPrefix to filter Prefix for next Open/Read.
+			path := strings.TrimPrefix(blob.Name, s.config.Prefix)
+			path = strings.TrimPrefix(path, "/")
+			if err = fn(path, blob.Properties.ContentLength); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if res.NextMarker == "" {
+			break
+		}
+		query.Set("marker", res.NextMarker)
+	}
+	return nil
+}
+
+// URI returns azure://<container>/<prefix>.
+func (s *AzureBlobStorage) URI() string {
+	return "azure://" + s.config.Container + "/" + s.config.Prefix
+}
+
+// DeleteFile delete the file in storage.
+func (s *AzureBlobStorage) DeleteFile(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.objectName(name), nil, nil, nil)
+	if err != nil {
+		if isAzureBlobNotFound(err) {
+			return nil
+		}
+		return errors.Trace(err)
+	}
+	return resp.Body.Close()
+}
+
+// DeleteFiles delete the files in storage.
+func (s *AzureBlobStorage) DeleteFiles(ctx context.Context, names []string) error {
+	for _, name := range names {
+		if err := s.DeleteFile(ctx, name); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Rename copies the blob to the new name and then deletes the old one, since
+// Azure Blob Storage doesn't support renaming.
+func (s *AzureBlobStorage) Rename(ctx context.Context, oldFileName, newFileName string) error {
+	source, err := s.requestURL(s.objectName(oldFileName), nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	header := http.Header{}
+	header.Set("x-ms-copy-source", source.String())
+	if s.config.AccessTier != "" {
+		header.Set("x-ms-access-tier", s.config.AccessTier)
+	}
+	dest := s.objectName(newFileName)
+	resp, err := s.do(ctx, http.MethodPut, dest, nil, header, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp.Body.Close()
+
+	// the copy in the same storage account usually completes synchronously,
+	// otherwise wait for it.
+	status := resp.Header.Get("x-ms-copy-status")
+	for status == "pending" {
+		select {
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		case <-time.After(azblobCopyPollInterval):
+		}
+		resp, err = s.do(ctx, http.MethodHead, dest, nil, nil, nil)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		resp.Body.Close()
+		status = resp.Header.Get("x-ms-copy-status")
+	}
+	if status != "" && status != "success" {
+		return errors.Annotatef(berrors.ErrStorageUnknown, "copy blob '%s' to '%s' failed, status: %s, description: %s",
+			oldFileName, newFileName, status, resp.Header.Get("x-ms-copy-status-description"))
+	}
+	return s.DeleteFile(ctx, oldFileName)
+}
+
+// CreateUploader implements ExternalStorage interface.
+func (s *AzureBlobStorage) CreateUploader(ctx context.Context, name string) (Uploader, error) {
+	return &azblobUploader{
+		storage:  s,
+		blob:     s.objectName(name),
+		blockIDs: make([]string, 0, 128),
+	}, nil
+}
+
+// azblobUploader does staged block upload to Azure Blob Storage.
+type azblobUploader struct {
+	storage  *AzureBlobStorage
+	blob     string
+	blockIDs []string
+}
+
+// UploadPart stages a block of the blob.
+func (u *azblobUploader) UploadPart(ctx context.Context, data []byte) error {
+	// all block IDs of a blob must have the same length.
+	blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%010d", len(u.blockIDs))))
+	query := url.Values{}
+	query.Set("comp", "block")
+	query.Set("blockid", blockID)
+	resp, err := u.storage.do(ctx, http.MethodPut, u.blob, query, nil, data)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp.Body.Close()
+	u.blockIDs = append(u.blockIDs, blockID)
+	return nil
+}
+
+// CompleteUpload commits the staged blocks as the blob content.
+func (u *azblobUploader) CompleteUpload(ctx context.Context) error {
+	var body bytes.Buffer
+	body.WriteString(xml.Header)
+	body.WriteString("<BlockList>")
+	for _, id := range u.blockIDs {
+		body.WriteString("<Latest>")
+		body.WriteString(id)
+		body.WriteString("</Latest>")
+	}
+	body.WriteString("</BlockList>")
+
+	query := url.Values{}
+	query.Set("comp", "blocklist")
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	if u.storage.config.AccessTier != "" {
+		header.Set("x-ms-access-tier", u.storage.config.AccessTier)
+	}
+	resp, err := u.storage.do(ctx, http.MethodPut, u.blob, query, header, body.Bytes())
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return resp.Body.Close()
+}
+
+// azblobObjectReader reads a blob with ranged requests and supports `Seek`.
+type azblobObjectReader struct {
+	storage   *AzureBlobStorage
+	name      string
+	reader    io.ReadCloser
+	pos       int64
+	totalSize int64
+	// reader context used for implement `io.Seek`
+	ctx context.Context
+}
+
+// Read implement the io.Reader interface.
+func (r *azblobObjectReader) Read(p []byte) (n int, err error) {
+	if r.pos >= r.totalSize {
+		return 0, io.EOF
+	}
+	if r.reader == nil {
+		header := http.Header{}
+		header.Set("x-ms-range", fmt.Sprintf("bytes=%d-", r.pos))
+		resp, err := r.storage.do(r.ctx, http.MethodGet, r.storage.objectName(r.name), nil, header, nil)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		r.reader = resp.Body
+	}
+	n, err = r.reader.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+// Close implement the io.Closer interface.
+func (r *azblobObjectReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Close()
+}
+
+// Seek implement the io.Seeker interface.
+func (r *azblobObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var realOffset int64
+	switch whence {
+	case io.SeekStart:
+		realOffset = offset
+	case io.SeekCurrent:
+		realOffset = r.pos + offset
+	case io.SeekEnd:
+		realOffset = r.totalSize + offset
+	default:
+		return 0, errors.Annotatef(berrors.ErrStorageUnknown, "Seek: invalid whence '%d'", whence)
+	}
+	if realOffset < 0 {
+		return 0, errors.Annotatef(berrors.ErrStorageUnknown, "Seek: offset '%d' out of range", realOffset)
+	}
+	if realOffset == r.pos {
+		return realOffset, nil
+	}
+	if r.reader != nil {
+		if err := r.reader.Close(); err != nil {
+			return 0, errors.Trace(err)
+		}
+		r.reader = nil
+	}
+	r.pos = realOffset
+	return realOffset, nil
+}
@@ -0,0 +1,376 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package storage
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/pingcap/check"
+)
+
+const (
+	fakeAzureAccount   = "devstoreaccount1"
+	fakeAzureContainer = "container"
+	// the well-known key of Azurite.
+	fakeAzureKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// fakeAzurite is a minimal in-memory stand-in of the Blob service.
+type fakeAzurite struct {
+	mu     sync.Mutex
+	blobs  map[string][]byte
+	blocks map[string]map[string][]byte
+	// requireSAS makes the server reject requests without a `sig` query.
+	requireSAS bool
+}
+
+func newFakeAzurite() *fakeAzurite {
+	return &fakeAzurite{
+		blobs:  make(map[string][]byte),
+		blocks: make(map[string]map[string][]byte),
+	}
+}
+
+func (f *fakeAzurite) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.requireSAS {
+		if req.URL.Query().Get("sig") == "" || req.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+	} else if !strings.HasPrefix(req.Header.Get("Authorization"), "SharedKey "+fakeAzureAccount+":") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if req.Header.Get("x-ms-version") == "" || req.Header.Get("x-ms-date") == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 3)
+	if len(parts) < 2 || parts[0] != fakeAzureAccount || parts[1] != fakeAzureContainer {
+		w.Header().Set("x-ms-error-code", "ContainerNotFound")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	query := req.URL.Query()
+	if len(parts) == 2 {
+		switch {
+		case req.Method == http.MethodHead && query.Get("restype") == "container":
+			w.WriteHeader(http.StatusOK)
+		case req.Method == http.MethodGet && query.Get("comp") == "list":
+			f.list(w, query.Get("prefix"), query.Get("maxresults"), query.Get("marker"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		return
+	}
+
+	blob := parts[2]
+	body, _ := ioutil.ReadAll(req.Body)
+	switch req.Method {
+	case http.MethodPut:
+		switch query.Get("comp") {
+		case "":
+			if source := req.Header.Get("x-ms-copy-source"); source != "" {
+				prefix := "/" + fakeAzureAccount + "/" + fakeAzureContainer + "/"
+				u, err := url.Parse(source)
+				if err != nil || !strings.HasPrefix(u.Path, prefix) {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				content, ok := f.blobs[strings.TrimPrefix(u.Path, prefix)]
+				if !ok {
+					w.Header().Set("x-ms-error-code", "CannotVerifyCopySource")
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				f.blobs[blob] = content
+				w.Header().Set("x-ms-copy-status", "success")
+				w.WriteHeader(http.StatusAccepted)
+				return
+			}
+			if req.Header.Get("x-ms-blob-type") != "BlockBlob" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.blobs[blob] = body
+		case "block":
+			if f.blocks[blob] == nil {
+				f.blocks[blob] = make(map[string][]byte)
+			}
+			f.blocks[blob][query.Get("blockid")] = body
+		case "blocklist":
+			var list struct {
+				Latest []string `xml:"Latest"`
+			}
+			if err := xml.Unmarshal(body, &list); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			var content []byte
+			for _, id := range list.Latest {
+				block, ok := f.blocks[blob][id]
+				if !ok {
+					w.Header().Set("x-ms-error-code", "InvalidBlockList")
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				content = append(content, block...)
+			}
+			delete(f.blocks, blob)
+			f.blobs[blob] = content
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		content, ok := f.blobs[blob]
+		if !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if req.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		status := http.StatusOK
+		if r := req.Header.Get("x-ms-range"); r != "" {
+			start, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r, "bytes="), "-"))
+			if err != nil || start > len(content) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			content = content[start:]
+			status = http.StatusPartialContent
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write(content)
+	case http.MethodDelete:
+		if _, ok := f.blobs[blob]; !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.blobs, blob)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeAzurite) list(w http.ResponseWriter, prefix, maxResults, marker string) {
+	names := make([]string, 0, len(f.blobs))
+	for name := range f.blobs {
+		if strings.HasPrefix(name, prefix) && name > marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	limit, err := strconv.Atoi(maxResults)
+	if err != nil || limit <= 0 {
+		limit = 5000
+	}
+	nextMarker := ""
+	if len(names) > limit {
+		names = names[:limit]
+		nextMarker = names[limit-1]
+	}
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString("<EnumerationResults><Blobs>")
+	for _, name := range names {
+		fmt.Fprintf(&b, "<Blob><Name>%s</Name><Properties><Content-Length>%d</Content-Length></Properties></Blob>",
+			name, len(f.blobs[name]))
+	}
+	fmt.Fprintf(&b, "</Blobs><NextMarker>%s</NextMarker></EnumerationResults>", nextMarker)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(b.String()))
+}
+
+func (r *testStorageSuite) TestAzureBlobStorage(c *C) {
+	ctx := context.Background()
+	server := httptest.NewServer(newFakeAzurite())
+	defer server.Close()
+
+	options := &BackendOptions{Azure: AzureBackendOptions{
+		Endpoint:    server.URL + "/" + fakeAzureAccount,
+		AccountName: fakeAzureAccount,
+		AccountKey:  fakeAzureKey,
+		AccessTier:  "Cool",
+	}}
+	stg, err := NewFromURL(ctx, "azure://"+fakeAzureContainer+"/a/b/", options, &ExternalStorageOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(stg.URI(), Equals, "azure://container/a/b")
+
+	err = stg.Write(ctx, "key", []byte("data"))
+	c.Assert(err, IsNil)
+	d, err := stg.Read(ctx, "key")
+	c.Assert(err, IsNil)
+	c.Assert(d, DeepEquals, []byte("data"))
+
+	exist, err := stg.FileExists(ctx, "key")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsTrue)
+	exist, err = stg.FileExists(ctx, "key_not_exist")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+
+	_, err = stg.Read(ctx, "key_not_exist")
+	c.Assert(err, ErrorMatches, ".*status: 404, code: BlobNotFound.*")
+
+	// staged block upload through the writer.
+	uploader, err := stg.CreateUploader(ctx, "sub/multi")
+	c.Assert(err, IsNil)
+	writer := newUploaderWriter(uploader, 4, NoCompression)
+	_, err = writer.Write(ctx, []byte("0123456789"))
+	c.Assert(err, IsNil)
+	err = writer.Close(ctx)
+	c.Assert(err, IsNil)
+	d, err = stg.Read(ctx, "sub/multi")
+	c.Assert(err, IsNil)
+	c.Assert(string(d), Equals, "0123456789")
+
+	// open and seek.
+	reader, err := stg.Open(ctx, "sub/multi")
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(reader, buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "012")
+	offset, err := reader.Seek(-2, io.SeekEnd)
+	c.Assert(err, IsNil)
+	c.Assert(offset, Equals, int64(8))
+	rest, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(rest), Equals, "89")
+
+	// walk with paging.
+	for i := 0; i < 5; i++ {
+		err = stg.Write(ctx, fmt.Sprintf("sub/file%d", i), []byte(strings.Repeat("x", i)))
+		c.Assert(err, IsNil)
+	}
+	walked := make(map[string]int64)
+	err = stg.WalkDir(ctx, &WalkOption{SubDir: "sub", ListCount: 2}, func(path string, size int64) error {
+		walked[path] = size
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(walked, DeepEquals, map[string]int64{
+		"sub/multi": 10,
+		"sub/file0": 0,
+		"sub/file1": 1,
+		"sub/file2": 2,
+		"sub/file3": 3,
+		"sub/file4": 4,
+	})
+
+	// rename and delete.
+	err = stg.Rename(ctx, "sub/multi", "renamed")
+	c.Assert(err, IsNil)
+	exist, err = stg.FileExists(ctx, "sub/multi")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	d, err = stg.Read(ctx, "renamed")
+	c.Assert(err, IsNil)
+	c.Assert(string(d), Equals, "0123456789")
+	err = stg.Rename(ctx, "sub/multi", "renamed")
+	c.Assert(err, ErrorMatches, ".*code: CannotVerifyCopySource.*")
+
+	err = stg.DeleteFile(ctx, "renamed")
+	c.Assert(err, IsNil)
+	err = stg.DeleteFile(ctx, "renamed")
+	c.Assert(err, IsNil)
+	err = stg.DeleteFiles(ctx, []string{"sub/file0", "sub/file1", "sub/file2", "sub/file3", "sub/file4"})
+	c.Assert(err, IsNil)
+	err = stg.WalkDir(ctx, nil, func(path string, size int64) error {
+		c.Assert(path, Equals, "key")
+		return nil
+	})
+	c.Assert(err, IsNil)
+}
+
+func (r *testStorageSuite) TestAzureBlobStorageSharedKey(c *C) {
+	config := &AzureBlobStorageConfig{
+		Endpoint:    "https://" + fakeAzureAccount + ".blob.core.windows.net",
+		Container:   fakeAzureContainer,
+		AccountName: fakeAzureAccount,
+		AccountKey:  fakeAzureKey,
+	}
+	s, err := newAzureBlobStorage(context.Background(), config, &ExternalStorageOptions{SkipCheckPath: true})
+	c.Assert(err, IsNil)
+
+	u, err := s.requestURL("backup/file", url.Values{"comp": {"block"}, "blockid": {"YmxvY2s="}})
+	c.Assert(err, IsNil)
+	req, err := http.NewRequest(http.MethodPut, u.String(), strings.NewReader("hello"))
+	c.Assert(err, IsNil)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("x-ms-date", "Fri, 16 Oct 2026 00:00:00 GMT")
+	req.Header.Set("x-ms-version", azblobAPIVersion)
+	s.authorize(req)
+	// the signature of the string to sign:
+	// "PUT\n\n\n5\n\ntext/plain\n\n\n\n\n\n\n" +
+	// "x-ms-blob-type:BlockBlob\nx-ms-date:Fri, 16 Oct 2026 00:00:00 GMT\nx-ms-version:2019-12-12\n" +
+	// "/devstoreaccount1/container/backup/file\nblockid:YmxvY2s=\ncomp:block"
+	c.Assert(req.Header.Get("Authorization"), Equals,
+		"SharedKey devstoreaccount1:QkaLXmSnQ3BpJb7QDoMoEJCXT+vXpUBMUCCgELbbHr4=")
+
+	// the signature changes with any signed part of the request.
+	req.Header.Set("x-ms-date", "Fri, 16 Oct 2026 00:00:01 GMT")
+	s.authorize(req)
+	c.Assert(req.Header.Get("Authorization"), Not(Equals),
+		"SharedKey devstoreaccount1:QkaLXmSnQ3BpJb7QDoMoEJCXT+vXpUBMUCCgELbbHr4=")
+}
+
+func (r *testStorageSuite) TestAzureBlobStorageSAS(c *C) {
+	ctx := context.Background()
+	fake := newFakeAzurite()
+	fake.requireSAS = true
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	options := &BackendOptions{Azure: AzureBackendOptions{
+		Endpoint: server.URL + "/" + fakeAzureAccount,
+		SASToken: "?sv=2019-12-12&ss=b&sig=fakesig",
+	}}
+	stg, err := NewFromURL(ctx, "azblob://"+fakeAzureContainer+"/prefix", options, &ExternalStorageOptions{})
+	c.Assert(err, IsNil)
+	err = stg.Write(ctx, "key", []byte("data"))
+	c.Assert(err, IsNil)
+	c.Assert(fake.blobs["prefix/key"], DeepEquals, []byte("data"))
+
+	// a wrong container is rejected when checking the path.
+	_, err = NewFromURL(ctx, "azure://missing/prefix", options, &ExternalStorageOptions{})
+	c.Assert(err, ErrorMatches, ".*Container missing is not accessible.*")
+}
+
+func (r *testStorageSuite) TestAzureBackendOptions(c *C) {
+	_, err := ParseBackend("azure://container/prefix", nil)
+	c.Assert(err, ErrorMatches, ".*not supported by TiKV yet.*")
+
+	config := &AzureBlobStorageConfig{}
+	options := &AzureBackendOptions{AccountName: "account"}
+	c.Assert(options.apply(config), IsNil)
+	c.Assert(config.Endpoint, Equals, "https://account.blob.core.windows.net")
+
+	options = &AzureBackendOptions{AccountName: "account", AccountKey: "not base64!"}
+	c.Assert(options.apply(config), ErrorMatches, ".*not a valid base64 string.*")
+
+	options = &AzureBackendOptions{AccountName: "account", Endpoint: "127.0.0.1:10000"}
+	c.Assert(options.apply(config), NotNil)
+}
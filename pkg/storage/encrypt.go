@@ -0,0 +1,639 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/spf13/pflag"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+)
+
+const (
+	encryptionMethodOption  = "encryption.method"
+	encryptionKeyOption     = "encryption.key"
+	encryptionKeyFileOption = "encryption.key-file"
+
+	// encryptionKeyEnv is the environment variable of the hex encoded key,
+	// it is used when neither the key nor the key file is specified.
+	encryptionKeyEnv = "BR_ENCRYPTION_KEY"
+
+	// encryptionKeyLen is the key length of AES-256.
+	encryptionKeyLen = 32
+
+	// The header of an encrypted file is laid out as:
+	//
+	//   magic (4 bytes) | version (1 byte) | method (1 byte) | key ID (8 bytes) | IV (16 bytes)
+	encryptionMagic     = "BREN"
+	encryptionVersion   = 1
+	encryptionKeyIDLen  = 8
+	encryptionIVLen     = aes.BlockSize
+	encryptionHeaderLen = len(encryptionMagic) + 2 + encryptionKeyIDLen + encryptionIVLen
+
+	// encryptionChunkSize is the size of the plaintext sealed as a whole by AES-256-GCM.
+	// The chunks are authenticated independently, so the file can be read from any offset.
+	encryptionChunkSize = 64 * 1024
+	gcmNonceLen         = 12
+	gcmTagLen           = 16
+)
+
+// EncryptionMethod is the cipher used to encrypt the files on the BR side.
+type EncryptionMethod string
+
+// The encryption methods.
+const (
+	EncryptionPlaintext EncryptionMethod = "plaintext"
+	EncryptionAES256GCM EncryptionMethod = "aes256-gcm"
+	EncryptionAES256CTR EncryptionMethod = "aes256-ctr"
+)
+
+// the method ID recorded in the header.
+func (method EncryptionMethod) id() byte {
+	switch method {
+	case EncryptionAES256GCM:
+		return 1
+	case EncryptionAES256CTR:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func encryptionMethodFromID(id byte) (EncryptionMethod, bool) {
+	for _, method := range []EncryptionMethod{EncryptionAES256GCM, EncryptionAES256CTR} {
+		if method.id() == id {
+			return method, true
+		}
+	}
+	return "", false
+}
+
+// EncryptionOptions are options for the client-side encryption.
+type EncryptionOptions struct {
+	Method  string `json:"method" toml:"method"`
+	Key     string `json:"key" toml:"key"`
+	KeyFile string `json:"key-file" toml:"key-file"`
+}
+
+// DefineEncryptionFlags adds flags to the flag set corresponding to the encryption options.
+func DefineEncryptionFlags(flags *pflag.FlagSet) {
+	flags.String(encryptionMethodOption, string(EncryptionPlaintext),
+		"Encrypt the files written by BR (e.g. backupmeta) on the client side, "+
+			"one of plaintext, aes256-gcm or aes256-ctr. The SST files are written by TiKV and are not encrypted")
+	flags.String(encryptionKeyOption, "",
+		"The hex encoded 256-bit encryption key, $"+encryptionKeyEnv+" is used if both key and key file are empty")
+	flags.String(encryptionKeyFileOption, "", "The path of the file containing the hex encoded 256-bit encryption key")
+}
+
+// ParseFromFlags obtains the encryption options from the flag set.
+func (options *EncryptionOptions) ParseFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	options.Method, err = flags.GetString(encryptionMethodOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	options.Key, err = flags.GetString(encryptionKeyOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	options.KeyFile, err = flags.GetString(encryptionKeyFileOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// Config resolves the key and returns the encryption config.
+// It returns nil if the encryption is disabled.
+func (options *EncryptionOptions) Config() (*EncryptionConfig, error) {
+	method := EncryptionMethod(strings.ToLower(options.Method))
+	switch method {
+	case "", EncryptionPlaintext:
+		return nil, nil
+	case EncryptionAES256GCM, EncryptionAES256CTR:
+	default:
+		return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig,
+			"unknown encryption method '%s', should be one of %s, %s or %s",
+			options.Method, EncryptionPlaintext, EncryptionAES256GCM, EncryptionAES256CTR)
+	}
+
+	hexKey := options.Key
+	if hexKey == "" && options.KeyFile != "" {
+		content, err := ioutil.ReadFile(options.KeyFile)
+		if err != nil {
+			return nil, errors.Annotate(err, "failed to read the encryption key file")
+		}
+		hexKey = string(content)
+	}
+	if hexKey == "" {
+		hexKey = os.Getenv(encryptionKeyEnv)
+	}
+	hexKey = strings.TrimSpace(hexKey)
+	if hexKey == "" {
+		return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig,
+			"encryption key is required by %s, please set --%s, --%s or $%s",
+			method, encryptionKeyOption, encryptionKeyFileOption, encryptionKeyEnv)
+	}
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, errors.Annotate(berrors.ErrStorageInvalidConfig, "encryption key should be hex encoded")
+	}
+	if len(key) != encryptionKeyLen {
+		return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig,
+			"encryption key should be %d bytes, but got %d bytes", encryptionKeyLen, len(key))
+	}
+	return &EncryptionConfig{Method: method, Key: key}, nil
+}
+
+// EncryptionConfig is the config of the client-side encryption.
+type EncryptionConfig struct {
+	Method EncryptionMethod
+	Key    []byte
+}
+
+// KeyID returns the identifier of the key recorded in the header of the encrypted files.
+func (config *EncryptionConfig) KeyID() string {
+	return hex.EncodeToString(encryptionKeyID(config.Key))
+}
+
+func encryptionKeyID(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:encryptionKeyIDLen]
+}
+
+// encryptedStorage encrypts the files written to and decrypts the files read
+// from the underlying ExternalStorage.
+//
+// The operations do not touch the content (FileExists, WalkDir, Delete, etc.)
+// are passed through, so the size reported by WalkDir is the encrypted size.
+type encryptedStorage struct {
+	ExternalStorage
+
+	method EncryptionMethod
+	block  cipher.Block
+	keyID  []byte
+}
+
+// NewEncryptedStorage wraps the storage with the client-side encryption.
+func NewEncryptedStorage(inner ExternalStorage, config *EncryptionConfig) (ExternalStorage, error) {
+	if config.Method.id() == 0 {
+		return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig, "unsupported encryption method '%s'", config.Method)
+	}
+	if len(config.Key) != encryptionKeyLen {
+		return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig,
+			"encryption key should be %d bytes, but got %d bytes", encryptionKeyLen, len(config.Key))
+	}
+	block, err := aes.NewCipher(config.Key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &encryptedStorage{
+		ExternalStorage: inner,
+		method:          config.Method,
+		block:           block,
+		keyID:           encryptionKeyID(config.Key),
+	}, nil
+}
+
+// WithoutEncryption returns the storage which reads and writes the files as-is,
+// e.g. to access the SST files written by TiKV.
+func WithoutEncryption(s ExternalStorage) ExternalStorage {
+	if es, ok := s.(*encryptedStorage); ok {
+		return es.ExternalStorage
+	}
+	return s
+}
+
+// Write encrypts the data and writes it to the storage.
+func (s *encryptedStorage) Write(ctx context.Context, name string, data []byte) error {
+	enc, err := s.newEncrypter()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	buf := make([]byte, 0, encryptionHeaderLen+len(data)+(len(data)/encryptionChunkSize+1)*gcmTagLen)
+	buf = enc.seal(enc.header(buf), data)
+	buf = enc.finish(buf)
+	return s.ExternalStorage.Write(ctx, name, buf)
+}
+
+// Read reads and decrypts the file.
+func (s *encryptedStorage) Read(ctx context.Context, name string) ([]byte, error) {
+	data, err := s.ExternalStorage.Read(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	r, err := s.newDecryptReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to decrypt file '%s'", name)
+	}
+	plaintext, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to decrypt file '%s'", name)
+	}
+	return plaintext, nil
+}
+
+// Open a Reader by file path, the reader decrypts the file on the fly.
+func (s *encryptedStorage) Open(ctx context.Context, name string) (ReadSeekCloser, error) {
+	reader, err := s.ExternalStorage.Open(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	r, err := s.newDecryptReader(reader)
+	if err != nil {
+		_ = reader.Close()
+		return nil, errors.Annotatef(err, "failed to decrypt file '%s'", name)
+	}
+	return r, nil
+}
+
+// CreateUploader creates an Uploader which encrypts the parts before uploading.
+func (s *encryptedStorage) CreateUploader(ctx context.Context, name string) (Uploader, error) {
+	enc, err := s.newEncrypter()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	uploader, err := s.ExternalStorage.CreateUploader(ctx, name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &encryptedUploader{
+		uploader:  uploader,
+		encrypter: enc,
+		buf:       enc.header(nil),
+	}, nil
+}
+
+func (s *encryptedStorage) newEncrypter() (*encrypter, error) {
+	iv := make([]byte, encryptionIVLen)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, errors.Trace(err)
+	}
+	enc := &encrypter{method: s.method, keyID: s.keyID, iv: iv}
+	switch s.method {
+	case EncryptionAES256GCM:
+		aead, err := cipher.NewGCM(s.block)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		enc.aead = aead
+	case EncryptionAES256CTR:
+		enc.stream = newCTRStream(s.block, iv, 0)
+	}
+	return enc, nil
+}
+
+func (s *encryptedStorage) newDecryptReader(inner io.ReadSeeker) (*decryptReader, error) {
+	header := make([]byte, encryptionHeaderLen)
+	if _, err := io.ReadFull(inner, header); err != nil || string(header[:len(encryptionMagic)]) != encryptionMagic {
+		return nil, errors.Annotate(berrors.ErrStorageEncryption, "the file is not encrypted by BR")
+	}
+	header = header[len(encryptionMagic):]
+	if header[0] != encryptionVersion {
+		return nil, errors.Annotatef(berrors.ErrStorageEncryption, "unsupported encryption version %d", header[0])
+	}
+	method, ok := encryptionMethodFromID(header[1])
+	if !ok {
+		return nil, errors.Annotatef(berrors.ErrStorageEncryption, "unsupported encryption method %d", header[1])
+	}
+	keyID := header[2 : 2+encryptionKeyIDLen]
+	if !bytes.Equal(keyID, s.keyID) {
+		return nil, errors.Annotatef(berrors.ErrStorageEncryption,
+			"encryption key mismatch, the file is encrypted by key %x, but the given key is %x", keyID, s.keyID)
+	}
+
+	r := &decryptReader{
+		inner:  inner,
+		method: method,
+		block:  s.block,
+		iv:     append([]byte(nil), header[2+encryptionKeyIDLen:]...),
+	}
+	switch method {
+	case EncryptionAES256GCM:
+		aead, err := cipher.NewGCM(s.block)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		r.aead = aead
+		r.reader = bufio.NewReaderSize(inner, encryptionChunkSize+gcmTagLen)
+		r.chunkBuf = make([]byte, encryptionChunkSize+gcmTagLen)
+	case EncryptionAES256CTR:
+		r.stream = newCTRStream(s.block, r.iv, 0)
+	}
+	return r, nil
+}
+
+// newCTRStream returns the key stream of AES-CTR starting from the given offset.
+func newCTRStream(block cipher.Block, iv []byte, offset int64) cipher.Stream {
+	// add offset / block size to the 128-bit big-endian counter.
+	counter := append([]byte(nil), iv...)
+	carry := uint64(offset / aes.BlockSize)
+	for i := len(counter) - 1; i >= 0 && carry > 0; i-- {
+		sum := uint64(counter[i]) + carry&0xff
+		counter[i] = byte(sum)
+		carry = carry>>8 + sum>>8
+	}
+	stream := cipher.NewCTR(block, counter)
+	if skip := offset % aes.BlockSize; skip > 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+	return stream
+}
+
+// gcmNonce returns the nonce of the index-th chunk, which is derived from the IV.
+func gcmNonce(iv []byte, index uint64) []byte {
+	nonce := make([]byte, gcmNonceLen)
+	copy(nonce, iv)
+	binary.BigEndian.PutUint64(nonce[4:], binary.BigEndian.Uint64(nonce[4:])^index)
+	return nonce
+}
+
+// gcmAdditionalData marks whether it is the last chunk, so the truncation can be detected.
+func gcmAdditionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encrypter encrypts a file as a stream.
+type encrypter struct {
+	method EncryptionMethod
+	keyID  []byte
+	iv     []byte
+
+	// for AES-256-CTR.
+	stream cipher.Stream
+
+	// for AES-256-GCM.
+	aead       cipher.AEAD
+	chunkIndex uint64
+	// pending is the plaintext not sealed yet. The last chunk is sealed by finish,
+	// so at least one byte is kept here until then unless the file is empty.
+	pending []byte
+}
+
+// header appends the file header to dst.
+func (e *encrypter) header(dst []byte) []byte {
+	dst = append(dst, encryptionMagic...)
+	dst = append(dst, encryptionVersion, e.method.id())
+	dst = append(dst, e.keyID...)
+	return append(dst, e.iv...)
+}
+
+// seal appends the ciphertext of data to dst.
+func (e *encrypter) seal(dst, data []byte) []byte {
+	if e.stream != nil {
+		offset := len(dst)
+		dst = append(dst, data...)
+		e.stream.XORKeyStream(dst[offset:], dst[offset:])
+		return dst
+	}
+
+	e.pending = append(e.pending, data...)
+	sealed := 0
+	for len(e.pending)-sealed > encryptionChunkSize {
+		dst = e.sealChunk(dst, e.pending[sealed:sealed+encryptionChunkSize], false)
+		sealed += encryptionChunkSize
+	}
+	e.pending = append(e.pending[:0], e.pending[sealed:]...)
+	return dst
+}
+
+// finish appends the remaining ciphertext to dst, it must be called after all data are sealed.
+func (e *encrypter) finish(dst []byte) []byte {
+	if e.stream != nil {
+		return dst
+	}
+	dst = e.sealChunk(dst, e.pending, true)
+	e.pending = nil
+	return dst
+}
+
+func (e *encrypter) sealChunk(dst, plaintext []byte, last bool) []byte {
+	dst = e.aead.Seal(dst, gcmNonce(e.iv, e.chunkIndex), plaintext, gcmAdditionalData(last))
+	e.chunkIndex++
+	return dst
+}
+
+// encryptedUploader encrypts the parts and uploads them with the underlying uploader.
+type encryptedUploader struct {
+	uploader  Uploader
+	encrypter *encrypter
+	// buf is the ciphertext not uploaded yet.
+	buf []byte
+}
+
+// UploadPart encrypts and uploads the data.
+//
+// The parts except the last one may have a minimum size (e.g. 5MB on S3), and
+// AES-256-GCM holds back the last chunk until the upload completes, so the
+// ciphertext is buffered until it is no smaller than the given part.
+func (u *encryptedUploader) UploadPart(ctx context.Context, data []byte) error {
+	u.buf = u.encrypter.seal(u.buf, data)
+	if len(u.buf) < len(data) {
+		return nil
+	}
+	if err := u.uploader.UploadPart(ctx, u.buf); err != nil {
+		return errors.Trace(err)
+	}
+	u.buf = nil
+	return nil
+}
+
+// CompleteUpload uploads the remaining ciphertext and completes the upload.
+func (u *encryptedUploader) CompleteUpload(ctx context.Context) error {
+	u.buf = u.encrypter.finish(u.buf)
+	if len(u.buf) > 0 {
+		if err := u.uploader.UploadPart(ctx, u.buf); err != nil {
+			return errors.Trace(err)
+		}
+		u.buf = nil
+	}
+	return u.uploader.CompleteUpload(ctx)
+}
+
+// decryptReader decrypts the file read from the underlying reader.
+type decryptReader struct {
+	inner  io.ReadSeeker
+	method EncryptionMethod
+	block  cipher.Block
+	iv     []byte
+	// pos is the current offset in the plaintext.
+	pos int64
+	// seeked marks the position is changed by Seek, and the underlying reader
+	// should be repositioned before the next Read.
+	seeked bool
+
+	// for AES-256-CTR.
+	stream cipher.Stream
+
+	// for AES-256-GCM.
+	aead     cipher.AEAD
+	reader   *bufio.Reader
+	chunkBuf []byte
+	// chunk is the unread plaintext of the current chunk.
+	chunk     []byte
+	nextChunk uint64
+	eof       bool
+}
+
+// Read implements the io.Reader interface.
+func (r *decryptReader) Read(p []byte) (int, error) {
+	if r.seeked {
+		if err := r.reposition(); err != nil {
+			return 0, errors.Trace(err)
+		}
+		r.seeked = false
+	}
+
+	if r.stream != nil {
+		n, err := r.inner.Read(p)
+		r.stream.XORKeyStream(p[:n], p[:n])
+		r.pos += int64(n)
+		return n, err
+	}
+
+	for len(r.chunk) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		if err := r.readChunk(); err != nil {
+			return 0, errors.Trace(err)
+		}
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	r.pos += int64(n)
+	return n, nil
+}
+
+// reposition moves the underlying reader to the current position.
+func (r *decryptReader) reposition() error {
+	if r.stream != nil {
+		if _, err := r.inner.Seek(int64(encryptionHeaderLen)+r.pos, io.SeekStart); err != nil {
+			return errors.Trace(err)
+		}
+		r.stream = newCTRStream(r.block, r.iv, r.pos)
+		return nil
+	}
+
+	index := r.pos / encryptionChunkSize
+	offset := int64(encryptionHeaderLen) + index*(encryptionChunkSize+gcmTagLen)
+	if _, err := r.inner.Seek(offset, io.SeekStart); err != nil {
+		return errors.Trace(err)
+	}
+	r.reader.Reset(r.inner)
+	r.nextChunk = uint64(index)
+	r.chunk = nil
+	r.eof = false
+	if err := r.readChunk(); err != nil {
+		return errors.Trace(err)
+	}
+	skip := int(r.pos - index*encryptionChunkSize)
+	if skip > len(r.chunk) {
+		skip = len(r.chunk)
+	}
+	r.chunk = r.chunk[skip:]
+	return nil
+}
+
+// readChunk reads and decrypts the next chunk of AES-256-GCM.
+func (r *decryptReader) readChunk() error {
+	n, err := io.ReadFull(r.reader, r.chunkBuf)
+	last := false
+	switch err {
+	case nil:
+		if _, err = r.reader.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return errors.Trace(err)
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	case io.EOF:
+		if r.nextChunk == 0 {
+			return errors.Annotate(berrors.ErrStorageEncryption, "the encrypted file is truncated")
+		}
+		// reading beyond the end after seeking.
+		r.eof = true
+		return nil
+	default:
+		return errors.Trace(err)
+	}
+
+	plaintext, err := r.aead.Open(r.chunkBuf[:0], gcmNonce(r.iv, r.nextChunk), r.chunkBuf[:n], gcmAdditionalData(last))
+	if err != nil {
+		return errors.Annotatef(berrors.ErrStorageEncryption,
+			"failed to decrypt chunk %d, the file may be corrupted or truncated", r.nextChunk)
+	}
+	r.chunk = plaintext
+	r.nextChunk++
+	r.eof = last
+	return nil
+}
+
+// Seek implements the io.Seeker interface, the offset is in the plaintext.
+func (r *decryptReader) Seek(offset int64, whence int) (int64, error) {
+	var realOffset int64
+	switch whence {
+	case io.SeekStart:
+		realOffset = offset
+	case io.SeekCurrent:
+		realOffset = r.pos + offset
+	case io.SeekEnd:
+		size, err := r.inner.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		// the underlying reader is moved.
+		r.seeked = true
+		realOffset = plaintextSize(r.method, size-int64(encryptionHeaderLen)) + offset
+	default:
+		return 0, errors.Annotatef(berrors.ErrStorageUnknown, "Seek: invalid whence '%d'", whence)
+	}
+	if realOffset < 0 {
+		return 0, errors.Annotatef(berrors.ErrStorageUnknown, "Seek in '%d': invalid offset to seek '%d'.", r.pos, realOffset)
+	}
+	if realOffset != r.pos {
+		r.pos = realOffset
+		r.seeked = true
+	}
+	return realOffset, nil
+}
+
+// Close implements the io.Closer interface.
+func (r *decryptReader) Close() error {
+	if closer, ok := r.inner.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// plaintextSize returns the plaintext size of the ciphertext excluding the header.
+func plaintextSize(method EncryptionMethod, size int64) int64 {
+	if method != EncryptionAES256GCM {
+		return size
+	}
+	chunks, rem := size/(encryptionChunkSize+gcmTagLen), size%(encryptionChunkSize+gcmTagLen)
+	size = chunks * encryptionChunkSize
+	if rem > gcmTagLen {
+		size += rem - gcmTagLen
+	}
+	return size
+}
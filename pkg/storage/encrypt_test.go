@@ -0,0 +1,221 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+)
+
+var testEncryptionKey = bytes.Repeat([]byte{0x42}, encryptionKeyLen)
+
+func newTestEncryptedStorage(c *C, dir string, method EncryptionMethod, key []byte) ExternalStorage {
+	local, err := NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	s, err := NewEncryptedStorage(local, &EncryptionConfig{Method: method, Key: key})
+	c.Assert(err, IsNil)
+	return s
+}
+
+func (r *testStorageSuite) TestEncryptedStorageReadWrite(c *C) {
+	ctx := context.Background()
+	for _, method := range []EncryptionMethod{EncryptionAES256GCM, EncryptionAES256CTR} {
+		dir := c.MkDir()
+		s := newTestEncryptedStorage(c, dir, method, testEncryptionKey)
+
+		for _, size := range []int{0, 1, encryptionChunkSize, encryptionChunkSize + 1, 3*encryptionChunkSize + 100} {
+			data := make([]byte, size)
+			_, err := rand.Read(data)
+			c.Assert(err, IsNil)
+
+			err = s.Write(ctx, "file", data)
+			c.Assert(err, IsNil)
+			raw, err := ioutil.ReadFile(filepath.Join(dir, "file"))
+			c.Assert(err, IsNil)
+			c.Assert(raw[:len(encryptionMagic)], DeepEquals, []byte(encryptionMagic))
+			if size > 0 {
+				c.Assert(bytes.Contains(raw, data), IsFalse)
+			}
+
+			read, err := s.Read(ctx, "file")
+			c.Assert(err, IsNil, Commentf("method: %s, size: %d", method, size))
+			c.Assert(bytes.Equal(read, data), IsTrue, Commentf("method: %s, size: %d", method, size))
+		}
+	}
+}
+
+func (r *testStorageSuite) TestEncryptedStorageOpenAndSeek(c *C) {
+	ctx := context.Background()
+	data := make([]byte, 3*encryptionChunkSize+100)
+	_, err := rand.Read(data)
+	c.Assert(err, IsNil)
+
+	for _, method := range []EncryptionMethod{EncryptionAES256GCM, EncryptionAES256CTR} {
+		s := newTestEncryptedStorage(c, c.MkDir(), method, testEncryptionKey)
+		err = s.Write(ctx, "file", data)
+		c.Assert(err, IsNil)
+
+		reader, err := s.Open(ctx, "file")
+		c.Assert(err, IsNil)
+		buf := make([]byte, 100)
+		_, err = io.ReadFull(reader, buf)
+		c.Assert(err, IsNil)
+		c.Assert(buf, DeepEquals, data[:100])
+
+		offset, err := reader.Seek(encryptionChunkSize+7, io.SeekCurrent)
+		c.Assert(err, IsNil)
+		c.Assert(offset, Equals, int64(encryptionChunkSize+107))
+		_, err = io.ReadFull(reader, buf)
+		c.Assert(err, IsNil)
+		c.Assert(buf, DeepEquals, data[offset:offset+100])
+
+		offset, err = reader.Seek(-150, io.SeekEnd)
+		c.Assert(err, IsNil)
+		c.Assert(offset, Equals, int64(len(data)-150))
+		rest, err := ioutil.ReadAll(reader)
+		c.Assert(err, IsNil)
+		c.Assert(rest, DeepEquals, data[offset:])
+
+		offset, err = reader.Seek(3, io.SeekStart)
+		c.Assert(err, IsNil)
+		c.Assert(offset, Equals, int64(3))
+		_, err = io.ReadFull(reader, buf)
+		c.Assert(err, IsNil)
+		c.Assert(buf, DeepEquals, data[3:103])
+
+		_, err = reader.Seek(int64(len(data)), io.SeekStart)
+		c.Assert(err, IsNil)
+		rest, err = ioutil.ReadAll(reader)
+		c.Assert(err, IsNil)
+		c.Assert(rest, HasLen, 0)
+		c.Assert(reader.Close(), IsNil)
+	}
+}
+
+func (r *testStorageSuite) TestEncryptedStorageUploader(c *C) {
+	ctx := context.Background()
+	data := make([]byte, 5*encryptionChunkSize+3)
+	_, err := rand.Read(data)
+	c.Assert(err, IsNil)
+
+	for _, method := range []EncryptionMethod{EncryptionAES256GCM, EncryptionAES256CTR} {
+		s := newTestEncryptedStorage(c, c.MkDir(), method, testEncryptionKey)
+		uploader, err := s.CreateUploader(ctx, "multi")
+		c.Assert(err, IsNil)
+		writer := newUploaderWriter(uploader, encryptionChunkSize/2, NoCompression)
+		for i := 0; i < len(data); i += 1000 {
+			end := i + 1000
+			if end > len(data) {
+				end = len(data)
+			}
+			_, err = writer.Write(ctx, data[i:end])
+			c.Assert(err, IsNil)
+		}
+		err = writer.Close(ctx)
+		c.Assert(err, IsNil)
+
+		read, err := s.Read(ctx, "multi")
+		c.Assert(err, IsNil)
+		c.Assert(bytes.Equal(read, data), IsTrue)
+
+		// empty file.
+		uploader, err = s.CreateUploader(ctx, "empty")
+		c.Assert(err, IsNil)
+		err = uploader.CompleteUpload(ctx)
+		c.Assert(err, IsNil)
+		read, err = s.Read(ctx, "empty")
+		c.Assert(err, IsNil)
+		c.Assert(read, HasLen, 0)
+	}
+}
+
+func (r *testStorageSuite) TestEncryptedStorageErrors(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	s := newTestEncryptedStorage(c, dir, EncryptionAES256GCM, testEncryptionKey)
+	data := bytes.Repeat([]byte("0123456789"), encryptionChunkSize/5)
+	err := s.Write(ctx, "file", data)
+	c.Assert(err, IsNil)
+
+	// wrong key.
+	other := newTestEncryptedStorage(c, dir, EncryptionAES256GCM, bytes.Repeat([]byte{0x24}, encryptionKeyLen))
+	_, err = other.Read(ctx, "file")
+	c.Assert(err, ErrorMatches, ".*encryption key mismatch.*")
+
+	// plaintext file.
+	err = WithoutEncryption(s).Write(ctx, "plain", data)
+	c.Assert(err, IsNil)
+	_, err = s.Read(ctx, "plain")
+	c.Assert(err, ErrorMatches, ".*the file is not encrypted by BR.*")
+
+	// tampered file.
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "file"))
+	c.Assert(err, IsNil)
+	raw[len(raw)-1] ^= 1
+	err = ioutil.WriteFile(filepath.Join(dir, "tampered"), raw, 0o644)
+	c.Assert(err, IsNil)
+	_, err = s.Read(ctx, "tampered")
+	c.Assert(err, ErrorMatches, ".*failed to decrypt chunk 1.*")
+
+	// truncated at the chunk boundary.
+	err = ioutil.WriteFile(filepath.Join(dir, "truncated"), raw[:encryptionHeaderLen+encryptionChunkSize+gcmTagLen], 0o644)
+	c.Assert(err, IsNil)
+	_, err = s.Read(ctx, "truncated")
+	c.Assert(err, ErrorMatches, ".*failed to decrypt chunk 0.*")
+}
+
+func (r *testStorageSuite) TestEncryptionOptions(c *C) {
+	hexKey := hex.EncodeToString(testEncryptionKey)
+
+	config, err := (&EncryptionOptions{}).Config()
+	c.Assert(err, IsNil)
+	c.Assert(config, IsNil)
+	config, err = (&EncryptionOptions{Method: "plaintext", Key: hexKey}).Config()
+	c.Assert(err, IsNil)
+	c.Assert(config, IsNil)
+
+	_, err = (&EncryptionOptions{Method: "aes128-ecb", Key: hexKey}).Config()
+	c.Assert(err, ErrorMatches, ".*unknown encryption method 'aes128-ecb'.*")
+	_, err = (&EncryptionOptions{Method: "aes256-gcm", Key: "xyz"}).Config()
+	c.Assert(err, ErrorMatches, ".*encryption key should be hex encoded.*")
+	_, err = (&EncryptionOptions{Method: "aes256-gcm", Key: "0011"}).Config()
+	c.Assert(err, ErrorMatches, ".*encryption key should be 32 bytes, but got 2 bytes.*")
+
+	config, err = (&EncryptionOptions{Method: "AES256-GCM", Key: hexKey}).Config()
+	c.Assert(err, IsNil)
+	c.Assert(config.Method, Equals, EncryptionAES256GCM)
+	c.Assert(config.Key, DeepEquals, testEncryptionKey)
+	c.Assert(config.KeyID(), HasLen, 2*encryptionKeyIDLen)
+
+	keyFile := filepath.Join(c.MkDir(), "key")
+	err = ioutil.WriteFile(keyFile, []byte(hexKey+"\n"), 0o600)
+	c.Assert(err, IsNil)
+	config, err = (&EncryptionOptions{Method: "aes256-ctr", KeyFile: keyFile}).Config()
+	c.Assert(err, IsNil)
+	c.Assert(config.Method, Equals, EncryptionAES256CTR)
+	c.Assert(config.Key, DeepEquals, testEncryptionKey)
+
+	oldEnv, hasEnv := os.LookupEnv(encryptionKeyEnv)
+	defer func() {
+		if hasEnv {
+			os.Setenv(encryptionKeyEnv, oldEnv)
+		} else {
+			os.Unsetenv(encryptionKeyEnv)
+		}
+	}()
+	os.Unsetenv(encryptionKeyEnv)
+	_, err = (&EncryptionOptions{Method: "aes256-ctr"}).Config()
+	c.Assert(err, ErrorMatches, ".*encryption key is required.*")
+	os.Setenv(encryptionKeyEnv, hexKey)
+	config, err = (&EncryptionOptions{Method: "aes256-ctr"}).Config()
+	c.Assert(err, IsNil)
+	c.Assert(config.Key, DeepEquals, testEncryptionKey)
+}
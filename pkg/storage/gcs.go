@@ -3,10 +3,19 @@
 package storage
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
 	"path"
+	"strconv"
 	"strings"
 
 	"cloud.google.com/go/storage"
@@ -16,8 +25,10 @@ import (
 	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 	"golang.org/x/oauth2/google"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 
 	berrors "github.com/Orion7r/pr/pkg/errors"
 )
@@ -27,6 +38,14 @@ const (
 	gcsStorageClassOption = "gcs.storage-class"
 	gcsPredefinedACL      = "gcs.predefined-acl"
 	gcsCredentialsFile    = "gcs.credentials-file"
+
+	// gcsDeleteConcurrency is the number of concurrent requests of DeleteFiles
+	// if the batch requests are not supported.
+	gcsDeleteConcurrency = 16
+	// gcsBatchSize is the max number of calls in a batch request.
+	gcsBatchSize = 100
+	// gcsDefaultBatchURL is the URL of the batch requests of the JSON API.
+	gcsDefaultBatchURL = "https://storage.googleapis.com/batch/storage/v1"
 )
 
 // GCSBackendOptions are options for configuration the GCS storage.
@@ -87,6 +106,10 @@ func (options *GCSBackendOptions) parseFromFlags(flags *pflag.FlagSet) error {
 type gcsStorage struct {
 	gcs    *backup.GCS
 	bucket *storage.BucketHandle
+	// batchClient sends the batch requests to batchURL, which are not
+	// supported by the GCS client.
+	batchClient *http.Client
+	batchURL    string
 }
 
 func (s *gcsStorage) objectName(name string) string {
@@ -142,8 +165,30 @@ func (s *gcsStorage) FileExists(ctx context.Context, name string) (bool, error)
 
 // Open a Reader by file path.
 func (s *gcsStorage) Open(ctx context.Context, path string) (ReadSeekCloser, error) {
-	// TODO, implement this if needed
-	panic("Unsupported Operation")
+	object := s.objectName(path)
+	handle := s.bucket.Object(object)
+
+	attrs, err := handle.Attrs(ctx)
+	if err != nil {
+		return nil, errors.Annotatef(err,
+			"failed to get gcs file attrs, file info: input.bucket='%s', input.key='%s'",
+			s.gcs.Bucket, object)
+	}
+	rc, err := handle.NewRangeReader(ctx, 0, -1)
+	if err != nil {
+		return nil, errors.Annotatef(err,
+			"failed to read gcs file, file info: input.bucket='%s', input.key='%s'",
+			s.gcs.Bucket, object)
+	}
+
+	return &gcsObjectReader{
+		storage:   s,
+		name:      path,
+		objHandle: handle,
+		reader:    rc,
+		totalSize: attrs.Size,
+		ctx:       ctx,
+	}, nil
 }
 
 // WalkDir traverse all the files in a dir.
@@ -153,18 +198,390 @@ func (s *gcsStorage) Open(ctx context.Context, path string) (ReadSeekCloser, err
 // function; the second argument is the size in byte of the file determined
 // by path.
 func (s *gcsStorage) WalkDir(ctx context.Context, opt *WalkOption, fn func(string, int64) error) error {
-	// TODO, implement this if needed
-	panic("Unsupported Operation")
+	if opt == nil {
+		opt = &WalkOption{}
+	}
+
+	prefix := path.Join(s.gcs.Prefix, opt.SubDir)
+	if len(prefix) > 0 && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	query := &storage.Query{Prefix: prefix}
+	// only need each object's name and size
+	_ = query.SetAttrSelection([]string{"Name", "Size"})
+	iter := s.bucket.Objects(ctx, query)
+	if opt.ListCount > 0 {
+		iter.PageInfo().MaxSize = int(opt.ListCount)
+	}
+	for {
+		attrs, err := iter.Next()
+		if err == iterator.Done { // nolint:errorlint
+			break
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		// when walk on specify directory, the result include storage.Prefix,
+		// which can not be reuse in other API(Open/Read) directly.
+		// so we use TrimPrefix to filter Prefix for next Open/Read.
+		path := strings.TrimPrefix(attrs.Name, s.gcs.Prefix)
+		// trim the prefix '/' to ensure that the path returned is consistent with the local storage
+		path = strings.TrimPrefix(path, "/")
+		if err = fn(path, attrs.Size); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
 }
 
 func (s *gcsStorage) URI() string {
 	return "gcs://" + s.gcs.Bucket + "/" + s.gcs.Prefix
 }
 
+// DeleteFile delete the file in storage.
+func (s *gcsStorage) DeleteFile(ctx context.Context, name string) error {
+	object := s.objectName(name)
+	err := s.bucket.Object(object).Delete(ctx)
+	if err != nil && errors.Cause(err) != storage.ErrObjectNotExist { // nolint:errorlint
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// DeleteFiles delete the files in storage.
+//
+// The objects are deleted by the batch requests of the JSON API, up to
+// gcsBatchSize objects in a request. If the endpoint doesn't support the batch
+// requests, e.g. some emulators, they are deleted one by one concurrently.
+func (s *gcsStorage) DeleteFiles(ctx context.Context, names []string) error {
+	for len(names) > 0 {
+		n := len(names)
+		if n > gcsBatchSize {
+			n = gcsBatchSize
+		}
+		supported, err := s.deleteBatch(ctx, names[:n])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !supported {
+			log.Warn("gcs batch request is not supported, delete the files one by one",
+				zap.String("url", s.batchURL))
+			return errors.Trace(s.deleteConcurrently(ctx, names))
+		}
+		names = names[n:]
+	}
+	return nil
+}
+
+// deleteBatch deletes the objects in one batch request, it returns false if
+// the endpoint doesn't support the batch requests.
+func (s *gcsStorage) deleteBatch(ctx context.Context, names []string) (bool, error) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for i, name := range names {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type": []string{"application/http"},
+			"Content-Id":   []string{strconv.Itoa(i)},
+		})
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		_, err = fmt.Fprintf(part, "DELETE /storage/v1/b/%s/o/%s HTTP/1.1\r\n\r\n",
+			url.PathEscape(s.gcs.Bucket), url.PathEscape(s.objectName(name)))
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return false, errors.Trace(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.batchURL, body)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "multipart/mixed; boundary="+w.Boundary())
+	resp, err := s.batchClient.Do(req)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return false, errors.Annotatef(berrors.ErrStorageUnknown,
+			"gcs batch request failed, status: %s, body: %s", resp.Status, data)
+	}
+
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false, errors.Annotate(err, "invalid content type of the gcs batch response")
+	}
+	reader := multipart.NewReader(resp.Body, params["boundary"])
+	responded := make(map[int]struct{}, len(names))
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF { // nolint:errorlint
+			break
+		}
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		// the Content-ID of the response is "response-<Content-ID of the call>".
+		id := strings.Trim(part.Header.Get("Content-Id"), "<>")
+		i, err := strconv.Atoi(strings.TrimPrefix(id, "response-"))
+		if err != nil || i < 0 || i >= len(names) {
+			return false, errors.Annotatef(berrors.ErrStorageUnknown,
+				"unexpected Content-ID '%s' in the gcs batch response", id)
+		}
+		callResp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		callResp.Body.Close()
+		// the object not found is deleted, the same as DeleteFile.
+		if callResp.StatusCode/100 != 2 && callResp.StatusCode != http.StatusNotFound {
+			return false, errors.Annotatef(berrors.ErrStorageUnknown,
+				"failed to delete gcs file, file info: input.bucket='%s', input.key='%s', status: %s",
+				s.gcs.Bucket, s.objectName(names[i]), callResp.Status)
+		}
+		responded[i] = struct{}{}
+	}
+	if len(responded) != len(names) {
+		return false, errors.Annotatef(berrors.ErrStorageUnknown,
+			"gcs batch response has %d results, but %d files are deleted", len(responded), len(names))
+	}
+	return true, nil
+}
+
+// deleteConcurrently deletes the objects one by one concurrently.
+func (s *gcsStorage) deleteConcurrently(ctx context.Context, names []string) error {
+	eg, ectx := errgroup.WithContext(ctx)
+	ch := make(chan string)
+	concurrency := gcsDeleteConcurrency
+	if len(names) < concurrency {
+		concurrency = len(names)
+	}
+	for i := 0; i < concurrency; i++ {
+		eg.Go(func() error {
+			for name := range ch {
+				if err := s.DeleteFile(ectx, name); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			return nil
+		})
+	}
+	eg.Go(func() error {
+		defer close(ch)
+		for _, name := range names {
+			select {
+			case ch <- name:
+			case <-ectx.Done():
+				return errors.Trace(ectx.Err())
+			}
+		}
+		return nil
+	})
+	return eg.Wait()
+}
+
+// gcsBatchURL returns the URL of the batch requests of the endpoint.
+func gcsBatchURL(endpoint string) (string, error) {
+	if endpoint == "" {
+		return gcsDefaultBatchURL, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", errors.Annotatef(berrors.ErrStorageInvalidConfig, "invalid gcs endpoint %s: %v", endpoint, err)
+	}
+	return u.Scheme + "://" + u.Host + "/batch/storage/v1", nil
+}
+
+// Rename copies the object to the new name and then deletes the old one,
+// since GCS doesn't support renaming.
+func (s *gcsStorage) Rename(ctx context.Context, oldFileName, newFileName string) error {
+	src := s.bucket.Object(s.objectName(oldFileName))
+	copier := s.bucket.Object(s.objectName(newFileName)).CopierFrom(src)
+	copier.StorageClass = s.gcs.StorageClass
+	copier.PredefinedACL = s.gcs.PredefinedAcl
+	if _, err := copier.Run(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(src.Delete(ctx))
+}
+
 // CreateUploader implenments ExternalStorage interface.
+//
+// Every part is uploaded as a temporary object by a resumable upload, and
+// CompleteUpload composes all parts into the final object.
 func (s *gcsStorage) CreateUploader(ctx context.Context, name string) (Uploader, error) {
-	// TODO, implement this if needed
-	panic("gcs storage not support multi-upload")
+	return &gcsUploader{
+		storage:   s,
+		name:      name,
+		partNames: make([]string, 0, 128),
+	}, nil
+}
+
+// gcsObjectReader wraps storage.Reader and add the `Seek` method.
+type gcsObjectReader struct {
+	storage   *gcsStorage
+	name      string
+	objHandle *storage.ObjectHandle
+	reader    io.ReadCloser
+	pos       int64
+	totalSize int64
+	// reader context used for implement `io.Seek`
+	ctx context.Context
+}
+
+// Read implement the io.Reader interface.
+func (r *gcsObjectReader) Read(p []byte) (n int, err error) {
+	if r.reader == nil {
+		rc, err := r.objHandle.NewRangeReader(r.ctx, r.pos, -1)
+		if err != nil {
+			return 0, errors.Annotatef(err,
+				"failed to read gcs file, file info: input.bucket='%s', input.key='%s'",
+				r.storage.gcs.Bucket, r.name)
+		}
+		r.reader = rc
+	}
+	n, err = r.reader.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+// Close implement the io.Closer interface.
+func (r *gcsObjectReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Close()
+}
+
+// Seek implement the io.Seeker interface.
+func (r *gcsObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var realOffset int64
+	switch whence {
+	case io.SeekStart:
+		realOffset = offset
+	case io.SeekCurrent:
+		realOffset = r.pos + offset
+	case io.SeekEnd:
+		realOffset = r.totalSize + offset
+	default:
+		return 0, errors.Annotatef(berrors.ErrStorageUnknown, "Seek: invalid whence '%d'", whence)
+	}
+	if realOffset < 0 {
+		return 0, errors.Annotatef(berrors.ErrStorageUnknown, "Seek: offset '%d' out of range", realOffset)
+	}
+
+	if realOffset == r.pos {
+		return realOffset, nil
+	}
+
+	// if seek ahead no more than 64k, we discard these data
+	if r.reader != nil && realOffset > r.pos && realOffset-r.pos <= maxSkipOffsetByRead {
+		_, err := io.CopyN(ioutil.Discard, r, realOffset-r.pos)
+		if err != nil {
+			return r.pos, errors.Trace(err)
+		}
+		return realOffset, nil
+	}
+
+	// close current read and reopen lazily at the target offset
+	if r.reader != nil {
+		if err := r.reader.Close(); err != nil {
+			return 0, errors.Trace(err)
+		}
+		r.reader = nil
+	}
+	r.pos = realOffset
+	return realOffset, nil
+}
+
+// gcsMaxComposeSources is the maximum number of source objects in a single
+// GCS compose request.
+const gcsMaxComposeSources = 32
+
+// gcsUploader does multi-part upload to gcs.
+type gcsUploader struct {
+	storage   *gcsStorage
+	name      string
+	partNames []string
+}
+
+func (u *gcsUploader) partName(level, index int) string {
+	return fmt.Sprintf("%s.part-%d-%05d", u.storage.objectName(u.name), level, index)
+}
+
+// UploadPart uploads the data as a temporary part object.
+func (u *gcsUploader) UploadPart(ctx context.Context, data []byte) error {
+	object := u.partName(0, len(u.partNames))
+	wc := u.storage.bucket.Object(object).NewWriter(ctx)
+	wc.StorageClass = u.storage.gcs.StorageClass
+	_, err := wc.Write(data)
+	if err != nil {
+		_ = wc.Close()
+		return errors.Trace(err)
+	}
+	if err = wc.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	u.partNames = append(u.partNames, object)
+	return nil
+}
+
+// CompleteUpload composes all uploaded parts into the target object and
+// removes the temporary part objects.
+func (u *gcsUploader) CompleteUpload(ctx context.Context) error {
+	if len(u.partNames) == 0 {
+		return errors.Trace(u.storage.Write(ctx, u.name, nil))
+	}
+	sources := u.partNames
+	temporaries := append([]string(nil), u.partNames...)
+	defer func() {
+		for _, object := range temporaries {
+			if err := u.storage.bucket.Object(object).Delete(ctx); err != nil &&
+				errors.Cause(err) != storage.ErrObjectNotExist { // nolint:errorlint
+				log.Warn("failed to delete temporary gcs object", zap.String("object", object), zap.Error(err))
+			}
+		}
+	}()
+
+	// a compose request accepts at most 32 sources, so compose the parts
+	// level by level until they fit in one request.
+	for level := 1; len(sources) > gcsMaxComposeSources; level++ {
+		next := make([]string, 0, (len(sources)+gcsMaxComposeSources-1)/gcsMaxComposeSources)
+		for i := 0; i < len(sources); i += gcsMaxComposeSources {
+			end := i + gcsMaxComposeSources
+			if end > len(sources) {
+				end = len(sources)
+			}
+			object := u.partName(level, len(next))
+			if err := u.compose(ctx, object, sources[i:end]); err != nil {
+				return errors.Trace(err)
+			}
+			next = append(next, object)
+			temporaries = append(temporaries, object)
+		}
+		sources = next
+	}
+	return errors.Trace(u.compose(ctx, u.storage.objectName(u.name), sources))
+}
+
+func (u *gcsUploader) compose(ctx context.Context, dst string, sources []string) error {
+	handles := make([]*storage.ObjectHandle, 0, len(sources))
+	for _, src := range sources {
+		handles = append(handles, u.storage.bucket.Object(src))
+	}
+	composer := u.storage.bucket.Object(dst).ComposerFrom(handles...)
+	composer.StorageClass = u.storage.gcs.StorageClass
+	composer.PredefinedACL = u.storage.gcs.PredefinedAcl
+	_, err := composer.Run(ctx)
+	return errors.Trace(err)
 }
 
 func newGCSStorage(ctx context.Context, gcs *backup.GCS, opts *ExternalStorageOptions) (*gcsStorage, error) {
@@ -199,6 +616,17 @@ func newGCSStorage(ctx context.Context, gcs *backup.GCS, opts *ExternalStorageOp
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	// the batch requests are sent by the same authorized HTTP client as the
+	// GCS client.
+	batchClient, _, err := htransport.NewClient(ctx,
+		append([]option.ClientOption{option.WithScopes(storage.ScopeFullControl)}, clientOps...)...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	batchURL, err := gcsBatchURL(gcs.Endpoint)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	if !opts.SendCredentials {
 		// Clear the credentials if exists so that they will not be sent to TiKV
@@ -225,7 +653,7 @@ func newGCSStorage(ctx context.Context, gcs *backup.GCS, opts *ExternalStorageOp
 			return nil, errors.Trace(err)
 		}
 	}
-	return &gcsStorage{gcs: gcs, bucket: bucket}, nil
+	return &gcsStorage{gcs: gcs, bucket: bucket, batchClient: batchClient, batchURL: batchURL}, nil
 }
 
 func hasSSTFiles(ctx context.Context, bucket *storage.BucketHandle, prefix string) bool {
@@ -3,9 +3,19 @@
 package storage
 
 import (
+	"bufio"
 	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/fsouza/fake-gcs-server/fakestorage"
 	. "github.com/pingcap/check"
@@ -60,6 +70,38 @@ func (r *testStorageSuite) TestGCS(c *C) {
 	c.Assert(exist, IsFalse)
 
 	c.Assert(stg.URI(), Equals, "gcs://testbucket/a/b/")
+
+	err = stg.Rename(ctx, "key", "key2")
+	c.Assert(err, IsNil)
+	exist, err = stg.FileExists(ctx, "key")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	d, err = stg.Read(ctx, "key2")
+	c.Assert(err, IsNil)
+	c.Assert(d, DeepEquals, []byte("data"))
+
+	err = stg.DeleteFile(ctx, "key2")
+	c.Assert(err, IsNil)
+	exist, err = stg.FileExists(ctx, "key2")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	err = stg.DeleteFile(ctx, "key_not_exist")
+	c.Assert(err, IsNil)
+
+	names := make([]string, 0, 40)
+	for i := 0; i < 40; i++ {
+		name := fmt.Sprintf("batch/%02d", i)
+		err = stg.Write(ctx, name, []byte("data"))
+		c.Assert(err, IsNil)
+		names = append(names, name)
+	}
+	err = stg.DeleteFiles(ctx, append(names, "key_not_exist"))
+	c.Assert(err, IsNil)
+	err = stg.WalkDir(ctx, &WalkOption{SubDir: "batch"}, func(path string, size int64) error {
+		c.Errorf("file %s should be deleted", path)
+		return nil
+	})
+	c.Assert(err, IsNil)
 }
 
 func (r *testStorageSuite) TestNewGCSStorage(c *C) {
@@ -201,3 +243,237 @@ func (r *testStorageSuite) TestNewGCSStorage(c *C) {
 		c.Assert(s.objectName("x"), Equals, "a/b/x")
 	}
 }
+
+func (r *testStorageSuite) TestGCSWalkDirAndOpen(c *C) {
+	ctx := context.Background()
+
+	opts := fakestorage.Options{
+		NoListener: true,
+	}
+	server, err := fakestorage.NewServerWithOptions(opts)
+	c.Assert(err, IsNil)
+	bucketName := "testbucket"
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: bucketName})
+
+	gcs := &backup.GCS{
+		Bucket:          bucketName,
+		Prefix:          "a/b",
+		StorageClass:    "NEARLINE",
+		PredefinedAcl:   "private",
+		CredentialsBlob: "Fake Credentials",
+	}
+	stg, err := newGCSStorage(ctx, gcs, &ExternalStorageOptions{
+		SendCredentials: false,
+		SkipCheckPath:   false,
+		HTTPClient:      server.HTTPClient(),
+	})
+	c.Assert(err, IsNil)
+
+	files := map[string]string{
+		"key1":        "data1",
+		"sub/key2":    "data22",
+		"sub/key3":    "data333",
+		"other/key4":  "data4444",
+		"sub2/key5_1": "data55555",
+	}
+	for name, content := range files {
+		err = stg.Write(ctx, name, []byte(content))
+		c.Assert(err, IsNil)
+	}
+
+	// walk the whole prefix with a tiny page size.
+	walked := make(map[string]int64)
+	err = stg.WalkDir(ctx, &WalkOption{ListCount: 2}, func(path string, size int64) error {
+		walked[path] = size
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(walked, HasLen, len(files))
+	for name, content := range files {
+		c.Assert(walked[name], Equals, int64(len(content)))
+	}
+
+	// walk a sub directory only.
+	walked = make(map[string]int64)
+	err = stg.WalkDir(ctx, &WalkOption{SubDir: "sub"}, func(path string, size int64) error {
+		walked[path] = size
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(walked, DeepEquals, map[string]int64{"sub/key2": 6, "sub/key3": 7})
+
+	// open and seek.
+	reader, err := stg.Open(ctx, "sub2/key5_1")
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(reader, buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "data")
+
+	offset, err := reader.Seek(-3, io.SeekEnd)
+	c.Assert(err, IsNil)
+	c.Assert(offset, Equals, int64(6))
+	buf = make([]byte, 3)
+	_, err = io.ReadFull(reader, buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "555")
+
+	offset, err = reader.Seek(1, io.SeekStart)
+	c.Assert(err, IsNil)
+	c.Assert(offset, Equals, int64(1))
+	buf = make([]byte, 3)
+	_, err = io.ReadFull(reader, buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "ata")
+
+	_, err = reader.Seek(-100, io.SeekCurrent)
+	c.Assert(err, NotNil)
+}
+
+func (r *testStorageSuite) TestGCSUploader(c *C) {
+	ctx := context.Background()
+
+	opts := fakestorage.Options{
+		NoListener: true,
+	}
+	server, err := fakestorage.NewServerWithOptions(opts)
+	c.Assert(err, IsNil)
+	bucketName := "testbucket"
+	server.CreateBucketWithOpts(fakestorage.CreateBucketOpts{Name: bucketName})
+
+	gcs := &backup.GCS{
+		Bucket:          bucketName,
+		Prefix:          "a/b/",
+		CredentialsBlob: "Fake Credentials",
+	}
+	stg, err := newGCSStorage(ctx, gcs, &ExternalStorageOptions{
+		SendCredentials: false,
+		SkipCheckPath:   false,
+		HTTPClient:      server.HTTPClient(),
+	})
+	c.Assert(err, IsNil)
+
+	// more than gcsMaxComposeSources parts to exercise the multi-level compose.
+	uploader, err := stg.CreateUploader(ctx, "multi")
+	c.Assert(err, IsNil)
+	var expected []byte
+	for i := 0; i < gcsMaxComposeSources+5; i++ {
+		part := []byte(fmt.Sprintf("part-%02d;", i))
+		expected = append(expected, part...)
+		err = uploader.UploadPart(ctx, part)
+		c.Assert(err, IsNil)
+	}
+	err = uploader.CompleteUpload(ctx)
+	c.Assert(err, IsNil)
+
+	d, err := stg.Read(ctx, "multi")
+	c.Assert(err, IsNil)
+	c.Assert(d, DeepEquals, expected)
+
+	// all temporary parts should be removed.
+	var names []string
+	err = stg.WalkDir(ctx, nil, func(path string, size int64) error {
+		names = append(names, path)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []string{"multi"})
+
+	// the writer on top of the uploader.
+	uploader, err = stg.CreateUploader(ctx, "writer")
+	c.Assert(err, IsNil)
+	writer := newUploaderWriter(uploader, 4, NoCompression)
+	_, err = writer.Write(ctx, []byte("0123456789"))
+	c.Assert(err, IsNil)
+	err = writer.Close(ctx)
+	c.Assert(err, IsNil)
+	d, err = stg.Read(ctx, "writer")
+	c.Assert(err, IsNil)
+	c.Assert(string(d), Equals, "0123456789")
+}
+
+// fakeGCSBatch serves the batch requests of the JSON API, the objects whose
+// names contain "denied" can not be deleted.
+type fakeGCSBatch struct {
+	mu       sync.Mutex
+	batches  int
+	deleted  []string
+	notFound map[string]struct{}
+}
+
+func (f *fakeGCSBatch) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if req.URL.Path != "/batch/storage/v1" || err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f.batches++
+	reader := multipart.NewReader(req.Body, params["boundary"])
+	body := &strings.Builder{}
+	writer := multipart.NewWriter(body)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		call, err := http.ReadRequest(bufio.NewReader(part))
+		if err != nil || call.Method != http.MethodDelete {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		object := strings.TrimPrefix(call.URL.Path, "/storage/v1/b/testbucket/o/")
+		status := "204 No Content"
+		if strings.Contains(object, "denied") {
+			status = "403 Forbidden"
+		} else if _, ok := f.notFound[object]; ok {
+			status = "404 Not Found"
+		} else {
+			f.deleted = append(f.deleted, object)
+		}
+		result, _ := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": []string{"application/http"},
+			"Content-Id":   []string{"<response-" + part.Header.Get("Content-Id") + ">"},
+		})
+		fmt.Fprintf(result, "HTTP/1.1 %s\r\nContent-Length: 0\r\n\r\n", status)
+	}
+	_ = writer.Close()
+	w.Header().Set("Content-Type", "multipart/mixed; boundary="+writer.Boundary())
+	_, _ = w.Write([]byte(body.String()))
+}
+
+func (r *testStorageSuite) TestGCSDeleteFilesBatch(c *C) {
+	ctx := context.Background()
+	fake := &fakeGCSBatch{notFound: map[string]struct{}{"a/b/key_not_exist": {}}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	batchURL, err := gcsBatchURL(server.URL + "/storage/v1/")
+	c.Assert(err, IsNil)
+	c.Assert(batchURL, Equals, server.URL+"/batch/storage/v1")
+	stg := &gcsStorage{
+		gcs:         &backup.GCS{Bucket: "testbucket", Prefix: "a/b/"},
+		batchClient: server.Client(),
+		batchURL:    batchURL,
+	}
+
+	names := make([]string, 0, 150)
+	expected := make([]string, 0, 150)
+	for i := 0; i < 150; i++ {
+		names = append(names, fmt.Sprintf("batch/%03d", i))
+		expected = append(expected, fmt.Sprintf("a/b/batch/%03d", i))
+	}
+	err = stg.DeleteFiles(ctx, append(names, "key_not_exist"))
+	c.Assert(err, IsNil)
+	c.Assert(fake.batches, Equals, 2)
+	c.Assert(fake.deleted, DeepEquals, expected)
+
+	err = stg.DeleteFiles(ctx, []string{"key", "denied"})
+	c.Assert(err, ErrorMatches, ".*failed to delete gcs file.*input.key='a/b/denied'.*403 Forbidden.*")
+}
@@ -0,0 +1,578 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+)
+
+const (
+	hdfsEndpointOption = "hdfs.endpoint"
+	hdfsUserOption     = "hdfs.user"
+
+	// hdfsDefaultHTTPPort is the default port of the NameNode web UI since Hadoop 3.
+	hdfsDefaultHTTPPort = "9870"
+	hdfsPathPrefix      = "/webhdfs/v1"
+
+	// hdfsRenameBackupSuffix is the suffix of the destination moved aside
+	// by Rename.
+	hdfsRenameBackupSuffix = ".rename-backup"
+)
+
+// HDFSBackendOptions contains options for HDFS storage.
+type HDFSBackendOptions struct {
+	Endpoint string `json:"endpoint" toml:"endpoint"`
+	User     string `json:"user" toml:"user"`
+}
+
+// HDFSStorageConfig is the resolved configuration of a HDFS backend.
+type HDFSStorageConfig struct {
+	// Endpoint is the WebHDFS HTTP address of the NameNode.
+	Endpoint string
+	// Path is the absolute path of the base directory.
+	Path string
+	User string
+}
+
+func (options *HDFSBackendOptions) apply(namenode string, config *HDFSStorageConfig) error {
+	config.User = options.User
+	config.Endpoint = options.Endpoint
+	if config.Endpoint == "" {
+		host := namenode
+		if _, _, err := net.SplitHostPort(namenode); err != nil {
+			host = net.JoinHostPort(namenode, hdfsDefaultHTTPPort)
+		}
+		config.Endpoint = "http://" + host
+	} else {
+		u, err := url.Parse(config.Endpoint)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if u.Scheme == "" {
+			return errors.Annotate(berrors.ErrStorageInvalidConfig, "scheme not found in endpoint")
+		}
+		if u.Host == "" {
+			return errors.Annotate(berrors.ErrStorageInvalidConfig, "host not found in endpoint")
+		}
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	return nil
+}
+
+func defineHDFSFlags(flags *pflag.FlagSet) {
+	// TODO: remove experimental tag if it's stable
+	flags.String(hdfsEndpointOption, "",
+		"(experimental) Set the WebHDFS endpoint of the NameNode, e.g. http://namenode:9870")
+	flags.String(hdfsUserOption, "", "(experimental) Set the user name used by the WebHDFS simple authentication")
+}
+
+func (options *HDFSBackendOptions) parseFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	options.Endpoint, err = flags.GetString(hdfsEndpointOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	options.User, err = flags.GetString(hdfsUserOption)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// HDFSStorage is a storage backend on HDFS, speaking the WebHDFS REST protocol.
+type HDFSStorage struct {
+	config *HDFSStorageConfig
+	client *http.Client
+	// noRedirectClient doesn't follow redirects, it is used for the two-step
+	// CREATE and APPEND operations which must send data to the DataNode.
+	noRedirectClient *http.Client
+}
+
+func newHDFSStorage(
+	ctx context.Context,
+	config *HDFSStorageConfig,
+	opts *ExternalStorageOptions,
+) (*HDFSStorage, error) {
+	client := http.DefaultClient
+	if opts.HTTPClient != nil {
+		client = opts.HTTPClient
+	}
+	noRedirectClient := *client
+	noRedirectClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	s := &HDFSStorage{
+		config:           config,
+		client:           client,
+		noRedirectClient: &noRedirectClient,
+	}
+	if !opts.SkipCheckPath {
+		resp, err := s.do(ctx, s.client, http.MethodPut, "", "MKDIRS", nil, nil)
+		if err != nil {
+			return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig,
+				"Path %s is not accessible: %v", config.Path, err)
+		}
+		resp.Body.Close()
+	}
+	return s, nil
+}
+
+func (s *HDFSStorage) requestURL(name, op string, query url.Values) (*url.URL, error) {
+	u, err := url.Parse(s.config.Endpoint)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	u.Path = hdfsPathPrefix + path.Join("/", s.config.Path, name)
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("op", op)
+	if s.config.User != "" {
+		q.Set("user.name", s.config.User)
+	}
+	u.RawQuery = q.Encode()
+	return u, nil
+}
+
+// hdfsRemoteException is the error returned by WebHDFS.
+type hdfsRemoteException struct {
+	op         string
+	name       string
+	statusCode int
+	Exception  string `json:"exception"`
+	Message    string `json:"message"`
+}
+
+func (e *hdfsRemoteException) Error() string {
+	return fmt.Sprintf("webhdfs %s '%s' failed, status: %d, exception: %s, message: %s",
+		e.op, e.name, e.statusCode, e.Exception, e.Message)
+}
+
+func isHDFSNotFound(err error) bool {
+	e, ok := errors.Cause(err).(*hdfsRemoteException) // nolint:errorlint
+	return ok && e.statusCode == http.StatusNotFound
+}
+
+func (s *HDFSStorage) do(
+	ctx context.Context,
+	client *http.Client,
+	method, name, op string,
+	query url.Values,
+	body []byte,
+) (*http.Response, error) {
+	u, err := s.requestURL(name, op, query)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return s.send(ctx, client, method, u.String(), name, op, body)
+}
+
+func (s *HDFSStorage) send(
+	ctx context.Context,
+	client *http.Client,
+	method, rawURL, name, op string,
+	body []byte,
+) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, reader)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var result struct {
+			RemoteException hdfsRemoteException `json:"RemoteException"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+		e := result.RemoteException
+		e.op, e.name, e.statusCode = op, name, resp.StatusCode
+		return nil, &e
+	}
+	return resp, nil
+}
+
+// writeData does the two-step CREATE or APPEND operation: the NameNode
+// redirects the request to a DataNode, where the data is actually sent.
+func (s *HDFSStorage) writeData(ctx context.Context, method, name, op string, query url.Values, data []byte) error {
+	resp, err := s.do(ctx, s.noRedirectClient, method, name, op, query, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		return errors.Annotatef(berrors.ErrStorageUnknown,
+			"webhdfs %s '%s' expects a redirection, but got status %d", op, name, resp.StatusCode)
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return errors.Annotatef(berrors.ErrStorageUnknown, "webhdfs %s '%s' redirects to nowhere", op, name)
+	}
+	resp, err = s.send(ctx, s.client, method, location, name, op, data)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return resp.Body.Close()
+}
+
+// Write file to storage.
+func (s *HDFSStorage) Write(ctx context.Context, name string, data []byte) error {
+	if data == nil {
+		data = []byte{}
+	}
+	query := url.Values{"overwrite": []string{"true"}}
+	return s.writeData(ctx, http.MethodPut, name, "CREATE", query, data)
+}
+
+// Read storage file.
+func (s *HDFSStorage) Read(ctx context.Context, name string) ([]byte, error) {
+	resp, err := s.do(ctx, s.client, http.MethodGet, name, "OPEN", nil, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, errors.Trace(err)
+}
+
+type hdfsFileStatus struct {
+	PathSuffix string `json:"pathSuffix"`
+	Type       string `json:"type"`
+	Length     int64  `json:"length"`
+}
+
+func (s *HDFSStorage) fileStatus(ctx context.Context, name string) (*hdfsFileStatus, error) {
+	resp, err := s.do(ctx, s.client, http.MethodGet, name, "GETFILESTATUS", nil, nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		FileStatus hdfsFileStatus `json:"FileStatus"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &result.FileStatus, nil
+}
+
+// FileExists return true if file exists.
+func (s *HDFSStorage) FileExists(ctx context.Context, name string) (bool, error) {
+	status, err := s.fileStatus(ctx, name)
+	if err != nil {
+		if isHDFSNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Trace(err)
+	}
+	return status.Type == "FILE", nil
+}
+
+// Open a Reader by file path.
+func (s *HDFSStorage) Open(ctx context.Context, path string) (ReadSeekCloser, error) {
+	status, err := s.fileStatus(ctx, path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if status.Type != "FILE" {
+		return nil, errors.Annotatef(berrors.ErrStorageUnknown, "open hdfs file '%s' failed, it is a %s", path, status.Type)
+	}
+	return &hdfsFileReader{
+		storage:   s,
+		name:      path,
+		totalSize: status.Length,
+		ctx:       ctx,
+	}, nil
+}
+
+type hdfsListing struct {
+	DirectoryListing struct {
+		PartialListing struct {
+			FileStatuses struct {
+				FileStatus []hdfsFileStatus `json:"FileStatus"`
+			} `json:"FileStatuses"`
+		} `json:"partialListing"`
+		RemainingEntries int `json:"remainingEntries"`
+	} `json:"DirectoryListing"`
+}
+
+// WalkDir traverse all the files in a dir.
+//
+// fn is the function called for each regular file visited by WalkDir.
+// The first argument is the file path that can be used in `Open`
+// function; the second argument is the size in byte of the file determined
+// by path.
+//
+// WalkOption.ListCount is ignored, since the page size of WebHDFS listing is
+// decided by the NameNode (`dfs.ls.limit`).
+func (s *HDFSStorage) WalkDir(ctx context.Context, opt *WalkOption, fn func(string, int64) error) error {
+	if opt == nil {
+		opt = &WalkOption{}
+	}
+	err := s.walkDir(ctx, strings.Trim(opt.SubDir, "/"), fn)
+	if isHDFSNotFound(err) {
+		// keep the same behavior as the other storages if path not exists.
+		return nil
+	}
+	return errors.Trace(err)
+}
+
+func (s *HDFSStorage) walkDir(ctx context.Context, dir string, fn func(string, int64) error) error {
+	query := url.Values{}
+	for {
+		resp, err := s.do(ctx, s.client, http.MethodGet, dir, "LISTSTATUS_BATCH", query, nil)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		var listing hdfsListing
+		err = json.NewDecoder(resp.Body).Decode(&listing)
+		resp.Body.Close()
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		statuses := listing.DirectoryListing.PartialListing.FileStatuses.FileStatus
+		for _, status := range statuses {
+			name := path.Join(dir, status.PathSuffix)
+			if status.Type == "DIRECTORY" {
+				if err = s.walkDir(ctx, name, fn); err != nil {
+					return errors.Trace(err)
+				}
+				continue
+			}
+			if err = fn(name, status.Length); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		if listing.DirectoryListing.RemainingEntries == 0 || len(statuses) == 0 {
+			return nil
+		}
+		query.Set("startAfter", statuses[len(statuses)-1].PathSuffix)
+	}
+}
+
+// URI returns hdfs://<namenode>/<path>.
+func (s *HDFSStorage) URI() string {
+	u, err := url.Parse(s.config.Endpoint)
+	if err != nil {
+		return "hdfs://" + s.config.Path
+	}
+	return "hdfs://" + u.Host + path.Join("/", s.config.Path)
+}
+
+// DeleteFile delete the file in storage.
+func (s *HDFSStorage) DeleteFile(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, s.client, http.MethodDelete, name, "DELETE", nil, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// the response is `{"boolean": false}` if the file doesn't exist, which
+	// is not an error.
+	return resp.Body.Close()
+}
+
+// DeleteFiles delete the files in storage.
+func (s *HDFSStorage) DeleteFiles(ctx context.Context, names []string) error {
+	for _, name := range names {
+		if err := s.DeleteFile(ctx, name); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Rename renames the file, the parent directory of newFileName is created if
+// needed. WebHDFS never overwrites the destination, so the existing
+// newFileName is moved aside before renaming and deleted after that, like the
+// other storages overwrite it. The destination is moved back if the rename
+// fails, and it is kept in the backup file if BR crashes in between.
+func (s *HDFSStorage) Rename(ctx context.Context, oldFileName, newFileName string) error {
+	resp, err := s.do(ctx, s.client, http.MethodPut, path.Dir(newFileName), "MKDIRS", nil, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resp.Body.Close()
+
+	renamed, err := s.rename(ctx, oldFileName, newFileName)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if renamed {
+		return nil
+	}
+	exist, err := s.FileExists(ctx, oldFileName)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !exist {
+		return errors.Annotatef(berrors.ErrStorageUnknown, "rename hdfs file '%s' to '%s' failed", oldFileName, newFileName)
+	}
+
+	backupFileName := newFileName + hdfsRenameBackupSuffix
+	// the backup file is left by a crash of the previous rename, the
+	// destination still exists so the backup is stale.
+	if err = s.DeleteFile(ctx, backupFileName); err != nil {
+		return errors.Trace(err)
+	}
+	if renamed, err = s.rename(ctx, newFileName, backupFileName); err != nil {
+		return errors.Trace(err)
+	}
+	if !renamed {
+		return errors.Annotatef(berrors.ErrStorageUnknown,
+			"rename hdfs file '%s' to '%s' failed, cannot move the destination aside", oldFileName, newFileName)
+	}
+	renamed, err = s.rename(ctx, oldFileName, newFileName)
+	if err != nil || !renamed {
+		if _, e := s.rename(ctx, backupFileName, newFileName); e != nil {
+			log.Warn("failed to restore the destination of the hdfs rename",
+				zap.String("file", newFileName), zap.String("backup", backupFileName), zap.Error(e))
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return errors.Annotatef(berrors.ErrStorageUnknown, "rename hdfs file '%s' to '%s' failed", oldFileName, newFileName)
+	}
+	if err = s.DeleteFile(ctx, backupFileName); err != nil {
+		log.Warn("failed to delete the backup file of the hdfs rename",
+			zap.String("backup", backupFileName), zap.Error(err))
+	}
+	return nil
+}
+
+// rename does the RENAME operation, it returns false if the source doesn't
+// exist or the destination exists.
+func (s *HDFSStorage) rename(ctx context.Context, oldFileName, newFileName string) (bool, error) {
+	query := url.Values{"destination": []string{path.Join("/", s.config.Path, newFileName)}}
+	resp, err := s.do(ctx, s.client, http.MethodPut, oldFileName, "RENAME", query, nil)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Boolean bool `json:"boolean"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, errors.Trace(err)
+	}
+	return result.Boolean, nil
+}
+
+// CreateUploader implements ExternalStorage interface.
+//
+// The file is created empty, and every part is appended to it.
+func (s *HDFSStorage) CreateUploader(ctx context.Context, name string) (Uploader, error) {
+	if err := s.Write(ctx, name, nil); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &hdfsUploader{storage: s, name: name}, nil
+}
+
+// hdfsUploader appends the parts to a HDFS file.
+type hdfsUploader struct {
+	storage *HDFSStorage
+	name    string
+}
+
+// UploadPart appends the data to the file.
+func (u *hdfsUploader) UploadPart(ctx context.Context, data []byte) error {
+	return u.storage.writeData(ctx, http.MethodPost, u.name, "APPEND", nil, data)
+}
+
+// CompleteUpload does nothing since all parts are already appended.
+func (u *hdfsUploader) CompleteUpload(ctx context.Context) error {
+	return nil
+}
+
+// hdfsFileReader reads a HDFS file with offset reads and supports `Seek`.
+type hdfsFileReader struct {
+	storage   *HDFSStorage
+	name      string
+	reader    io.ReadCloser
+	pos       int64
+	totalSize int64
+	// reader context used for implement `io.Seek`
+	ctx context.Context
+}
+
+// Read implement the io.Reader interface.
+func (r *hdfsFileReader) Read(p []byte) (n int, err error) {
+	if r.pos >= r.totalSize {
+		return 0, io.EOF
+	}
+	if r.reader == nil {
+		query := url.Values{"offset": []string{strconv.FormatInt(r.pos, 10)}}
+		resp, err := r.storage.do(r.ctx, r.storage.client, http.MethodGet, r.name, "OPEN", query, nil)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		r.reader = resp.Body
+	}
+	n, err = r.reader.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+// Close implement the io.Closer interface.
+func (r *hdfsFileReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Close()
+}
+
+// Seek implement the io.Seeker interface.
+func (r *hdfsFileReader) Seek(offset int64, whence int) (int64, error) {
+	var realOffset int64
+	switch whence {
+	case io.SeekStart:
+		realOffset = offset
+	case io.SeekCurrent:
+		realOffset = r.pos + offset
+	case io.SeekEnd:
+		realOffset = r.totalSize + offset
+	default:
+		return 0, errors.Annotatef(berrors.ErrStorageUnknown, "Seek: invalid whence '%d'", whence)
+	}
+	if realOffset < 0 {
+		return 0, errors.Annotatef(berrors.ErrStorageUnknown, "Seek: offset '%d' out of range", realOffset)
+	}
+	if realOffset == r.pos {
+		return realOffset, nil
+	}
+	if r.reader != nil {
+		if err := r.reader.Close(); err != nil {
+			return 0, errors.Trace(err)
+		}
+		r.reader = nil
+	}
+	r.pos = realOffset
+	return realOffset, nil
+}
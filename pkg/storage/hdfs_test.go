@@ -0,0 +1,338 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	. "github.com/pingcap/check"
+)
+
+const fakeWebHDFSListLimit = 2
+
+// fakeWebHDFS is a minimal in-memory stand-in of the WebHDFS REST API.
+// Requests to `/webhdfs/v1` are served by the "NameNode", which redirects
+// the data operations to `/datanode`.
+type fakeWebHDFS struct {
+	mu    sync.Mutex
+	url   string
+	files map[string][]byte
+	dirs  map[string]struct{}
+	// failRename is the source path whose RENAME always fails.
+	failRename string
+}
+
+func newFakeWebHDFS() *fakeWebHDFS {
+	return &fakeWebHDFS{
+		files: make(map[string][]byte),
+		dirs:  map[string]struct{}{"/": {}},
+	}
+}
+
+func (f *fakeWebHDFS) mkdirs(p string) {
+	for ; p != "/"; p = path.Dir(p) {
+		f.dirs[p] = struct{}{}
+	}
+}
+
+func (f *fakeWebHDFS) notFound(w http.ResponseWriter, p string) {
+	w.WriteHeader(http.StatusNotFound)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"RemoteException": map[string]string{
+			"exception": "FileNotFoundException",
+			"message":   "File does not exist: " + p,
+		},
+	})
+}
+
+func (f *fakeWebHDFS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := req.URL.Query()
+	if query.Get("user.name") != "br" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	op := query.Get("op")
+
+	if p := strings.TrimPrefix(req.URL.Path, "/datanode"); p != req.URL.Path {
+		body, _ := ioutil.ReadAll(req.Body)
+		switch op {
+		case "CREATE":
+			f.mkdirs(path.Dir(p))
+			f.files[p] = body
+			w.WriteHeader(http.StatusCreated)
+		case "APPEND":
+			content, ok := f.files[p]
+			if !ok {
+				f.notFound(w, p)
+				return
+			}
+			f.files[p] = append(content, body...)
+			w.WriteHeader(http.StatusOK)
+		case "OPEN":
+			content, ok := f.files[p]
+			if !ok {
+				f.notFound(w, p)
+				return
+			}
+			offset, _ := strconv.Atoi(query.Get("offset"))
+			if offset > len(content) {
+				offset = len(content)
+			}
+			_, _ = w.Write(content[offset:])
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		return
+	}
+
+	p := strings.TrimPrefix(req.URL.Path, hdfsPathPrefix)
+	switch op {
+	case "CREATE", "APPEND", "OPEN":
+		w.Header().Set("Location", f.url+"/datanode"+p+"?"+req.URL.RawQuery)
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	case "MKDIRS":
+		f.mkdirs(p)
+		_, _ = w.Write([]byte(`{"boolean":true}`))
+	case "DELETE":
+		_, ok := f.files[p]
+		delete(f.files, p)
+		_ = json.NewEncoder(w).Encode(map[string]bool{"boolean": ok})
+	case "RENAME":
+		dest := query.Get("destination")
+		content, ok := f.files[p]
+		_, destExists := f.files[dest]
+		_, parentExists := f.dirs[path.Dir(dest)]
+		if p == f.failRename {
+			ok = false
+		}
+		if ok && !destExists && parentExists {
+			delete(f.files, p)
+			f.files[dest] = content
+		}
+		_ = json.NewEncoder(w).Encode(map[string]bool{"boolean": ok && !destExists && parentExists})
+	case "GETFILESTATUS":
+		status := hdfsFileStatus{}
+		if content, ok := f.files[p]; ok {
+			status.Type, status.Length = "FILE", int64(len(content))
+		} else if _, ok := f.dirs[p]; ok {
+			status.Type = "DIRECTORY"
+		} else {
+			f.notFound(w, p)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"FileStatus": status})
+	case "LISTSTATUS_BATCH":
+		if _, ok := f.dirs[p]; !ok {
+			f.notFound(w, p)
+			return
+		}
+		var children []hdfsFileStatus
+		for name, content := range f.files {
+			if path.Dir(name) == p {
+				children = append(children, hdfsFileStatus{PathSuffix: path.Base(name), Type: "FILE", Length: int64(len(content))})
+			}
+		}
+		for name := range f.dirs {
+			if name != "/" && path.Dir(name) == p {
+				children = append(children, hdfsFileStatus{PathSuffix: path.Base(name), Type: "DIRECTORY"})
+			}
+		}
+		sort.Slice(children, func(i, j int) bool { return children[i].PathSuffix < children[j].PathSuffix })
+		startAfter := query.Get("startAfter")
+		i := sort.Search(len(children), func(i int) bool { return children[i].PathSuffix > startAfter })
+		children = children[i:]
+		remaining := 0
+		if len(children) > fakeWebHDFSListLimit {
+			remaining = len(children) - fakeWebHDFSListLimit
+			children = children[:fakeWebHDFSListLimit]
+		}
+		var listing hdfsListing
+		listing.DirectoryListing.PartialListing.FileStatuses.FileStatus = children
+		listing.DirectoryListing.RemainingEntries = remaining
+		_ = json.NewEncoder(w).Encode(listing)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (r *testStorageSuite) TestHDFSStorage(c *C) {
+	ctx := context.Background()
+	fake := newFakeWebHDFS()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	fake.url = server.URL
+
+	options := &BackendOptions{HDFS: HDFSBackendOptions{
+		Endpoint: server.URL,
+		User:     "br",
+	}}
+	stg, err := NewFromURL(ctx, "hdfs://namenode/backup/br/", options, &ExternalStorageOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(stg.URI(), Equals, "hdfs://"+strings.TrimPrefix(server.URL, "http://")+"/backup/br")
+	_, ok := fake.dirs["/backup/br"]
+	c.Assert(ok, IsTrue)
+
+	err = stg.Write(ctx, "key", []byte("data"))
+	c.Assert(err, IsNil)
+	c.Assert(fake.files["/backup/br/key"], DeepEquals, []byte("data"))
+	d, err := stg.Read(ctx, "key")
+	c.Assert(err, IsNil)
+	c.Assert(d, DeepEquals, []byte("data"))
+
+	exist, err := stg.FileExists(ctx, "key")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsTrue)
+	exist, err = stg.FileExists(ctx, "key_not_exist")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	_, err = stg.Read(ctx, "key_not_exist")
+	c.Assert(err, ErrorMatches, ".*exception: FileNotFoundException.*")
+
+	// create + append through the writer.
+	uploader, err := stg.CreateUploader(ctx, "sub/multi")
+	c.Assert(err, IsNil)
+	writer := newUploaderWriter(uploader, 4, NoCompression)
+	_, err = writer.Write(ctx, []byte("0123456789"))
+	c.Assert(err, IsNil)
+	err = writer.Close(ctx)
+	c.Assert(err, IsNil)
+	d, err = stg.Read(ctx, "sub/multi")
+	c.Assert(err, IsNil)
+	c.Assert(string(d), Equals, "0123456789")
+
+	// offset reads.
+	reader, err := stg.Open(ctx, "sub/multi")
+	c.Assert(err, IsNil)
+	defer reader.Close()
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(reader, buf)
+	c.Assert(err, IsNil)
+	c.Assert(string(buf), Equals, "012")
+	offset, err := reader.Seek(5, io.SeekCurrent)
+	c.Assert(err, IsNil)
+	c.Assert(offset, Equals, int64(8))
+	rest, err := ioutil.ReadAll(reader)
+	c.Assert(err, IsNil)
+	c.Assert(string(rest), Equals, "89")
+
+	// walk recursively with paged listing.
+	for i := 0; i < 5; i++ {
+		err = stg.Write(ctx, fmt.Sprintf("sub/deep/file%d", i), []byte(strings.Repeat("x", i)))
+		c.Assert(err, IsNil)
+	}
+	walked := make(map[string]int64)
+	err = stg.WalkDir(ctx, &WalkOption{SubDir: "sub"}, func(path string, size int64) error {
+		walked[path] = size
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(walked, DeepEquals, map[string]int64{
+		"sub/multi":      10,
+		"sub/deep/file0": 0,
+		"sub/deep/file1": 1,
+		"sub/deep/file2": 2,
+		"sub/deep/file3": 3,
+		"sub/deep/file4": 4,
+	})
+
+	walked = make(map[string]int64)
+	err = stg.WalkDir(ctx, &WalkOption{SubDir: "not_exist"}, func(path string, size int64) error {
+		walked[path] = size
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(walked, HasLen, 0)
+
+	// rename and delete.
+	err = stg.Rename(ctx, "sub/multi", "renamed/multi")
+	c.Assert(err, IsNil)
+	exist, err = stg.FileExists(ctx, "sub/multi")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	d, err = stg.Read(ctx, "renamed/multi")
+	c.Assert(err, IsNil)
+	c.Assert(string(d), Equals, "0123456789")
+	err = stg.Rename(ctx, "sub/multi", "renamed/multi")
+	c.Assert(err, ErrorMatches, ".*rename hdfs file 'sub/multi' to 'renamed/multi' failed.*")
+	// the destination is kept if the source doesn't exist.
+	d, err = stg.Read(ctx, "renamed/multi")
+	c.Assert(err, IsNil)
+	c.Assert(string(d), Equals, "0123456789")
+
+	// the existing destination is overwritten, and the stale backup file of
+	// the destination is replaced.
+	err = stg.Write(ctx, "sub/new", []byte("new"))
+	c.Assert(err, IsNil)
+	err = stg.Write(ctx, "renamed/multi"+hdfsRenameBackupSuffix, []byte("stale"))
+	c.Assert(err, IsNil)
+	err = stg.Rename(ctx, "sub/new", "renamed/multi")
+	c.Assert(err, IsNil)
+	exist, err = stg.FileExists(ctx, "sub/new")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	d, err = stg.Read(ctx, "renamed/multi")
+	c.Assert(err, IsNil)
+	c.Assert(string(d), Equals, "new")
+	exist, err = stg.FileExists(ctx, "renamed/multi"+hdfsRenameBackupSuffix)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+
+	// the destination is moved back if the rename fails.
+	err = stg.Write(ctx, "sub/fail", []byte("fail"))
+	c.Assert(err, IsNil)
+	fake.mu.Lock()
+	fake.failRename = "/backup/br/sub/fail"
+	fake.mu.Unlock()
+	err = stg.Rename(ctx, "sub/fail", "renamed/multi")
+	c.Assert(err, ErrorMatches, ".*rename hdfs file 'sub/fail' to 'renamed/multi' failed.*")
+	fake.mu.Lock()
+	fake.failRename = ""
+	fake.mu.Unlock()
+	d, err = stg.Read(ctx, "renamed/multi")
+	c.Assert(err, IsNil)
+	c.Assert(string(d), Equals, "new")
+	exist, err = stg.FileExists(ctx, "renamed/multi"+hdfsRenameBackupSuffix)
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	err = stg.DeleteFile(ctx, "sub/fail")
+	c.Assert(err, IsNil)
+
+	err = stg.DeleteFile(ctx, "renamed/multi")
+	c.Assert(err, IsNil)
+	err = stg.DeleteFile(ctx, "renamed/multi")
+	c.Assert(err, IsNil)
+	err = stg.DeleteFiles(ctx, []string{"key", "sub/deep/file0", "sub/deep/file1", "sub/deep/file2"})
+	c.Assert(err, IsNil)
+	c.Assert(fake.files, HasLen, 2)
+}
+
+func (r *testStorageSuite) TestHDFSBackendOptions(c *C) {
+	_, err := ParseBackend("hdfs://namenode/path", nil)
+	c.Assert(err, ErrorMatches, ".*not supported by TiKV yet.*")
+
+	config := &HDFSStorageConfig{}
+	options := &HDFSBackendOptions{}
+	c.Assert(options.apply("namenode", config), IsNil)
+	c.Assert(config.Endpoint, Equals, "http://namenode:9870")
+
+	c.Assert(options.apply("namenode:50070", config), IsNil)
+	c.Assert(config.Endpoint, Equals, "http://namenode:50070")
+
+	options = &HDFSBackendOptions{Endpoint: "https://namenode:9871/"}
+	c.Assert(options.apply("namenode", config), IsNil)
+	c.Assert(config.Endpoint, Equals, "https://namenode:9871")
+}
@@ -26,6 +26,10 @@ type LocalStorage struct {
 
 func (l *LocalStorage) Write(ctx context.Context, name string, data []byte) error {
 	path := filepath.Join(l.base, name)
+	// the name may be in a sub directory, e.g. the manifests of the tables.
+	if err := os.MkdirAll(filepath.Dir(path), localDirPerm); err != nil {
+		return errors.Trace(err)
+	}
 	return ioutil.WriteFile(path, data, localFilePerm)
 	// the backup meta file _is_ intended to be world-readable.
 }
@@ -83,6 +87,35 @@ func (l *LocalStorage) URI() string {
 	return "file:///" + l.base
 }
 
+// DeleteFile deletes the file.
+func (l *LocalStorage) DeleteFile(ctx context.Context, name string) error {
+	err := os.Remove(filepath.Join(l.base, name))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// DeleteFiles deletes the files.
+func (l *LocalStorage) DeleteFiles(ctx context.Context, names []string) error {
+	for _, name := range names {
+		if err := l.DeleteFile(ctx, name); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// Rename renames the file, the parent directory of newFileName is created if
+// needed.
+func (l *LocalStorage) Rename(ctx context.Context, oldFileName, newFileName string) error {
+	newPath := filepath.Join(l.base, newFileName)
+	if err := mkdirAll(filepath.Dir(newPath)); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(filepath.Join(l.base, oldFileName), newPath))
+}
+
 type localStorageUploader struct {
 	file io.WriteCloser
 }
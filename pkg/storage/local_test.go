@@ -61,3 +61,38 @@ func (r *testStorageSuite) TestWalkDirWithSoftLinkFile(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(i, Equals, 2)
 }
+
+func (r *testStorageSuite) TestLocalDeleteAndRename(c *C) {
+	ctx := context.Background()
+	store, err := NewLocalStorage(c.MkDir())
+	c.Assert(err, IsNil)
+
+	for _, name := range []string{"a", "b", "c"} {
+		err = store.Write(ctx, name, []byte(name))
+		c.Assert(err, IsNil)
+	}
+
+	err = store.Rename(ctx, "a", "sub/dir/a1")
+	c.Assert(err, IsNil)
+	exist, err := store.FileExists(ctx, "a")
+	c.Assert(err, IsNil)
+	c.Assert(exist, IsFalse)
+	data, err := store.Read(ctx, "sub/dir/a1")
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte("a"))
+
+	err = store.DeleteFile(ctx, "sub/dir/a1")
+	c.Assert(err, IsNil)
+	err = store.DeleteFile(ctx, "not-exist")
+	c.Assert(err, IsNil)
+	err = store.DeleteFiles(ctx, []string{"b", "c", "not-exist"})
+	c.Assert(err, IsNil)
+
+	var names []string
+	err = store.WalkDir(ctx, &WalkOption{}, func(path string, size int64) error {
+		names = append(names, path)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(names, HasLen, 0)
+}
@@ -37,6 +37,21 @@ func (s *noopStorage) URI() string {
 	return "noop:///"
 }
 
+// DeleteFile implements ExternalStorage interface.
+func (*noopStorage) DeleteFile(ctx context.Context, name string) error {
+	return nil
+}
+
+// DeleteFiles implements ExternalStorage interface.
+func (*noopStorage) DeleteFiles(ctx context.Context, names []string) error {
+	return nil
+}
+
+// Rename implements ExternalStorage interface.
+func (*noopStorage) Rename(ctx context.Context, oldFileName, newFileName string) error {
+	return nil
+}
+
 // CreateUploader implenments ExternalStorage interface.
 func (*noopStorage) CreateUploader(ctx context.Context, name string) (Uploader, error) {
 	panic("noop storage not support multi-upload")
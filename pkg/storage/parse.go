@@ -3,7 +3,9 @@
 package storage
 
 import (
+	"context"
 	"net/url"
+	"path"
 	"path/filepath"
 	"reflect"
 	"strconv"
@@ -18,8 +20,10 @@ import (
 // BackendOptions further configures the storage backend not expressed by the
 // storage URL.
 type BackendOptions struct {
-	S3  S3BackendOptions  `json:"s3" toml:"s3"`
-	GCS GCSBackendOptions `json:"gcs" toml:"gcs"`
+	S3    S3BackendOptions    `json:"s3" toml:"s3"`
+	GCS   GCSBackendOptions   `json:"gcs" toml:"gcs"`
+	Azure AzureBackendOptions `json:"azblob" toml:"azblob"`
+	HDFS  HDFSBackendOptions  `json:"hdfs" toml:"hdfs"`
 }
 
 // ParseRawURL parse raw url to url object.
@@ -92,11 +96,75 @@ func ParseBackend(rawURL string, options *BackendOptions) (*backup.StorageBacken
 		}
 		return &backup.StorageBackend{Backend: &backup.StorageBackend_Gcs{Gcs: gcs}}, nil
 
+	case "azure", "azblob", "hdfs":
+		return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig,
+			"storage %s is not supported by TiKV yet, so backup and restore can not use it, "+
+				"only gc, list, show, verify, restore cdclog and the debug commands can", u.Scheme)
+
 	default:
 		return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig, "storage %s not support yet", u.Scheme)
 	}
 }
 
+// NewFromURL creates an ExternalStorage from the storage URL.
+//
+// Unlike ParseBackend, it also accepts the backends which TiKV can not access
+// (e.g. Azure Blob Storage and HDFS). Such storages can be used by the tasks that only
+// read or write files on the BR side, e.g. `restore cdclog`.
+func NewFromURL(
+	ctx context.Context,
+	rawURL string,
+	options *BackendOptions,
+	opts *ExternalStorageOptions,
+) (ExternalStorage, error) {
+	if len(rawURL) == 0 {
+		return nil, errors.Annotate(berrors.ErrStorageInvalidConfig, "empty store is not allowed")
+	}
+	u, err := ParseRawURL(rawURL)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if options == nil {
+		options = &BackendOptions{}
+	}
+	switch u.Scheme {
+	case "azure", "azblob":
+		if u.Host == "" {
+			return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig, "please specify the container for azure in %s", rawURL)
+		}
+		config := &AzureBlobStorageConfig{Container: u.Host, Prefix: strings.Trim(u.Path, "/")}
+		ExtractQueryParameters(u, &options.Azure)
+		if err := options.Azure.apply(config); err != nil {
+			return nil, errors.Trace(err)
+		}
+		s, err := newAzureBlobStorage(ctx, config, opts)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return wrapEncryption(s, opts)
+	case "hdfs":
+		if u.Host == "" {
+			return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig, "please specify the namenode for hdfs in %s", rawURL)
+		}
+		config := &HDFSStorageConfig{Path: path.Join("/", u.Path)}
+		ExtractQueryParameters(u, &options.HDFS)
+		if err := options.HDFS.apply(u.Host, config); err != nil {
+			return nil, errors.Trace(err)
+		}
+		s, err := newHDFSStorage(ctx, config, opts)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return wrapEncryption(s, opts)
+	default:
+		backend, err := ParseBackend(rawURL, options)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return New(ctx, backend, opts)
+	}
+}
+
 // ExtractQueryParameters moves the query parameters of the URL into the options
 // using reflection.
 //
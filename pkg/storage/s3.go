@@ -41,6 +41,9 @@ const (
 
 	// the maximum number of byte to read for seek.
 	maxSkipOffsetByRead = 1 << 16 // 64KB
+
+	// the maximum number of keys in a DeleteObjects request.
+	maxDeleteObjectsKeys = 1000
 )
 
 // S3Storage info for s3 storage.
@@ -422,6 +425,78 @@ func (rs *S3Storage) WalkDir(ctx context.Context, opt *WalkOption, fn func(strin
 	return nil
 }
 
+// DeleteFile delete the file in s3 storage.
+func (rs *S3Storage) DeleteFile(ctx context.Context, file string) error {
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(rs.options.Bucket),
+		Key:    aws.String(rs.options.Prefix + file),
+	}
+	_, err := rs.svc.DeleteObjectWithContext(ctx, input)
+	return errors.Trace(err)
+}
+
+// DeleteFiles delete the files in s3 storage with DeleteObjects requests.
+func (rs *S3Storage) DeleteFiles(ctx context.Context, files []string) error {
+	for len(files) > 0 {
+		batch := files
+		if len(batch) > maxDeleteObjectsKeys {
+			batch = batch[:maxDeleteObjectsKeys]
+		}
+		files = files[len(batch):]
+
+		objects := make([]*s3.ObjectIdentifier, 0, len(batch))
+		for _, file := range batch {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(rs.options.Prefix + file)})
+		}
+		input := &s3.DeleteObjectsInput{
+			Bucket: aws.String(rs.options.Bucket),
+			Delete: &s3.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		}
+		output, err := rs.svc.DeleteObjectsWithContext(ctx, input)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if len(output.Errors) > 0 {
+			e := output.Errors[0]
+			return errors.Annotatef(berrors.ErrStorageUnknown,
+				"failed to delete %d files, first error: key '%s', code: %s, %s",
+				len(output.Errors), aws.StringValue(e.Key), aws.StringValue(e.Code), aws.StringValue(e.Message))
+		}
+	}
+	return nil
+}
+
+// Rename copies the file to the new name and then deletes the old one, since
+// s3 doesn't support renaming.
+func (rs *S3Storage) Rename(ctx context.Context, oldFileName, newFileName string) error {
+	// the copy source must be URL-encoded.
+	copySource := (&url.URL{Path: rs.options.Bucket + "/" + rs.options.Prefix + oldFileName}).EscapedPath()
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(rs.options.Bucket),
+		CopySource: aws.String(copySource),
+		Key:        aws.String(rs.options.Prefix + newFileName),
+	}
+	if rs.options.Acl != "" {
+		input = input.SetACL(rs.options.Acl)
+	}
+	if rs.options.Sse != "" {
+		input = input.SetServerSideEncryption(rs.options.Sse)
+	}
+	if rs.options.SseKmsKeyId != "" {
+		input = input.SetSSEKMSKeyId(rs.options.SseKmsKeyId)
+	}
+	if rs.options.StorageClass != "" {
+		input = input.SetStorageClass(rs.options.StorageClass)
+	}
+	if _, err := rs.svc.CopyObjectWithContext(ctx, input); err != nil {
+		return errors.Trace(err)
+	}
+	return rs.DeleteFile(ctx, oldFileName)
+}
+
 // URI returns s3://<base>/<prefix>.
 func (rs *S3Storage) URI() string {
 	return "s3://" + rs.options.Bucket + "/" + rs.options.Prefix
@@ -6,6 +6,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"math/rand"
@@ -802,3 +803,71 @@ func (s *s3Suite) TestWalkDir(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(i, Equals, len(contents))
 }
+
+// TestDeleteFiles checks DeleteFiles sends DeleteObjects requests in batches.
+func (s *s3Suite) TestDeleteFiles(c *C) {
+	s.setUpTest(c)
+	defer s.tearDownTest()
+	ctx := aws.BackgroundContext()
+
+	files := make([]string, 0, 1500)
+	for i := 0; i < 1500; i++ {
+		files = append(files, fmt.Sprintf("file%d", i))
+	}
+
+	firstCall := s.s3.EXPECT().
+		DeleteObjectsWithContext(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			c.Assert(aws.StringValue(input.Bucket), Equals, "bucket")
+			c.Assert(input.Delete.Objects, HasLen, 1000)
+			c.Assert(aws.StringValue(input.Delete.Objects[0].Key), Equals, "prefix/file0")
+			c.Assert(aws.BoolValue(input.Delete.Quiet), IsTrue)
+			return &s3.DeleteObjectsOutput{}, nil
+		})
+	s.s3.EXPECT().
+		DeleteObjectsWithContext(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+			c.Assert(input.Delete.Objects, HasLen, 500)
+			c.Assert(aws.StringValue(input.Delete.Objects[0].Key), Equals, "prefix/file1000")
+			return &s3.DeleteObjectsOutput{
+				Errors: []*s3.Error{{
+					Key:     aws.String("prefix/file1001"),
+					Code:    aws.String("AccessDenied"),
+					Message: aws.String("Access Denied"),
+				}},
+			}, nil
+		}).
+		After(firstCall)
+
+	err := s.storage.DeleteFiles(ctx, files)
+	c.Assert(err, ErrorMatches, "failed to delete 1 files, first error: key 'prefix/file1001', code: AccessDenied.*")
+}
+
+// TestRename checks Rename copies the object and deletes the old one.
+func (s *s3Suite) TestRename(c *C) {
+	s.setUpTest(c)
+	defer s.tearDownTest()
+	ctx := aws.BackgroundContext()
+
+	copyCall := s.s3.EXPECT().
+		CopyObjectWithContext(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+			c.Assert(aws.StringValue(input.Bucket), Equals, "bucket")
+			c.Assert(aws.StringValue(input.CopySource), Equals, "bucket/prefix/old%20file")
+			c.Assert(aws.StringValue(input.Key), Equals, "prefix/new")
+			c.Assert(aws.StringValue(input.ACL), Equals, "acl")
+			c.Assert(aws.StringValue(input.StorageClass), Equals, "sc")
+			return &s3.CopyObjectOutput{}, nil
+		})
+	s.s3.EXPECT().
+		DeleteObjectWithContext(ctx, gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+			c.Assert(aws.StringValue(input.Bucket), Equals, "bucket")
+			c.Assert(aws.StringValue(input.Key), Equals, "prefix/old file")
+			return &s3.DeleteObjectOutput{}, nil
+		}).
+		After(copyCall)
+
+	err := s.storage.Rename(ctx, "old file", "new")
+	c.Assert(err, IsNil)
+}
@@ -75,6 +75,18 @@ type ExternalStorage interface {
 	// URI returns the base path as a URI
 	URI() string
 
+	// DeleteFile delete the file in storage. It is not an error if the file
+	// doesn't exist.
+	DeleteFile(ctx context.Context, name string) error
+	// DeleteFiles delete the files in storage in batch. It is not an error if
+	// some of the files don't exist.
+	DeleteFiles(ctx context.Context, names []string) error
+	// Rename file name from oldFileName to newFileName.
+	//
+	// Rename is atomic only if the storage supports it natively (e.g. local
+	// and HDFS), otherwise it is implemented by copy and delete.
+	Rename(ctx context.Context, oldFileName, newFileName string) error
+
 	// CreateUploader create a uploader that will upload chunks data to storage.
 	// It's design for s3 multi-part upload currently. e.g. cdc log backup use this to do multi part upload
 	// to avoid generate small fragment files.
@@ -102,6 +114,10 @@ type ExternalStorageOptions struct {
 	// HTTPClient to use. The created storage may ignore this field if it is not
 	// directly using HTTP (e.g. the local storage).
 	HTTPClient *http.Client
+
+	// Encryption is the config of the client-side encryption. The files are
+	// written and read as-is if it is nil.
+	Encryption *EncryptionConfig
 }
 
 // Create creates ExternalStorage.
@@ -117,6 +133,14 @@ func Create(ctx context.Context, backend *backup.StorageBackend, sendCreds bool)
 
 // New creates an ExternalStorage with options.
 func New(ctx context.Context, backend *backup.StorageBackend, opts *ExternalStorageOptions) (ExternalStorage, error) {
+	s, err := newBackendStorage(ctx, backend, opts)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return wrapEncryption(s, opts)
+}
+
+func newBackendStorage(ctx context.Context, backend *backup.StorageBackend, opts *ExternalStorageOptions) (ExternalStorage, error) {
 	switch backend := backend.Backend.(type) {
 	case *backup.StorageBackend_Local:
 		if backend.Local == nil {
@@ -142,3 +166,10 @@ func New(ctx context.Context, backend *backup.StorageBackend, opts *ExternalStor
 		return nil, errors.Annotatef(berrors.ErrStorageInvalidConfig, "storage %T is not supported yet", backend)
 	}
 }
+
+func wrapEncryption(s ExternalStorage, opts *ExternalStorageOptions) (ExternalStorage, error) {
+	if opts.Encryption == nil {
+		return s, nil
+	}
+	return NewEncryptedStorage(s, opts.Encryption)
+}
@@ -37,8 +37,12 @@ type LogCollector interface {
 
 	CollectUInt(name string, t uint64)
 
+	CollectString(name string, t string)
+
 	SetSuccessStatus(success bool)
 
+	Report(name string) *Report
+
 	Summary(name string)
 }
 
@@ -76,6 +80,7 @@ type logCollector struct {
 	durations        map[string]time.Duration
 	ints             map[string]int
 	uints            map[string]uint64
+	strings          map[string]string
 	successStatus    bool
 	startTime        time.Time
 
@@ -93,6 +98,7 @@ func NewLogCollector(log logFunc) LogCollector {
 		durations:        make(map[string]time.Duration),
 		ints:             make(map[string]int),
 		uints:            make(map[string]uint64),
+		strings:          make(map[string]string),
 		log:              log,
 		startTime:        time.Now(),
 	}
@@ -144,6 +150,12 @@ func (tc *logCollector) CollectUInt(name string, t uint64) {
 	tc.uints[name] += t
 }
 
+func (tc *logCollector) CollectString(name string, t string) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.strings[name] = t
+}
+
 func (tc *logCollector) SetSuccessStatus(success bool) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
@@ -155,11 +167,18 @@ func (tc *logCollector) Summary(name string) {
 	defer func() {
 		tc.durations = make(map[string]time.Duration)
 		tc.ints = make(map[string]int)
+		tc.strings = make(map[string]string)
 		tc.successCosts = make(map[string]time.Duration)
 		tc.failureReasons = make(map[string]error)
 		tc.mu.Unlock()
 	}()
 
+	if path := reportFile(); path != "" {
+		if err := writeReport(path, tc.report(name)); err != nil {
+			log.Warn("failed to write summary file", zap.String("path", path), zap.Error(err))
+		}
+	}
+
 	var msg string
 	switch tc.unit {
 	case BackupUnit:
@@ -180,6 +199,9 @@ func (tc *logCollector) Summary(name string) {
 	for key, val := range tc.uints {
 		logFields = append(logFields, zap.Uint64(key, val))
 	}
+	for key, val := range tc.strings {
+		logFields = append(logFields, zap.String(key, val))
+	}
 
 	if len(tc.failureReasons) != 0 || !tc.successStatus {
 		for unitName, reason := range tc.failureReasons {
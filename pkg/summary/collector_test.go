@@ -3,10 +3,14 @@
 package summary
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 	"time"
 
 	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
 	"go.uber.org/zap"
 )
 
@@ -47,3 +51,43 @@ func (suit *testCollectorSuite) TestSumDurationInt(c *C) {
 	assertContains(zap.Duration("b", 2*time.Second))
 	assertContains(zap.Int("c", 4))
 }
+
+func (suit *testCollectorSuite) TestSummaryFile(c *C) {
+	path := filepath.Join(c.MkDir(), "summary.json")
+	SetSummaryFile(path)
+	defer SetSummaryFile("")
+
+	col := NewLogCollector(func(msg string, fs ...zap.Field) {})
+	col.SetUnit(RestoreUnit)
+	col.CollectSuccessUnit("files", 2, 2*time.Second)
+	col.CollectSuccessUnit(TotalKV, 1, uint64(100))
+	col.CollectSuccessUnit(TotalBytes, 1, uint64(1000))
+	col.CollectFailureUnit("file", errors.New("injected"))
+	col.CollectDuration("a", time.Second)
+	col.CollectInt("b", 3)
+	col.CollectUInt("backup ts", 42)
+	col.CollectString("backup path", "local:///tmp/backup")
+	col.SetSuccessStatus(true)
+	col.Summary("Full restore")
+
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, IsNil)
+	report := &Report{}
+	c.Assert(json.Unmarshal(data, report), IsNil)
+	c.Assert(report.Name, Equals, "Full restore")
+	c.Assert(report.Unit, Equals, RestoreUnit)
+	// the task fails since there is a failure unit.
+	c.Assert(report.Success, IsFalse)
+	c.Assert(report.TotalUnits, Equals, 3)
+	c.Assert(report.SuccessUnits, Equals, 2)
+	c.Assert(report.FailureUnits, Equals, 1)
+	c.Assert(report.FailureReasons, DeepEquals, map[string]string{"file": "injected"})
+	c.Assert(report.TotalCost, Equals, float64(2))
+	c.Assert(report.TotalKV, Equals, uint64(100))
+	c.Assert(report.TotalBytes, Equals, uint64(1000))
+	c.Assert(report.AvgSpeed, Equals, float64(500))
+	c.Assert(report.Durations, DeepEquals, map[string]float64{"a": 1})
+	c.Assert(report.Ints, DeepEquals, map[string]int{"b": 3})
+	c.Assert(report.Uints, DeepEquals, map[string]uint64{"backup ts": 42})
+	c.Assert(report.Strings, DeepEquals, map[string]string{"backup path": "local:///tmp/backup"})
+}
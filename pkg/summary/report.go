@@ -0,0 +1,125 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package summary
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+var summaryFile = struct {
+	sync.Mutex
+	path string
+}{}
+
+// SetSummaryFile sets the file to write the summary report to in JSON when
+// the summary is output. The report is not written if path is empty.
+func SetSummaryFile(path string) {
+	summaryFile.Lock()
+	defer summaryFile.Unlock()
+	summaryFile.path = path
+}
+
+func reportFile() string {
+	summaryFile.Lock()
+	defer summaryFile.Unlock()
+	return summaryFile.path
+}
+
+// Report is the machine-readable summary of a task. The durations are in
+// seconds and the speed is in bytes per second.
+type Report struct {
+	Name      string    `json:"name"`
+	Unit      string    `json:"unit"`
+	Success   bool      `json:"success"`
+	StartTime time.Time `json:"start-time"`
+	EndTime   time.Time `json:"end-time"`
+
+	TotalUnits     int               `json:"total-units"`
+	SuccessUnits   int               `json:"success-units"`
+	FailureUnits   int               `json:"failure-units"`
+	FailureReasons map[string]string `json:"failure-reasons"`
+
+	TotalCost  float64 `json:"total-cost"`
+	RealCost   float64 `json:"real-cost"`
+	TotalKV    uint64  `json:"total-kv"`
+	TotalBytes uint64  `json:"total-bytes"`
+	AvgSpeed   float64 `json:"avg-speed"`
+
+	Durations   map[string]float64 `json:"durations"`
+	Ints        map[string]int     `json:"ints"`
+	Uints       map[string]uint64  `json:"uints"`
+	Strings     map[string]string  `json:"strings"`
+	SuccessData map[string]uint64  `json:"success-data"`
+}
+
+// Report returns the report of the fields collected so far.
+func (tc *logCollector) Report(name string) *Report {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	return tc.report(name)
+}
+
+// report builds the report from the collected fields, the caller must hold
+// the lock.
+func (tc *logCollector) report(name string) *Report {
+	now := time.Now()
+	r := &Report{
+		Name:           name,
+		Unit:           tc.unit,
+		Success:        len(tc.failureReasons) == 0 && tc.successStatus,
+		StartTime:      tc.startTime,
+		EndTime:        now,
+		TotalUnits:     tc.successUnitCount + tc.failureUnitCount,
+		SuccessUnits:   tc.successUnitCount,
+		FailureUnits:   tc.failureUnitCount,
+		FailureReasons: make(map[string]string, len(tc.failureReasons)),
+		RealCost:       now.Sub(tc.startTime).Seconds(),
+		TotalKV:        tc.successData[TotalKV],
+		TotalBytes:     tc.successData[TotalBytes],
+		Durations:      make(map[string]float64, len(tc.durations)),
+		Ints:           make(map[string]int, len(tc.ints)),
+		Uints:          make(map[string]uint64, len(tc.uints)),
+		Strings:        make(map[string]string, len(tc.strings)),
+		SuccessData:    make(map[string]uint64, len(tc.successData)),
+	}
+	for unitName, reason := range tc.failureReasons {
+		r.FailureReasons[unitName] = reason.Error()
+	}
+	var totalCost time.Duration
+	for _, cost := range tc.successCosts {
+		totalCost += cost
+	}
+	r.TotalCost = totalCost.Seconds()
+	if r.TotalCost > 0 {
+		r.AvgSpeed = float64(r.TotalBytes) / r.TotalCost
+	}
+	for key, val := range tc.durations {
+		r.Durations[key] = val.Seconds()
+	}
+	for key, val := range tc.ints {
+		r.Ints[key] = val
+	}
+	for key, val := range tc.uints {
+		r.Uints[key] = val
+	}
+	for key, val := range tc.strings {
+		r.Strings[key] = val
+	}
+	for key, val := range tc.successData {
+		r.SuccessData[key] = val
+	}
+	return r
+}
+
+func writeReport(path string, r *Report) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(ioutil.WriteFile(path, append(data, '\n'), 0o644))
+}
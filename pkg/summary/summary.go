@@ -34,11 +34,21 @@ func CollectUint(name string, t uint64) {
 	collector.CollectUInt(name, t)
 }
 
+// CollectString collects log string field.
+func CollectString(name string, t string) {
+	collector.CollectString(name, t)
+}
+
 // SetSuccessStatus sets final success status.
 func SetSuccessStatus(success bool) {
 	collector.SetSuccessStatus(success)
 }
 
+// GetReport returns the report of the fields collected so far.
+func GetReport(name string) *Report {
+	return collector.Report(name)
+}
+
 // Summary outputs summary log.
 func Summary(name string) {
 	collector.Summary(name)
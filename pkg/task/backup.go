@@ -36,6 +36,8 @@ const (
 	flagCompressionLevel = "compression-level"
 	flagRemoveSchedulers = "remove-schedulers"
 	flagIgnoreStats      = "ignore-stats"
+	flagResume           = "resume"
+	flagLayout           = "layout"
 
 	flagGCTTL = "gcttl"
 
@@ -59,6 +61,8 @@ type BackupConfig struct {
 	GCTTL            int64         `json:"gc-ttl" toml:"gc-ttl"`
 	RemoveSchedulers bool          `json:"remove-schedulers" toml:"remove-schedulers"`
 	IgnoreStats      bool          `json:"ignore-stats" toml:"ignore-stats"`
+	Resume           bool          `json:"resume" toml:"resume"`
+	Layout           string        `json:"layout" toml:"layout"`
 	CompressionConfig
 }
 
@@ -83,14 +87,16 @@ func DefineBackupFlags(flags *pflag.FlagSet) {
 	// This flag can impact the online cluster, so hide it in case of abuse.
 	_ = flags.MarkHidden(flagRemoveSchedulers)
 
-	// Disable stats by default. because of
-	// 1. DumpStatsToJson is not stable
-	// 2. It increases memory usage may cause BR OOM
-	// TODO: we need a better way to backup/restore stats.
-	flags.Bool(flagIgnoreStats, true,
-		"ignore backup stats, used for test")
-	// This flag is used for test. we should backup stats all the time.
-	_ = flags.MarkHidden(flagIgnoreStats)
+	flags.Bool(flagIgnoreStats, false,
+		"do not backup the statistics of the tables, "+
+			"the statistics of each table are saved in a separate file by default")
+
+	flags.Bool(flagResume, false,
+		"resume the failed backup to the same storage from its checkpoint, the backed up ranges are skipped")
+
+	flags.String(flagLayout, backup.LayoutFlat,
+		"the layout of the backup files, value can be one of 'flat|table', "+
+			"'table' writes the files of each table under the <db>/<table>/ directory with a manifest")
 }
 
 // ParseFromFlags parses the backup-related flags from the flag set.
@@ -135,7 +141,21 @@ func (cfg *BackupConfig) ParseFromFlags(flags *pflag.FlagSet) error {
 		return errors.Trace(err)
 	}
 	cfg.IgnoreStats, err = flags.GetBool(flagIgnoreStats)
-	return errors.Trace(err)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Resume, err = flags.GetBool(flagResume)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Layout, err = flags.GetString(flagLayout)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.Layout != backup.LayoutFlat && cfg.Layout != backup.LayoutTable {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "invalid layout %s", cfg.Layout)
+	}
+	return nil
 }
 
 // ParseFromFlags parses the backup-related flags from the flag set.
@@ -178,13 +198,17 @@ func (cfg *BackupConfig) adjustBackupConfig() {
 	if cfg.CompressionType == kvproto.CompressionType_UNKNOWN {
 		cfg.CompressionType = kvproto.CompressionType_ZSTD
 	}
+	if cfg.Layout == "" {
+		cfg.Layout = backup.LayoutFlat
+	}
 }
 
 // RunBackup starts a backup task inside the current goroutine.
-func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig) error {
+func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig) (err error) {
 	cfg.adjustBackupConfig()
 
 	defer summary.Summary(cmdName)
+	defer func() { cfg.Notify.notifyTaskFinished(cmdName, err) }()
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
@@ -192,6 +216,7 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 	if err != nil {
 		return errors.Trace(err)
 	}
+	collectBackupPath(u)
 	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
 	if err != nil {
 		return errors.Trace(err)
@@ -202,9 +227,29 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 	if err != nil {
 		return errors.Trace(err)
 	}
-	if err = client.SetStorage(ctx, u, cfg.SendCreds); err != nil {
+	opts, err := cfg.storageOptions()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.Resume {
+		client.EnableResume()
+	}
+	if err = client.SetStorage(ctx, u, opts); err != nil {
 		return errors.Trace(err)
 	}
+	var previousCheckpoint *backup.Checkpoint
+	if cfg.Resume {
+		previousCheckpoint, err = client.LoadCheckpoint(ctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if previousCheckpoint == nil {
+			log.Info("no checkpoint found, start a new backup")
+		} else if cfg.BackupTS == 0 {
+			// Resume the backup with the same backup ts.
+			cfg.BackupTS = previousCheckpoint.BackupTS
+		}
+	}
 	err = client.SetLockFile(ctx)
 	if err != nil {
 		return errors.Trace(err)
@@ -216,6 +261,7 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 		return errors.Trace(err)
 	}
 	g.Record("BackupTS", backupTS)
+	summary.CollectUint("backup ts", backupTS)
 	sp := utils.BRServiceSafePoint{
 		BackupTS: backupTS,
 		TTL:      client.GetGCTTL(),
@@ -250,6 +296,7 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 	}
 
 	req := kvproto.BackupRequest{
+		ClusterId:        client.GetClusterID(),
 		StartVersion:     cfg.LastBackupTS,
 		EndVersion:       backupTS,
 		RateLimit:        cfg.RateLimit,
@@ -259,7 +306,7 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 	}
 
 	ranges, backupSchemas, err := backup.BuildBackupRangeAndSchema(
-		mgr.GetDomain(), mgr.GetTiKV(), cfg.TableFilter, backupTS, cfg.IgnoreStats)
+		mgr.GetDomain(), mgr.GetTiKV(), cfg.TableFilter, backupTS)
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -274,6 +321,9 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 			zap.String("PD address", pdAddress))
 		return client.SaveBackupMeta(ctx, &backupMeta)
 	}
+	if cfg.Layout == backup.LayoutTable {
+		client.SetTableLayout(backupSchemas.Tables())
+	}
 
 	ddlJobs := make([]*model.Job, 0)
 	if isIncrementalBackup {
@@ -292,6 +342,16 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 		}
 	}
 
+	checkpoint := backup.NewCheckpoint(client.GetClusterID(), backupTS, cfg.LastBackupTS, ranges)
+	checkpoint.Layout = cfg.Layout
+	if previousCheckpoint != nil {
+		if err = checkpoint.Check(previousCheckpoint); err != nil {
+			return errors.Trace(err)
+		}
+		checkpoint = previousCheckpoint
+	}
+	client.SetCheckpoint(checkpoint)
+
 	// The number of regions need to backup
 	approximateRegions := 0
 	for _, r := range ranges {
@@ -310,12 +370,36 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 	updateCh := g.StartProgress(
 		ctx, cmdName, int64(approximateRegions), !cfg.LogProgress)
 
+	client.SetConcurrency(uint(cfg.Concurrency))
+	client.SetRateLimit(cfg.RateLimit)
+	defer registerTaskControls(map[string]utils.TaskControl{
+		controlRateLimit: {
+			Get: client.RateLimit,
+			Set: func(rateLimit uint64) error {
+				client.SetRateLimit(rateLimit)
+				return nil
+			},
+		},
+		controlConcurrency: positiveControl(
+			func() uint64 { return uint64(client.Concurrency()) },
+			func(concurrency uint64) { client.SetConcurrency(uint(concurrency)) },
+		),
+	}, client)()
+	stopSchedule, err := startRateLimitSchedule(ctx, &cfg.Config, nil)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer stopSchedule()
+
 	files, err := client.BackupRanges(ctx, ranges, req, uint(cfg.Concurrency), updateCh)
 	if err != nil {
 		return errors.Trace(err)
 	}
 	// Backup has finished
 	updateCh.Close()
+	if err = client.SaveTableManifests(ctx, files); err != nil {
+		return errors.Trace(err)
+	}
 
 	backupMeta, err := backup.BuildBackupMeta(&req, files, nil, ddlJobs)
 	if err != nil {
@@ -356,10 +440,30 @@ func RunBackup(c context.Context, g glue.Glue, cmdName string, cfg *BackupConfig
 		}
 	}
 
+	if !cfg.IgnoreStats && len(backupMeta.Schemas) > 0 {
+		statsConcurrency := utils.MinInt(backup.DefaultStatsConcurrency, len(backupMeta.Schemas))
+		updateCh = g.StartProgress(
+			ctx, "Backup statistics", int64(len(backupMeta.Schemas)), !cfg.LogProgress)
+		err = client.BackupStats(
+			ctx, mgr.GetDomain().StatsHandle(), backupMeta.Schemas, uint(statsConcurrency), updateCh)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		updateCh.Close()
+	}
+
+	err = client.BackupPlacementRules(ctx, cfg.PD, mgr.GetTLSConfig(), backupMeta.Schemas)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
 	err = client.SaveBackupMeta(ctx, &backupMeta)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if err = client.RemoveCheckpoint(ctx); err != nil {
+		log.Warn("failed to remove the backup checkpoint", zap.Error(err))
+	}
 
 	g.Record("Size", utils.ArchiveSize(&backupMeta))
 
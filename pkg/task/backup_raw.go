@@ -117,10 +117,11 @@ func (cfg *RawKvConfig) ParseBackupConfigFromFlags(flags *pflag.FlagSet) error {
 }
 
 // RunBackupRaw starts a backup task inside the current goroutine.
-func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConfig) error {
+func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConfig) (err error) {
 	cfg.adjust()
 
 	defer summary.Summary(cmdName)
+	defer func() { cfg.Notify.notifyTaskFinished(cmdName, err) }()
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
@@ -128,6 +129,7 @@ func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConf
 	if err != nil {
 		return errors.Trace(err)
 	}
+	collectBackupPath(u)
 	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
 	if err != nil {
 		return errors.Trace(err)
@@ -138,7 +140,11 @@ func RunBackupRaw(c context.Context, g glue.Glue, cmdName string, cfg *RawKvConf
 	if err != nil {
 		return errors.Trace(err)
 	}
-	if err = client.SetStorage(ctx, u, cfg.SendCreds); err != nil {
+	opts, err := cfg.storageOptions()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = client.SetStorage(ctx, u, opts); err != nil {
 		return errors.Trace(err)
 	}
 
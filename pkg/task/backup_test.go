@@ -1,10 +1,13 @@
 package task
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	. "github.com/pingcap/check"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
 )
 
 var _ = Suite(&testBackupSuite{})
@@ -34,3 +37,26 @@ func (s *testBackupSuite) TestParseTSString(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(int(ts), Equals, 400032515489792000-(offset*1000)<<18)
 }
+
+func (s *testBackupSuite) TestBRSideStorage(c *C) {
+	ctx := context.Background()
+	// TiKV can not access the storages, so the tasks fail before connecting
+	// to the cluster.
+	for _, tc := range []struct {
+		url    string
+		scheme string
+	}{
+		{"azure://container/backup", "azure"},
+		{"hdfs://namenode/backup", "hdfs"},
+	} {
+		backupCfg := &BackupConfig{Config: Config{Storage: tc.url}}
+		err := RunBackup(ctx, nil, "backup", backupCfg)
+		c.Assert(berrors.ErrStorageInvalidConfig.Equal(err), IsTrue)
+		c.Assert(err, ErrorMatches, ".*storage "+tc.scheme+" is not supported by TiKV yet.*only gc, list, show, verify.*")
+
+		restoreCfg := &RestoreConfig{Config: Config{Storage: tc.url}}
+		err = RunRestore(ctx, nil, "restore", restoreCfg)
+		c.Assert(berrors.ErrStorageInvalidConfig.Equal(err), IsTrue)
+		c.Assert(err, ErrorMatches, ".*storage "+tc.scheme+" is not supported by TiKV yet.*")
+	}
+}
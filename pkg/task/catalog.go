@@ -0,0 +1,149 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// The types of the backups.
+const (
+	backupTypeFull        = "full"
+	backupTypeIncremental = "incremental"
+	backupTypeRaw         = "raw"
+	backupTypeUnfinished  = "unfinished"
+)
+
+// backupSet is a backup found under a storage root.
+type backupSet struct {
+	// dir is the directory of the backup relative to the storage root,
+	// it is empty if the backup is at the storage root.
+	dir string
+	// meta is nil if the backup is not finished, i.e. there is only a lock file.
+	meta   *backup.BackupMeta
+	locked bool
+	// files are all the files of the backup, including the backupmeta.
+	files []string
+	size  int64
+}
+
+func (s *backupSet) backupType() string {
+	switch {
+	case s.meta == nil:
+		return backupTypeUnfinished
+	case s.meta.IsRawKv:
+		return backupTypeRaw
+	case s.meta.StartVersion > 0:
+		return backupTypeIncremental
+	default:
+		return backupTypeFull
+	}
+}
+
+// displayDir returns the directory of the backup for printing.
+func (s *backupSet) displayDir() string {
+	if s.dir == "" {
+		return "."
+	}
+	return s.dir
+}
+
+// discoverBackupSets walks the storage and finds the backups by the backupmeta
+// and the lock files. The files under the directory of a backup belong to the
+// backup, unless they are under the directory of another nested backup.
+func discoverBackupSets(ctx context.Context, s storage.ExternalStorage) ([]*backupSet, error) {
+	sizes, err := walkFileSizes(ctx, s)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	sets := groupBackupSets(sizes)
+
+	result := make([]*backupSet, 0, len(sets))
+	for _, set := range sets {
+		metaFile := path.Join(set.dir, utils.MetaFile)
+		if _, ok := sizes[metaFile]; ok {
+			data, err := s.Read(ctx, metaFile)
+			if err != nil {
+				return nil, errors.Annotatef(err, "failed to read %s", metaFile)
+			}
+			set.meta = &backup.BackupMeta{}
+			if err = proto.Unmarshal(data, set.meta); err != nil {
+				return nil, errors.Annotatef(err, "failed to parse %s", metaFile)
+			}
+		}
+		result = append(result, set)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].dir < result[j].dir
+	})
+	return result, nil
+}
+
+// walkFileSizes returns the sizes of all files in the storage.
+func walkFileSizes(ctx context.Context, s storage.ExternalStorage) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	err := s.WalkDir(ctx, &storage.WalkOption{}, func(name string, size int64) error {
+		sizes[name] = size
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return sizes, nil
+}
+
+// groupBackupSets groups the files into backups by the directories of the
+// backupmeta and the lock files, the backupmeta is not read.
+func groupBackupSets(sizes map[string]int64) map[string]*backupSet {
+	sets := make(map[string]*backupSet)
+	for name := range sizes {
+		base := path.Base(name)
+		if base != utils.MetaFile && base != utils.LockFile {
+			continue
+		}
+		dir := backupSetDir(name)
+		set, ok := sets[dir]
+		if !ok {
+			set = &backupSet{dir: dir}
+			sets[dir] = set
+		}
+		if base == utils.LockFile {
+			set.locked = true
+		}
+	}
+
+	for name, size := range sizes {
+		for dir := backupSetDir(name); ; dir = backupSetDir(dir) {
+			if set, ok := sets[dir]; ok {
+				set.files = append(set.files, name)
+				set.size += size
+				break
+			}
+			if dir == "" {
+				break
+			}
+		}
+	}
+	for _, set := range sets {
+		sort.Strings(set.files)
+	}
+	return sets
+}
+
+// backupSetDir returns the parent directory of the name, "" for the storage root.
+func backupSetDir(name string) string {
+	dir := path.Dir(name)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
@@ -30,6 +30,7 @@ import (
 	berrors "github.com/Orion7r/pr/pkg/errors"
 	"github.com/Orion7r/pr/pkg/glue"
 	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/summary"
 	"github.com/Orion7r/pr/pkg/utils"
 )
 
@@ -53,6 +54,7 @@ const (
 	flagChecksumConcurrency = "checksum-concurrency"
 	flagRateLimit           = "ratelimit"
 	flagRateLimitUnit       = "ratelimit-unit"
+	flagRateLimitSchedule   = "ratelimit-schedule"
 	flagConcurrency         = "concurrency"
 	flagChecksum            = "checksum"
 	flagFilter              = "filter"
@@ -64,6 +66,8 @@ const (
 	flagGrpcKeepaliveTime = "grpc-keepalive-time"
 	// flagGrpcKeepaliveTimeout is the max time a grpc conn can keep idel before killed.
 	flagGrpcKeepaliveTimeout = "grpc-keepalive-timeout"
+	// flagDryRun is the name of the dry run flag of gc and restore.
+	flagDryRun = "dry-run"
 
 	defaultSwitchInterval       = 5 * time.Minute
 	defaultGRPCKeepaliveTime    = 10 * time.Second
@@ -104,6 +108,7 @@ type Config struct {
 	PD                  []string  `json:"pd" toml:"pd"`
 	TLS                 TLSConfig `json:"tls" toml:"tls"`
 	RateLimit           uint64    `json:"rate-limit" toml:"rate-limit"`
+	RateLimitSchedule   string    `json:"ratelimit-schedule" toml:"ratelimit-schedule"`
 	ChecksumConcurrency uint      `json:"checksum-concurrency" toml:"checksum-concurrency"`
 	Concurrency         uint32    `json:"concurrency" toml:"concurrency"`
 	Checksum            bool      `json:"checksum" toml:"checksum"`
@@ -130,12 +135,19 @@ type Config struct {
 	GRPCKeepaliveTime time.Duration `json:"grpc-keepalive-time" toml:"grpc-keepalive-time"`
 	// GrpcKeepaliveTimeout is the max time a grpc conn can keep idel before killed.
 	GRPCKeepaliveTimeout time.Duration `json:"grpc-keepalive-timeout" toml:"grpc-keepalive-timeout"`
+
+	// Encryption is the client-side encryption of the files written by BR.
+	Encryption storage.EncryptionOptions `json:"encryption" toml:"encryption"`
+
+	// Notify is the notifications sent when the task finishes.
+	Notify NotifyConfig `json:"notify" toml:"notify"`
 }
 
 // DefineCommonFlags defines the flags common to all BRIE commands.
 func DefineCommonFlags(flags *pflag.FlagSet) {
 	flags.BoolP(flagSendCreds, "c", true, "Whether send credentials to tikv")
-	flags.StringP(flagStorage, "s", "", `specify the url where backup storage, eg, "s3://bucket/path/prefix"`)
+	flags.StringP(flagStorage, "s", "", `specify the url where backup storage, eg, "s3://bucket/path/prefix", `+
+		`the "azure://" and "hdfs://" storages are only supported by gc, list, show, verify, restore cdclog and debug`)
 	flags.StringSliceP(flagPD, "u", []string{"127.0.0.1:2379"}, "PD address")
 	flags.String(flagCA, "", "CA certificate path for TLS connection")
 	flags.String(flagCert, "", "Certificate path for TLS connection")
@@ -144,6 +156,10 @@ func DefineCommonFlags(flags *pflag.FlagSet) {
 	_ = flags.MarkHidden(flagChecksumConcurrency)
 
 	flags.Uint64(flagRateLimit, 0, "The rate limit of the task, MB/s per node")
+	flags.String(flagRateLimitSchedule, "",
+		"The rate limit of the task in the time windows of every day, the rate limit is --ratelimit out of the windows, "+
+			`e.g. "08:00-20:00=20MB,20:00-08:00=0". `+
+			`Use "=pause" to pause the task or add "/normal" to keep TiKV in normal mode in a window`)
 	flags.Bool(flagChecksum, true, "Run checksum at end of task")
 	flags.Bool(flagRemoveTiFlash, true,
 		"Remove TiFlash replicas before backup or restore, for unsupported versions of TiFlash")
@@ -170,6 +186,8 @@ func DefineCommonFlags(flags *pflag.FlagSet) {
 	_ = flags.MarkHidden(flagGrpcKeepaliveTimeout)
 
 	storage.DefineFlags(flags)
+	storage.DefineEncryptionFlags(flags)
+	defineNotifyFlags(flags)
 }
 
 // DefineDatabaseFlags defines the required --db flag for `db` subcommand.
@@ -255,6 +273,15 @@ func (cfg *Config) ParseFromFlags(flags *pflag.FlagSet) error {
 		return errors.Trace(err)
 	}
 	cfg.RateLimit = rateLimit * rateLimitUnit
+	cfg.RateLimitSchedule, err = flags.GetString(flagRateLimitSchedule)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.RateLimitSchedule != "" {
+		if _, err = utils.ParseRateLimitSchedule(cfg.RateLimitSchedule); err != nil {
+			return errors.Trace(err)
+		}
+	}
 
 	var caseSensitive bool
 	if filterFlag := flags.Lookup(flagFilter); filterFlag != nil {
@@ -316,9 +343,15 @@ func (cfg *Config) ParseFromFlags(flags *pflag.FlagSet) error {
 	if err = cfg.BackendOptions.ParseFromFlags(flags); err != nil {
 		return errors.Trace(err)
 	}
+	if err = cfg.Encryption.ParseFromFlags(flags); err != nil {
+		return errors.Trace(err)
+	}
 	if err = cfg.TLS.ParseFromFlags(flags); err != nil {
 		return errors.Trace(err)
 	}
+	if err = cfg.Notify.ParseFromFlags(flags); err != nil {
+		return errors.Trace(err)
+	}
 	cfg.PD, err = flags.GetStringSlice(flagPD)
 	if err != nil {
 		return errors.Trace(err)
@@ -377,13 +410,44 @@ func GetStorage(
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
-	s, err := storage.Create(ctx, u, cfg.SendCreds)
+	opts, err := cfg.storageOptions()
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	s, err := storage.New(ctx, u, opts)
 	if err != nil {
 		return nil, nil, errors.Annotate(err, "create storage failed")
 	}
 	return u, s, nil
 }
 
+// GetExternalStorage gets the storage from the config for the tasks which only
+// access the storage on the BR side. Unlike GetStorage, it also accepts the
+// storages which TiKV can not access, e.g. Azure Blob Storage and HDFS.
+func GetExternalStorage(ctx context.Context, cfg *Config) (storage.ExternalStorage, error) {
+	opts, err := cfg.storageOptions()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s, err := storage.NewFromURL(ctx, cfg.Storage, &cfg.BackendOptions, opts)
+	if err != nil {
+		return nil, errors.Annotate(err, "create storage failed")
+	}
+	return s, nil
+}
+
+// storageOptions returns the options of the storage accessed on the BR side.
+func (cfg *Config) storageOptions() (*storage.ExternalStorageOptions, error) {
+	encryption, err := cfg.Encryption.Config()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &storage.ExternalStorageOptions{
+		SendCredentials: cfg.SendCreds,
+		Encryption:      encryption,
+	}, nil
+}
+
 // ReadBackupMeta reads the backupmeta file from the storage.
 func ReadBackupMeta(
 	ctx context.Context,
@@ -402,7 +466,12 @@ func ReadBackupMeta(
 			newPrefix, file := path.Split(oldPrefix)
 			newFileName := file + fileName
 			u.GetGcs().Prefix = newPrefix
-			s, err = storage.Create(ctx, u, cfg.SendCreds)
+			var opts *storage.ExternalStorageOptions
+			opts, err = cfg.storageOptions()
+			if err != nil {
+				return nil, nil, nil, errors.Trace(err)
+			}
+			s, err = storage.New(ctx, u, opts)
 			if err != nil {
 				return nil, nil, nil, errors.Trace(err)
 			}
@@ -424,6 +493,40 @@ func ReadBackupMeta(
 	return u, s, backupMeta, nil
 }
 
+// ReadExternalBackupMeta reads the backupmeta file from the storage for the
+// tasks which only access the storage on the BR side, see GetExternalStorage.
+func ReadExternalBackupMeta(
+	ctx context.Context,
+	fileName string,
+	cfg *Config,
+) (storage.ExternalStorage, *backup.BackupMeta, error) {
+	s, err := GetExternalStorage(ctx, cfg)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	metaData, err := s.Read(ctx, fileName)
+	if err != nil {
+		if gcsObjectNotFound(err) {
+			// the backupmeta may be prefixed by the last part of the gcs path.
+			_, s, backupMeta, err := ReadBackupMeta(ctx, fileName, cfg)
+			return s, backupMeta, errors.Trace(err)
+		}
+		return nil, nil, errors.Annotate(err, "load backupmeta failed")
+	}
+	backupMeta := &backup.BackupMeta{}
+	if err = proto.Unmarshal(metaData, backupMeta); err != nil {
+		return nil, nil, errors.Annotate(err, "parse backupmeta failed")
+	}
+	return s, backupMeta, nil
+}
+
+// collectBackupPath collects the path of the backup to the summary, the
+// options of the backend are dropped so the secret keys are not exposed.
+func collectBackupPath(backend *backup.StorageBackend) {
+	backendURL := storage.FormatBackendURL(backend)
+	summary.CollectString("backup path", backendURL.String())
+}
+
 // flagToZapField checks whether this flag can be logged,
 // if need to log, return its zap field. Or return a field with hidden value.
 func flagToZapField(f *pflag.Flag) zap.Field {
@@ -436,6 +539,9 @@ func flagToZapField(f *pflag.Flag) zap.Field {
 		hiddenQuery.RawQuery = ""
 		return zap.Stringer(f.Name, hiddenQuery)
 	}
+	if f.Name == flagNotifyWebhookSecret {
+		return zap.String(f.Name, "<redacted>")
+	}
 	return zap.Stringer(f.Name, f.Value)
 }
 
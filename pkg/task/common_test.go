@@ -3,12 +3,21 @@
 package task
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 
+	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/kvproto/pkg/backup"
 	"github.com/pingcap/tidb/config"
 
 	. "github.com/pingcap/check"
 	"github.com/spf13/pflag"
+
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/utils"
 )
 
 var _ = Suite(&testCommonSuite{})
@@ -63,3 +72,38 @@ func (s *testCommonSuite) TestStripingPDURL(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(noChange, Equals, "127.0.0.1:2379")
 }
+
+func (s *testCommonSuite) TestReadExternalBackupMeta(c *C) {
+	ctx := context.Background()
+	data, err := proto.Marshal(&backup.BackupMeta{EndVersion: 42})
+	c.Assert(err, IsNil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodGet && strings.HasSuffix(req.URL.Path, "/"+utils.MetaFile) {
+			_, _ = w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	cfgs := []*Config{
+		{
+			Storage: "azure://container/backup",
+			BackendOptions: storage.BackendOptions{
+				Azure: storage.AzureBackendOptions{Endpoint: server.URL + "/account"},
+			},
+		},
+		{
+			Storage: "hdfs://namenode/backup",
+			BackendOptions: storage.BackendOptions{
+				HDFS: storage.HDFSBackendOptions{Endpoint: server.URL},
+			},
+		},
+	}
+	for _, cfg := range cfgs {
+		// the storages can not be accessed by TiKV.
+		_, _, err = GetStorage(ctx, cfg)
+		c.Assert(err, ErrorMatches, ".*not supported by TiKV yet.*")
+		_, meta, err := ReadExternalBackupMeta(ctx, utils.MetaFile, cfg)
+		c.Assert(err, IsNil, Commentf("storage %s", cfg.Storage))
+		c.Assert(meta.EndVersion, Equals, uint64(42))
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"github.com/pingcap/errors"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// The names of the controls of the running task, see utils.TaskControl.
+const (
+	// controlRateLimit is the rate limit in bytes per second of every TiKV.
+	controlRateLimit = "rate-limit"
+	// controlConcurrency is the number of the ranges backed up concurrently,
+	// or the number of the files restored concurrently.
+	controlConcurrency = "concurrency"
+	// controlBatchSize is the number of the ranges restored in a batch.
+	controlBatchSize = "batch-size"
+	// controlChecksumConcurrency is the concurrency of the checksum of every
+	// restored table.
+	controlChecksumConcurrency = "checksum-concurrency"
+)
+
+// registerTaskControls registers the controls and the pausers of the running
+// task for the HTTP API of the status server. It returns a function to
+// unregister them, which should be called when the task is finished.
+func registerTaskControls(controls map[string]utils.TaskControl, pausers ...utils.Pauser) func() {
+	unregisters := make([]func(), 0, len(controls)+len(pausers))
+	for name, control := range controls {
+		unregisters = append(unregisters, utils.RegisterTaskControl(name, control))
+	}
+	for _, pauser := range pausers {
+		unregisters = append(unregisters, utils.RegisterTaskPauser(pauser))
+	}
+	return func() {
+		for _, unregister := range unregisters {
+			unregister()
+		}
+	}
+}
+
+// positiveControl returns a control which rejects zero, which would stall the
+// task.
+func positiveControl(get func() uint64, set func(uint64)) utils.TaskControl {
+	return utils.TaskControl{
+		Get: get,
+		Set: func(value uint64) error {
+			if value == 0 {
+				return errors.Annotate(berrors.ErrInvalidArgument, "the value must be positive")
+			}
+			set(value)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/summary"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+const (
+	flagKeepLast   = "keep-last"
+	flagKeepWithin = "keep-within"
+)
+
+// GCConfig is the configuration specific for the gc task.
+type GCConfig struct {
+	Config
+
+	KeepLast   int           `json:"keep-last" toml:"keep-last"`
+	KeepWithin time.Duration `json:"keep-within" toml:"keep-within"`
+	DryRun     bool          `json:"dry-run" toml:"dry-run"`
+}
+
+// DefineGCFlags defines flags for the gc command.
+func DefineGCFlags(flags *pflag.FlagSet) {
+	flags.Int(flagKeepLast, 0, "keep the last N backups ordered by the backup ts")
+	flags.Duration(flagKeepWithin, 0, "keep the backups whose backup ts is within the duration, e.g. 168h")
+	flags.Bool(flagDryRun, false, "only report the backups to delete, do not delete them")
+}
+
+// ParseFromFlags parses the gc related flags from the flag set.
+func (cfg *GCConfig) ParseFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.KeepLast, err = flags.GetInt(flagKeepLast)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.KeepWithin, err = flags.GetDuration(flagKeepWithin)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.DryRun, err = flags.GetBool(flagDryRun)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.KeepLast < 0 || cfg.KeepWithin < 0 {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s and --%s should not be negative", flagKeepLast, flagKeepWithin)
+	}
+	// It is too dangerous to delete all backups by mistake.
+	if cfg.KeepLast == 0 && cfg.KeepWithin == 0 {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"at least one of --%s and --%s is required", flagKeepLast, flagKeepWithin)
+	}
+	return cfg.Config.ParseFromFlags(flags)
+}
+
+// gcItem is the decision made for a backup by the gc task.
+type gcItem struct {
+	set    *backupSet
+	delete bool
+	reason string
+}
+
+// planGC decides which backups to delete by the retention policy. A backup is
+// kept if it is one of the last keepLast backups or its backup ts is within
+// keepWithin, and the backups which a kept incremental backup depends on are
+// kept too, so the chain of the incremental backups is never broken.
+// The backups to delete are put first and ordered from the newest to the oldest,
+// so that the incremental backups are deleted before the backups they depend on.
+func planGC(sets []*backupSet, keepLast int, keepWithin time.Duration, now time.Time) []*gcItem {
+	items := make([]*gcItem, 0, len(sets))
+	backups := make([]*gcItem, 0, len(sets))
+	for _, set := range sets {
+		item := &gcItem{set: set}
+		items = append(items, item)
+		switch set.backupType() {
+		case backupTypeUnfinished:
+			item.reason = "the backup is not finished"
+		case backupTypeRaw:
+			item.reason = "the raw kv backup has no backup ts"
+		default:
+			backups = append(backups, item)
+		}
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].set.meta.EndVersion > backups[j].set.meta.EndVersion
+	})
+
+	kept := make([]*gcItem, 0, len(backups))
+	for i, item := range backups {
+		backupTime := oracle.GetTimeFromTS(item.set.meta.EndVersion)
+		switch {
+		case i < keepLast:
+			item.reason = fmt.Sprintf("one of the last %d backups", keepLast)
+		case keepWithin > 0 && now.Sub(backupTime) <= keepWithin:
+			item.reason = fmt.Sprintf("backed up within %s", keepWithin)
+		default:
+			item.delete = true
+			continue
+		}
+		kept = append(kept, item)
+	}
+
+	// keep the backups which the kept incremental backups depend on.
+	for len(kept) > 0 {
+		item := kept[len(kept)-1]
+		kept = kept[:len(kept)-1]
+		if item.set.backupType() != backupTypeIncremental {
+			continue
+		}
+		meta := item.set.meta
+		found := false
+		for _, base := range backups {
+			if base.set.meta.EndVersion != meta.StartVersion || base.set.meta.ClusterId != meta.ClusterId {
+				continue
+			}
+			found = true
+			if base.delete {
+				base.delete = false
+				base.reason = fmt.Sprintf("required by the incremental backup %s", item.set.displayDir())
+				kept = append(kept, base)
+			}
+		}
+		if !found {
+			log.Warn("the backup which the incremental backup depends on is not found",
+				zap.String("backup", item.set.displayDir()),
+				zap.Uint64("lastBackupTS", meta.StartVersion))
+		}
+	}
+
+	result := make([]*gcItem, 0, len(items))
+	for _, item := range backups {
+		if item.delete {
+			item.reason = "out of the retention policy"
+			result = append(result, item)
+		}
+	}
+	for _, item := range items {
+		if !item.delete {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// RunGC deletes the backups out of the retention policy under the storage,
+// and writes the report to out.
+func RunGC(c context.Context, cmdName string, cfg *GCConfig, out io.Writer) error {
+	defer summary.Summary(cmdName)
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	s, err := GetExternalStorage(ctx, &cfg.Config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	sets, err := discoverBackupSets(ctx, s)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	items := planGC(sets, cfg.KeepLast, cfg.KeepWithin, time.Now())
+	if err = writeGCReport(out, items, cfg.DryRun); err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.DryRun {
+		summary.SetSuccessStatus(true)
+		return nil
+	}
+
+	start := time.Now()
+	deleted := 0
+	var deletedSize int64
+	for _, item := range items {
+		if !item.delete {
+			continue
+		}
+		if err = deleteBackupSet(ctx, s, item.set); err != nil {
+			return errors.Annotatef(err, "failed to delete backup %s", item.set.displayDir())
+		}
+		log.Info("backup deleted", zap.String("backup", item.set.displayDir()),
+			zap.Int("files", len(item.set.files)), zap.Int64("size", item.set.size))
+		deleted++
+		deletedSize += item.set.size
+	}
+	summary.CollectSuccessUnit("deleted backups", deleted, time.Since(start))
+	summary.CollectInt("deleted bytes", int(deletedSize))
+	summary.SetSuccessStatus(true)
+	return nil
+}
+
+// deleteBackupSet deletes all files of the backup, the backupmeta is deleted
+// at last so that a partially deleted backup can be found and deleted again.
+func deleteBackupSet(ctx context.Context, s storage.ExternalStorage, set *backupSet) error {
+	metaFile := path.Join(set.dir, utils.MetaFile)
+	files := make([]string, 0, len(set.files))
+	for _, name := range set.files {
+		if name != metaFile {
+			files = append(files, name)
+		}
+	}
+	if err := s.DeleteFiles(ctx, files); err != nil {
+		return errors.Trace(err)
+	}
+	return s.DeleteFile(ctx, metaFile)
+}
+
+func writeGCReport(out io.Writer, items []*gcItem, dryRun bool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tPATH\tTYPE\tBACKUP TIME\tSIZE(BYTES)\tREASON")
+	for _, item := range items {
+		action := "keep"
+		if item.delete {
+			action = "delete"
+			if dryRun {
+				action = "would delete"
+			}
+		}
+		backupTime := "-"
+		if meta := item.set.meta; meta != nil {
+			backupTime = orDash(formatTS(meta.EndVersion))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", action, item.set.displayDir(), item.set.backupType(),
+			backupTime, item.set.size, item.reason)
+	}
+	return errors.Trace(w.Flush())
+}
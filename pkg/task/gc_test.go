@@ -0,0 +1,133 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+
+	"github.com/Orion7r/pr/pkg/storage"
+)
+
+var _ = Suite(&testGCSuite{})
+
+type testGCSuite struct{}
+
+func (s *testGCSuite) TestDiscoverBackupSets(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	local, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+
+	meta, err := proto.Marshal(&backup.BackupMeta{ClusterId: 1, EndVersion: 100})
+	c.Assert(err, IsNil)
+	files := map[string][]byte{
+		"full/backupmeta":       meta,
+		"full/backup.lock":      []byte("lock"),
+		"full/1.sst":            []byte("12345"),
+		"full/inc/backupmeta":   meta,
+		"full/inc/2.sst":        []byte("12"),
+		"running/backup.lock":   []byte("lock"),
+		"running/3.sst":         []byte("123"),
+		"not-a-backup/file.txt": []byte("1"),
+	}
+	for name, data := range files {
+		c.Assert(os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0o755), IsNil)
+		c.Assert(local.Write(ctx, name, data), IsNil)
+	}
+
+	sets, err := discoverBackupSets(ctx, local)
+	c.Assert(err, IsNil)
+	c.Assert(sets, HasLen, 3)
+
+	c.Assert(sets[0].dir, Equals, "full")
+	c.Assert(sets[0].backupType(), Equals, backupTypeFull)
+	c.Assert(sets[0].locked, IsTrue)
+	c.Assert(sets[0].meta.EndVersion, Equals, uint64(100))
+	c.Assert(sets[0].files, DeepEquals, []string{"full/1.sst", "full/backup.lock", "full/backupmeta"})
+	c.Assert(sets[0].size, Equals, int64(len(meta)+9))
+
+	c.Assert(sets[1].dir, Equals, "full/inc")
+	c.Assert(sets[1].locked, IsFalse)
+	c.Assert(sets[1].files, DeepEquals, []string{"full/inc/2.sst", "full/inc/backupmeta"})
+
+	c.Assert(sets[2].dir, Equals, "running")
+	c.Assert(sets[2].backupType(), Equals, backupTypeUnfinished)
+	c.Assert(sets[2].files, DeepEquals, []string{"running/3.sst", "running/backup.lock"})
+
+	c.Assert(deleteBackupSet(ctx, local, sets[0]), IsNil)
+	sets, err = discoverBackupSets(ctx, local)
+	c.Assert(err, IsNil)
+	c.Assert(sets, HasLen, 2)
+	c.Assert(sets[0].dir, Equals, "full/inc")
+}
+
+func (s *testGCSuite) TestPlanGC(c *C) {
+	now := time.Now()
+	ts := func(daysAgo int) uint64 {
+		return oracle.ComposeTS(oracle.GetPhysical(now.Add(-time.Duration(daysAgo)*24*time.Hour)), 0)
+	}
+	newSet := func(dir string, startVersion, endVersion uint64) *backupSet {
+		return &backupSet{dir: dir, meta: &backup.BackupMeta{
+			ClusterId:    1,
+			StartVersion: startVersion,
+			EndVersion:   endVersion,
+		}}
+	}
+	sets := []*backupSet{
+		newSet("full-1", 0, ts(30)),
+		newSet("inc-1-1", ts(30), ts(29)),
+		newSet("full-2", 0, ts(20)),
+		newSet("inc-2-1", ts(20), ts(19)),
+		newSet("inc-2-2", ts(19), ts(2)),
+		newSet("full-3", 0, ts(1)),
+		{dir: "raw", meta: &backup.BackupMeta{IsRawKv: true}},
+		{dir: "running", locked: true},
+	}
+
+	action := func(items []*gcItem) map[string]bool {
+		deleted := make(map[string]bool)
+		for _, item := range items {
+			deleted[item.set.dir] = item.delete
+		}
+		return deleted
+	}
+
+	// inc-2-2 is kept, so the whole chain of full-2 is kept.
+	items := planGC(sets, 0, 7*24*time.Hour, now)
+	c.Assert(action(items), DeepEquals, map[string]bool{
+		"full-1": true, "inc-1-1": true, "full-2": false, "inc-2-1": false,
+		"inc-2-2": false, "full-3": false, "raw": false, "running": false,
+	})
+	// the newest backup is deleted first.
+	c.Assert(items[0].set.dir, Equals, "inc-1-1")
+	c.Assert(items[1].set.dir, Equals, "full-1")
+	for _, item := range items[2:] {
+		c.Assert(item.delete, IsFalse)
+	}
+
+	items = planGC(sets, 1, 0, now)
+	c.Assert(action(items), DeepEquals, map[string]bool{
+		"full-1": true, "inc-1-1": true, "full-2": true, "inc-2-1": true,
+		"inc-2-2": true, "full-3": false, "raw": false, "running": false,
+	})
+
+	items = planGC(sets, 2, 0, now)
+	c.Assert(action(items), DeepEquals, map[string]bool{
+		"full-1": true, "inc-1-1": true, "full-2": false, "inc-2-1": false,
+		"inc-2-2": false, "full-3": false, "raw": false, "running": false,
+	})
+
+	// the incremental backup of another cluster does not keep the base backup.
+	sets[4].meta.ClusterId = 2
+	items = planGC(sets, 2, 0, now)
+	c.Assert(action(items)["inc-2-1"], IsTrue)
+	c.Assert(action(items)["full-2"], IsTrue)
+}
@@ -0,0 +1,256 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/spf13/pflag"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+const (
+	flagFormat = "format"
+
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// CatalogConfig is the configuration specific for the list and show tasks.
+type CatalogConfig struct {
+	Config
+
+	Format string `json:"format" toml:"format"`
+}
+
+// DefineCatalogFlags defines flags for the list and show commands.
+func DefineCatalogFlags(flags *pflag.FlagSet) {
+	flags.String(flagFormat, formatTable, "the output format, 'table' or 'json'")
+}
+
+// ParseFromFlags parses the list and show related flags from the flag set.
+func (cfg *CatalogConfig) ParseFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.Format, err = flags.GetString(flagFormat)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.Format != formatTable && cfg.Format != formatJSON {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s should be '%s' or '%s', but got '%s'", flagFormat, formatTable, formatJSON, cfg.Format)
+	}
+	return cfg.Config.ParseFromFlags(flags)
+}
+
+// BackupSummary is the summary of a backup.
+type BackupSummary struct {
+	Path         string `json:"path"`
+	Type         string `json:"type"`
+	StartVersion uint64 `json:"start-version"`
+	StartTime    string `json:"start-time,omitempty"`
+	EndVersion   uint64 `json:"end-version"`
+	EndTime      string `json:"end-time,omitempty"`
+	ClusterID    uint64 `json:"cluster-id"`
+	BRVersion    string `json:"br-version"`
+	Size         uint64 `json:"size"`
+	Tables       int    `json:"tables"`
+	Locked       bool   `json:"locked"`
+}
+
+func newBackupSummary(set *backupSet) *BackupSummary {
+	summary := &BackupSummary{
+		Path:   set.displayDir(),
+		Type:   set.backupType(),
+		Size:   uint64(set.size),
+		Locked: set.locked,
+	}
+	meta := set.meta
+	if meta == nil {
+		return summary
+	}
+	summary.StartVersion = meta.StartVersion
+	summary.StartTime = formatTS(meta.StartVersion)
+	summary.EndVersion = meta.EndVersion
+	summary.EndTime = formatTS(meta.EndVersion)
+	summary.ClusterID = meta.ClusterId
+	summary.BRVersion = meta.BrVersion
+	summary.Size = utils.ArchiveSize(meta)
+	for _, schema := range meta.Schemas {
+		// the empty databases are recorded without table.
+		if len(schema.Table) > 0 {
+			summary.Tables++
+		}
+	}
+	return summary
+}
+
+// formatTS formats the physical time of the ts, or returns "" for a zero ts.
+func formatTS(ts uint64) string {
+	if ts == 0 {
+		return ""
+	}
+	return oracle.GetTimeFromTS(ts).Format(time.RFC3339)
+}
+
+// RunList lists the backups under the storage, and writes them to out.
+func RunList(c context.Context, cfg *CatalogConfig, out io.Writer) error {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	s, err := GetExternalStorage(ctx, &cfg.Config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	sets, err := discoverBackupSets(ctx, s)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	summaries := make([]*BackupSummary, 0, len(sets))
+	for _, set := range sets {
+		summaries = append(summaries, newBackupSummary(set))
+	}
+
+	if cfg.Format == formatJSON {
+		return writeJSON(out, summaries)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PATH\tTYPE\tSTART TS\tSTART TIME\tEND TS\tEND TIME\tCLUSTER ID\tBR VERSION\tSIZE(BYTES)\tTABLES\tLOCKED")
+	for _, sum := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%s\t%d\t%s\t%d\t%d\t%t\n",
+			sum.Path, sum.Type, sum.StartVersion, orDash(sum.StartTime), sum.EndVersion, orDash(sum.EndTime),
+			sum.ClusterID, orDash(sum.BRVersion), sum.Size, sum.Tables, sum.Locked)
+	}
+	return errors.Trace(w.Flush())
+}
+
+// TableDetail is the detail of a table in a backup.
+type TableDetail struct {
+	Name       string `json:"name"`
+	Files      int    `json:"files"`
+	TotalKvs   uint64 `json:"total-kvs"`
+	TotalBytes uint64 `json:"total-bytes"`
+	Crc64Xor   uint64 `json:"crc64xor"`
+}
+
+// DatabaseDetail is the detail of a database in a backup.
+type DatabaseDetail struct {
+	Name       string         `json:"name"`
+	Files      int            `json:"files"`
+	TotalKvs   uint64         `json:"total-kvs"`
+	TotalBytes uint64         `json:"total-bytes"`
+	Tables     []*TableDetail `json:"tables"`
+}
+
+// BackupDetail is the detail of a backup.
+type BackupDetail struct {
+	*BackupSummary
+	Databases []*DatabaseDetail `json:"databases"`
+}
+
+func newBackupDetail(meta *backup.BackupMeta) (*BackupDetail, error) {
+	dbs, err := utils.LoadBackupTables(meta)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	detail := &BackupDetail{
+		BackupSummary: newBackupSummary(&backupSet{meta: meta}),
+		Databases:     make([]*DatabaseDetail, 0, len(dbs)),
+	}
+	for _, db := range dbs {
+		dbDetail := &DatabaseDetail{
+			Name:   db.Info.Name.O,
+			Tables: make([]*TableDetail, 0, len(db.Tables)),
+		}
+		for _, table := range db.Tables {
+			dbDetail.Tables = append(dbDetail.Tables, &TableDetail{
+				Name:       table.Info.Name.O,
+				Files:      len(table.Files),
+				TotalKvs:   table.TotalKvs,
+				TotalBytes: table.TotalBytes,
+				Crc64Xor:   table.Crc64Xor,
+			})
+			dbDetail.Files += len(table.Files)
+			dbDetail.TotalKvs += table.TotalKvs
+			dbDetail.TotalBytes += table.TotalBytes
+		}
+		sort.Slice(dbDetail.Tables, func(i, j int) bool {
+			return dbDetail.Tables[i].Name < dbDetail.Tables[j].Name
+		})
+		detail.Databases = append(detail.Databases, dbDetail)
+	}
+	sort.Slice(detail.Databases, func(i, j int) bool {
+		return detail.Databases[i].Name < detail.Databases[j].Name
+	})
+	return detail, nil
+}
+
+// RunShow shows the databases and tables of the backup, and writes them to out.
+func RunShow(c context.Context, cfg *CatalogConfig, out io.Writer) error {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	s, meta, err := ReadExternalBackupMeta(ctx, utils.MetaFile, &cfg.Config)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	detail, err := newBackupDetail(meta)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	detail.Path = s.URI()
+	detail.Locked, err = s.FileExists(ctx, utils.LockFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if cfg.Format == formatJSON {
+		return writeJSON(out, detail)
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Path:\t%s\n", detail.Path)
+	fmt.Fprintf(w, "Type:\t%s\n", detail.Type)
+	fmt.Fprintf(w, "Start TS:\t%d %s\n", detail.StartVersion, detail.StartTime)
+	fmt.Fprintf(w, "End TS:\t%d %s\n", detail.EndVersion, detail.EndTime)
+	fmt.Fprintf(w, "Cluster ID:\t%d\n", detail.ClusterID)
+	fmt.Fprintf(w, "BR Version:\t%s\n", orDash(detail.BRVersion))
+	fmt.Fprintf(w, "Size(Bytes):\t%d\n", detail.Size)
+	fmt.Fprintf(w, "Locked:\t%t\n", detail.Locked)
+	if err = w.Flush(); err != nil {
+		return errors.Trace(err)
+	}
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tTABLE\tFILES\tTOTAL KVS\tTOTAL BYTES\tCRC64XOR")
+	for _, db := range detail.Databases {
+		for _, table := range db.Tables {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\n",
+				db.Name, table.Name, table.Files, table.TotalKvs, table.TotalBytes, table.Crc64Xor)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", db.Name, "(total)", db.Files, db.TotalKvs, db.TotalBytes, "-")
+	}
+	return errors.Trace(w.Flush())
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return errors.Trace(encoder.Encode(v))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
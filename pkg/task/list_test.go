@@ -0,0 +1,70 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"encoding/json"
+
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/tidb/tablecodec"
+)
+
+var _ = Suite(&testListSuite{})
+
+type testListSuite struct{}
+
+func mockBackupSchema(c *C, dbName, tableName string, tableID int64, kvs uint64) *backup.Schema {
+	db, err := json.Marshal(&model.DBInfo{Name: model.NewCIStr(dbName)})
+	c.Assert(err, IsNil)
+	table, err := json.Marshal(&model.TableInfo{ID: tableID, Name: model.NewCIStr(tableName)})
+	c.Assert(err, IsNil)
+	return &backup.Schema{Db: db, Table: table, TotalKvs: kvs, TotalBytes: 10 * kvs, Crc64Xor: kvs}
+}
+
+func (s *testListSuite) TestBackupDetail(c *C) {
+	meta := &backup.BackupMeta{
+		ClusterId:    1,
+		StartVersion: 0,
+		EndVersion:   423456789012345678,
+		Schemas: []*backup.Schema{
+			mockBackupSchema(c, "test", "t2", 2, 20),
+			mockBackupSchema(c, "test", "t1", 1, 10),
+			mockBackupSchema(c, "another", "t3", 3, 30),
+		},
+		Files: []*backup.File{
+			{Name: "1.sst", StartKey: tablecodec.EncodeTablePrefix(1), EndKey: tablecodec.EncodeTablePrefix(2), Size_: 100},
+			{Name: "2.sst", StartKey: tablecodec.EncodeTablePrefix(2), EndKey: tablecodec.EncodeTablePrefix(3), Size_: 200},
+			{Name: "3.sst", StartKey: tablecodec.EncodeTablePrefix(2), EndKey: tablecodec.EncodeTablePrefix(3), Size_: 300},
+		},
+	}
+	summary := newBackupSummary(&backupSet{dir: "full", meta: meta, locked: true})
+	c.Assert(summary.Path, Equals, "full")
+	c.Assert(summary.Type, Equals, backupTypeFull)
+	c.Assert(summary.StartTime, Equals, "")
+	c.Assert(summary.EndTime, Not(Equals), "")
+	c.Assert(summary.ClusterID, Equals, uint64(1))
+	c.Assert(summary.Tables, Equals, 3)
+	c.Assert(summary.Size > 600, IsTrue)
+	c.Assert(summary.Locked, IsTrue)
+
+	detail, err := newBackupDetail(meta)
+	c.Assert(err, IsNil)
+	c.Assert(detail.Databases, HasLen, 2)
+	c.Assert(detail.Databases[0].Name, Equals, "another")
+	c.Assert(detail.Databases[0].Files, Equals, 0)
+	test := detail.Databases[1]
+	c.Assert(test.Name, Equals, "test")
+	c.Assert(test.Files, Equals, 3)
+	c.Assert(test.TotalKvs, Equals, uint64(30))
+	c.Assert(test.TotalBytes, Equals, uint64(300))
+	c.Assert(test.Tables, DeepEquals, []*TableDetail{
+		{Name: "t1", Files: 1, TotalKvs: 10, TotalBytes: 100, Crc64Xor: 10},
+		{Name: "t2", Files: 2, TotalKvs: 20, TotalBytes: 200, Crc64Xor: 20},
+	})
+
+	data, err := json.Marshal(detail)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Matches, `\{"path":"\.","type":"full",.*"databases":\[\{"name":"another".*`)
+}
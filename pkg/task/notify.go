@@ -0,0 +1,206 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/summary"
+)
+
+const (
+	flagNotifyWebhook       = "notify-webhook"
+	flagNotifyWebhookSecret = "notify-webhook-secret"
+	flagOnSuccessCmd        = "on-success-cmd"
+	flagOnFailureCmd        = "on-failure-cmd"
+
+	// notifyTimeout is the timeout of sending the webhook or running a hook
+	// command.
+	notifyTimeout = time.Minute
+	// notifySignatureHeader is the header of the HMAC-SHA256 signature of the
+	// webhook payload.
+	notifySignatureHeader = "X-BR-Signature"
+)
+
+// NotifyConfig is the configuration of the notifications sent when a task
+// finishes.
+type NotifyConfig struct {
+	Webhook string `json:"notify-webhook" toml:"notify-webhook"`
+	// WebhookSecret is the key to sign the webhook payload, the payload is not
+	// signed if it is empty.
+	WebhookSecret string `json:"-" toml:"notify-webhook-secret"`
+	OnSuccessCmd  string `json:"on-success-cmd" toml:"on-success-cmd"`
+	OnFailureCmd  string `json:"on-failure-cmd" toml:"on-failure-cmd"`
+}
+
+// defineNotifyFlags defines the flags of the notifications.
+func defineNotifyFlags(flags *pflag.FlagSet) {
+	flags.String(flagNotifyWebhook, "",
+		"the url to post the summary of the task to in JSON when the task finishes")
+	flags.String(flagNotifyWebhookSecret, "",
+		"the key to sign the payload of --"+flagNotifyWebhook+" with HMAC-SHA256, "+
+			"the signature is sent in the "+notifySignatureHeader+" header as 'sha256=<hex>'")
+	flags.String(flagOnSuccessCmd, "",
+		"the shell command to run when the task succeeds, the summary is passed in JSON by stdin")
+	flags.String(flagOnFailureCmd, "",
+		"the shell command to run when the task fails, the summary is passed in JSON by stdin")
+}
+
+// ParseFromFlags parses the notification flags from the flag set.
+func (cfg *NotifyConfig) ParseFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.Webhook, err = flags.GetString(flagNotifyWebhook)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.WebhookSecret, err = flags.GetString(flagNotifyWebhookSecret)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.WebhookSecret != "" && cfg.Webhook == "" {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s requires --%s", flagNotifyWebhookSecret, flagNotifyWebhook)
+	}
+	cfg.OnSuccessCmd, err = flags.GetString(flagOnSuccessCmd)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.OnFailureCmd, err = flags.GetString(flagOnFailureCmd)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// TaskNotification is the payload sent to the webhook and the hook commands
+// when a task finishes.
+type TaskNotification struct {
+	Task    string `json:"task"`
+	Success bool   `json:"success"`
+	// ErrorCode is the normalized error code of BR, e.g.
+	// "BR:Backup:ErrBackupChecksumMismatch".
+	ErrorCode string          `json:"error-code,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Summary   *summary.Report `json:"summary"`
+}
+
+// errorCode returns the normalized error code of err, errors not defined by
+// BR are unknown errors.
+func errorCode(err error) string {
+	if e, ok := errors.Cause(err).(*errors.Error); ok {
+		return string(e.RFCCode())
+	}
+	return string(berrors.ErrUnknown.RFCCode())
+}
+
+func newTaskNotification(cmdName string, err error) *TaskNotification {
+	n := &TaskNotification{
+		Task:    cmdName,
+		Success: err == nil,
+		Summary: summary.GetReport(cmdName),
+	}
+	if err != nil {
+		n.Summary.Success = false
+		n.ErrorCode = errorCode(err)
+		n.Error = err.Error()
+	}
+	return n
+}
+
+// notifyTaskFinished sends the notifications of the task, it must be called
+// before the summary is output, since the summary is reset after that. The
+// failures of the notifications are only logged, they don't fail the task.
+func (cfg *NotifyConfig) notifyTaskFinished(cmdName string, err error) {
+	cmd := cfg.OnSuccessCmd
+	if err != nil {
+		cmd = cfg.OnFailureCmd
+	}
+	if cfg.Webhook == "" && cmd == "" {
+		return
+	}
+	payload, e := json.Marshal(newTaskNotification(cmdName, err))
+	if e != nil {
+		log.Warn("failed to marshal the task notification", zap.Error(e))
+		return
+	}
+	// the task context may be canceled, e.g. by a signal.
+	ctx := context.Background()
+	if cfg.Webhook != "" {
+		if e = postWebhook(ctx, cfg.Webhook, cfg.WebhookSecret, payload); e != nil {
+			log.Warn("failed to send the webhook notification", zap.Error(e))
+		}
+	}
+	if cmd != "" {
+		if e = runHookCmd(ctx, cmd, cmdName, err, payload); e != nil {
+			log.Warn("failed to run the hook command", zap.String("cmd", cmd), zap.Error(e))
+		}
+	}
+}
+
+// signPayload returns the hex HMAC-SHA256 signature of the payload.
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(ctx context.Context, url, secret string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(notifySignatureHeader, signPayload(secret, payload))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("the webhook responds %s", resp.Status)
+	}
+	return nil
+}
+
+// runHookCmd runs the hook command by the shell, the payload is passed by
+// stdin and the result is passed by the environment variables too.
+func runHookCmd(ctx context.Context, cmd, cmdName string, taskErr error, payload []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	c := exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
+	c.Stdin = bytes.NewReader(payload)
+	c.Env = append(os.Environ(),
+		"BR_TASK="+cmdName,
+		"BR_SUCCESS="+strconv.FormatBool(taskErr == nil))
+	if taskErr != nil {
+		c.Env = append(c.Env,
+			"BR_ERROR_CODE="+errorCode(taskErr),
+			"BR_ERROR="+taskErr.Error())
+	}
+	output, err := c.CombinedOutput()
+	if err != nil {
+		return errors.Annotatef(err, "output: %s", output)
+	}
+	log.Info("run the hook command", zap.String("cmd", cmd), zap.ByteString("output", output))
+	return nil
+}
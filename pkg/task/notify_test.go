@@ -0,0 +1,102 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+)
+
+var _ = Suite(&testNotifySuite{})
+
+type testNotifySuite struct{}
+
+func (s *testNotifySuite) TestErrorCode(c *C) {
+	err := errors.Annotate(berrors.ErrBackupChecksumMismatch, "checksum mismatch of table t")
+	c.Assert(errorCode(err), Equals, "BR:Backup:ErrBackupChecksumMismatch")
+	err = berrors.ErrRestoreRTsConstrain.GenWithStack("restored ts %d", 100)
+	c.Assert(errorCode(errors.Trace(err)), Equals, "BR:Restore:ErrRestoreResolvedTsConstrain")
+	c.Assert(errorCode(errors.New("not a BR error")), Equals, "BR:Common:ErrUnknown")
+}
+
+func (s *testNotifySuite) TestNotifyWebhook(c *C) {
+	type request struct {
+		signature string
+		body      []byte
+	}
+	reqCh := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, IsNil)
+		reqCh <- request{signature: r.Header.Get(notifySignatureHeader), body: body}
+	}))
+	defer server.Close()
+
+	cfg := &NotifyConfig{Webhook: server.URL, WebhookSecret: "secret"}
+	cfg.notifyTaskFinished("Full backup", errors.Annotate(berrors.ErrBackupChecksumMismatch, "injected"))
+	req := <-reqCh
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	_, _ = mac.Write(req.body)
+	c.Assert(req.signature, Equals, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	n := &TaskNotification{}
+	c.Assert(json.Unmarshal(req.body, n), IsNil)
+	c.Assert(n.Task, Equals, "Full backup")
+	c.Assert(n.Success, IsFalse)
+	c.Assert(n.ErrorCode, Equals, "BR:Backup:ErrBackupChecksumMismatch")
+	c.Assert(n.Error, Matches, "injected.*")
+	c.Assert(n.Summary, NotNil)
+	c.Assert(n.Summary.Name, Equals, "Full backup")
+	c.Assert(n.Summary.Success, IsFalse)
+
+	// the payload is not signed without the secret.
+	cfg.WebhookSecret = ""
+	cfg.notifyTaskFinished("Full backup", nil)
+	req = <-reqCh
+	c.Assert(req.signature, Equals, "")
+	c.Assert(json.Unmarshal(req.body, n), IsNil)
+	c.Assert(n.Success, IsTrue)
+}
+
+func (s *testNotifySuite) TestNotifyHookCmd(c *C) {
+	dir := c.MkDir()
+	payloadFile := filepath.Join(dir, "payload")
+	envFile := filepath.Join(dir, "env")
+	cfg := &NotifyConfig{
+		OnSuccessCmd: "cat > " + payloadFile + `; echo "$BR_TASK,$BR_SUCCESS" > ` + envFile,
+		OnFailureCmd: "cat > " + payloadFile + `; echo "$BR_TASK,$BR_SUCCESS,$BR_ERROR_CODE" > ` + envFile,
+	}
+
+	cfg.notifyTaskFinished("Full restore", nil)
+	env, err := ioutil.ReadFile(envFile)
+	c.Assert(err, IsNil)
+	c.Assert(string(env), Equals, "Full restore,true\n")
+	payload, err := ioutil.ReadFile(payloadFile)
+	c.Assert(err, IsNil)
+	n := &TaskNotification{}
+	c.Assert(json.Unmarshal(payload, n), IsNil)
+	c.Assert(n.Task, Equals, "Full restore")
+	c.Assert(n.Success, IsTrue)
+
+	cfg.notifyTaskFinished("Full restore", errors.Annotate(berrors.ErrRestoreBackupChainBroken, "injected"))
+	env, err = ioutil.ReadFile(envFile)
+	c.Assert(err, IsNil)
+	c.Assert(string(env), Equals, "Full restore,false,BR:Restore:ErrRestoreBackupChainBroken\n")
+	payload, err = ioutil.ReadFile(payloadFile)
+	c.Assert(err, IsNil)
+	n = &TaskNotification{}
+	c.Assert(json.Unmarshal(payload, n), IsNil)
+	c.Assert(n.Success, IsFalse)
+	c.Assert(n.ErrorCode, Equals, "BR:Restore:ErrRestoreBackupChainBroken")
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	"github.com/Orion7r/pr/pkg/conn"
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/glue"
+	"github.com/Orion7r/pr/pkg/restore"
+)
+
+const (
+	flagOnlineStores = "online-stores"
+	flagOnlineLease  = "online-lease"
+	flagForce        = "force"
+
+	defaultOnlineLease = 10 * time.Minute
+)
+
+// defineOnlineRestoreFlags defines the flags of the online restore.
+func defineOnlineRestoreFlags(flags *pflag.FlagSet) {
+	flags.Int(flagOnlineStores, 0,
+		"the number of the TiKV stores which BR labels exclusively for --"+flagOnline+", "+
+			"0 uses the stores labelled 'exclusive=restore' manually")
+	flags.Duration(flagOnlineLease, defaultOnlineLease,
+		"the lease of the store labels and the placement rules set by --"+flagOnline+", "+
+			"they can be removed by 'br debug cleanup-online-restore' after the lease expires if BR exits unexpectedly")
+}
+
+// parseOnlineRestoreFlags parses the flags of the online restore.
+func (cfg *RestoreConfig) parseOnlineRestoreFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.OnlineStores, err = flags.GetInt(flagOnlineStores)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.OnlineStores < 0 {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "--%s must not be negative", flagOnlineStores)
+	}
+	cfg.OnlineLease, err = flags.GetDuration(flagOnlineLease)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.OnlineLease <= 0 {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "--%s must be positive", flagOnlineLease)
+	}
+	return nil
+}
+
+// newOnlineRecorder creates the record of the store labels and the placement
+// rules set by the online restore in the checkpoint storage.
+func newOnlineRecorder(ctx context.Context, mgr *conn.Mgr, cfg *RestoreConfig) (*restore.OnlineRecorder, error) {
+	s, _, err := newCheckpointStorage(ctx, &cfg.Config, cfg.CheckpointStorage)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	lease := cfg.OnlineLease
+	if lease <= 0 {
+		lease = defaultOnlineLease
+	}
+	return restore.NewOnlineRecorder(ctx, s, mgr.GetPDClient().GetClusterID(ctx), lease,
+		restore.NewSplitClient(mgr.GetPDClient(), mgr.GetTLSConfig()))
+}
+
+// CleanupOnlineRestoreConfig is the configuration specific for cleaning up
+// the online restore.
+type CleanupOnlineRestoreConfig struct {
+	Config
+
+	CheckpointStorage string `json:"checkpoint-storage" toml:"checkpoint-storage"`
+	Force             bool   `json:"force" toml:"force"`
+}
+
+// DefineCleanupOnlineRestoreFlags defines the flags for cleaning up the online
+// restore.
+func DefineCleanupOnlineRestoreFlags(flags *pflag.FlagSet) {
+	flags.String(flagCheckpointStorage, "",
+		"the storage of the restore checkpoint, "+
+			"by default it is the '"+defaultCheckpointDir+"' directory of the backup storage")
+	flags.Bool(flagForce, false, "clean up even if the lease of the online restore doesn't expire")
+}
+
+// ParseFromFlags parses the flags for cleaning up the online restore.
+func (cfg *CleanupOnlineRestoreConfig) ParseFromFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.CheckpointStorage, err = flags.GetString(flagCheckpointStorage)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Force, err = flags.GetBool(flagForce)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(cfg.Config.ParseFromFlags(flags))
+}
+
+// RunCleanupOnlineRestore removes the store labels and the placement rules
+// left by an online restore which exits unexpectedly.
+func RunCleanupOnlineRestore(c context.Context, g glue.Glue, cfg *CleanupOnlineRestoreConfig) error {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer mgr.Close()
+
+	s, rawURL, err := newCheckpointStorage(ctx, &cfg.Config, cfg.CheckpointStorage)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	name := restore.OnlineRecordName(mgr.GetPDClient().GetClusterID(ctx))
+	log.Info("clean up online restore", zap.String("storage", rawURL), zap.String("record", name))
+	return errors.Trace(restore.CleanupOnlineRestore(ctx, s, name,
+		restore.NewSplitClient(mgr.GetPDClient(), mgr.GetTLSConfig()), cfg.Force))
+}
@@ -4,8 +4,12 @@ package task
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/failpoint"
 	"github.com/pingcap/kvproto/pkg/backup"
@@ -26,12 +30,27 @@ import (
 )
 
 const (
-	flagOnline   = "online"
-	flagNoSchema = "no-schema"
+	flagOnline            = "online"
+	flagNoSchema          = "no-schema"
+	flagRestoreResume     = "resume"
+	flagCheckpointStorage = "checkpoint-storage"
+	flagRename            = "rename"
+	flagRenameFile        = "rename-file"
+	flagLoadStats         = "load-stats"
+	flagAnalyzeNoStats    = "analyze-missing-stats"
+	flagOnExisting        = "on-existing"
+	flagTiFlashReplicas   = "tiflash-replicas"
+	flagTiFlashTimeout    = "wait-tiflash-timeout"
+	flagPlacementRules    = "placement-rules"
+
+	// defaultCheckpointDir is the directory of the restore checkpoint in the
+	// backup storage if --checkpoint-storage is not specified.
+	defaultCheckpointDir = "restore-checkpoint"
 
 	defaultRestoreConcurrency = 128
 	maxRestoreBatchSizeLimit  = 10240
 	defaultDDLConcurrency     = 16
+	defaultTiFlashTimeout     = 30 * time.Minute
 )
 
 // RestoreConfig is the configuration specific for restore tasks.
@@ -40,13 +59,73 @@ type RestoreConfig struct {
 
 	Online   bool `json:"online" toml:"online"`
 	NoSchema bool `json:"no-schema" toml:"no-schema"`
+
+	OnlineStores int           `json:"online-stores" toml:"online-stores"`
+	OnlineLease  time.Duration `json:"online-lease" toml:"online-lease"`
+
+	Resume            bool   `json:"resume" toml:"resume"`
+	CheckpointStorage string `json:"checkpoint-storage" toml:"checkpoint-storage"`
+
+	// Incremental and IncrementalRoot are the incremental backups to restore
+	// after the backup of Storage in one task.
+	Incremental     []string `json:"incremental" toml:"incremental"`
+	IncrementalRoot string   `json:"incremental-root" toml:"incremental-root"`
+
+	Rename     []string `json:"rename" toml:"rename"`
+	RenameFile string   `json:"rename-file" toml:"rename-file"`
+
+	LoadStats           bool `json:"load-stats" toml:"load-stats"`
+	AnalyzeMissingStats bool `json:"analyze-missing-stats" toml:"analyze-missing-stats"`
+
+	DryRun bool `json:"dry-run" toml:"dry-run"`
+
+	// OnExisting is the policy to restore the existing tables, see
+	// restore.OnExisting. If it is empty, the existing tables are appended
+	// to in incremental restores and with --no-schema, otherwise the restore
+	// fails.
+	OnExisting string `json:"on-existing" toml:"on-existing"`
+
+	TiFlashReplicas int           `json:"tiflash-replicas" toml:"tiflash-replicas"`
+	TiFlashTimeout  time.Duration `json:"wait-tiflash-timeout" toml:"wait-tiflash-timeout"`
+	PlacementRules  bool          `json:"placement-rules" toml:"placement-rules"`
 }
 
 // DefineRestoreFlags defines common flags for the restore command.
 func DefineRestoreFlags(flags *pflag.FlagSet) {
 	// TODO remove experimental tag if it's stable
 	flags.Bool(flagOnline, false, "(experimental) Whether online when restore")
+	defineOnlineRestoreFlags(flags)
 	flags.Bool(flagNoSchema, false, "skip creating schemas and tables, reuse existing empty ones")
+	flags.Bool(flagRestoreResume, false,
+		"resume the restore from the checkpoint, skip the tables created, the ranges restored and the checksums passed")
+	flags.String(flagCheckpointStorage, "",
+		"the storage to save the restore checkpoint, "+
+			"by default it is saved under the '"+defaultCheckpointDir+"' directory of the backup storage")
+	defineRestoreChainFlags(flags)
+	flags.StringArray(flagRename, nil,
+		"rename the databases and tables on restore, in the form of 'db.table:newdb.newtable', "+
+			"e.g. 'prod.*:prod_restore.*' restores all tables of prod into prod_restore")
+	flags.String(flagRenameFile, "",
+		"the TOML file of the rename rules, each rule is a [[rename]] table with 'from' and 'to', "+
+			"the rules of --"+flagRename+" are matched first")
+	flags.Bool(flagLoadStats, true, "load the statistics of the tables after the data is restored")
+	flags.Bool(flagAnalyzeNoStats, false,
+		"analyze the tables whose statistics are not backed up, it only works with --"+flagLoadStats)
+	flags.Bool(flagDryRun, false,
+		"print the plan of the restore as JSON without changing the cluster, "+
+			"including the tables to create, the DDL jobs to replay, the regions to split and the ETA")
+	flags.String(flagOnExisting, "",
+		"how to restore the tables which already exist, one of 'error', 'skip', 'truncate', 'replace' and 'append', "+
+			"'append' requires the tables to be empty unless the backup is incremental. "+
+			"By default it is 'append' for incremental backups and --"+flagNoSchema+", otherwise 'error'")
+	flags.Int(flagTiFlashReplicas, -1,
+		"the TiFlash replica count of the tables which have TiFlash replicas in the backup, "+
+			"0 skips setting TiFlash replicas, a negative value keeps the count in the backup. "+
+			"The TiFlash replicas are skipped with a warning if the cluster has no TiFlash store")
+	flags.Duration(flagTiFlashTimeout, defaultTiFlashTimeout,
+		"the max duration to wait for the TiFlash replica of each table to be available, 0 waits forever")
+	flags.Bool(flagPlacementRules, true,
+		"restore the custom placement rules of the tables recorded at backup time")
 
 	// Do not expose this flag
 	_ = flags.MarkHidden(flagNoSchema)
@@ -63,6 +142,66 @@ func (cfg *RestoreConfig) ParseFromFlags(flags *pflag.FlagSet) error {
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if err = cfg.parseOnlineRestoreFlags(flags); err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Resume, err = flags.GetBool(flagRestoreResume)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.CheckpointStorage, err = flags.GetString(flagCheckpointStorage)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = cfg.parseRestoreChainFlags(flags); err != nil {
+		return errors.Trace(err)
+	}
+	cfg.Rename, err = flags.GetStringArray(flagRename)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.RenameFile, err = flags.GetString(flagRenameFile)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.LoadStats, err = flags.GetBool(flagLoadStats)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.AnalyzeMissingStats, err = flags.GetBool(flagAnalyzeNoStats)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.DryRun, err = flags.GetBool(flagDryRun)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.OnExisting, err = flags.GetString(flagOnExisting)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.TiFlashReplicas, err = flags.GetInt(flagTiFlashReplicas)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.TiFlashTimeout, err = flags.GetDuration(flagTiFlashTimeout)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.PlacementRules, err = flags.GetBool(flagPlacementRules)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.OnExisting != "" {
+		policy, err := restore.ParseOnExisting(cfg.OnExisting)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if policy == restore.OnExistingReplace && cfg.NoSchema {
+			return errors.Annotatef(berrors.ErrInvalidArgument,
+				"--%s=%s cannot be used with --%s", flagOnExisting, policy, flagNoSchema)
+		}
+	}
 	err = cfg.Config.ParseFromFlags(flags)
 	if err != nil {
 		return errors.Trace(err)
@@ -91,12 +230,29 @@ func (cfg *RestoreConfig) adjustRestoreConfig() {
 
 // RunRestore starts a restore task inside the current goroutine.
 func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConfig) error {
+	defer summary.Summary(cmdName)
+	err := runRestore(c, g, cmdName, cfg)
+	cfg.Notify.notifyTaskFinished(cmdName, err)
+	return errors.Trace(err)
+}
+
+// runRestore restores the snapshot backup without printing the summary, so
+// it can be a step of other restore tasks.
+func runRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConfig) error {
 	cfg.adjustRestoreConfig()
 
-	defer summary.Summary(cmdName)
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
+	renamer, err := newTableRenamer(cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// fail before connecting to the cluster if TiKV can not access the storage.
+	if _, err = storage.ParseBackend(cfg.Storage, &cfg.BackendOptions); err != nil {
+		return errors.Trace(err)
+	}
+
 	mgr, err := NewMgr(ctx, g, cfg.PD, cfg.TLS, GetKeepalive(&cfg.Config), cfg.CheckRequirements)
 	if err != nil {
 		return errors.Trace(err)
@@ -111,13 +267,6 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 	}
 	defer client.Close()
 
-	u, err := storage.ParseBackend(cfg.Storage, &cfg.BackendOptions)
-	if err != nil {
-		return errors.Trace(err)
-	}
-	if err = client.SetStorage(ctx, u, cfg.SendCreds); err != nil {
-		return errors.Trace(err)
-	}
 	client.SetRateLimit(cfg.RateLimit)
 	client.SetConcurrency(uint(cfg.Concurrency))
 	if cfg.Online {
@@ -127,17 +276,191 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 		client.EnableSkipCreateSQL()
 	}
 	client.SetSwitchModeInterval(cfg.SwitchModeInterval)
+	// the dry run only reads the stores labelled manually.
+	if cfg.Online && !cfg.DryRun {
+		recorder, err := newOnlineRecorder(ctx, mgr, cfg)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		go recorder.Run(ctx)
+		defer func() {
+			if err := recorder.Finish(context.Background()); err != nil {
+				log.Warn("failed to remove the online restore record", zap.Error(err))
+			}
+		}()
+		client.SetOnlineRecorder(recorder)
+		client.SetOnlineStores(cfg.OnlineStores)
+		client.SetPlacementProgress(func(total int64) glue.Progress {
+			return g.StartProgress(ctx, "Wait placement schedule", total, !cfg.LogProgress)
+		})
+	}
 	err = client.LoadRestoreStores(ctx)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	defer func() {
+		if err := client.ResetRestoreLabels(context.Background()); err != nil {
+			log.Warn("failed to reset the labels of the restore stores", zap.Error(err))
+		}
+	}()
+
+	chain, err := loadRestoreChain(ctx, cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	var size uint64
+	for _, item := range chain {
+		size += utils.ArchiveSize(item.meta)
+	}
+	g.Record("Size", size)
+	collectBackupPath(chain[0].backend)
+	summary.CollectUint("backup ts", chain[len(chain)-1].meta.EndVersion)
+
+	rs := &restoreSession{
+		g:       g,
+		mgr:     mgr,
+		client:  client,
+		renamer: renamer,
+	}
+	if !cfg.DryRun {
+		rs.restoreTS, err = client.GetTS(ctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		summary.CollectUint("restore ts", rs.restoreTS)
+
+		sp := utils.BRServiceSafePoint{
+			BackupTS: rs.restoreTS,
+			TTL:      utils.DefaultBRGCSafePointTTL,
+			ID:       utils.MakeSafePointID(),
+		}
+		// restore checksum will check safe point with its start ts, see details at
+		// https://github.com/pingcap/tidb/blob/180c02127105bed73712050594da6ead4d70a85f/store/tikv/kv.go#L186-L190
+		// so, we should keep the safe point unchangeable. to avoid GC life time is shorter than transaction duration.
+		utils.StartServiceSafePointKeeper(ctx, mgr.GetPDClient(), sp)
+
+		// pre-set TiDB config for restore
+		restoreDBConfig := enableTiDBConfig()
+		defer restoreDBConfig()
+	}
+	// Always run the post-work even on error, so we don't stuck in the import
+	// mode or emptied schedulers
+	defer rs.postWork(ctx)
+
+	rs.chained = len(chain) > 1
+	for i, item := range chain {
+		itemCfg := *cfg
+		itemCfg.Storage = item.storage
+		name := cmdName
+		if len(chain) > 1 {
+			name = fmt.Sprintf("%s (%d/%d)", cmdName, i+1, len(chain))
+			log.Info("restore backup in chain",
+				zap.Int("index", i+1),
+				zap.String("storage", item.storage),
+				zap.Uint64("start-version", item.meta.StartVersion),
+				zap.Uint64("end-version", item.meta.EndVersion))
+			// the tables are created by the previous backups in the chain.
+			if i > 0 {
+				itemCfg.OnExisting = string(restore.OnExistingAppend)
+			}
+		}
+		if err = rs.restoreBackup(ctx, name, &itemCfg, item); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	rs.removeCheckpoints(ctx)
+
+	// Set task summary to success status.
+	summary.SetSuccessStatus(true)
+	return nil
+}
+
+// restoreSession is the state shared by the backups restored in one restore
+// task, i.e. the backups of an incremental chain.
+type restoreSession struct {
+	g       glue.Glue
+	mgr     *conn.Mgr
+	client  *restore.Client
+	renamer *restore.TableRenamer
+
+	restoreTS uint64
+	// restoreSchedulers is nil until the cluster is prepared for the restore.
+	restoreSchedulers pdutil.UndoFunc
+	// chained is set if more than one backup is restored. The checkpoints of
+	// the restored backups are kept until the whole chain is restored, so
+	// they are skipped on resume.
+	chained       bool
+	checkpointers []*restore.Checkpointer
+}
+
+// preWork prepares the cluster for the restore, only the first call takes
+// effect.
+func (rs *restoreSession) preWork(ctx context.Context) error {
+	if rs.restoreSchedulers != nil {
+		return nil
+	}
+	restoreSchedulers, err := restorePreWork(ctx, rs.client, rs.mgr)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	rs.restoreSchedulers = restoreSchedulers
+	return nil
+}
+
+// postWork undoes preWork if the cluster is prepared.
+func (rs *restoreSession) postWork(ctx context.Context) {
+	if rs.restoreSchedulers == nil {
+		return
+	}
+	restorePostWork(ctx, rs.client, rs.restoreSchedulers)
+}
+
+// finishBackup records the backup is restored if it is in a chain.
+func (rs *restoreSession) finishBackup(ctx context.Context, checkpointer *restore.Checkpointer) error {
+	if !rs.chained {
+		return nil
+	}
+	if err := checkpointer.MarkFinished(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	rs.checkpointers = append(rs.checkpointers, checkpointer)
+	return nil
+}
+
+// removeCheckpoints removes the checkpoints of the chain after the whole chain
+// is restored.
+func (rs *restoreSession) removeCheckpoints(ctx context.Context) {
+	for _, checkpointer := range rs.checkpointers {
+		if err := checkpointer.Remove(ctx); err != nil {
+			log.Warn("failed to remove restore checkpoint", zap.Error(err))
+		}
+	}
+}
 
-	u, _, backupMeta, err := ReadBackupMeta(ctx, utils.MetaFile, &cfg.Config)
+// restoreBackup restores a backup of the chain.
+func (rs *restoreSession) restoreBackup(
+	c context.Context,
+	cmdName string,
+	cfg *RestoreConfig,
+	item *restoreChainItem,
+) error {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+	g, mgr, client, renamer := rs.g, rs.mgr, rs.client, rs.renamer
+
+	u, err := storage.ParseBackend(cfg.Storage, &cfg.BackendOptions)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	g.Record("Size", utils.ArchiveSize(backupMeta))
-	if err = client.InitBackupMeta(backupMeta, u); err != nil {
+	opts, err := cfg.storageOptions()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = client.SetStorage(ctx, u, opts); err != nil {
+		return errors.Trace(err)
+	}
+	backupMeta := item.meta
+	if err = client.InitBackupMeta(backupMeta, item.backend); err != nil {
 		return errors.Trace(err)
 	}
 
@@ -150,30 +473,84 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 		return errors.Annotate(berrors.ErrRestoreInvalidBackup, "contain tables but no databases")
 	}
 
-	restoreTS, err := client.GetTS(ctx)
+	ddlJobs := restore.FilterDDLJobs(client.GetDDLJobs(), tables)
+	// the ddl jobs are filtered by the original names, rename them after that.
+	if renamer != nil {
+		if tables, dbs, err = renamer.RenameTables(tables); err != nil {
+			return errors.Trace(err)
+		}
+		if ddlJobs, err = renamer.RenameDDLJobs(ddlJobs); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	if cfg.DryRun {
+		plan, err := client.PlanRestore(ctx, mgr.GetDomain(), dbs, tables, ddlJobs, files)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		log.Info("restore plan",
+			zap.Int("new tables", len(plan.NewTables)),
+			zap.Int("existing tables", len(plan.ExistingTables)),
+			zap.Int("ddl jobs", len(plan.DDLJobs)),
+			zap.Int("split keys", plan.SplitKeys),
+			zap.String("eta", plan.ETA))
+		return errors.Trace(writeJSON(os.Stdout, plan))
+	}
+
+	checkpointer, err := newRestoreCheckpointer(ctx, mgr.GetPDClient().GetClusterID(ctx), cfg, backupMeta)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if checkpointer.IsFinished() {
+		log.Info("skip the backup restored before the checkpoint",
+			zap.Uint64("start-version", backupMeta.StartVersion),
+			zap.Uint64("end-version", backupMeta.EndVersion))
+		rs.checkpointers = append(rs.checkpointers, checkpointer)
+		return nil
+	}
+	client.SetCheckpointer(checkpointer)
+	go checkpointer.Run(ctx)
+	restoreFinished := false
+	defer func() {
+		if restoreFinished {
+			// the checkpoints of a chain are removed by removeCheckpoints.
+			if rs.chained {
+				return
+			}
+			if err := checkpointer.Remove(ctx); err != nil {
+				log.Warn("failed to remove restore checkpoint", zap.Error(err))
+			}
+			return
+		}
+		// the ctx may be canceled, save the progress with a new context.
+		if err := checkpointer.Flush(context.Background()); err != nil {
+			log.Warn("failed to save restore checkpoint", zap.Error(err))
+		}
+	}()
 
-	sp := utils.BRServiceSafePoint{
-		BackupTS: restoreTS,
-		TTL:      utils.DefaultBRGCSafePointTTL,
-		ID:       utils.MakeSafePointID(),
+	// the existing tables are resolved before the cluster is changed by the
+	// DDLs, so the restore fails without side effects if the policy fails.
+	onExisting, err := onExistingPolicy(client, cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	resolvedTables, err := client.ResolveExistingTables(ctx, mgr.GetDomain(), tables, onExisting)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(resolvedTables) != len(tables) {
+		// some existing tables are skipped.
+		tables, files = resolvedTables, nil
+		for _, table := range tables {
+			files = append(files, table.Files...)
+		}
 	}
-	// restore checksum will check safe point with its start ts, see details at
-	// https://github.com/pingcap/tidb/blob/180c02127105bed73712050594da6ead4d70a85f/store/tikv/kv.go#L186-L190
-	// so, we should keep the safe point unchangeable. to avoid GC life time is shorter than transaction duration.
-	utils.StartServiceSafePointKeeper(ctx, mgr.GetPDClient(), sp)
 
 	var newTS uint64
 	if client.IsIncremental() {
-		newTS = restoreTS
+		newTS = rs.restoreTS
 	}
-	ddlJobs := restore.FilterDDLJobs(client.GetDDLJobs(), tables)
-
-	// pre-set TiDB config for restore
-	restoreDBConfig := enableTiDBConfig()
-	defer restoreDBConfig()
 
 	// execute DDL first
 	err = client.ExecDDLs(ctx, ddlJobs)
@@ -184,8 +561,10 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 	// nothing to restore, maybe only ddl changes in incremental restore
 	if len(dbs) == 0 && len(tables) == 0 {
 		log.Info("nothing to restore, all databases and tables are filtered out")
-		// even nothing to restore, we show a success message since there is no failure.
-		summary.SetSuccessStatus(true)
+		if err = rs.finishBackup(ctx, checkpointer); err != nil {
+			return errors.Trace(err)
+		}
+		restoreFinished = true
 		return nil
 	}
 
@@ -220,7 +599,6 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 	tableStream := client.GoCreateTables(ctx, mgr.GetDomain(), tables, newTS, dbPool, errCh)
 	if len(files) == 0 {
 		log.Info("no files, empty databases and tables are restored")
-		summary.SetSuccessStatus(true)
 		// don't return immediately, wait all pipeline done.
 	}
 
@@ -233,21 +611,22 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 	summary.CollectInt("restore ranges", rangeSize)
 	log.Info("range and file prepared", zap.Int("file count", len(files)), zap.Int("range count", rangeSize))
 
-	restoreSchedulers, err := restorePreWork(ctx, client, mgr)
-	if err != nil {
+	// the cluster is prepared once for all the backups in the chain, so it is
+	// kept in import mode by the context of the session.
+	if err = rs.preWork(c); err != nil {
 		return errors.Trace(err)
 	}
-	// Always run the post-work even on error, so we don't stuck in the import
-	// mode or emptied schedulers
-	defer restorePostWork(ctx, client, restoreSchedulers)
 
 	// Do not reset timestamp if we are doing incremental restore, because
 	// we are not allowed to decrease timestamp.
-	if !client.IsIncremental() {
+	// The timestamp reset before the checkpoint is not reset again, since it
+	// may be smaller than the current timestamp now.
+	if !client.IsIncremental() && !checkpointer.IsTSReset() {
 		if err = client.ResetTS(ctx, cfg.PD); err != nil {
 			log.Error("reset pd TS failed", zap.Error(err))
 			return errors.Trace(err)
 		}
+		checkpointer.MarkTSReset()
 	}
 
 	// Restore sst files in batch.
@@ -272,18 +651,75 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 	manager := restore.NewBRContextManager(client)
 	batcher, afterRestoreStream := restore.NewBatcher(ctx, sender, manager, errCh)
 	batcher.SetThreshold(batchSize)
+	client.SetChecksumConcurrency(cfg.ChecksumConcurrency)
+	defer registerTaskControls(map[string]utils.TaskControl{
+		controlRateLimit: {
+			Get: client.RateLimit,
+			Set: func(rateLimit uint64) error {
+				return client.UpdateRateLimit(ctx, rateLimit)
+			},
+		},
+		controlConcurrency: positiveControl(
+			func() uint64 { return uint64(client.Concurrency()) },
+			func(concurrency uint64) { client.SetConcurrency(uint(concurrency)) },
+		),
+		controlBatchSize: positiveControl(
+			func() uint64 { return uint64(batcher.Threshold()) },
+			func(size uint64) {
+				if size > maxRestoreBatchSizeLimit {
+					size = maxRestoreBatchSizeLimit
+				}
+				batcher.SetThreshold(int(size))
+			},
+		),
+		controlChecksumConcurrency: positiveControl(
+			func() uint64 { return uint64(client.ChecksumConcurrency()) },
+			func(concurrency uint64) { client.SetChecksumConcurrency(uint(concurrency)) },
+		),
+	}, client)()
+	stopSchedule, err := startRateLimitSchedule(ctx, &cfg.Config, client.HoldNormalMode)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer stopSchedule()
 	batcher.EnableAutoCommit(ctx, time.Second)
 	go restoreTableStream(ctx, rangeStream, batcher, errCh)
 
-	var finish <-chan struct{}
+	postRestoreStream := afterRestoreStream
 	// Checksum
 	if cfg.Checksum {
-		finish = client.GoValidateChecksum(
-			ctx, afterRestoreStream, mgr.GetTiKV().GetClient(), errCh, updateCh, cfg.ChecksumConcurrency)
+		postRestoreStream = client.GoValidateChecksum(
+			ctx, postRestoreStream, mgr.GetTiKV().GetClient(), errCh, updateCh)
 	} else {
-		// when user skip checksum, just collect tables, and drop them.
-		finish = dropToBlackhole(ctx, afterRestoreStream, errCh, updateCh)
+		// when user skip checksum, just count the tables.
+		postRestoreStream = skipChecksum(ctx, postRestoreStream, errCh, updateCh)
+	}
+	// TiFlash replicas and placement rules
+	tiflashReplicas, err := tiflashReplicasToRestore(ctx, client, cfg, tables)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	postRestoreStream = client.GoRestorePlacement(
+		ctx, postRestoreStream, errCh, tiflashReplicas, cfg.PlacementRules)
+	// Statistics
+	if cfg.LoadStats {
+		statsCh := g.StartProgress(ctx, "Load statistics", int64(len(tables)), !cfg.LogProgress)
+		defer statsCh.Close()
+		postRestoreStream = client.GoLoadStats(ctx, postRestoreStream, errCh, statsCh, cfg.AnalyzeMissingStats)
+	}
+	// Wait TiFlash replicas
+	tiflashTables := 0
+	for _, table := range tables {
+		if restore.TiFlashReplicaCount(table, tiflashReplicas) > 0 {
+			tiflashTables++
+		}
+	}
+	if tiflashTables > 0 {
+		tiflashCh := g.StartProgress(ctx, "Wait TiFlash replicas", int64(tiflashTables), !cfg.LogProgress)
+		defer tiflashCh.Close()
+		postRestoreStream = client.GoWaitTiFlashReplicas(ctx, postRestoreStream, errCh, tiflashCh, cfg.TiFlashTimeout)
 	}
+	finish := dropToBlackhole(ctx, postRestoreStream, errCh)
 
 	select {
 	case err = <-errCh:
@@ -296,18 +732,103 @@ func RunRestore(c context.Context, g glue.Glue, cmdName string, cfg *RestoreConf
 		return errors.Trace(err)
 	}
 
-	// Set task summary to success status.
-	summary.SetSuccessStatus(true)
+	if err = rs.finishBackup(ctx, checkpointer); err != nil {
+		return errors.Trace(err)
+	}
+	restoreFinished = true
 	return nil
 }
 
-// dropToBlackhole drop all incoming tables into black hole,
-// i.e. don't execute checksum, just increase the process anyhow.
-func dropToBlackhole(
+// newCheckpointStorage opens the storage of the restore checkpoint, which is
+// the "restore-checkpoint" directory of the backup storage if rawURL is empty.
+func newCheckpointStorage(
+	ctx context.Context,
+	cfg *Config,
+	rawURL string,
+) (storage.ExternalStorage, string, error) {
+	if len(rawURL) == 0 {
+		u, err := storage.ParseRawURL(cfg.Storage)
+		if err != nil {
+			return nil, "", errors.Trace(err)
+		}
+		u.Path = path.Join(u.Path, defaultCheckpointDir)
+		rawURL = u.String()
+	}
+	opts, err := cfg.storageOptions()
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	s, err := storage.NewFromURL(ctx, rawURL, &cfg.BackendOptions, opts)
+	if err != nil {
+		return nil, "", errors.Annotate(err, "create checkpoint storage failed")
+	}
+	return s, rawURL, nil
+}
+
+// newRestoreCheckpointer creates the checkpointer of the restore, which resumes
+// the previous checkpoint if --resume is set.
+func newRestoreCheckpointer(
+	ctx context.Context,
+	clusterID uint64,
+	cfg *RestoreConfig,
+	backupMeta *backup.BackupMeta,
+) (*restore.Checkpointer, error) {
+	s, rawURL, err := newCheckpointStorage(ctx, &cfg.Config, cfg.CheckpointStorage)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// the same backup may be restored to several clusters, and the backups of
+	// a chain may share the checkpoint storage.
+	name := fmt.Sprintf("restore-%d-%d.checkpoint", clusterID, backupMeta.GetEndVersion())
+
+	var previous *restore.Checkpoint
+	if cfg.Resume {
+		previous, err = restore.LoadCheckpoint(ctx, s, name)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if previous == nil {
+			log.Warn("no restore checkpoint found, restore from the beginning",
+				zap.String("checkpoint", rawURL), zap.String("name", name))
+		}
+	}
+	return restore.NewCheckpointer(s, name, clusterID, backupMeta.GetEndVersion(), previous)
+}
+
+// skipChecksum passes the tables through without checksum, and updates the
+// progress of the checksum.
+func skipChecksum(
 	ctx context.Context,
 	tableStream <-chan restore.CreatedTable,
 	errCh chan<- error,
 	updateCh glue.Progress,
+) <-chan restore.CreatedTable {
+	outCh := make(chan restore.CreatedTable, cap(tableStream))
+	go func() {
+		defer close(outCh)
+		for {
+			select {
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			case tbl, ok := <-tableStream:
+				if !ok {
+					return
+				}
+				updateCh.Inc()
+				outCh <- tbl
+			}
+		}
+	}()
+	return outCh
+}
+
+// dropToBlackhole drop all incoming tables into black hole, the returned
+// channel is notified when the table stream is closed.
+func dropToBlackhole(
+	ctx context.Context,
+	tableStream <-chan restore.CreatedTable,
+	errCh chan<- error,
 ) <-chan struct{} {
 	outCh := make(chan struct{}, 1)
 	go func() {
@@ -323,13 +844,54 @@ func dropToBlackhole(
 				if !ok {
 					return
 				}
-				updateCh.Inc()
 			}
 		}
 	}()
 	return outCh
 }
 
+// tiflashReplicasToRestore returns the TiFlash replica count to override the
+// count in the backup, see restore.TiFlashReplicaCount. The TiFlash replicas
+// are skipped if the cluster has no TiFlash store, otherwise setting them would
+// fail the restore after all data is ingested.
+func tiflashReplicasToRestore(
+	ctx context.Context,
+	client *restore.Client,
+	cfg *RestoreConfig,
+	tables []*utils.Table,
+) (int, error) {
+	tiflashTables := 0
+	for _, table := range tables {
+		if restore.TiFlashReplicaCount(table, cfg.TiFlashReplicas) > 0 {
+			tiflashTables++
+		}
+	}
+	if tiflashTables == 0 {
+		return cfg.TiFlashReplicas, nil
+	}
+	hasTiFlash, err := client.HasTiFlashStores(ctx)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	if !hasTiFlash {
+		log.Warn("the cluster has no TiFlash store, skip restoring the TiFlash replicas",
+			zap.Int("tables", tiflashTables))
+		return 0, nil
+	}
+	return cfg.TiFlashReplicas, nil
+}
+
+// onExistingPolicy returns the policy to restore the existing tables.
+func onExistingPolicy(client *restore.Client, cfg *RestoreConfig) (restore.OnExisting, error) {
+	if cfg.OnExisting != "" {
+		return restore.ParseOnExisting(cfg.OnExisting)
+	}
+	if client.IsIncremental() || cfg.NoSchema {
+		return restore.OnExistingAppend, nil
+	}
+	return restore.OnExistingError, nil
+}
+
 func filterRestoreFiles(
 	client *restore.Client,
 	cfg *RestoreConfig,
@@ -352,6 +914,46 @@ func filterRestoreFiles(
 	return
 }
 
+// renameFile is the TOML file of the rename rules, e.g.
+//
+//	[[rename]]
+//	from = "prod.*"
+//	to = "prod_restore.*"
+type renameFile struct {
+	Rename []struct {
+		From string `toml:"from"`
+		To   string `toml:"to"`
+	} `toml:"rename"`
+}
+
+// newTableRenamer creates the renamer from --rename and --rename-file, it
+// returns nil if there is no rule.
+func newTableRenamer(cfg *RestoreConfig) (*restore.TableRenamer, error) {
+	rules := make([]restore.RenameRule, 0, len(cfg.Rename))
+	for _, r := range cfg.Rename {
+		rule, err := restore.ParseRenameRule(r)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		rules = append(rules, rule)
+	}
+	if cfg.RenameFile != "" {
+		var file renameFile
+		if _, err := toml.DecodeFile(cfg.RenameFile, &file); err != nil {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"failed to parse the rename file %s: %v", cfg.RenameFile, err)
+		}
+		for _, r := range file.Rename {
+			rule, err := restore.ParseRenameRule(r.From + ":" + r.To)
+			if err != nil {
+				return nil, errors.Annotatef(err, "invalid rule in the rename file %s", cfg.RenameFile)
+			}
+			rules = append(rules, rule)
+		}
+	}
+	return restore.NewTableRenamer(rules), nil
+}
+
 // restorePreWork executes some prepare work before restore.
 // TODO make this function returns a restore post work.
 func restorePreWork(ctx context.Context, client *restore.Client, mgr *conn.Mgr) (pdutil.UndoFunc, error) {
@@ -0,0 +1,169 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"path"
+	"sort"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+const (
+	flagIncremental     = "incremental"
+	flagIncrementalRoot = "incremental-root"
+)
+
+// defineRestoreChainFlags defines the flags to restore the incremental
+// backups after the backup of --storage.
+func defineRestoreChainFlags(flags *pflag.FlagSet) {
+	flags.StringSlice(flagIncremental, nil,
+		"the urls of the incremental backups to restore after the backup of --"+flagStorage+
+			", they are sorted by the backup ts and must form a chain without gaps")
+	flags.String(flagIncrementalRoot, "",
+		"the url of the directory to discover the incremental backups to restore after the backup of --"+
+			flagStorage+", the incremental backups which start before the backup ends are ignored")
+}
+
+// parseRestoreChainFlags parses the flags of the incremental backups.
+func (cfg *RestoreConfig) parseRestoreChainFlags(flags *pflag.FlagSet) error {
+	var err error
+	cfg.Incremental, err = flags.GetStringSlice(flagIncremental)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cfg.IncrementalRoot, err = flags.GetString(flagIncrementalRoot)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// the checkpoint only records the progress of one backup.
+	if cfg.Resume && (len(cfg.Incremental) > 0 || cfg.IncrementalRoot != "") {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "--%s cannot be used with --%s or --%s",
+			flagRestoreResume, flagIncremental, flagIncrementalRoot)
+	}
+	return nil
+}
+
+// restoreChainItem is a backup to restore in the chain.
+type restoreChainItem struct {
+	storage string
+	backend *backup.StorageBackend
+	meta    *backup.BackupMeta
+}
+
+// loadRestoreChain reads the backupmeta of the backup of --storage and the
+// incremental backups after it, and returns them in the order to restore.
+func loadRestoreChain(ctx context.Context, cfg *RestoreConfig) ([]*restoreChainItem, error) {
+	base, err := readRestoreChainItem(ctx, &cfg.Config, cfg.Storage)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	chain := []*restoreChainItem{base}
+	for _, rawURL := range cfg.Incremental {
+		item, err := readRestoreChainItem(ctx, &cfg.Config, rawURL)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		chain = append(chain, item)
+	}
+	if cfg.IncrementalRoot != "" {
+		found, err := discoverIncrementalBackups(ctx, &cfg.Config, cfg.IncrementalRoot, base.meta.EndVersion)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		chain = append(chain, found...)
+	}
+	if err = sortRestoreChain(chain); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return chain, nil
+}
+
+func readRestoreChainItem(ctx context.Context, cfg *Config, rawURL string) (*restoreChainItem, error) {
+	itemCfg := *cfg
+	itemCfg.Storage = rawURL
+	u, _, meta, err := ReadBackupMeta(ctx, utils.MetaFile, &itemCfg)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to read the backup %s", rawURL)
+	}
+	return &restoreChainItem{storage: rawURL, backend: u, meta: meta}, nil
+}
+
+// discoverIncrementalBackups finds the finished incremental backups under the
+// root which start at or after startVersion.
+func discoverIncrementalBackups(
+	ctx context.Context,
+	cfg *Config,
+	root string,
+	startVersion uint64,
+) ([]*restoreChainItem, error) {
+	rootCfg := *cfg
+	rootCfg.Storage = root
+	_, s, err := GetStorage(ctx, &rootCfg)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	sets, err := discoverBackupSets(ctx, s)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	var items []*restoreChainItem
+	for _, set := range sets {
+		if set.backupType() != backupTypeIncremental || set.meta.StartVersion < startVersion {
+			continue
+		}
+		u, err := storage.ParseRawURL(root)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		u.Path = path.Join(u.Path, set.dir)
+		item, err := readRestoreChainItem(ctx, cfg, u.String())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		log.Info("discover incremental backup",
+			zap.String("storage", item.storage),
+			zap.Uint64("start-version", item.meta.StartVersion),
+			zap.Uint64("end-version", item.meta.EndVersion))
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// sortRestoreChain sorts the incremental backups after the first backup by
+// the backup ts, and checks that each of them starts at the end of the
+// previous one.
+func sortRestoreChain(chain []*restoreChainItem) error {
+	incrementals := chain[1:]
+	sort.SliceStable(incrementals, func(i, j int) bool {
+		if incrementals[i].meta.StartVersion != incrementals[j].meta.StartVersion {
+			return incrementals[i].meta.StartVersion < incrementals[j].meta.StartVersion
+		}
+		return incrementals[i].meta.EndVersion < incrementals[j].meta.EndVersion
+	})
+	for i, item := range chain {
+		if item.meta.IsRawKv {
+			return errors.Annotatef(berrors.ErrRestoreModeMismatch,
+				"cannot do transactional restore from raw kv data %s", item.storage)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := chain[i-1]
+		if item.meta.StartVersion != prev.meta.EndVersion {
+			return errors.Annotatef(berrors.ErrRestoreBackupChainBroken,
+				"the backup %s starts at %d, but the previous backup %s ends at %d",
+				item.storage, item.meta.StartVersion, prev.storage, prev.meta.EndVersion)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gogo/protobuf/proto"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+var _ = Suite(&testRestoreChainSuite{})
+
+type testRestoreChainSuite struct{}
+
+func (s *testRestoreChainSuite) TestLoadRestoreChain(c *C) {
+	ctx := context.Background()
+	root := c.MkDir()
+	local, err := storage.NewLocalStorage(root)
+	c.Assert(err, IsNil)
+	for dir, versions := range map[string][2]uint64{
+		"full": {0, 100},
+		"inc1": {100, 200},
+		"inc2": {200, 300},
+		// it ends before the full backup.
+		"old": {50, 100},
+	} {
+		data, err := proto.Marshal(&backup.BackupMeta{StartVersion: versions[0], EndVersion: versions[1]})
+		c.Assert(err, IsNil)
+		c.Assert(local.Write(ctx, path.Join(dir, utils.MetaFile), data), IsNil)
+	}
+	url := func(dir string) string {
+		return "local://" + path.Join(root, dir)
+	}
+	versions := func(chain []*restoreChainItem) [][2]uint64 {
+		result := make([][2]uint64, 0, len(chain))
+		for _, item := range chain {
+			result = append(result, [2]uint64{item.meta.StartVersion, item.meta.EndVersion})
+		}
+		return result
+	}
+
+	cfg := &RestoreConfig{Config: Config{Storage: url("full")}}
+	chain, err := loadRestoreChain(ctx, cfg)
+	c.Assert(err, IsNil)
+	c.Assert(versions(chain), DeepEquals, [][2]uint64{{0, 100}})
+
+	// the incremental backups are sorted.
+	cfg.Incremental = []string{url("inc2"), url("inc1")}
+	chain, err = loadRestoreChain(ctx, cfg)
+	c.Assert(err, IsNil)
+	c.Assert(versions(chain), DeepEquals, [][2]uint64{{0, 100}, {100, 200}, {200, 300}})
+	c.Assert(chain[1].storage, Equals, url("inc1"))
+
+	cfg.Incremental = nil
+	cfg.IncrementalRoot = "local://" + root
+	chain, err = loadRestoreChain(ctx, cfg)
+	c.Assert(err, IsNil)
+	c.Assert(versions(chain), DeepEquals, [][2]uint64{{0, 100}, {100, 200}, {200, 300}})
+	c.Assert(chain[2].storage, Equals, url("inc2"))
+
+	// inc1 is missing.
+	cfg.Incremental = []string{url("inc2")}
+	cfg.IncrementalRoot = ""
+	_, err = loadRestoreChain(ctx, cfg)
+	c.Assert(berrors.ErrRestoreBackupChainBroken.Equal(err), IsTrue)
+
+	// inc1 is duplicated.
+	cfg.Incremental = []string{url("inc1"), url("inc1"), url("inc2")}
+	_, err = loadRestoreChain(ctx, cfg)
+	c.Assert(berrors.ErrRestoreBackupChainBroken.Equal(err), IsTrue)
+}
+
+func (s *testRestoreChainSuite) TestResumeChainCheckpoint(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	cfg := &RestoreConfig{Config: Config{Storage: "local://" + dir}}
+	full := &backup.BackupMeta{EndVersion: 100}
+	inc := &backup.BackupMeta{StartVersion: 100, EndVersion: 200}
+	rs := &restoreSession{chained: true}
+
+	// the full backup is restored, and the restore fails in the incremental
+	// backup after some progress.
+	checkpointer, err := newRestoreCheckpointer(ctx, 1, cfg, full)
+	c.Assert(err, IsNil)
+	c.Assert(rs.finishBackup(ctx, checkpointer), IsNil)
+	checkpointer, err = newRestoreCheckpointer(ctx, 1, cfg, inc)
+	c.Assert(err, IsNil)
+	checkpointer.MarkTSReset()
+	c.Assert(checkpointer.Flush(ctx), IsNil)
+
+	// the full backup is skipped on resume, and the incremental backup resumes
+	// from its own checkpoint.
+	cfg.Resume = true
+	rs = &restoreSession{chained: true}
+	checkpointer, err = newRestoreCheckpointer(ctx, 1, cfg, full)
+	c.Assert(err, IsNil)
+	c.Assert(checkpointer.IsFinished(), IsTrue)
+	rs.checkpointers = append(rs.checkpointers, checkpointer)
+	checkpointer, err = newRestoreCheckpointer(ctx, 1, cfg, inc)
+	c.Assert(err, IsNil)
+	c.Assert(checkpointer.IsFinished(), IsFalse)
+	c.Assert(checkpointer.IsTSReset(), IsTrue)
+	c.Assert(rs.finishBackup(ctx, checkpointer), IsNil)
+
+	// the checkpoints are removed after the whole chain is restored.
+	names := []string{"restore-1-100.checkpoint", "restore-1-200.checkpoint"}
+	for _, name := range names {
+		_, err = os.Stat(filepath.Join(dir, defaultCheckpointDir, name))
+		c.Assert(err, IsNil)
+	}
+	rs.removeCheckpoints(ctx)
+	for _, name := range names {
+		_, err = os.Stat(filepath.Join(dir, defaultCheckpointDir, name))
+		c.Assert(os.IsNotExist(err), IsTrue)
+	}
+}
@@ -26,6 +26,9 @@ const (
 	defaultFlushKVSize = 5 << 20
 	// represents kv that write to TiKV once at at time.
 	defaultWriteKV = 1280
+
+	// logRestoreCmdName is the task name in the notifications of log restore.
+	logRestoreCmdName = "Log restore"
 )
 
 // LogRestoreConfig is the configuration specific for restore tasks.
@@ -94,6 +97,14 @@ func (cfg *LogRestoreConfig) adjustRestoreConfig() {
 
 // RunLogRestore starts a restore task inside the current goroutine.
 func RunLogRestore(c context.Context, g glue.Glue, cfg *LogRestoreConfig) error {
+	err := runLogRestore(c, g, cfg)
+	cfg.Notify.notifyTaskFinished(logRestoreCmdName, err)
+	return errors.Trace(err)
+}
+
+// runLogRestore applies the cdc log backup without sending notifications, so
+// it can be a step of other restore tasks.
+func runLogRestore(c context.Context, g glue.Glue, cfg *LogRestoreConfig) error {
 	cfg.adjustRestoreConfig()
 
 	ctx, cancel := context.WithCancel(c)
@@ -105,7 +116,12 @@ func RunLogRestore(c context.Context, g glue.Glue, cfg *LogRestoreConfig) error
 	}
 	defer mgr.Close()
 
-	u, err := storage.ParseBackend(cfg.Storage, &cfg.BackendOptions)
+	// log restore reads the cdc logs on BR side, so storages which TiKV
+	// doesn't support are acceptable here.
+	s, err := storage.NewFromURL(ctx, cfg.Storage, &cfg.BackendOptions, &storage.ExternalStorageOptions{
+		SendCredentials: false,
+		SkipCheckPath:   false,
+	})
 	if err != nil {
 		return errors.Trace(err)
 	}
@@ -117,9 +133,7 @@ func RunLogRestore(c context.Context, g glue.Glue, cfg *LogRestoreConfig) error
 	}
 	defer client.Close()
 
-	if err = client.SetStorage(ctx, u, false); err != nil {
-		return errors.Trace(err)
-	}
+	client.SetExternalStorage(s)
 
 	err = client.LoadRestoreStores(ctx)
 	if err != nil {
@@ -0,0 +1,184 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/glue"
+	"github.com/Orion7r/pr/pkg/restore"
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/summary"
+)
+
+const (
+	flagFullBackup = "full-backup"
+	flagLog        = "log"
+	flagRestoredTS = "restored-ts"
+)
+
+// PointRestoreConfig is the configuration specific for point-in-time restore
+// tasks, which restore a snapshot backup and then apply the cdc log backup.
+type PointRestoreConfig struct {
+	RestoreConfig
+
+	FullBackupStorage string `json:"full-backup" toml:"full-backup"`
+	LogStorage        string `json:"log" toml:"log"`
+	// RestoredTS is the TS to restore to, it is the resolved TS of the log
+	// backup if it is zero.
+	RestoredTS uint64 `json:"restored-ts" toml:"restored-ts"`
+}
+
+// DefinePointRestoreFlags defines the flags for the point-in-time restore
+// command.
+func DefinePointRestoreFlags(command *cobra.Command) {
+	command.Flags().String(flagFullBackup, "",
+		"the url of the snapshot backup to restore, by default it is --"+flagStorage)
+	command.Flags().String(flagLog, "", "the url of the cdc log backup to apply after the snapshot backup")
+	command.Flags().String(flagRestoredTS, "",
+		"the time to restore to, support TSO or datetime, e.g. '400036290571534337', '2018-05-11 01:42:23', "+
+			"by default it is the resolved ts of the log backup")
+}
+
+// ParseFromFlags parses the point-in-time restore flags from the flag set.
+func (cfg *PointRestoreConfig) ParseFromFlags(flags *pflag.FlagSet) error {
+	if err := cfg.RestoreConfig.ParseFromFlags(flags); err != nil {
+		return errors.Trace(err)
+	}
+	var err error
+	cfg.FullBackupStorage, err = flags.GetString(flagFullBackup)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.FullBackupStorage == "" {
+		cfg.FullBackupStorage = cfg.Storage
+	}
+	if cfg.FullBackupStorage == "" {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "--%s is required", flagFullBackup)
+	}
+	cfg.Storage = cfg.FullBackupStorage
+	cfg.LogStorage, err = flags.GetString(flagLog)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.LogStorage == "" {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "--%s is required", flagLog)
+	}
+	restoredTS, err := flags.GetString(flagRestoredTS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if cfg.RestoredTS, err = parseTSString(restoredTS); err != nil {
+		return errors.Annotatef(berrors.ErrInvalidArgument, "invalid --%s %s: %v", flagRestoredTS, restoredTS, err)
+	}
+	// the log is applied to the original tables.
+	if len(cfg.Rename) > 0 || cfg.RenameFile != "" {
+		return errors.Annotatef(berrors.ErrInvalidArgument,
+			"--%s and --%s cannot be used in point-in-time restore", flagRename, flagRenameFile)
+	}
+	return nil
+}
+
+// checkPointRestoreTS checks that the log backup can bring the snapshot to
+// the restored TS, and returns the TS to restore to. The log backup must start
+// at or before the snapshot and end after it, and the restored TS must be
+// between the snapshot and the resolved TS. startTS is 0 if the log backup
+// has no events.
+func checkPointRestoreTS(snapshotTS, startTS, resolvedTS, restoredTS uint64) (uint64, error) {
+	if startTS > snapshotTS {
+		return 0, errors.Annotatef(berrors.ErrRestoreRTsConstrain,
+			"the log backup starts at %d, after the snapshot end version %d", startTS, snapshotTS)
+	}
+	if snapshotTS > resolvedTS {
+		return 0, errors.Annotatef(berrors.ErrRestoreRTsConstrain,
+			"the snapshot end version %d is greater than the resolved ts %d of the log backup", snapshotTS, resolvedTS)
+	}
+	if restoredTS == 0 {
+		return resolvedTS, nil
+	}
+	if restoredTS < snapshotTS {
+		return 0, errors.Annotatef(berrors.ErrRestoreRTsConstrain,
+			"the restored ts %d is less than the snapshot end version %d", restoredTS, snapshotTS)
+	}
+	if restoredTS > resolvedTS {
+		return 0, errors.Annotatef(berrors.ErrRestoreRTsConstrain,
+			"the restored ts %d is greater than the resolved ts %d of the log backup", restoredTS, resolvedTS)
+	}
+	return restoredTS, nil
+}
+
+// RunPointRestore restores the snapshot backup and the incremental backups
+// after it, and then applies the cdc log backup from the end version of the
+// snapshot to the restored TS with the same table filter. One summary is
+// reported for both steps.
+func RunPointRestore(c context.Context, g glue.Glue, cmdName string, cfg *PointRestoreConfig) (err error) {
+	defer summary.Summary(cmdName)
+	defer func() { cfg.Notify.notifyTaskFinished(cmdName, err) }()
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	// the log is applied after the last incremental backup if any.
+	chain, err := loadRestoreChain(ctx, &cfg.RestoreConfig)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	snapshotTS := chain[len(chain)-1].meta.EndVersion
+	logCfg := LogRestoreConfig{Config: cfg.Config}
+	logCfg.Storage = cfg.LogStorage
+	logStorage, err := storage.NewFromURL(ctx, logCfg.Storage, &logCfg.BackendOptions, &storage.ExternalStorageOptions{
+		SendCredentials: false,
+		SkipCheckPath:   false,
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	logMeta, err := restore.ReadLogMeta(ctx, logStorage)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	logStartTS, err := restore.ReadLogStartTS(ctx, logStorage, logMeta)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	restoredTS, err := checkPointRestoreTS(snapshotTS, logStartTS, logMeta.GlobalResolvedTS, cfg.RestoredTS)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	log.Info("point-in-time restore",
+		zap.Uint64("snapshot-ts", snapshotTS),
+		zap.Uint64("log-start-ts", logStartTS),
+		zap.Uint64("resolved-ts", logMeta.GlobalResolvedTS),
+		zap.Uint64("restored-ts", restoredTS))
+
+	start := time.Now()
+	if err = runRestore(ctx, g, cmdName, &cfg.RestoreConfig); err != nil {
+		return errors.Trace(err)
+	}
+	summary.CollectDuration("snapshot restore", time.Since(start))
+	if cfg.DryRun {
+		log.Info("skip applying the log backup in dry run")
+		return nil
+	}
+
+	// the snapshot restore marks the task success, reset it until the log is
+	// applied.
+	summary.SetSuccessStatus(false)
+	start = time.Now()
+	logCfg.StartTS = snapshotTS
+	logCfg.EndTS = restoredTS
+	if err = runLogRestore(ctx, g, &logCfg); err != nil {
+		return errors.Trace(err)
+	}
+	summary.CollectDuration("log restore", time.Since(start))
+	summary.CollectUint("restored ts", restoredTS)
+	summary.SetSuccessStatus(true)
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	. "github.com/pingcap/check"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+)
+
+var _ = Suite(&testPointRestoreSuite{})
+
+type testPointRestoreSuite struct{}
+
+func (s *testPointRestoreSuite) TestCheckPointRestoreTS(c *C) {
+	ts, err := checkPointRestoreTS(100, 50, 200, 0)
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, uint64(200))
+
+	ts, err = checkPointRestoreTS(100, 50, 200, 150)
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, uint64(150))
+
+	ts, err = checkPointRestoreTS(100, 50, 100, 100)
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, uint64(100))
+
+	// the log backup doesn't cover the snapshot.
+	_, err = checkPointRestoreTS(300, 50, 200, 0)
+	c.Assert(berrors.ErrRestoreRTsConstrain.Equal(err), IsTrue)
+	// the restored ts is before the snapshot.
+	_, err = checkPointRestoreTS(100, 50, 200, 50)
+	c.Assert(berrors.ErrRestoreRTsConstrain.Equal(err), IsTrue)
+	// the log backup starts after the snapshot.
+	_, err = checkPointRestoreTS(100, 150, 200, 0)
+	c.Assert(berrors.ErrRestoreRTsConstrain.Equal(err), IsTrue)
+	ts, err = checkPointRestoreTS(100, 100, 200, 0)
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, uint64(200))
+	// the log backup has no events.
+	ts, err = checkPointRestoreTS(100, 0, 200, 0)
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, uint64(200))
+	// the restored ts is beyond the log backup.
+	_, err = checkPointRestoreTS(100, 50, 200, 250)
+	c.Assert(berrors.ErrRestoreRTsConstrain.Equal(err), IsTrue)
+}
@@ -59,6 +59,7 @@ func RunRestoreRaw(c context.Context, g glue.Glue, cmdName string, cfg *RestoreR
 	cfg.adjust()
 
 	defer summary.Summary(cmdName)
+	defer func() { cfg.Notify.notifyTaskFinished(cmdName, err) }()
 	ctx, cancel := context.WithCancel(c)
 	defer cancel()
 
@@ -88,6 +89,7 @@ func RunRestoreRaw(c context.Context, g glue.Glue, cmdName string, cfg *RestoreR
 	if err != nil {
 		return errors.Trace(err)
 	}
+	collectBackupPath(u)
 	g.Record("Size", utils.ArchiveSize(backupMeta))
 	if err = client.InitBackupMeta(backupMeta, u); err != nil {
 		return errors.Trace(err)
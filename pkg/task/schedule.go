@@ -0,0 +1,81 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+// startRateLimitSchedule follows --ratelimit-schedule if it is set. At every
+// boundary of the windows, the rate limit of the task is changed by the
+// control registered by registerTaskControls, the task is paused or resumed,
+// and holdNormalMode is called if it is not nil. Out of the windows, the rate
+// limit falls back to --ratelimit. It returns a function to stop following
+// the schedule, which should be called before the controls are unregistered.
+func startRateLimitSchedule(
+	ctx context.Context,
+	cfg *Config,
+	holdNormalMode func(ctx context.Context, hold bool) error,
+) (stop func(), err error) {
+	if cfg.RateLimitSchedule == "" {
+		return func() {}, nil
+	}
+	schedule, err := utils.ParseRateLimitSchedule(cfg.RateLimitSchedule)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		paused := false
+		for {
+			now := time.Now()
+			window, ok, next := schedule.At(now)
+			rateLimit := cfg.RateLimit
+			if ok {
+				rateLimit = window.RateLimit
+				log.Info("enter rate limit window", zap.Stringer("window", window), zap.Time("next", next))
+			} else {
+				log.Info("out of rate limit windows", zap.Uint64("rate-limit", rateLimit), zap.Time("next", next))
+			}
+			err := utils.SetTaskControls(map[string]uint64{controlRateLimit: rateLimit})
+			if err != nil {
+				log.Warn("failed to set rate limit by schedule", zap.Error(err))
+			}
+			if holdNormalMode != nil {
+				if err = holdNormalMode(ctx, ok && window.NormalMode); err != nil {
+					log.Warn("failed to switch tikv mode by schedule", zap.Error(err))
+				}
+			}
+			pause := ok && window.Pause
+			if pause && !paused {
+				utils.PauseTask()
+			} else if !pause && paused {
+				utils.ResumeTask()
+			}
+			paused = pause
+
+			select {
+			case <-ctx.Done():
+				if paused {
+					utils.ResumeTask()
+				}
+				return
+			case <-time.After(time.Until(next)):
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
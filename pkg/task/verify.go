@@ -0,0 +1,327 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/DigitalChinaOpenSource/DCParser/model"
+	"github.com/pingcap/errors"
+	kvproto "github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Orion7r/pr/pkg/backup"
+	berrors "github.com/Orion7r/pr/pkg/errors"
+	"github.com/Orion7r/pr/pkg/rtree"
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+const defaultVerifyConcurrency = 16
+
+// The types of the problems found by the verify task.
+const (
+	problemMissingFile     = "missing-file"
+	problemSizeMismatch    = "size-mismatch"
+	problemSHA256Mismatch  = "sha256-mismatch"
+	problemOrphanFile      = "orphan-file"
+	problemOverlappedRange = "overlapped-range"
+	problemChecksum        = "checksum-mismatch"
+)
+
+// VerifyProblem is a problem of the backup found by the verify task.
+type VerifyProblem struct {
+	Type    string `json:"type"`
+	File    string `json:"file,omitempty"`
+	Table   string `json:"table,omitempty"`
+	Message string `json:"message"`
+}
+
+// VerifyReport is the report of the verify task.
+type VerifyReport struct {
+	Path         string           `json:"path"`
+	Files        int              `json:"files"`
+	VerifiedSize uint64           `json:"verified-size"`
+	Tables       int              `json:"tables"`
+	Problems     []*VerifyProblem `json:"problems"`
+}
+
+func (r *VerifyReport) addProblem(tp, file, table, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, &VerifyProblem{
+		Type:    tp,
+		File:    file,
+		Table:   table,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// RunVerify verifies the integrity of the backup without the cluster, and
+// writes the report to out. It returns an error if any problem is found.
+func RunVerify(c context.Context, cfg *Config, out io.Writer) error {
+	ctx, cancel := context.WithCancel(c)
+	defer cancel()
+
+	s, backupMeta, err := ReadExternalBackupMeta(ctx, utils.MetaFile, cfg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	sizes, err := walkFileSizes(ctx, s)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	report := &VerifyReport{
+		Path:     s.URI(),
+		Files:    len(backupMeta.Files),
+		Problems: make([]*VerifyProblem, 0),
+	}
+	statsFiles, err := backupStatsFiles(backupMeta)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	manifests, err := backupTableManifests(backupMeta)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	verifyFileSizes(report, backupMeta, statsFiles, sizes)
+	verifyOrphanFiles(report, backupMeta, append(statsFiles, manifests...), sizes)
+	verifyRanges(report, backupMeta)
+	if err = verifyTableChecksums(report, backupMeta); err != nil {
+		return errors.Trace(err)
+	}
+
+	concurrency := uint(cfg.Concurrency)
+	if concurrency == 0 {
+		concurrency = defaultVerifyConcurrency
+	}
+	// SST files are written by TiKV, they are never encrypted.
+	if err = verifySHA256(ctx, report, storage.WithoutEncryption(s), backupMeta, sizes, concurrency); err != nil {
+		return errors.Trace(err)
+	}
+
+	sort.Slice(report.Problems, func(i, j int) bool {
+		pi, pj := report.Problems[i], report.Problems[j]
+		if pi.Type != pj.Type {
+			return pi.Type < pj.Type
+		}
+		if pi.File != pj.File {
+			return pi.File < pj.File
+		}
+		return pi.Table < pj.Table
+	})
+	if err = writeJSON(out, report); err != nil {
+		return errors.Trace(err)
+	}
+	if len(report.Problems) > 0 {
+		return errors.Annotatef(berrors.ErrBackupVerifyFailed, "found %d problems in the backup", len(report.Problems))
+	}
+	return nil
+}
+
+// backupStatsFiles returns the statistics files referenced by the schemas.
+func backupStatsFiles(meta *kvproto.BackupMeta) ([]string, error) {
+	var files []string
+	for _, schema := range meta.Schemas {
+		_, file, err := utils.ParseStats(schema.Stats)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// backupTableManifests returns the table manifests of the schemas if the
+// backup is in the table layout.
+func backupTableManifests(meta *kvproto.BackupMeta) ([]string, error) {
+	files := make([]string, 0, len(meta.Schemas))
+	for _, schema := range meta.Schemas {
+		if schema.Table == nil {
+			continue
+		}
+		dbInfo := &model.DBInfo{}
+		if err := json.Unmarshal(schema.Db, dbInfo); err != nil {
+			return nil, errors.Trace(err)
+		}
+		tableInfo := &model.TableInfo{}
+		if err := json.Unmarshal(schema.Table, tableInfo); err != nil {
+			return nil, errors.Trace(err)
+		}
+		files = append(files, path.Join(backup.TableDir(dbInfo.Name.O, tableInfo.Name.O), utils.TableManifestFile))
+	}
+	return files, nil
+}
+
+// verifyFileSizes checks every file in the backupmeta exists with the expected
+// size, and the statistics files exist.
+func verifyFileSizes(report *VerifyReport, meta *kvproto.BackupMeta, statsFiles []string, sizes map[string]int64) {
+	for _, name := range statsFiles {
+		if _, ok := sizes[name]; !ok {
+			report.addProblem(problemMissingFile, name, "", "the statistics file does not exist")
+		}
+	}
+	for _, file := range meta.Files {
+		size, ok := sizes[file.Name]
+		if !ok {
+			report.addProblem(problemMissingFile, file.Name, "", "the file does not exist")
+			continue
+		}
+		// the size is not recorded by the old version of TiKV.
+		if file.Size_ != 0 && uint64(size) != file.Size_ {
+			report.addProblem(problemSizeMismatch, file.Name, "",
+				"the size is %d, but the size in backupmeta is %d", size, file.Size_)
+		}
+	}
+}
+
+// isBRFile checks whether the file is written by BR rather than TiKV.
+func isBRFile(name string) bool {
+	switch name {
+	case utils.MetaFile, utils.MetaJSONFile, utils.SavedMetaFile, utils.LockFile, utils.CheckpointFile,
+		utils.PlacementRulesFile:
+		return true
+	}
+	return strings.HasPrefix(name, defaultCheckpointDir+"/")
+}
+
+// verifyOrphanFiles checks every file in the backup is referenced by the backupmeta.
+// The files of the backups nested in the directory are not orphans, and the
+// files written by BR, e.g. the statistics files and the table manifests, are
+// passed in brFiles.
+func verifyOrphanFiles(report *VerifyReport, meta *kvproto.BackupMeta, brFiles []string, sizes map[string]int64) {
+	set, ok := groupBackupSets(sizes)[""]
+	if !ok {
+		return
+	}
+	referenced := make(map[string]struct{}, len(meta.Files))
+	for _, file := range meta.Files {
+		referenced[file.Name] = struct{}{}
+	}
+	for _, name := range brFiles {
+		referenced[name] = struct{}{}
+	}
+	for _, name := range set.files {
+		if _, ok := referenced[name]; ok || isBRFile(name) {
+			continue
+		}
+		report.addProblem(problemOrphanFile, name, "", "the file is not referenced by backupmeta")
+	}
+}
+
+// verifyRanges checks the ranges of the files are not overlapped. The files of
+// the different column families in the same range share the range.
+func verifyRanges(report *VerifyReport, meta *kvproto.BackupMeta) {
+	tree := rtree.NewRangeTree()
+	for _, file := range meta.Files {
+		rg := rtree.Range{StartKey: file.StartKey, EndKey: file.EndKey}
+		out := tree.InsertRange(rg)
+		// only the same range of the different column families is not overlapped.
+		if out != nil && !(bytes.Equal(out.StartKey, rg.StartKey) && bytes.Equal(out.EndKey, rg.EndKey)) {
+			report.addProblem(problemOverlappedRange, file.Name, "",
+				"the range %s is overlapped with the range %s", rg.String(), out.String())
+		}
+	}
+	ranges := tree.GetSortedRanges()
+	for i := 1; i < len(ranges); i++ {
+		prev, cur := ranges[i-1], ranges[i]
+		if len(prev.EndKey) == 0 || bytes.Compare(prev.EndKey, cur.StartKey) > 0 {
+			report.addProblem(problemOverlappedRange, "", "",
+				"the range %s is overlapped with the range %s", prev.String(), cur.String())
+		}
+	}
+}
+
+// verifyTableChecksums recomputes the checksum of every table from the files,
+// and compares it with the checksum in the schema.
+func verifyTableChecksums(report *VerifyReport, meta *kvproto.BackupMeta) error {
+	dbs, err := utils.LoadBackupTables(meta)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, db := range dbs {
+		for _, table := range db.Tables {
+			report.Tables++
+			if table.NoChecksum() {
+				continue
+			}
+			var crc64Xor, totalKvs, totalBytes uint64
+			for _, file := range table.Files {
+				crc64Xor ^= file.Crc64Xor
+				totalKvs += file.TotalKvs
+				totalBytes += file.TotalBytes
+			}
+			if crc64Xor != table.Crc64Xor || totalKvs != table.TotalKvs || totalBytes != table.TotalBytes {
+				report.addProblem(problemChecksum, "", utils.EncloseName(db.Info.Name.O)+"."+utils.EncloseName(table.Info.Name.O),
+					"the checksum of files is (crc64xor: %d, kvs: %d, bytes: %d), "+
+						"but the checksum in schema is (crc64xor: %d, kvs: %d, bytes: %d)",
+					crc64Xor, totalKvs, totalBytes, table.Crc64Xor, table.TotalKvs, table.TotalBytes)
+			}
+		}
+	}
+	return nil
+}
+
+// verifySHA256 checks the SHA256 of the existing files concurrently.
+func verifySHA256(
+	ctx context.Context,
+	report *VerifyReport,
+	s storage.ExternalStorage,
+	meta *kvproto.BackupMeta,
+	sizes map[string]int64,
+	concurrency uint,
+) error {
+	var mu sync.Mutex
+	pool := utils.NewWorkerPool(concurrency, "verify")
+	eg, ectx := errgroup.WithContext(ctx)
+	for _, f := range meta.Files {
+		file := f
+		if _, ok := sizes[file.Name]; !ok || len(file.Sha256) == 0 {
+			continue
+		}
+		pool.ApplyOnErrorGroup(eg, func() error {
+			checksum, size, err := sha256File(ectx, s, file.Name)
+			if err != nil {
+				return errors.Annotatef(err, "failed to read %s", file.Name)
+			}
+			log.Debug("file verified", zap.String("file", file.Name), zap.Int64("size", size))
+			mu.Lock()
+			defer mu.Unlock()
+			report.VerifiedSize += uint64(size)
+			if !bytes.Equal(checksum, file.Sha256) {
+				report.addProblem(problemSHA256Mismatch, file.Name, "",
+					"the sha256 is %s, but the sha256 in backupmeta is %s",
+					hex.EncodeToString(checksum), hex.EncodeToString(file.Sha256))
+			}
+			return nil
+		})
+	}
+	return errors.Trace(eg.Wait())
+}
+
+func sha256File(ctx context.Context, s storage.ExternalStorage, name string) ([]byte, int64, error) {
+	reader, err := s.Open(ctx, name)
+	if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	defer reader.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	return hash.Sum(nil), size, nil
+}
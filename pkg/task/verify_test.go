@@ -0,0 +1,162 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+
+	"github.com/gogo/protobuf/proto"
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/backup"
+	"github.com/pingcap/tidb/tablecodec"
+
+	"github.com/Orion7r/pr/pkg/storage"
+	"github.com/Orion7r/pr/pkg/utils"
+)
+
+var _ = Suite(&testVerifySuite{})
+
+type testVerifySuite struct{}
+
+func mockBackupFile(name string, data []byte, start, end string, kvs uint64) *backup.File {
+	checksum := sha256.Sum256(data)
+	prefix := tablecodec.EncodeTablePrefix(1)
+	return &backup.File{
+		Name:       name,
+		Sha256:     checksum[:],
+		Size_:      uint64(len(data)),
+		StartKey:   append(append([]byte{}, prefix...), start...),
+		EndKey:     append(append([]byte{}, prefix...), end...),
+		Crc64Xor:   kvs,
+		TotalKvs:   kvs,
+		TotalBytes: 10 * kvs,
+	}
+}
+
+func (s *testVerifySuite) runVerify(c *C, dir string, meta *backup.BackupMeta) (*VerifyReport, error) {
+	ctx := context.Background()
+	local, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+	data, err := proto.Marshal(meta)
+	c.Assert(err, IsNil)
+	c.Assert(local.Write(ctx, utils.MetaFile, data), IsNil)
+
+	out := &bytes.Buffer{}
+	err = RunVerify(ctx, &Config{Storage: "local://" + dir}, out)
+	report := &VerifyReport{}
+	c.Assert(json.Unmarshal(out.Bytes(), report), IsNil)
+	return report, err
+}
+
+func (s *testVerifySuite) TestVerify(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	local, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+
+	files := []*backup.File{
+		mockBackupFile("1_default.sst", []byte("default-1"), "a", "c", 1),
+		mockBackupFile("1_write.sst", []byte("write-1"), "a", "c", 2),
+		mockBackupFile("2_write.sst", []byte("write-2"), "c", "e", 4),
+	}
+	c.Assert(local.Write(ctx, "1_default.sst", []byte("default-1")), IsNil)
+	c.Assert(local.Write(ctx, "1_write.sst", []byte("write-1")), IsNil)
+	c.Assert(local.Write(ctx, "2_write.sst", []byte("write-2")), IsNil)
+	c.Assert(local.Write(ctx, utils.LockFile, []byte("lock")), IsNil)
+	c.Assert(local.Write(ctx, utils.PlacementRulesFile, []byte("{}")), IsNil)
+	c.Assert(local.Write(ctx, "stats_1.json.gz", []byte("stats")), IsNil)
+	// the checksum of the table is the xor of 1, 2 and 4.
+	schema := mockBackupSchema(c, "test", "t", 1, 7)
+	schema.Stats, err = json.Marshal(&utils.StatsFile{Name: "stats_1.json.gz"})
+	c.Assert(err, IsNil)
+	meta := &backup.BackupMeta{Files: files, Schemas: []*backup.Schema{schema}}
+
+	report, err := s.runVerify(c, dir, meta)
+	c.Assert(err, IsNil)
+	c.Assert(report.Files, Equals, 3)
+	c.Assert(report.Tables, Equals, 1)
+	c.Assert(report.VerifiedSize, Equals, uint64(len("default-1")+len("write-1")+len("write-2")))
+	c.Assert(report.Problems, HasLen, 0)
+
+	// break the backup.
+	c.Assert(local.Write(ctx, "2_write.sst", []byte("write-x")), IsNil)
+	c.Assert(local.Write(ctx, "orphan.sst", []byte("orphan")), IsNil)
+	meta.Files = append(meta.Files, mockBackupFile("3_write.sst", []byte("write-3"), "d", "f", 8))
+	report, err = s.runVerify(c, dir, meta)
+	c.Assert(err, ErrorMatches, ".*found 5 problems in the backup.*")
+	types := make([]string, 0, len(report.Problems))
+	for _, problem := range report.Problems {
+		types = append(types, problem.Type+":"+problem.File+problem.Table)
+	}
+	c.Assert(types, DeepEquals, []string{
+		problemChecksum + ":`test`.`t`",
+		problemMissingFile + ":3_write.sst",
+		problemOrphanFile + ":orphan.sst",
+		problemOverlappedRange + ":",
+		problemSHA256Mismatch + ":2_write.sst",
+	})
+}
+
+func (s *testVerifySuite) TestVerifyTableLayout(c *C) {
+	ctx := context.Background()
+	dir := c.MkDir()
+	local, err := storage.NewLocalStorage(dir)
+	c.Assert(err, IsNil)
+
+	files := []*backup.File{
+		mockBackupFile("test/t/1_default.sst", []byte("default-1"), "a", "c", 3),
+		mockBackupFile("test/t/1_write.sst", []byte("write-1"), "a", "c", 4),
+	}
+	c.Assert(local.Write(ctx, "test/t/1_default.sst", []byte("default-1")), IsNil)
+	c.Assert(local.Write(ctx, "test/t/1_write.sst", []byte("write-1")), IsNil)
+	c.Assert(local.Write(ctx, "test/t/"+utils.TableManifestFile, []byte("{}")), IsNil)
+	c.Assert(local.Write(ctx, "test/empty/"+utils.TableManifestFile, []byte("{}")), IsNil)
+	meta := &backup.BackupMeta{Files: files, Schemas: []*backup.Schema{
+		mockBackupSchema(c, "test", "t", 1, 7),
+		mockBackupSchema(c, "test", "empty", 2, 0),
+	}}
+
+	report, err := s.runVerify(c, dir, meta)
+	c.Assert(err, IsNil)
+	c.Assert(report.Tables, Equals, 2)
+	c.Assert(report.Problems, HasLen, 0)
+
+	// the manifest of a table not in the backup is an orphan.
+	c.Assert(local.Write(ctx, "test/dropped/"+utils.TableManifestFile, []byte("{}")), IsNil)
+	report, err = s.runVerify(c, dir, meta)
+	c.Assert(err, NotNil)
+	c.Assert(report.Problems, HasLen, 1)
+	c.Assert(report.Problems[0].Type, Equals, problemOrphanFile)
+	c.Assert(report.Problems[0].File, Equals, "test/dropped/"+utils.TableManifestFile)
+}
+
+func (s *testVerifySuite) TestVerifyRanges(c *C) {
+	report := &VerifyReport{}
+	verifyRanges(report, &backup.BackupMeta{Files: []*backup.File{
+		mockBackupFile("1_default.sst", nil, "a", "c", 1),
+		mockBackupFile("1_write.sst", nil, "a", "c", 1),
+		mockBackupFile("2_write.sst", nil, "c", "e", 1),
+	}})
+	c.Assert(report.Problems, HasLen, 0)
+
+	// the ranges with the same end key are overlapped.
+	report = &VerifyReport{}
+	verifyRanges(report, &backup.BackupMeta{Files: []*backup.File{
+		mockBackupFile("1_write.sst", nil, "a", "c", 1),
+		mockBackupFile("2_write.sst", nil, "b", "c", 1),
+	}})
+	c.Assert(report.Problems, HasLen, 1)
+	c.Assert(report.Problems[0].Type, Equals, problemOverlappedRange)
+
+	// the ranges with the same start key are overlapped.
+	report = &VerifyReport{}
+	verifyRanges(report, &backup.BackupMeta{Files: []*backup.File{
+		mockBackupFile("1_write.sst", nil, "a", "c", 1),
+		mockBackupFile("2_write.sst", nil, "a", "d", 1),
+	}})
+	c.Assert(report.Problems, HasLen, 1)
+	c.Assert(report.Problems[0].File, Equals, "2_write.sst")
+}
@@ -0,0 +1,384 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/opentracing/basictracer-go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// otlpBatchSize is the max number of the spans exported in one request.
+	otlpBatchSize = 512
+	// otlpFlushInterval is the interval to export the spans.
+	otlpFlushInterval = 5 * time.Second
+	// otlpQueueSize is the max number of the spans waiting to be exported,
+	// the spans are dropped if the queue is full.
+	otlpQueueSize = 8192
+	// otlpTimeout is the timeout of exporting a batch of spans.
+	otlpTimeout = 10 * time.Second
+)
+
+// Span is a finished span in the trace file.
+type Span struct {
+	TraceID      string                 `json:"trace-id"`
+	SpanID       string                 `json:"span-id"`
+	ParentSpanID string                 `json:"parent-span-id,omitempty"`
+	Operation    string                 `json:"operation"`
+	Start        time.Time              `json:"start"`
+	Duration     float64                `json:"duration"`
+	Tags         map[string]interface{} `json:"tags,omitempty"`
+	Logs         []SpanLog              `json:"logs,omitempty"`
+}
+
+// SpanLog is a log of the span in the trace file.
+type SpanLog struct {
+	Time   time.Time              `json:"time"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+func formatID(id uint64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+// newSpan converts the raw span, the duration is in seconds.
+func newSpan(raw basictracer.RawSpan) *Span {
+	span := &Span{
+		TraceID:   formatID(raw.Context.TraceID),
+		SpanID:    formatID(raw.Context.SpanID),
+		Operation: raw.Operation,
+		Start:     raw.Start,
+		Duration:  raw.Duration.Seconds(),
+		Tags:      raw.Tags,
+	}
+	if raw.ParentSpanID != 0 {
+		span.ParentSpanID = formatID(raw.ParentSpanID)
+	}
+	for _, l := range raw.Logs {
+		span.Logs = append(span.Logs, SpanLog{Time: l.Timestamp, Fields: logFields(l)})
+	}
+	return span
+}
+
+func logFields(l opentracing.LogRecord) map[string]interface{} {
+	fields := make(map[string]interface{}, len(l.Fields))
+	for _, f := range l.Fields {
+		fields[f.Key()] = f.Value()
+	}
+	return fields
+}
+
+// fileRecorder writes the spans to a local file in newline-delimited JSON.
+type fileRecorder struct {
+	mu sync.Mutex
+	f  *os.File
+	w  *bufio.Writer
+}
+
+// NewFileRecorder returns a recorder writing the spans to the file in
+// newline-delimited JSON, so the trace can be inspected offline.
+func NewFileRecorder(path string) (Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to open the trace file %s", path)
+	}
+	return &fileRecorder{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (r *fileRecorder) RecordSpan(raw basictracer.RawSpan) {
+	data, err := json.Marshal(newSpan(raw))
+	if err != nil {
+		log.Warn("failed to marshal span", zap.String("operation", raw.Operation), zap.Error(err))
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err = r.w.Write(append(data, '\n')); err != nil {
+		log.Warn("failed to write span", zap.String("operation", raw.Operation), zap.Error(err))
+	}
+}
+
+func (r *fileRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.w.Flush(); err != nil {
+		_ = r.f.Close()
+		return errors.Trace(err)
+	}
+	return errors.Trace(r.f.Close())
+}
+
+// otlpRecorder exports the spans to an OpenTelemetry collector by OTLP/HTTP
+// in JSON encoding.
+type otlpRecorder struct {
+	endpoint string
+	service  string
+	client   *http.Client
+
+	// mu protects sending to the spans channel after it is closed.
+	mu      sync.RWMutex
+	closed  bool
+	spans   chan basictracer.RawSpan
+	done    chan struct{}
+	dropped int64
+}
+
+// NewOTLPRecorder returns a recorder exporting the spans to the OTLP/HTTP
+// endpoint in batches, e.g. "http://127.0.0.1:4318/v1/traces".
+func NewOTLPRecorder(endpoint, service string) Recorder {
+	r := &otlpRecorder{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{Timeout: otlpTimeout},
+		spans:    make(chan basictracer.RawSpan, otlpQueueSize),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *otlpRecorder) RecordSpan(raw basictracer.RawSpan) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		atomic.AddInt64(&r.dropped, 1)
+		return
+	}
+	select {
+	case r.spans <- raw:
+	default:
+		// don't block the traced code if the collector is slow.
+		atomic.AddInt64(&r.dropped, 1)
+	}
+}
+
+func (r *otlpRecorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]basictracer.RawSpan, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.export(batch); err != nil {
+			log.Warn("failed to export spans",
+				zap.String("endpoint", r.endpoint), zap.Int("spans", len(batch)), zap.Error(err))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case raw, ok := <-r.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, raw)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (r *otlpRecorder) export(batch []basictracer.RawSpan) error {
+	data, err := json.Marshal(newOTLPRequest(r.service, batch))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), otlpTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("the collector responds %s", resp.Status)
+	}
+	return nil
+}
+
+// Close exports the remaining spans, the spans recorded after it are dropped.
+func (r *otlpRecorder) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.spans)
+	}
+	r.mu.Unlock()
+	<-r.done
+	if dropped := atomic.LoadInt64(&r.dropped); dropped > 0 {
+		log.Warn("some spans are dropped", zap.Int64("dropped", dropped))
+	}
+	return nil
+}
+
+// The following types are the JSON encoding of the OTLP trace request, see
+// https://github.com/open-telemetry/opentelemetry-proto.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeError  = 2
+)
+
+func newOTLPRequest(service string, batch []basictracer.RawSpan) *otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, raw := range batch {
+		spans = append(spans, newOTLPSpan(raw))
+	}
+	return &otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{newOTLPKeyValue("service.name", service)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: service}, Spans: spans}},
+	}}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func newOTLPSpan(raw basictracer.RawSpan) otlpSpan {
+	span := otlpSpan{
+		// the trace ID of OTLP is 16 bytes.
+		TraceID:           formatID(0) + formatID(raw.Context.TraceID),
+		SpanID:            formatID(raw.Context.SpanID),
+		Name:              raw.Operation,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: unixNano(raw.Start),
+		EndTimeUnixNano:   unixNano(raw.Start.Add(raw.Duration)),
+	}
+	if raw.ParentSpanID != 0 {
+		span.ParentSpanID = formatID(raw.ParentSpanID)
+	}
+	for key, value := range raw.Tags {
+		span.Attributes = append(span.Attributes, newOTLPKeyValue(key, value))
+	}
+	if failed, ok := raw.Tags["error"].(bool); ok && failed {
+		span.Status = &otlpStatus{Code: otlpStatusCodeError}
+		if msg, ok := raw.Tags["error.message"].(string); ok {
+			span.Status.Message = msg
+		}
+	}
+	for _, l := range raw.Logs {
+		event := otlpEvent{TimeUnixNano: unixNano(l.Timestamp), Name: "log"}
+		for key, value := range logFields(l) {
+			event.Attributes = append(event.Attributes, newOTLPKeyValue(key, value))
+		}
+		span.Events = append(span.Events, event)
+	}
+	return span
+}
+
+func newOTLPKeyValue(key string, value interface{}) otlpKeyValue {
+	kv := otlpKeyValue{Key: key}
+	switch v := value.(type) {
+	case string:
+		kv.Value.StringValue = &v
+	case bool:
+		kv.Value.BoolValue = &v
+	case int:
+		s := strconv.FormatInt(int64(v), 10)
+		kv.Value.IntValue = &s
+	case int32:
+		s := strconv.FormatInt(int64(v), 10)
+		kv.Value.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		kv.Value.IntValue = &s
+	case uint32:
+		s := strconv.FormatUint(uint64(v), 10)
+		kv.Value.IntValue = &s
+	case uint64:
+		// the int value of OTLP is int64.
+		s := strconv.FormatUint(v, 10)
+		kv.Value.StringValue = &s
+	case float64:
+		kv.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		kv.Value.StringValue = &s
+	}
+	return kv
+}
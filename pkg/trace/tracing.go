@@ -0,0 +1,88 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package trace
+
+import (
+	"context"
+
+	"github.com/opentracing/basictracer-go"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/errors"
+	"go.uber.org/multierr"
+
+	"github.com/Orion7r/pr/pkg/redact"
+)
+
+// Recorder records the finished spans, and exports them when it is closed.
+type Recorder interface {
+	basictracer.SpanRecorder
+	Close() error
+}
+
+// NewTracer returns a tracer which records all spans by the recorder.
+func NewTracer(recorder Recorder) opentracing.Tracer {
+	opts := basictracer.DefaultOptions()
+	// the tracing is enabled explicitly, so sample all traces.
+	opts.ShouldSample = func(uint64) bool { return true }
+	opts.Recorder = recorder
+	return basictracer.NewWithOptions(opts)
+}
+
+// StartSpan starts a child span of the span in ctx, and returns the context
+// with the child span. If there is no span in ctx, i.e. the tracing is
+// disabled, it returns a noop span and ctx unchanged, so the span costs
+// nothing.
+func StartSpan(
+	ctx context.Context,
+	operation string,
+	opts ...opentracing.StartSpanOption,
+) (opentracing.Span, context.Context) {
+	parent := opentracing.SpanFromContext(ctx)
+	if parent == nil {
+		return opentracing.NoopTracer{}.StartSpan(operation), ctx
+	}
+	opts = append(opts, opentracing.ChildOf(parent.Context()))
+	span := parent.Tracer().StartSpan(operation, opts...)
+	return span, opentracing.ContextWithSpan(ctx, span)
+}
+
+// FinishSpan marks the span failed if err isn't nil and finishes it.
+func FinishSpan(span opentracing.Span, err error) {
+	if err != nil {
+		span.SetTag("error", true)
+		span.SetTag("error.message", err.Error())
+	}
+	span.Finish()
+}
+
+type multiRecorder []Recorder
+
+// NewMultiRecorder returns a recorder which records the spans by all of the
+// recorders.
+func NewMultiRecorder(recorders ...Recorder) Recorder {
+	if len(recorders) == 1 {
+		return recorders[0]
+	}
+	return multiRecorder(recorders)
+}
+
+func (m multiRecorder) RecordSpan(span basictracer.RawSpan) {
+	for _, r := range m {
+		r.RecordSpan(span)
+	}
+}
+
+func (m multiRecorder) Close() error {
+	var err error
+	for _, r := range m {
+		err = multierr.Append(err, r.Close())
+	}
+	return errors.Trace(err)
+}
+
+// SetRangeTags sets the start key and the end key of the range processed by
+// the span, the keys are redacted if the log is redacted.
+func SetRangeTags(span opentracing.Span, startKey, endKey []byte) {
+	span.SetTag("start-key", redact.Key(startKey))
+	span.SetTag("end-key", redact.Key(endKey))
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	. "github.com/pingcap/check"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testTraceSuite{})
+
+type testTraceSuite struct{}
+
+// traceTask starts a root span and a child span, the child span fails.
+func traceTask(recorder Recorder) {
+	root := NewTracer(recorder).StartSpan("root")
+	ctx := opentracing.ContextWithSpan(context.Background(), root)
+	span, _ := StartSpan(ctx, "child")
+	span.SetTag("table", "t")
+	SetRangeTags(span, []byte{0x74}, []byte{0x75})
+	FinishSpan(span, errors.New("injected"))
+	root.Finish()
+}
+
+func (s *testTraceSuite) TestStartSpanWithoutParent(c *C) {
+	ctx := context.Background()
+	span, ctx1 := StartSpan(ctx, "noop")
+	c.Assert(span, Equals, opentracing.Span(opentracing.NoopTracer{}.StartSpan("noop")))
+	c.Assert(ctx1, Equals, ctx)
+	FinishSpan(span, errors.New("injected"))
+}
+
+func (s *testTraceSuite) TestFileRecorder(c *C) {
+	path := filepath.Join(c.MkDir(), "trace.json")
+	recorder, err := NewFileRecorder(path)
+	c.Assert(err, IsNil)
+	traceTask(recorder)
+	c.Assert(recorder.Close(), IsNil)
+
+	f, err := os.Open(path)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	var spans []*Span
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		span := &Span{}
+		c.Assert(json.Unmarshal(scanner.Bytes(), span), IsNil)
+		spans = append(spans, span)
+	}
+	c.Assert(scanner.Err(), IsNil)
+	c.Assert(spans, HasLen, 2)
+
+	// the child finishes first.
+	child, root := spans[0], spans[1]
+	c.Assert(child.Operation, Equals, "child")
+	c.Assert(root.Operation, Equals, "root")
+	c.Assert(child.TraceID, Equals, root.TraceID)
+	c.Assert(child.ParentSpanID, Equals, root.SpanID)
+	c.Assert(root.ParentSpanID, Equals, "")
+	c.Assert(child.Tags, DeepEquals, map[string]interface{}{
+		"table":         "t",
+		"start-key":     "74",
+		"end-key":       "75",
+		"error":         true,
+		"error.message": "injected",
+	})
+}
+
+func (s *testTraceSuite) TestOTLPRecorder(c *C) {
+	reqCh := make(chan *otlpRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.Header.Get("Content-Type"), Equals, "application/json")
+		body, err := ioutil.ReadAll(r.Body)
+		c.Check(err, IsNil)
+		req := &otlpRequest{}
+		c.Check(json.Unmarshal(body, req), IsNil)
+		reqCh <- req
+	}))
+	defer server.Close()
+
+	recorder := NewOTLPRecorder(server.URL, "br")
+	traceTask(recorder)
+	c.Assert(recorder.Close(), IsNil)
+	// the spans recorded after closed are dropped.
+	traceTask(recorder)
+
+	req := <-reqCh
+	c.Assert(req.ResourceSpans, HasLen, 1)
+	resource := req.ResourceSpans[0]
+	c.Assert(resource.Resource.Attributes, HasLen, 1)
+	c.Assert(resource.Resource.Attributes[0].Key, Equals, "service.name")
+	c.Assert(*resource.Resource.Attributes[0].Value.StringValue, Equals, "br")
+	c.Assert(resource.ScopeSpans, HasLen, 1)
+	spans := resource.ScopeSpans[0].Spans
+	c.Assert(spans, HasLen, 2)
+
+	child, root := spans[0], spans[1]
+	c.Assert(child.Name, Equals, "child")
+	c.Assert(root.Name, Equals, "root")
+	c.Assert(child.TraceID, HasLen, 32)
+	c.Assert(child.TraceID, Equals, root.TraceID)
+	c.Assert(child.SpanID, HasLen, 16)
+	c.Assert(child.ParentSpanID, Equals, root.SpanID)
+	c.Assert(root.ParentSpanID, Equals, "")
+	c.Assert(root.Status, IsNil)
+	c.Assert(child.Status, DeepEquals, &otlpStatus{Code: otlpStatusCodeError, Message: "injected"})
+	attrs := make(map[string]string, len(child.Attributes))
+	for _, kv := range child.Attributes {
+		if kv.Value.StringValue != nil {
+			attrs[kv.Key] = *kv.Value.StringValue
+		}
+	}
+	c.Assert(attrs, DeepEquals, map[string]string{
+		"table":         "t",
+		"start-key":     "74",
+		"end-key":       "75",
+		"error.message": "injected",
+	})
+	select {
+	case <-reqCh:
+		c.Fatal("the spans are exported after closed")
+	default:
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+)
+
+// The HTTP API of the status server to control the running task.
+//
+//	GET  /task/control  returns the controls of the running task.
+//	POST /task/control  changes the controls, the body is a JSON object like
+//	                    {"rate-limit": 104857600, "concurrency": 8}.
+//	POST /task/pause    pauses the running task.
+//	POST /task/resume   resumes the paused task.
+//
+// All of them respond the controls after the request, like
+// {"paused": false, "controls": {"concurrency": 8, "rate-limit": 104857600}}.
+const (
+	taskControlPath = "/task/control"
+	taskPausePath   = "/task/pause"
+	taskResumePath  = "/task/resume"
+)
+
+// TaskControl is a value of the running task which can be read and changed
+// while the task is running.
+type TaskControl struct {
+	Get func() uint64
+	// Set changes the value, it returns an error if the value is invalid.
+	Set func(uint64) error
+}
+
+// Pauser is a part of the running task which can be paused.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+var taskControls = struct {
+	sync.Mutex
+	controls map[string]TaskControl
+	pausers  map[Pauser]struct{}
+	paused   bool
+}{
+	controls: make(map[string]TaskControl),
+	pausers:  make(map[Pauser]struct{}),
+}
+
+func init() {
+	http.HandleFunc(taskControlPath, handleTaskControl)
+	http.HandleFunc(taskPausePath, handleTaskPause(true))
+	http.HandleFunc(taskResumePath, handleTaskPause(false))
+}
+
+// RegisterTaskControl registers a control of the running task, it returns a
+// function to unregister the control.
+func RegisterTaskControl(name string, control TaskControl) (unregister func()) {
+	taskControls.Lock()
+	defer taskControls.Unlock()
+	taskControls.controls[name] = control
+	return func() {
+		taskControls.Lock()
+		defer taskControls.Unlock()
+		delete(taskControls.controls, name)
+	}
+}
+
+// RegisterTaskPauser registers a pauser of the running task, it returns a
+// function to unregister the pauser. The pauser is paused at once if the
+// task has been paused.
+func RegisterTaskPauser(pauser Pauser) (unregister func()) {
+	taskControls.Lock()
+	defer taskControls.Unlock()
+	taskControls.pausers[pauser] = struct{}{}
+	if taskControls.paused {
+		pauser.Pause()
+	}
+	return func() {
+		taskControls.Lock()
+		defer taskControls.Unlock()
+		delete(taskControls.pausers, pauser)
+	}
+}
+
+// PauseTask pauses all parts of the running task.
+func PauseTask() {
+	taskControls.Lock()
+	defer taskControls.Unlock()
+	taskControls.paused = true
+	for pauser := range taskControls.pausers {
+		pauser.Pause()
+	}
+	log.Info("task paused")
+}
+
+// ResumeTask resumes all parts of the running task.
+func ResumeTask() {
+	taskControls.Lock()
+	defer taskControls.Unlock()
+	taskControls.paused = false
+	for pauser := range taskControls.pausers {
+		pauser.Resume()
+	}
+	log.Info("task resumed")
+}
+
+// SetTaskControls changes the controls of the running task. The unknown
+// controls are rejected before any of them is changed, but if one fails to
+// change, the controls changed before it are not reverted.
+func SetTaskControls(values map[string]uint64) error {
+	taskControls.Lock()
+	defer taskControls.Unlock()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		if _, ok := taskControls.controls[name]; !ok {
+			return errors.Annotatef(berrors.ErrInvalidArgument, "unknown task control %s", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := taskControls.controls[name].Set(values[name]); err != nil {
+			return errors.Annotatef(err, "failed to set task control %s", name)
+		}
+		log.Info("task control changed", zap.String("name", name), zap.Uint64("value", values[name]))
+	}
+	return nil
+}
+
+// TaskControlStatus is the status of the controls of the running task.
+type TaskControlStatus struct {
+	Paused   bool              `json:"paused"`
+	Controls map[string]uint64 `json:"controls"`
+}
+
+// GetTaskControls returns the status of the controls of the running task.
+func GetTaskControls() TaskControlStatus {
+	taskControls.Lock()
+	defer taskControls.Unlock()
+	status := TaskControlStatus{
+		Paused:   taskControls.paused,
+		Controls: make(map[string]uint64, len(taskControls.controls)),
+	}
+	for name, control := range taskControls.controls {
+		status.Controls[name] = control.Get()
+	}
+	return status
+}
+
+func handleTaskControl(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		values := make(map[string]uint64)
+		if err := json.NewDecoder(r.Body).Decode(&values); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := SetTaskControls(values); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "only GET and POST are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeTaskControls(w)
+}
+
+func handleTaskPause(pause bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if pause {
+			PauseTask()
+		} else {
+			ResumeTask()
+		}
+		writeTaskControls(w)
+	}
+}
+
+func writeTaskControls(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(GetTaskControls()); err != nil {
+		log.Warn("failed to write task controls", zap.Error(err))
+	}
+}
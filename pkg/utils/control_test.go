@@ -0,0 +1,89 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/errors"
+)
+
+type testTaskControlSuite struct{}
+
+var _ = Suite(&testTaskControlSuite{})
+
+func (s *testTaskControlSuite) TestTaskControlAPI(c *C) {
+	rateLimit := uint64(100)
+	pool := NewWorkerPool(4, "test")
+	unregisterRateLimit := RegisterTaskControl("rate-limit", TaskControl{
+		Get: func() uint64 { return rateLimit },
+		Set: func(v uint64) error {
+			rateLimit = v
+			return nil
+		},
+	})
+	defer unregisterRateLimit()
+	unregisterConcurrency := RegisterTaskControl("concurrency", TaskControl{
+		Get: func() uint64 { return uint64(pool.Limit()) },
+		Set: func(v uint64) error {
+			if v == 0 {
+				return errors.New("the value must be positive")
+			}
+			pool.SetLimit(uint(v))
+			return nil
+		},
+	})
+	unregisterPool := RegisterTaskPauser(pool)
+
+	request := func(method, path, body string) (int, TaskControlStatus) {
+		w := httptest.NewRecorder()
+		http.DefaultServeMux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		var status TaskControlStatus
+		if w.Code == http.StatusOK {
+			c.Assert(json.Unmarshal(w.Body.Bytes(), &status), IsNil)
+		}
+		return w.Code, status
+	}
+
+	code, status := request(http.MethodGet, "/task/control", "")
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(status, DeepEquals, TaskControlStatus{
+		Controls: map[string]uint64{"rate-limit": 100, "concurrency": 4},
+	})
+
+	code, status = request(http.MethodPost, "/task/control", `{"rate-limit": 200, "concurrency": 8}`)
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(status.Controls, DeepEquals, map[string]uint64{"rate-limit": 200, "concurrency": 8})
+	c.Assert(pool.Limit(), Equals, uint(8))
+
+	code, _ = request(http.MethodPost, "/task/control", `{"rate-limit": 300, "unknown": 1}`)
+	c.Assert(code, Equals, http.StatusBadRequest)
+	c.Assert(rateLimit, Equals, uint64(200))
+	code, _ = request(http.MethodPost, "/task/control", `{"concurrency": 0}`)
+	c.Assert(code, Equals, http.StatusBadRequest)
+	code, _ = request(http.MethodPost, "/task/control", `{"concurrency": -1}`)
+	c.Assert(code, Equals, http.StatusBadRequest)
+	code, _ = request(http.MethodDelete, "/task/control", "")
+	c.Assert(code, Equals, http.StatusMethodNotAllowed)
+
+	code, status = request(http.MethodPost, "/task/pause", "")
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(status.Paused, IsTrue)
+	c.Assert(pool.HasWorker(), IsFalse)
+	code, status = request(http.MethodPost, "/task/resume", "")
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(status.Paused, IsFalse)
+	c.Assert(pool.HasWorker(), IsTrue)
+
+	unregisterConcurrency()
+	unregisterPool()
+	_, status = request(http.MethodGet, "/task/control", "")
+	c.Assert(status.Controls, DeepEquals, map[string]uint64{"rate-limit": 200})
+	request(http.MethodPost, "/task/pause", "")
+	c.Assert(pool.HasWorker(), IsTrue)
+	request(http.MethodPost, "/task/resume", "")
+}
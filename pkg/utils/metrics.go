@@ -0,0 +1,66 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pingcap/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"go.uber.org/zap"
+)
+
+// metricsPath is the path of the status server to expose the metrics.
+const metricsPath = "/metrics"
+
+func init() {
+	http.Handle(metricsPath, promhttp.Handler())
+}
+
+// StartMetricsPusher forks a goroutine pushing the metrics to the push
+// gateway periodically, since the short-lived tasks may exit before they are
+// scraped. The returned function stops the goroutine and pushes the metrics
+// for the last time.
+func StartMetricsPusher(addr, job string, interval time.Duration) (stop func()) {
+	pusher := push.New(addr, job).Gatherer(prometheus.DefaultGatherer)
+	if hostname, err := os.Hostname(); err == nil {
+		pusher = pusher.Grouping("instance", hostname)
+	}
+	doPush := func() {
+		if err := pusher.Push(); err != nil {
+			log.Warn("failed to push metrics", zap.String("addr", addr), zap.Error(err))
+		}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				doPush()
+			}
+		}
+	}()
+	log.Info("start pushing metrics", zap.String("addr", addr), zap.Duration("interval", interval))
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			doPush()
+		})
+	}
+}
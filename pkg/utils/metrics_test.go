@@ -0,0 +1,48 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type testMetricsSuite struct{}
+
+var _ = Suite(&testMetricsSuite{})
+
+func (s *testMetricsSuite) TestMetricsHandler(c *C) {
+	rec := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, metricsPath, nil))
+	c.Assert(rec.Code, Equals, http.StatusOK)
+	c.Assert(rec.Body.String(), Matches, "(?s).*go_goroutines.*")
+}
+
+func (s *testMetricsSuite) TestMetricsPusher(c *C) {
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		c.Check(r.Method, Equals, http.MethodPut)
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	stop := StartMetricsPusher(server.URL, "br", time.Hour)
+	// the metrics are pushed once on stop even if the interval doesn't pass.
+	stop()
+	stop()
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(paths, HasLen, 1)
+	c.Assert(strings.HasPrefix(paths[0], "/metrics/job/br"), IsTrue)
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -141,6 +142,122 @@ func (ww *wrappedWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// ProgressEvent is a progress event in the JSON progress format. The
+// durations are in seconds and the rate is the progress per second.
+type ProgressEvent struct {
+	Step    string    `json:"step"`
+	Current int64     `json:"current"`
+	Total   int64     `json:"total"`
+	Percent float64   `json:"percent"`
+	Rate    float64   `json:"rate"`
+	Elapsed float64   `json:"elapsed"`
+	ETA     float64   `json:"eta"`
+	Done    bool      `json:"done"`
+	Time    time.Time `json:"time"`
+}
+
+var progressJSON = struct {
+	sync.Mutex
+	w io.Writer
+}{}
+
+// SetProgressJSONWriter makes the progress printers write the progress
+// events to w in newline-delimited JSON instead of printing progress bars.
+// The progress bars are restored if w is nil.
+func SetProgressJSONWriter(w io.Writer) {
+	progressJSON.Lock()
+	defer progressJSON.Unlock()
+	progressJSON.w = w
+}
+
+func progressJSONWriter() io.Writer {
+	progressJSON.Lock()
+	defer progressJSON.Unlock()
+	return progressJSON.w
+}
+
+func writeProgressEvent(w io.Writer, event *ProgressEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Warn("failed to marshal progress event", zap.Error(err))
+		return
+	}
+	// the events of the concurrent steps are not interleaved.
+	progressJSON.Lock()
+	defer progressJSON.Unlock()
+	if _, err = w.Write(append(data, '\n')); err != nil {
+		log.Warn("failed to write progress event", zap.Error(err))
+	}
+}
+
+// newProgressEvent builds the progress event at now.
+func (pp *ProgressPrinter) newProgressEvent(start, now time.Time, current int64, done bool) *ProgressEvent {
+	if current > pp.total {
+		current = pp.total
+	}
+	event := &ProgressEvent{
+		Step:    pp.name,
+		Current: current,
+		Total:   pp.total,
+		Elapsed: now.Sub(start).Seconds(),
+		Done:    done,
+		Time:    now,
+	}
+	if pp.total > 0 {
+		event.Percent = float64(current) * 100 / float64(pp.total)
+	}
+	if event.Elapsed > 0 {
+		event.Rate = float64(current) / event.Elapsed
+	}
+	if event.Rate > 0 {
+		event.ETA = float64(pp.total-current) / event.Rate
+	}
+	return event
+}
+
+// goPrintJSONProgress starts a goroutine and writes the progress events to w
+// every second if the progress changes.
+func (pp *ProgressPrinter) goPrintJSONProgress(ctx context.Context, w io.Writer) {
+	cctx, cancel := context.WithCancel(ctx)
+	finished := make(chan struct{})
+	// wait the last event written, so it isn't lost if BR exits after Close.
+	pp.cancel = func() {
+		cancel()
+		<-finished
+	}
+	start := time.Now()
+	writeProgressEvent(w, pp.newProgressEvent(start, start, 0, false))
+
+	go func() {
+		defer close(finished)
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+
+		last := int64(0)
+		for {
+			select {
+			case <-cctx.Done():
+				// like the progress bar, the progress is left unchanged if
+				// canceled by the outer context, and is pushed to 100% if
+				// canceled by Close.
+				current := atomic.LoadInt64(&pp.progress)
+				if ctx.Err() == nil {
+					current = pp.total
+				}
+				writeProgressEvent(w, pp.newProgressEvent(start, time.Now(), current, ctx.Err() == nil))
+				return
+			case <-t.C:
+			}
+
+			current := atomic.LoadInt64(&pp.progress)
+			if current != last {
+				last = current
+				writeProgressEvent(w, pp.newProgressEvent(start, time.Now(), current, false))
+			}
+		}
+	}()
+}
+
 // StartProgress starts progress bar.
 func StartProgress(
 	ctx context.Context,
@@ -150,6 +267,10 @@ func StartProgress(
 	log logFunc,
 ) *ProgressPrinter {
 	progress := NewProgressPrinter(name, total, redirectLog)
+	if w := progressJSONWriter(); w != nil {
+		progress.goPrintJSONProgress(ctx, w)
+		return progress
+	}
 	progress.goPrintProgress(ctx, log, nil)
 	return progress
 }
@@ -4,6 +4,7 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	. "github.com/pingcap/check"
@@ -75,3 +76,36 @@ func (r *testProgressSuite) TestProgress(c *C) {
 	p = <-pCh8
 	c.Assert(p, Matches, `.*"P":"25\.00%".*`)
 }
+
+func (r *testProgressSuite) TestJSONProgress(c *C) {
+	var lines []string
+	SetProgressJSONWriter(&testWriter{
+		fn: func(p string) { lines = append(lines, p) },
+	})
+	defer SetProgressJSONWriter(nil)
+
+	progress := StartProgress(context.Background(), "test", 4, false, nil)
+	progress.Inc()
+	progress.Inc()
+	time.Sleep(1500 * time.Millisecond)
+	progress.Close()
+
+	events := make([]*ProgressEvent, 0, len(lines))
+	for _, line := range lines {
+		c.Assert(line, Matches, `\{.*\}\n`)
+		event := &ProgressEvent{}
+		c.Assert(json.Unmarshal([]byte(line), event), IsNil)
+		c.Assert(event.Step, Equals, "test")
+		c.Assert(event.Total, Equals, int64(4))
+		events = append(events, event)
+	}
+	c.Assert(events, HasLen, 3)
+	c.Assert(events[0].Current, Equals, int64(0))
+	c.Assert(events[1].Current, Equals, int64(2))
+	c.Assert(events[1].Percent, Equals, float64(50))
+	c.Assert(events[1].Rate > 0, IsTrue)
+	c.Assert(events[1].Done, IsFalse)
+	c.Assert(events[2].Current, Equals, int64(4))
+	c.Assert(events[2].Done, IsTrue)
+	c.Assert(events[2].ETA, Equals, float64(0))
+}
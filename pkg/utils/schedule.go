@@ -0,0 +1,232 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+
+	berrors "github.com/Orion7r/pr/pkg/errors"
+)
+
+const (
+	day = 24 * time.Hour
+
+	// schedulePause is the value of the windows in which the task is paused.
+	schedulePause = "pause"
+	// scheduleNormalMode is the suffix of the rate limit of the windows in
+	// which TiKV is kept in normal mode.
+	scheduleNormalMode = "/normal"
+)
+
+// RateLimitWindow is a time window of the day and the throttling in it.
+type RateLimitWindow struct {
+	// Start and End are the offsets from the midnight. If End is not greater
+	// than Start, the window crosses the midnight.
+	Start time.Duration
+	End   time.Duration
+	// RateLimit is the rate limit in bytes per second, zero means unlimited.
+	RateLimit uint64
+	// Pause means the task is paused in the window.
+	Pause bool
+	// NormalMode means TiKV should not be in import mode in the window.
+	NormalMode bool
+}
+
+// contains checks whether the offset from the midnight is in the window.
+func (w RateLimitWindow) contains(offset time.Duration) bool {
+	if w.Start < w.End {
+		return w.Start <= offset && offset < w.End
+	}
+	return w.Start <= offset || offset < w.End
+}
+
+// segments returns the window as non-crossing ranges in [0, 24h).
+func (w RateLimitWindow) segments() [][2]time.Duration {
+	if w.Start < w.End {
+		return [][2]time.Duration{{w.Start, w.End}}
+	}
+	return [][2]time.Duration{{w.Start, day}, {0, w.End}}
+}
+
+// String implements fmt.Stringer.
+func (w RateLimitWindow) String() string {
+	window := fmt.Sprintf("%s-%s", formatDayOffset(w.Start), formatDayOffset(w.End))
+	switch {
+	case w.Pause:
+		return window + "=" + schedulePause
+	case w.NormalMode:
+		return fmt.Sprintf("%s=%dB%s", window, w.RateLimit, scheduleNormalMode)
+	default:
+		return fmt.Sprintf("%s=%dB", window, w.RateLimit)
+	}
+}
+
+// RateLimitSchedule is the throttling of a task in the time windows of every
+// day, in the local time zone.
+type RateLimitSchedule struct {
+	Windows []RateLimitWindow
+}
+
+// ParseRateLimitSchedule parses the schedule like
+// "08:00-20:00=20MB,20:00-08:00=0". Every window is followed by the rate limit
+// per TiKV in it, the number without unit is in MB like --ratelimit, zero
+// means unlimited. The rate limit can have a suffix "/normal" to keep TiKV in
+// normal mode in the window, and "pause" means the task is paused and TiKV is
+// in normal mode in the window. The windows should not overlap.
+func ParseRateLimitSchedule(s string) (*RateLimitSchedule, error) {
+	schedule := &RateLimitSchedule{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		window, err := parseRateLimitWindow(item)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		schedule.Windows = append(schedule.Windows, window)
+	}
+	if len(schedule.Windows) == 0 {
+		return nil, errors.Annotatef(berrors.ErrInvalidArgument, "empty rate limit schedule %q", s)
+	}
+
+	type segment struct {
+		window int
+		start  time.Duration
+		end    time.Duration
+	}
+	var segments []segment
+	for i, w := range schedule.Windows {
+		for _, seg := range w.segments() {
+			segments = append(segments, segment{window: i, start: seg[0], end: seg[1]})
+		}
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i].start < segments[j].start })
+	for i := 1; i < len(segments); i++ {
+		if segments[i].start < segments[i-1].end {
+			return nil, errors.Annotatef(berrors.ErrInvalidArgument,
+				"rate limit windows %s and %s overlap",
+				schedule.Windows[segments[i-1].window], schedule.Windows[segments[i].window])
+		}
+	}
+	return schedule, nil
+}
+
+func parseRateLimitWindow(item string) (RateLimitWindow, error) {
+	var window RateLimitWindow
+	eq := strings.IndexByte(item, '=')
+	if eq < 0 {
+		return window, errors.Annotatef(berrors.ErrInvalidArgument,
+			"rate limit window %q should be like 08:00-20:00=20MB", item)
+	}
+	times := strings.Split(item[:eq], "-")
+	if len(times) != 2 {
+		return window, errors.Annotatef(berrors.ErrInvalidArgument,
+			"rate limit window %q should be like 08:00-20:00=20MB", item)
+	}
+	var err error
+	if window.Start, err = parseDayOffset(times[0]); err != nil {
+		return window, errors.Trace(err)
+	}
+	if window.End, err = parseDayOffset(times[1]); err != nil {
+		return window, errors.Trace(err)
+	}
+	if window.Start == window.End {
+		return window, errors.Annotatef(berrors.ErrInvalidArgument, "empty rate limit window %q", item)
+	}
+
+	value := strings.ToLower(strings.TrimSpace(item[eq+1:]))
+	if value == schedulePause {
+		window.Pause = true
+		window.NormalMode = true
+		return window, nil
+	}
+	if strings.HasSuffix(value, scheduleNormalMode) {
+		window.NormalMode = true
+		value = strings.TrimSuffix(value, scheduleNormalMode)
+	}
+	window.RateLimit, err = ParseByteSize(value, MB)
+	if err != nil {
+		return window, errors.Annotatef(err, "invalid rate limit window %q", item)
+	}
+	return window, nil
+}
+
+// parseDayOffset parses the time like "08:00" to the offset from the midnight.
+func parseDayOffset(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, errors.Annotatef(berrors.ErrInvalidArgument, "invalid time %q, it should be like 08:00", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatDayOffset(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset/time.Hour), int(offset%time.Hour/time.Minute))
+}
+
+// At returns the window which the time is in, and the time when the next
+// window starts or the current window ends. The returned bool is false if the
+// time is not in any window.
+func (s *RateLimitSchedule) At(t time.Time) (RateLimitWindow, bool, time.Time) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	var (
+		window RateLimitWindow
+		found  bool
+	)
+	next := day
+	for _, w := range s.Windows {
+		if !found && w.contains(offset) {
+			window, found = w, true
+		}
+		for _, boundary := range []time.Duration{w.Start, w.End} {
+			d := (boundary - offset + day) % day
+			if d == 0 {
+				d = day
+			}
+			if d < next {
+				next = d
+			}
+		}
+	}
+	return window, found, t.Add(next)
+}
+
+// ParseByteSize parses the size like "20MB", "512KiB" or "1.5G". The units are
+// binary, and the number without unit is in defaultUnit.
+func ParseByteSize(s string, defaultUnit uint64) (uint64, error) {
+	size := strings.ToUpper(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		unit   uint64
+	}{
+		{"TIB", TB}, {"GIB", GB}, {"MIB", MB}, {"KIB", KB},
+		{"TB", TB}, {"GB", GB}, {"MB", MB}, {"KB", KB},
+		{"T", TB}, {"G", GB}, {"M", MB}, {"K", KB}, {"B", B},
+	}
+	unit := defaultUnit
+	for _, u := range units {
+		if strings.HasSuffix(size, u.suffix) {
+			size, unit = strings.TrimSpace(strings.TrimSuffix(size, u.suffix)), u.unit
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(size, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, errors.Annotatef(berrors.ErrInvalidArgument, "invalid size %q", s)
+	}
+	bytes := n * float64(unit)
+	if bytes >= math.MaxUint64 {
+		return 0, errors.Annotatef(berrors.ErrInvalidArgument, "size %q is too large", s)
+	}
+	return uint64(bytes), nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+)
+
+type testScheduleSuite struct{}
+
+var _ = Suite(&testScheduleSuite{})
+
+func (s *testScheduleSuite) TestParseByteSize(c *C) {
+	cases := []struct {
+		s    string
+		size uint64
+	}{
+		{"0", 0},
+		{"20", 20 * MB},
+		{"20MB", 20 * MB},
+		{"20mib", 20 * MB},
+		{"512K", 512 * KB},
+		{"1.5GB", 1536 * MB},
+		{"100B", 100},
+	}
+	for _, ca := range cases {
+		size, err := ParseByteSize(ca.s, MB)
+		c.Assert(err, IsNil, Commentf("size %s", ca.s))
+		c.Assert(size, Equals, ca.size, Commentf("size %s", ca.s))
+	}
+	for _, invalid := range []string{"", "MB", "-1MB", "20XB", "1e30TB"} {
+		_, err := ParseByteSize(invalid, MB)
+		c.Assert(err, ErrorMatches, ".*invalid argument.*", Commentf("size %s", invalid))
+	}
+}
+
+func (s *testScheduleSuite) TestParseRateLimitSchedule(c *C) {
+	schedule, err := ParseRateLimitSchedule("08:00-20:00=20MB, 20:00-01:30=pause,01:30-08:00=0/normal")
+	c.Assert(err, IsNil)
+	c.Assert(schedule.Windows, DeepEquals, []RateLimitWindow{
+		{Start: 8 * time.Hour, End: 20 * time.Hour, RateLimit: 20 * MB},
+		{Start: 20 * time.Hour, End: 90 * time.Minute, Pause: true, NormalMode: true},
+		{Start: 90 * time.Minute, End: 8 * time.Hour, NormalMode: true},
+	})
+
+	for _, invalid := range []string{
+		"",
+		"08:00-20:00",
+		"08:00=20MB",
+		"8-20=20MB",
+		"08:00-08:00=20MB",
+		"08:00-20:00=fast",
+		"08:00-20:00=20MB,19:00-21:00=0",
+		"22:00-02:00=20MB,01:00-03:00=0",
+	} {
+		_, err = ParseRateLimitSchedule(invalid)
+		c.Assert(err, ErrorMatches, ".*invalid argument.*", Commentf("schedule %s", invalid))
+	}
+}
+
+func (s *testScheduleSuite) TestRateLimitScheduleAt(c *C) {
+	schedule, err := ParseRateLimitSchedule("08:00-20:00=20MB,22:00-02:00=pause")
+	c.Assert(err, IsNil)
+	at := func(hour, min int) time.Time {
+		return time.Date(2021, 3, 1, hour, min, 0, 0, time.Local)
+	}
+
+	window, ok, next := schedule.At(at(9, 30))
+	c.Assert(ok, IsTrue)
+	c.Assert(window.RateLimit, Equals, 20*MB)
+	c.Assert(next, Equals, at(20, 0))
+
+	_, ok, next = schedule.At(at(20, 0))
+	c.Assert(ok, IsFalse)
+	c.Assert(next, Equals, at(22, 0))
+
+	window, ok, next = schedule.At(at(23, 0))
+	c.Assert(ok, IsTrue)
+	c.Assert(window.Pause, IsTrue)
+	c.Assert(next.Equal(at(26, 0)), IsTrue)
+
+	window, ok, next = schedule.At(at(1, 0))
+	c.Assert(ok, IsTrue)
+	c.Assert(window.Pause, IsTrue)
+	c.Assert(next, Equals, at(2, 0))
+
+	_, ok, next = schedule.At(at(3, 0))
+	c.Assert(ok, IsFalse)
+	c.Assert(next, Equals, at(8, 0))
+}
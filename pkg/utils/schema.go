@@ -23,6 +23,12 @@ const (
 	MetaJSONFile = "backupmeta.json"
 	// SavedMetaFile represents saved meta file name for recovering later
 	SavedMetaFile = "backupmeta.bak"
+	// CheckpointFile represents the file name of the backup progress, used for resuming the backup
+	CheckpointFile = "backup.checkpoint"
+	// PlacementRulesFile represents the file name of the custom placement rules of the tables
+	PlacementRulesFile = "placement_rules.json"
+	// TableManifestFile represents the file name of the manifest of the files of a table in the table layout
+	TableManifestFile = "manifest.json"
 )
 
 // Table wraps the schema and files of a table.
@@ -34,7 +40,42 @@ type Table struct {
 	TotalBytes      uint64
 	Files           []*backup.File
 	TiFlashReplicas int
-	Stats           *handle.JSONTable
+	// Stats is the statistics inlined in the schema by the old version of BR,
+	// it is nil if the statistics is saved in StatsFile or not backed up.
+	Stats *handle.JSONTable
+	// StatsFile is the file of the statistics in the backup storage.
+	StatsFile string
+}
+
+// HasStats checks whether the statistics of the table is backed up.
+func (tbl *Table) HasStats() bool {
+	return tbl.Stats != nil || tbl.StatsFile != ""
+}
+
+// StatsFile is saved in the stats field of the schema instead of the
+// statistics, if the statistics is saved in a separate file.
+type StatsFile struct {
+	Name string `json:"stats-file"`
+}
+
+// ParseStats parses the stats field of the schema, it returns either the
+// inlined statistics or the name of the statistics file.
+func ParseStats(data []byte) (*handle.JSONTable, string, error) {
+	if len(data) == 0 {
+		return nil, "", nil
+	}
+	file := &StatsFile{}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	if file.Name != "" {
+		return nil, file.Name, nil
+	}
+	stats := &handle.JSONTable{}
+	if err := json.Unmarshal(data, stats); err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	return stats, "", nil
 }
 
 // NoChecksum checks whether the table has a calculated checksum.
@@ -91,13 +132,9 @@ func LoadBackupTables(meta *backup.BackupMeta) (map[string]*Database, error) {
 			return nil, errors.Trace(err)
 		}
 		// stats maybe nil from old backup file.
-		stats := &handle.JSONTable{}
-		if schema.Stats != nil {
-			// Parse the stats table.
-			err = json.Unmarshal(schema.Stats, stats)
-			if err != nil {
-				return nil, errors.Trace(err)
-			}
+		stats, statsFile, err := ParseStats(schema.Stats)
+		if err != nil {
+			return nil, errors.Trace(err)
 		}
 		partitions := make(map[int64]bool)
 		if tableInfo.Partition != nil {
@@ -128,6 +165,7 @@ func LoadBackupTables(meta *backup.BackupMeta) (map[string]*Database, error) {
 			Files:           tableFiles,
 			TiFlashReplicas: int(schema.TiflashReplicas),
 			Stats:           stats,
+			StatsFile:       statsFile,
 		}
 		db.Tables = append(db.Tables, table)
 	}
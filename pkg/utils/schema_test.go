@@ -79,3 +79,26 @@ func (r *testSchemaSuite) TestLoadBackupMeta(c *C) {
 	c.Assert(tbl.Files, HasLen, 1)
 	c.Assert(tbl.Files[0].Name, Equals, "1.sst")
 }
+
+func (r *testSchemaSuite) TestParseStats(c *C) {
+	stats, file, err := ParseStats(nil)
+	c.Assert(err, IsNil)
+	c.Assert(stats, IsNil)
+	c.Assert(file, Equals, "")
+
+	data, err := json.Marshal(&handle.JSONTable{DatabaseName: "test", TableName: "t1"})
+	c.Assert(err, IsNil)
+	stats, file, err = ParseStats(data)
+	c.Assert(err, IsNil)
+	c.Assert(stats.TableName, Equals, "t1")
+	c.Assert(file, Equals, "")
+
+	data, err = json.Marshal(&StatsFile{Name: "stats_1.json.gz"})
+	c.Assert(err, IsNil)
+	stats, file, err = ParseStats(data)
+	c.Assert(err, IsNil)
+	c.Assert(stats, IsNil)
+	c.Assert(file, Equals, "stats_1.json.gz")
+	c.Assert((&Table{StatsFile: file}).HasStats(), IsTrue)
+	c.Assert((&Table{}).HasStats(), IsFalse)
+}
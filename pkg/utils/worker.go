@@ -3,15 +3,26 @@
 package utils
 
 import (
+	"context"
+	"sync"
+
+	"github.com/pingcap/errors"
 	"github.com/pingcap/log"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
-// WorkerPool contains a pool of workers.
+// WorkerPool contains a pool of workers. The limit of the workers can be
+// changed while the pool is used, and the pool can be paused.
 type WorkerPool struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// idle is the workers created but not allocated.
+	idle    []*Worker
+	created uint
+	busy    uint
 	limit   uint
-	workers chan *Worker
+	paused  bool
 	name    string
 }
 
@@ -26,20 +37,17 @@ type identifiedTaskFunc func(uint64)
 
 // NewWorkerPool returns a WorkPool.
 func NewWorkerPool(limit uint, name string) *WorkerPool {
-	workers := make(chan *Worker, limit)
-	for i := uint(0); i < limit; i++ {
-		workers <- &Worker{ID: uint64(i + 1)}
-	}
-	return &WorkerPool{
-		limit:   limit,
-		workers: workers,
-		name:    name,
+	pool := &WorkerPool{
+		limit: limit,
+		name:  name,
 	}
+	pool.cond = sync.NewCond(&pool.mu)
+	return pool
 }
 
 // Apply executes a task.
 func (pool *WorkerPool) Apply(fn taskFunc) {
-	worker := pool.apply()
+	worker := pool.mustApply()
 	go func() {
 		defer pool.recycle(worker)
 		fn()
@@ -48,7 +56,7 @@ func (pool *WorkerPool) Apply(fn taskFunc) {
 
 // ApplyWithID execute a task and provides it with the worker ID.
 func (pool *WorkerPool) ApplyWithID(fn identifiedTaskFunc) {
-	worker := pool.apply()
+	worker := pool.mustApply()
 	go func() {
 		defer pool.recycle(worker)
 		fn(worker.ID)
@@ -57,7 +65,7 @@ func (pool *WorkerPool) ApplyWithID(fn identifiedTaskFunc) {
 
 // ApplyOnErrorGroup executes a task in an errorgroup.
 func (pool *WorkerPool) ApplyOnErrorGroup(eg *errgroup.Group, fn func() error) {
-	worker := pool.apply()
+	worker := pool.mustApply()
 	eg.Go(func() error {
 		defer pool.recycle(worker)
 		return fn()
@@ -66,32 +74,123 @@ func (pool *WorkerPool) ApplyOnErrorGroup(eg *errgroup.Group, fn func() error) {
 
 // ApplyWithIDInErrorGroup executes a task in an errorgroup and provides it with the worker ID.
 func (pool *WorkerPool) ApplyWithIDInErrorGroup(eg *errgroup.Group, fn func(id uint64) error) {
-	worker := pool.apply()
+	worker := pool.mustApply()
 	eg.Go(func() error {
 		defer pool.recycle(worker)
 		return fn(worker.ID)
 	})
 }
 
-func (pool *WorkerPool) apply() *Worker {
-	var worker *Worker
-	select {
-	case worker = <-pool.workers:
-	default:
-		log.Debug("wait for workers", zap.String("pool", pool.name))
-		worker = <-pool.workers
+// ApplyOnErrorGroupContext executes a task in an errorgroup like
+// ApplyOnErrorGroup, but it stops waiting for a worker when ctx is done, e.g.
+// while the pool is paused. The task is not executed then, and the error of
+// ctx is returned.
+func (pool *WorkerPool) ApplyOnErrorGroupContext(ctx context.Context, eg *errgroup.Group, fn func() error) error {
+	worker, err := pool.apply(ctx)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	eg.Go(func() error {
+		defer pool.recycle(worker)
+		return fn()
+	})
+	return nil
+}
+
+// mustApply waits for a worker without a context, it never fails.
+func (pool *WorkerPool) mustApply() *Worker {
+	worker, err := pool.apply(context.Background())
+	if err != nil {
+		panic(err)
 	}
 	return worker
 }
 
+func (pool *WorkerPool) apply(ctx context.Context) (*Worker, error) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.paused || pool.busy >= pool.limit {
+		log.Debug("wait for workers", zap.String("pool", pool.name))
+		// wake up the waiting below when ctx is done.
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				pool.mu.Lock()
+				pool.cond.Broadcast()
+				pool.mu.Unlock()
+			case <-stop:
+			}
+		}()
+	}
+	for pool.paused || pool.busy >= pool.limit {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		pool.cond.Wait()
+	}
+	pool.busy++
+	if n := len(pool.idle); n > 0 {
+		worker := pool.idle[n-1]
+		pool.idle = pool.idle[:n-1]
+		return worker, nil
+	}
+	pool.created++
+	return &Worker{ID: uint64(pool.created)}, nil
+}
+
 func (pool *WorkerPool) recycle(worker *Worker) {
 	if worker == nil {
 		panic("invalid restore worker")
 	}
-	pool.workers <- worker
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.busy--
+	pool.idle = append(pool.idle, worker)
+	pool.cond.Signal()
 }
 
 // HasWorker checks if the pool has unallocated workers.
 func (pool *WorkerPool) HasWorker() bool {
-	return len(pool.workers) > 0
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return !pool.paused && pool.busy < pool.limit
+}
+
+// Limit returns the limit of the workers.
+func (pool *WorkerPool) Limit() uint {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	return pool.limit
+}
+
+// SetLimit changes the limit of the workers. If the limit is decreased, the
+// running tasks are not interrupted, but no new task is started until the
+// number of the running tasks is less than the limit.
+func (pool *WorkerPool) SetLimit(limit uint) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if pool.limit == limit {
+		return
+	}
+	log.Info("set worker pool limit",
+		zap.String("pool", pool.name), zap.Uint("from", pool.limit), zap.Uint("to", limit))
+	pool.limit = limit
+	pool.cond.Broadcast()
+}
+
+// Pause stops starting new tasks, the running tasks are not interrupted.
+func (pool *WorkerPool) Pause() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.paused = true
+}
+
+// Resume resumes starting new tasks.
+func (pool *WorkerPool) Resume() {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	pool.paused = false
+	pool.cond.Broadcast()
 }
@@ -0,0 +1,122 @@
+// Copyright 2021 PingCAP, Inc. Licensed under Apache-2.0.
+
+package utils
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/pingcap/check"
+	"golang.org/x/sync/errgroup"
+)
+
+type testWorkerPoolSuite struct{}
+
+var _ = Suite(&testWorkerPoolSuite{})
+
+func (s *testWorkerPoolSuite) TestSetLimitAndPause(c *C) {
+	pool := NewWorkerPool(2, "test")
+	c.Assert(pool.Limit(), Equals, uint(2))
+	c.Assert(pool.HasWorker(), IsTrue)
+
+	var running, maxRunning int64
+	block := make(chan struct{})
+	task := func() error {
+		n := atomic.AddInt64(&running, 1)
+		for {
+			m := atomic.LoadInt64(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+				break
+			}
+		}
+		<-block
+		atomic.AddInt64(&running, -1)
+		return nil
+	}
+
+	eg := new(errgroup.Group)
+	pool.ApplyOnErrorGroup(eg, task)
+	pool.ApplyOnErrorGroup(eg, task)
+	c.Assert(pool.HasWorker(), IsFalse)
+	pool.SetLimit(3)
+	c.Assert(pool.HasWorker(), IsTrue)
+	pool.ApplyOnErrorGroup(eg, task)
+
+	// the paused pool doesn't start new tasks.
+	pool.Pause()
+	c.Assert(pool.HasWorker(), IsFalse)
+	pool.SetLimit(4)
+	started := make(chan struct{})
+	go func() {
+		pool.ApplyOnErrorGroup(eg, task)
+		close(started)
+	}()
+	select {
+	case <-started:
+		c.Fatal("the task is started while the pool is paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+	pool.Resume()
+	<-started
+
+	for atomic.LoadInt64(&running) < 4 {
+		time.Sleep(time.Millisecond)
+	}
+	close(block)
+	c.Assert(eg.Wait(), IsNil)
+	c.Assert(atomic.LoadInt64(&maxRunning), Equals, int64(4))
+	c.Assert(pool.HasWorker(), IsTrue)
+
+	// the workers are reused.
+	ids := make(map[uint64]struct{})
+	for i := 0; i < 8; i++ {
+		pool.ApplyWithIDInErrorGroup(eg, func(id uint64) error {
+			ids[id] = struct{}{}
+			return nil
+		})
+		c.Assert(eg.Wait(), IsNil)
+	}
+	c.Assert(len(ids) <= 4, IsTrue)
+}
+
+func (s *testWorkerPoolSuite) TestCancelWhilePaused(c *C) {
+	pool := NewWorkerPool(2, "test")
+	pool.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	eg := new(errgroup.Group)
+	var executed int64
+	applied := make(chan error, 1)
+	go func() {
+		applied <- pool.ApplyOnErrorGroupContext(ctx, eg, func() error {
+			atomic.AddInt64(&executed, 1)
+			return nil
+		})
+	}()
+	select {
+	case err := <-applied:
+		c.Fatalf("the task is applied while the pool is paused: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	select {
+	case err := <-applied:
+		c.Assert(err, ErrorMatches, ".*context canceled.*")
+	case <-time.After(5 * time.Second):
+		c.Fatal("the task is still waiting for the worker after the context is canceled")
+	}
+	c.Assert(eg.Wait(), IsNil)
+	c.Assert(atomic.LoadInt64(&executed), Equals, int64(0))
+
+	// the canceled context fails fast, and no worker is leaked.
+	c.Assert(pool.ApplyOnErrorGroupContext(ctx, eg, func() error { return nil }), NotNil)
+	pool.Resume()
+	c.Assert(pool.ApplyOnErrorGroupContext(context.Background(), eg, func() error {
+		atomic.AddInt64(&executed, 1)
+		return nil
+	}), IsNil)
+	c.Assert(eg.Wait(), IsNil)
+	c.Assert(atomic.LoadInt64(&executed), Equals, int64(1))
+	c.Assert(pool.HasWorker(), IsTrue)
+}